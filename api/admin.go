@@ -0,0 +1,425 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"net/http"
+	"time"
+)
+
+// 各类内容在管理后台列表中展示的标题列
+var adminContentTitleColumns = map[string]string{
+	ReportTargetNote:             "title",
+	ReportTargetNoteReview:       "title",
+	ReportTargetDiscussion:       "title",
+	ReportTargetDiscussionReview: "title",
+	ReportTargetProblem:          "description",
+	ReportTargetProblemSet:       "name",
+}
+
+type AdminUserFilter struct {
+	Keyword *string `json:"keyword" form:"keyword"`
+	Role    *int    `json:"role" form:"role"`
+	Offset  *int    `json:"offset" form:"offset"`
+	Limit   *int    `json:"limit" form:"limit"`
+}
+
+type AdminUserResponse struct {
+	ID         int            `json:"id"`
+	Name       string         `json:"name"`
+	NickName   string         `json:"nick_name"`
+	Email      string         `json:"email"`
+	Phone      *string        `json:"phone"`
+	AvatarPath string         `json:"avatar_path"`
+	CreatedAt  time.Time      `json:"created_at"`
+	Role       int            `json:"role"`
+	Ban        *model.UserBan `json:"ban"`
+}
+
+type AllAdminUserResponse struct {
+	TotalCount int                 `json:"total_count"`
+	Users      []AdminUserResponse `json:"users"`
+}
+
+type AdminUserContentFilter struct {
+	TargetType string `json:"target_type" form:"target_type" binding:"required"`
+	Offset     *int   `json:"offset" form:"offset"`
+	Limit      *int   `json:"limit" form:"limit"`
+}
+
+type UserContentResponse struct {
+	ID        int       `json:"id" db:"id"`
+	Title     string    `json:"title" db:"title"`
+	IsHidden  bool      `json:"is_hidden" db:"is_hidden"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
+
+type AllUserContentResponse struct {
+	TotalCount int                   `json:"total_count"`
+	Items      []UserContentResponse `json:"items"`
+}
+
+type AdminRoleRequest struct {
+	IsAdmin bool `json:"is_admin"`
+}
+
+type AdminBanRequest struct {
+	Reason string `json:"reason" binding:"required"`
+	Days   int    `json:"days"`
+}
+
+// EnsureAdminUsers 把配置中的用户设为管理员，用于在没有管理员时初始化管理后台
+func EnsureAdminUsers(names []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	sqlString := `UPDATE "user" SET role = $1 WHERE name = ANY($2)`
+	_, err := global.Database.Exec(sqlString, global.ADMIN, pq.Array(names))
+	return err
+}
+
+// getManagedUser 返回管理员要操作的用户，用户不存在时写入 404 响应
+func getManagedUser(c *gin.Context) (*model.User, bool) {
+	var user model.User
+	sqlString := `SELECT id, name, role FROM "user" WHERE id = $1`
+	if err := global.Database.Get(&user, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "用户不存在")
+		return nil, false
+	}
+	return &user, true
+}
+
+// SearchUsers godoc
+// @Schemes http
+// @Description 管理员按用户名、昵称或邮箱搜索用户，返回用户的角色和当前生效的封禁
+// @Tags Admin
+// @Param filter query AdminUserFilter false "筛选条件, role: 1 普通用户/2 管理员"
+// @Success 200 {object} AllAdminUserResponse "用户列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/user/search [get]
+// @Security ApiKeyAuth
+func SearchUsers(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var filter AdminUserFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	keyword := ""
+	if filter.Keyword != nil {
+		keyword = *filter.Keyword
+	}
+	role := 0
+	if filter.Role != nil {
+		role = *filter.Role
+	}
+	condition := ` WHERE ($1 = '' OR name ILIKE '%' || $1 || '%' OR nick_name ILIKE '%' || $1 || '%'
+		OR email ILIKE '%' || $1 || '%') AND ($2 = 0 OR role = $2)`
+	var totalCount int
+	sqlString := `SELECT count(*) FROM "user"` + condition
+	if err := global.Database.Get(&totalCount, sqlString, keyword, role); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT id, name, nick_name, email, phone, avatar_url, created_at, role FROM "user"` + condition +
+		` ORDER BY id`
+	if filter.Limit != nil {
+		sqlString += fmt.Sprint(" LIMIT ", *filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += fmt.Sprint(" OFFSET ", *filter.Offset)
+	}
+	var users []model.User
+	if err := global.Database.Select(&users, sqlString, keyword, role); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]AdminUserResponse, 0, len(users))
+	for _, user := range users {
+		ban, err := getActiveBan(user.ID)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		responses = append(responses, AdminUserResponse{
+			ID:         user.ID,
+			Name:       user.Name,
+			NickName:   user.NickName,
+			Email:      user.Email,
+			Phone:      user.Phone,
+			AvatarPath: user.AvatarURL,
+			CreatedAt:  user.CreatedAt,
+			Role:       user.Role,
+			Ban:        ban,
+		})
+	}
+	c.JSON(http.StatusOK, AllAdminUserResponse{
+		TotalCount: totalCount,
+		Users:      responses,
+	})
+}
+
+// GetUserContent godoc
+// @Schemes http
+// @Description 管理员查看用户发布的内容（包括被隐藏和非公开的内容），按发布时间倒序
+// @Tags Admin
+// @Param id path int true "用户ID"
+// @Param filter query AdminUserContentFilter true "筛选条件, target_type: note/note_review/discussion/discussion_review/problem/problem_set"
+// @Success 200 {object} AllUserContentResponse "内容列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "用户不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/user/content/{id} [get]
+// @Security ApiKeyAuth
+func GetUserContent(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var filter AdminUserContentFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	table, ok := reportTargetTables[filter.TargetType]
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	var totalCount int
+	sqlString := `SELECT count(*) FROM ` + table + ` WHERE user_id = $1`
+	if err := global.Database.Get(&totalCount, sqlString, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT id, ` + adminContentTitleColumns[filter.TargetType] + ` AS title, is_hidden, created_at FROM ` +
+		table + ` WHERE user_id = $1 ORDER BY created_at DESC, id DESC`
+	if filter.Limit != nil {
+		sqlString += fmt.Sprint(" LIMIT ", *filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += fmt.Sprint(" OFFSET ", *filter.Offset)
+	}
+	items := make([]UserContentResponse, 0)
+	if err := global.Database.Select(&items, sqlString, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllUserContentResponse{
+		TotalCount: totalCount,
+		Items:      items,
+	})
+}
+
+// SetUserRole godoc
+// @Schemes http
+// @Description 管理员授予或撤销其他用户的管理员权限，修改后用户需要重新登录
+// @Tags Admin
+// @Param id path int true "用户ID"
+// @Param role body AdminRoleRequest true "是否为管理员"
+// @Success 200 {string} string "修改成功"
+// @Failure 400 {string} string "请求解析失败"/"不能修改自己的角色"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "用户不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/user/role/{id} [put]
+// @Security ApiKeyAuth
+func SetUserRole(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var request AdminRoleRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetInt("UserId") {
+		c.String(http.StatusBadRequest, "不能修改自己的角色")
+		return
+	}
+	role := global.USER
+	if request.IsAdmin {
+		role = global.ADMIN
+	}
+	sqlString := `UPDATE "user" SET role = $1 WHERE id = $2`
+	if _, err := global.Database.Exec(sqlString, role, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 会话中保存了登录时的角色，删除会话让新角色在下次登录时生效
+	if global.Role(user.Role) != role {
+		if err := global.DeleteUserSessions(c, user.ID); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionUserRole,
+		TargetType: AuditTargetUser,
+		TargetId:   user.ID,
+		Before:     map[string]int{"role": user.Role},
+		After:      map[string]global.Role{"role": role},
+	})
+	c.String(http.StatusOK, "修改成功")
+}
+
+// BanUser godoc
+// @Schemes http
+// @Description 管理员封禁用户，days 为 0 时永久封禁，否则为暂停使用的天数；封禁后用户的所有会话立即失效，jwt 模式下已签发的访问令牌在过期前仍然有效
+// @Tags Admin
+// @Param id path int true "用户ID"
+// @Param ban body AdminBanRequest true "封禁原因和天数"
+// @Success 200 {object} model.UserBan "封禁记录"
+// @Failure 400 {string} string "请求解析失败"/"不能封禁自己"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "用户不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/user/ban/{id} [post]
+// @Security ApiKeyAuth
+func BanUser(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var request AdminBanRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Days < 0 {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	if user.ID == c.GetInt("UserId") {
+		c.String(http.StatusBadRequest, "不能封禁自己")
+		return
+	}
+	var expiresAt *time.Time
+	if request.Days > 0 {
+		expires := time.Now().Local().AddDate(0, 0, request.Days)
+		expiresAt = &expires
+	}
+	var ban model.UserBan
+	sqlString := `INSERT INTO user_ban (user_id, reason, expires_at, created_by, created_at) VALUES ($1, $2, $3, $4, $5)
+		RETURNING *`
+	if err := global.Database.Get(&ban, sqlString, user.ID, request.Reason, expiresAt, c.GetInt("UserId"),
+		time.Now().Local()); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := global.InvalidateUserBan(c, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := global.DeleteUserSessions(c, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionUserBan,
+		TargetType: AuditTargetUser,
+		TargetId:   user.ID,
+		After:      ban,
+	})
+	CreateNotification(c, user.ID, NotificationModeration, 0, ban.ID, "你的账号已被封禁: "+request.Reason)
+	c.JSON(http.StatusOK, ban)
+}
+
+// UnbanUser godoc
+// @Schemes http
+// @Description 管理员解除用户当前生效的所有封禁
+// @Tags Admin
+// @Param id path int true "用户ID"
+// @Success 200 {string} string "解除成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "用户不存在"/"用户未被封禁"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/user/ban/{id} [delete]
+// @Security ApiKeyAuth
+func UnbanUser(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	ban, err := getActiveBan(user.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	now := time.Now().Local()
+	sqlString := `UPDATE user_ban SET expires_at = $1 WHERE user_id = $2 AND (expires_at IS NULL OR expires_at > $1)`
+	result, err := global.Database.Exec(sqlString, now, user.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		c.String(http.StatusNotFound, "用户未被封禁")
+		return
+	}
+	if err := global.InvalidateUserBan(c, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionUserUnban,
+		TargetType: AuditTargetUser,
+		TargetId:   user.ID,
+		Before:     ban,
+	})
+	c.String(http.StatusOK, "解除成功")
+}
+
+// ForceLogout godoc
+// @Schemes http
+// @Description 管理员强制用户在所有设备上退出登录
+// @Tags Admin
+// @Param id path int true "用户ID"
+// @Success 200 {string} string "操作成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "用户不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/user/logout/{id} [post]
+// @Security ApiKeyAuth
+func ForceLogout(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	user, ok := getManagedUser(c)
+	if !ok {
+		return
+	}
+	if err := global.DeleteUserSessions(c, user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionForceLogout,
+		TargetType: AuditTargetUser,
+		TargetId:   user.ID,
+	})
+	c.String(http.StatusOK, "操作成功")
+}
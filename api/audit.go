@@ -0,0 +1,242 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	AuditActionDelete         = "delete"
+	AuditActionUpdate         = "update"
+	AuditActionMemberJoin     = "member_join"
+	AuditActionMemberRemove   = "member_remove"
+	AuditActionMemberQuit     = "member_quit"
+	AuditActionMemberRole     = "member_role"
+	AuditActionGroupTransfer  = "group_transfer"
+	AuditActionPasswordReset  = "password_reset"
+	AuditActionPasswordChange = "password_change"
+	AuditActionUserRole       = "user_role"
+	AuditActionUserBan        = "user_ban"
+	AuditActionUserUnban      = "user_unban"
+	AuditActionForceLogout    = "force_logout"
+	AuditActionReportHandle   = "report_handle"
+)
+
+// 笔记、讨论、题目等内容沿用举报对象的类型名，小组成员的 target_id 为成员的用户ID
+const (
+	AuditTargetGroup       = "group"
+	AuditTargetGroupMember = "group_member"
+	AuditTargetUser        = "user"
+	AuditTargetReport      = "content_report"
+)
+
+// auditEvent 描述一次需要记录的操作，Before 和 After 是操作前后对象的快照，序列化为 JSON 保存
+type auditEvent struct {
+	Action     string
+	TargetType string
+	TargetId   int
+	// GroupId 为 0 表示操作与小组无关
+	GroupId int
+	// OwnerId 是被操作对象的所有者，管理员操作别人的对象时记为越权操作，为 0 时不判断
+	OwnerId int
+	Before  interface{}
+	After   interface{}
+}
+
+func marshalSnapshot(snapshot interface{}) *string {
+	if snapshot == nil {
+		return nil
+	}
+	raw, err := json.Marshal(snapshot)
+	if err != nil {
+		return nil
+	}
+	result := string(raw)
+	return &result
+}
+
+// isAdminOverride 判断当前操作是否是管理员绕过所有权检查的操作
+func isAdminOverride(c *gin.Context, ownerId int) bool {
+	role, _ := c.Get("Role")
+	return role == global.ADMIN && ownerId != 0 && ownerId != c.GetInt("UserId")
+}
+
+// insertAuditLog 写入审计日志，actorId 为 0 表示系统操作。审计日志写入失败不影响操作本身
+func insertAuditLog(actorId int, ip string, adminOverride bool, event auditEvent) {
+	var groupId *int
+	if event.GroupId != 0 {
+		groupId = &event.GroupId
+	}
+	sqlString := `INSERT INTO audit_log (actor_id, action, target_type, target_id, group_id, is_admin_override, before,
+		after, ip, created_at) VALUES (NULLIF($1, 0), $2, $3, $4, $5, $6, $7, $8, $9, $10)`
+	if _, err := global.Database.Exec(sqlString, actorId, event.Action, event.TargetType, event.TargetId, groupId,
+		adminOverride, marshalSnapshot(event.Before), marshalSnapshot(event.After), ip, time.Now().Local()); err != nil {
+		log.Printf("记录审计日志失败: %v", err)
+	}
+}
+
+// recordAudit 以当前登录用户的身份记录审计日志
+func recordAudit(c *gin.Context, event auditEvent) {
+	insertAuditLog(c.GetInt("UserId"), c.ClientIP(), isAdminOverride(c, event.OwnerId), event)
+}
+
+// recordMemberJoin 记录用户加入小组，快照为加入后的成员记录
+func recordMemberJoin(c *gin.Context, groupId int, userId int) {
+	member, err := getGroupMember(groupId, userId)
+	if err != nil {
+		log.Printf("记录审计日志失败: %v", err)
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionMemberJoin,
+		TargetType: AuditTargetGroupMember,
+		TargetId:   userId,
+		GroupId:    groupId,
+		After:      member,
+	})
+}
+
+type AuditLogFilter struct {
+	ActorId         *int       `json:"actor_id" form:"actor_id"`
+	Action          *string    `json:"action" form:"action"`
+	TargetType      *string    `json:"target_type" form:"target_type"`
+	TargetId        *int       `json:"target_id" form:"target_id"`
+	GroupId         *int       `json:"group_id" form:"group_id"`
+	IsAdminOverride *bool      `json:"is_admin_override" form:"is_admin_override"`
+	StartTime       *time.Time `json:"start_time" form:"start_time"`
+	EndTime         *time.Time `json:"end_time" form:"end_time"`
+	Offset          *int       `json:"offset" form:"offset"`
+	Limit           *int       `json:"limit" form:"limit"`
+}
+
+type AuditLogResponse struct {
+	ID              int              `json:"id"`
+	ActorInfo       UserInfoResponse `json:"actor_info"`
+	Action          string           `json:"action"`
+	TargetType      string           `json:"target_type"`
+	TargetId        int              `json:"target_id"`
+	GroupId         *int             `json:"group_id"`
+	IsAdminOverride bool             `json:"is_admin_override"`
+	Before          json.RawMessage  `json:"before" swaggertype:"object"`
+	After           json.RawMessage  `json:"after" swaggertype:"object"`
+	IP              string           `json:"ip"`
+	CreatedAt       time.Time        `json:"created_at"`
+}
+
+type AllAuditLogResponse struct {
+	TotalCount int                `json:"total_count"`
+	AuditLogs  []AuditLogResponse `json:"audit_logs"`
+}
+
+func rawSnapshot(snapshot *string) json.RawMessage {
+	if snapshot == nil {
+		return json.RawMessage("null")
+	}
+	return json.RawMessage(*snapshot)
+}
+
+// GetAuditLogs godoc
+// @Schemes http
+// @Description 管理员查询审计日志，按时间倒序返回，时间使用 RFC3339 格式
+// @Tags Admin
+// @Param filter query AuditLogFilter false "筛选条件"
+// @Success 200 {object} AllAuditLogResponse "审计日志"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/audit_log/all [get]
+// @Security ApiKeyAuth
+func GetAuditLogs(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var filter AuditLogFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	condition := ` WHERE 1 = 1`
+	var args []interface{}
+	addCondition := func(column string, operator string, value interface{}) {
+		args = append(args, value)
+		condition += fmt.Sprintf(" AND %s %s $%d", column, operator, len(args))
+	}
+	if filter.ActorId != nil {
+		addCondition("actor_id", "=", *filter.ActorId)
+	}
+	if filter.Action != nil {
+		addCondition("action", "=", *filter.Action)
+	}
+	if filter.TargetType != nil {
+		addCondition("target_type", "=", *filter.TargetType)
+	}
+	if filter.TargetId != nil {
+		addCondition("target_id", "=", *filter.TargetId)
+	}
+	if filter.GroupId != nil {
+		addCondition("group_id", "=", *filter.GroupId)
+	}
+	if filter.IsAdminOverride != nil {
+		addCondition("is_admin_override", "=", *filter.IsAdminOverride)
+	}
+	if filter.StartTime != nil {
+		addCondition("created_at", ">=", filter.StartTime.Local())
+	}
+	if filter.EndTime != nil {
+		addCondition("created_at", "<", filter.EndTime.Local())
+	}
+	var totalCount int
+	sqlString := `SELECT count(*) FROM audit_log` + condition
+	if err := global.Database.Get(&totalCount, sqlString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT * FROM audit_log` + condition + ` ORDER BY created_at DESC, id DESC`
+	if filter.Limit != nil {
+		sqlString += fmt.Sprint(" LIMIT ", *filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += fmt.Sprint(" OFFSET ", *filter.Offset)
+	}
+	var auditLogs []model.AuditLog
+	if err := global.Database.Select(&auditLogs, sqlString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]AuditLogResponse, 0, len(auditLogs))
+	for _, auditLog := range auditLogs {
+		// 系统操作和已注销用户的操作没有操作人
+		var actorInfo UserInfoResponse
+		if auditLog.ActorId != nil {
+			var err error
+			if actorInfo, err = getBriefUserInfo(*auditLog.ActorId); err != nil {
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
+		}
+		responses = append(responses, AuditLogResponse{
+			ID:              auditLog.ID,
+			ActorInfo:       actorInfo,
+			Action:          auditLog.Action,
+			TargetType:      auditLog.TargetType,
+			TargetId:        auditLog.TargetId,
+			GroupId:         auditLog.GroupId,
+			IsAdminOverride: auditLog.IsAdminOverride,
+			Before:          rawSnapshot(auditLog.Before),
+			After:           rawSnapshot(auditLog.After),
+			IP:              auditLog.IP,
+			CreatedAt:       auditLog.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, AllAuditLogResponse{
+		TotalCount: totalCount,
+		AuditLogs:  responses,
+	})
+}
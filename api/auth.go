@@ -1,11 +1,9 @@
 package api
 
 import (
-	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/go-redis/redis/v8"
-	"github.com/google/uuid"
 	"kayak-backend/global"
 	"kayak-backend/model"
 	"kayak-backend/utils"
@@ -20,10 +18,20 @@ const (
 type LoginInfo struct {
 	UserName string `json:"username"`
 	Password string `json:"password"`
+	// 登录失败次数过多后需要先通过 /captcha 获取验证码
+	CaptchaId     string `json:"captcha_id"`
+	CaptchaAnswer string `json:"captcha_answer"`
+	// Device 是展示在会话列表中的设备名，为空时使用 User-Agent
+	Device string `json:"device"`
+	// RememberMe 为 true 时会话30天不活动才过期，否则为12小时
+	RememberMe bool `json:"remember_me"`
 }
 
 type LoginResponse struct {
 	Token string `json:"token"`
+	// jwt 模式下 Token 是访问令牌，过期后用 RefreshToken 换取新的令牌
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
 }
 
 type RegisterInfo struct {
@@ -51,7 +59,10 @@ type ResetPasswordInfo struct {
 // @Tags Authentication
 // @Param info body LoginInfo true "用户登陆信息"
 // @Success 200 {object} LoginResponse "用户登陆反馈"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"用户名或密码错误"/"验证码错误"
+// @Failure 403 {string} string "账号已被封禁"
+// @Failure 428 {string} string "需要验证码"
+// @Failure 429 {string} string "登录失败次数过多，请稍后再试"
 // @Failure default {string} string "服务器错误"
 // @Router /login [post]
 func Login(c *gin.Context) {
@@ -64,28 +75,72 @@ func Login(c *gin.Context) {
 		c.String(http.StatusBadRequest, "用户名或密码错误")
 		return
 	}
+	// 用户不存在时 userInfo.ID 为0，同样计入失败次数，但不记录登录历史
 	userInfo := model.User{}
-	sqlString := `SELECT id, password FROM "user" WHERE name = $1`
-	if err := global.Database.Get(&userInfo, sqlString, loginRequest.UserName); err != nil {
-		c.String(http.StatusBadRequest, "用户名或密码错误")
+	sqlString := `SELECT id, password, role FROM "user" WHERE name = $1`
+	userExists := global.Database.Get(&userInfo, sqlString, loginRequest.UserName) == nil
+	ip := c.ClientIP()
+	throttle, err := reserveLoginAttempt(c, loginRequest.UserName, ip)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	if !utils.VerifyPassword(userInfo.Password, loginRequest.Password) {
-		c.String(http.StatusBadRequest, "用户名或密码错误")
+	if throttle.LockedFor > 0 {
+		if userExists {
+			recordLoginHistory(c, userInfo.ID, LoginMethodPassword, LoginFailLocked)
+		}
+		c.Header("Retry-After", fmt.Sprint(int(throttle.LockedFor.Seconds())+1))
+		c.String(http.StatusTooManyRequests, "登录失败次数过多，请稍后再试")
 		return
 	}
-	token, err := global.CreateSession(c, &global.Session{
-		Role:   global.USER,
-		UserId: userInfo.ID,
-	})
+	// 本次登录已经预先计入失败次数，失败时保留，其他情况下撤销
+	loginFailed := func(reason string, message string) {
+		if userExists {
+			recordLoginHistory(c, userInfo.ID, LoginMethodPassword, reason)
+		}
+		c.String(http.StatusBadRequest, message)
+	}
+	if throttle.NeedCaptcha {
+		if loginRequest.CaptchaId == "" {
+			_ = throttle.release(c)
+			c.String(http.StatusPreconditionRequired, "需要验证码")
+			return
+		}
+		if ok, err := utils.Captcha.Verify(c, loginRequest.CaptchaId, loginRequest.CaptchaAnswer); err != nil {
+			_ = throttle.release(c)
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		} else if !ok {
+			loginFailed(LoginFailCaptcha, "验证码错误")
+			return
+		}
+	}
+	if !userExists || !utils.VerifyPassword(userInfo.Password, loginRequest.Password) {
+		loginFailed(LoginFailWrongPassword, "用户名或密码错误")
+		return
+	}
+	if ban, err := getActiveBan(userInfo.ID); err != nil {
+		_ = throttle.release(c)
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if ban != nil {
+		_ = throttle.release(c)
+		recordLoginHistory(c, userInfo.ID, LoginMethodPassword, LoginFailBanned)
+		c.String(http.StatusForbidden, "账号已被封禁")
+		return
+	}
+	if err := clearLoginFailures(c, loginRequest.UserName, throttle); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordLoginHistory(c, userInfo.ID, LoginMethodPassword, "")
+	response, err := createUserSession(c, userInfo.ID, global.Role(userInfo.Role), loginRequest.Device, loginRequest.RememberMe)
 	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	c.JSON(http.StatusOK, LoginResponse{
-		Token: token,
-	})
-	c.Set("Role", global.USER)
+	c.JSON(http.StatusOK, response)
+	c.Set("Role", global.Role(userInfo.Role))
 	c.Set("UserId", userInfo.ID)
 }
 
@@ -95,7 +150,7 @@ func Login(c *gin.Context) {
 // @Tags Authentication
 // @Param info body RegisterInfo true "用户注册信息"
 // @Success 200 {string} string "注册成功"
-// @Failure 400 {string} string "请求解析失败"/"验证码已过期"/"验证码错误"
+// @Failure 400 {string} string "请求解析失败"/"验证码已过期"/"验证码错误"/"内容包含敏感词"
 // @Failure 409 {string} string "用户名已存在"
 // @Failure default {string} string "服务器错误"
 // @Router /register [post]
@@ -105,6 +160,9 @@ func Register(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	if !filterUserName(c, registerRequest.Name) {
+		return
+	}
 	userInfo := model.User{}
 	sqlString := `SELECT id FROM "user" WHERE name = $1`
 	if err := global.Database.Get(&userInfo, sqlString, registerRequest.Name); err == nil {
@@ -178,6 +236,17 @@ func ChangePassword(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	// 修改密码后其他设备需要重新登录
+	if err := global.DeleteOtherSessions(c, userInfo.ID, c.GetString("SessionId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 密码相关的审计日志不保存快照
+	recordAudit(c, auditEvent{
+		Action:     AuditActionPasswordChange,
+		TargetType: AuditTargetUser,
+		TargetId:   userInfo.ID,
+	})
 	c.String(http.StatusOK, "修改成功")
 }
 
@@ -226,6 +295,21 @@ func ResetPassword(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	// 重置密码时通常没有登录，如果带着本人的会话则保留该会话，其余会话全部注销
+	keepSessionId := ""
+	if c.GetInt("UserId") == userInfo.ID {
+		keepSessionId = c.GetString("SessionId")
+	}
+	if err := global.DeleteOtherSessions(c, userInfo.ID, keepSessionId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 重置密码时可能没有登录，操作人记为用户本人
+	insertAuditLog(userInfo.ID, c.ClientIP(), false, auditEvent{
+		Action:     AuditActionPasswordReset,
+		TargetType: AuditTargetUser,
+		TargetId:   userInfo.ID,
+	})
 	c.String(http.StatusOK, "修改成功")
 }
 
@@ -238,7 +322,7 @@ func ResetPassword(c *gin.Context) {
 // @Router /logout [get]
 // @Security ApiKeyAuth
 func Logout(c *gin.Context) {
-	err := global.DeleteSession(c, c.Request.Header.Get(global.TokenHeader))
+	_, err := global.DeleteSessionById(c, c.GetInt("UserId"), c.GetString("SessionId"))
 	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 	}
@@ -260,7 +344,7 @@ func SendEmail(c *gin.Context) {
 	currentTime := time.Now()
 	lastSentTimeStr, err := global.Redis.ZScore(c, lastSentTimesKey, email).Result()
 	if err == redis.Nil || (err == nil && currentTime.Sub(time.Unix(int64(lastSentTimeStr), 0)) >= time.Minute) {
-		vCode, err := utils.SendEmailValidate(c.Query("email"))
+		vCode, err := utils.SendEmailValidate(c, email, utils.ParseLocale(c.GetHeader("Accept-Language")))
 		if err != nil {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
@@ -285,35 +369,19 @@ func SendEmail(c *gin.Context) {
 }
 
 type WeixinLoginInfo struct {
-	Code string `json:"code"`
+	Code       string `json:"code"`
+	Device     string `json:"device"`
+	RememberMe bool   `json:"remember_me"`
 }
 
-type WeixinReturnInfo struct {
-	OpenID     string `json:"openid"`
-	SessionKey string `json:"session_key"`
-	UnionID    string `json:"unionid"`
-	ErrCode    int    `json:"errcode"`
-	ErrMsg     string `json:"errmsg"`
-}
-
-type WeixinLoginResponse struct {
-	Code    int    `json:"code"`
-	Message string `json:"message"`
-	Token   string `json:"token"`
-}
-
-var (
-	url = "https://api.weixin.qq.com/sns/jscode2session?appid=%s&secret=%s&js_code=%s&grant_type=authorization_code"
-)
-
 // WeixinLogin godoc
 // @Schemes http
-// @Description 微信登录
+// @Description 微信登录，等同于 /oauth/login/weixin
 // @Tags Authentication
 // @Param code body WeixinLoginInfo true "微信登录信息"
-// @Success 200 {object} WeixinLoginResponse "用户登陆反馈"
-// @Failure 400 {string} string "请求解析失败"
-// @Failure 409 {string} string "用户不存在"
+// @Success 200 {object} OAuthLoginResponse "用户登陆反馈"
+// @Failure 400 {string} string "请求解析失败"/"第三方登录失败"
+// @Failure 403 {string} string "账号已被封禁"
 // @Failure default {string} string "服务器错误"
 // @Router /weixin-login [post]
 func WeixinLogin(c *gin.Context) {
@@ -322,80 +390,21 @@ func WeixinLogin(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
-	// 获取微信用户信息
-	var weixinReturnInfo WeixinReturnInfo
-	httpState, bytes := utils.Get(fmt.Sprintf(url, global.AppID, global.AppSecret, weixinLoginInfo.Code))
-	if httpState != 200 {
-		_ = fmt.Errorf("获取SessionKey失败, Http状态码: %d", httpState)
-		c.String(http.StatusBadRequest, weixinReturnInfo.ErrMsg+" 获取SessionKey失败")
-	}
-	e := json.Unmarshal(bytes, &weixinReturnInfo)
-	if e != nil {
-		_ = fmt.Errorf("json解析失败")
-		c.String(http.StatusBadRequest, weixinReturnInfo.ErrMsg+" json解析失败")
-	}
-
-	// 查询用户是否存在
-	userInfo := model.User{}
-	sqlString := `SELECT * FROM "user" WHERE open_id = $1`
-	if err := global.Database.Get(&userInfo, sqlString, weixinReturnInfo.OpenID); err != nil {
-		randomUsername := uuid.New().String()
-		// 添加一个用户
-		sqlString = `INSERT INTO "user" (open_id, name, email, phone, password, created_at, nick_name) VALUES ($1, $2, '', '', '', now(), $3) RETURNING id`
-		var newUserId int
-		if err := global.Database.Get(&newUserId, sqlString, weixinReturnInfo.OpenID, randomUsername, randomUsername); err != nil {
-			c.String(http.StatusInternalServerError, "新注册用户添加失败")
-			return
-		}
-		token, err := global.CreateSession(c, &global.Session{
-			Role:   global.USER,
-			UserId: newUserId,
-		})
-		if err != nil {
-			c.String(http.StatusInternalServerError, "新注册用户Token生成失败")
-			return
-		}
-		c.Set("Role", global.USER)
-		c.Set("UserId", userInfo.ID)
-		c.JSON(http.StatusOK, WeixinLoginResponse{
-			Code:    201,
-			Message: "待完善信息",
-			Token:   token,
-		})
-		return
-	}
-	token, err := global.CreateSession(c, &global.Session{
-		Role:   global.USER,
-		UserId: userInfo.ID,
-	})
-	if err != nil {
-		c.String(http.StatusInternalServerError, "已注册用户Token生成失败")
-		return
-	}
-	c.Set("Role", global.USER)
-	c.Set("UserId", userInfo.ID)
-	if userInfo.Email == "" || userInfo.Password == "" {
-		c.JSON(http.StatusOK, WeixinLoginResponse{
-			Code:    201,
-			Message: "待完善信息",
-			Token:   token,
-		})
-		return
-	}
-	c.JSON(http.StatusOK, WeixinLoginResponse{
-		Code:    200,
-		Message: "登录成功",
-		Token:   token,
+	oauthLogin(c, LoginMethodWeixin, OAuthLoginRequest{
+		Code:       weixinLoginInfo.Code,
+		Device:     weixinLoginInfo.Device,
+		RememberMe: weixinLoginInfo.RememberMe,
 	})
 }
 
 // WeixinBind godoc
 // @Schemes http
-// @Description 微信绑定
+// @Description 微信绑定，等同于 /user/identity/bind/weixin
 // @Tags Authentication
 // @Param code body WeixinLoginInfo true "微信登录信息"
 // @Success 200 {string} string "绑定成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"第三方登录失败"
+// @Failure 409 {string} string "已绑定该登录方式"/"该第三方账号已被其他用户绑定"
 // @Failure default {string} string "服务器错误"
 // @Router /weixin-bind [post]
 // @Security ApiKeyAuth
@@ -405,43 +414,7 @@ func WeixinBind(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
-	// 获取微信用户信息
-	var weixinReturnInfo WeixinReturnInfo
-	httpState, bytes := utils.Get(fmt.Sprintf(url, global.AppID, global.AppSecret, weixinLoginInfo.Code))
-	if httpState != 200 {
-		_ = fmt.Errorf("获取SessionKey失败, Http状态码: %d", httpState)
-		c.String(http.StatusBadRequest, weixinReturnInfo.ErrMsg+" 获取SessionKey失败")
-	}
-	e := json.Unmarshal(bytes, &weixinReturnInfo)
-	if e != nil {
-		_ = fmt.Errorf("json解析失败")
-		c.String(http.StatusBadRequest, weixinReturnInfo.ErrMsg+" json解析失败")
-	}
-
-	// 查询微信是否已被绑定
-	userInfo := model.User{}
-	sqlString := `SELECT * FROM "user" WHERE open_id = $1`
-	if err := global.Database.Get(&userInfo, sqlString, weixinReturnInfo.OpenID); err == nil {
-		c.String(http.StatusBadRequest, "该微信已被绑定")
-		return
-	}
-	// 查询用户是否已经绑定微信
-	sqlString = `SELECT * FROM "user" WHERE id = $1`
-	if err := global.Database.Get(&userInfo, sqlString, c.GetInt("UserId")); err != nil {
-		c.String(http.StatusBadRequest, "用户不存在")
-		return
-	}
-	if userInfo.OpenId != nil && *userInfo.OpenId != "" {
-		c.String(http.StatusBadRequest, "该用户已绑定微信")
-		return
-	}
-	// 绑定用户
-	sqlString = `UPDATE "user" SET open_id = $1 WHERE id = $2`
-	if _, err := global.Database.Exec(sqlString, weixinReturnInfo.OpenID, c.GetInt("UserId")); err != nil {
-		c.String(http.StatusInternalServerError, "服务器错误")
-		return
-	}
-	c.String(http.StatusOK, "绑定成功")
+	bindIdentity(c, LoginMethodWeixin, weixinLoginInfo.Code, "")
 }
 
 type WeixinCompleteInfo struct {
@@ -457,7 +430,7 @@ type WeixinCompleteInfo struct {
 // @Tags Authentication
 // @Param info body WeixinCompleteInfo true "微信完善信息"
 // @Success 200 {string} string "完善成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure default {string} string "服务器错误"
 // @Router /weixin-complete [post]
 // @Security ApiKeyAuth
@@ -467,6 +440,9 @@ func WeixinComplete(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	if !filterUserName(c, weixinCompleteInfo.UserName) {
+		return
+	}
 	// 查询用户是否存在
 	userInfo := model.User{}
 	sqlString := `SELECT * FROM "user" WHERE id = $1`
@@ -5,6 +5,7 @@ import (
 	"kayak-backend/global"
 	"kayak-backend/model"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -75,7 +76,7 @@ func GetUserFavoriteProblems(c *gin.Context) {
 		`SELECT p.id AS id, p.description as description, p.created_at AS created_at, 
     		p.updated_at AS updated_at, p.user_id AS user_id, p.problem_type_id AS problem_type_id, p.is_public AS is_public
 	     FROM user_favorite_problem ufp JOIN problem_type p ON ufp.problem_id = p.id 
-	     WHERE ufp.user_id = $1`
+	     WHERE ufp.user_id = $1` + hiddenCondition(c, "p.")
 	if err := global.Database.Select(&problems, sqlString, userId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -107,7 +108,7 @@ func GetUserFavoriteProblemSets(c *gin.Context) {
 		`SELECT ps.id AS id, ps.name AS name, ps.description AS description, ps.created_at AS created_at, 
     		ps.updated_at AS updated_at, ps.user_id AS user_id, ps.is_public AS is_public
 	 	 FROM user_favorite_problem_set ufps RIGHT JOIN problem_set ps ON ufps."problem_set_id" = ps.id
-	 	 WHERE ufps.user_id = $1`
+	 	 WHERE ufps.user_id = $1` + hiddenCondition(c, "ps.")
 	if err := global.Database.Select(&problemsets, sqlString, userId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -174,7 +175,7 @@ func GetUserFavoriteNotes(c *gin.Context) {
 		`SELECT n.id AS id, n.title AS title, n.content AS content, 
        		n.created_at AS created_at, n.user_id AS user_id, n.updated_at AS updated_at, n.is_public AS is_public
 		 FROM user_favorite_note ufn JOIN note n ON ufn.note_id = n.id 
-		 WHERE ufn.user_id = $1`
+		 WHERE ufn.user_id = $1` + hiddenCondition(c, "n.")
 	if err := global.Database.Select(&notes, sqlString, userId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -295,7 +296,8 @@ func GetUserChoiceProblems(c *gin.Context) {
 	var problemType []model.ProblemType
 	var choiceProblems []ChoiceProblemItem
 	userId := c.GetInt("UserId")
-	sqlString := `SELECT id, description, created_at, updated_at, user_id, is_public FROM problem_type WHERE problem_type_id = $1 AND user_id = $2`
+	sqlString := `SELECT id, description, created_at, updated_at, user_id, is_public FROM problem_type WHERE problem_type_id = $1 AND user_id = $2` +
+		hiddenCondition(c, "")
 	if err := global.Database.Select(&problemType, sqlString, ChoiceProblemType, userId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -340,7 +342,8 @@ func GetUserChoiceProblems(c *gin.Context) {
 // @Deprecated
 func GetUserBlankProblems(c *gin.Context) {
 	userId := c.GetInt("UserId")
-	sqlString := `SELECT id, description FROM problem_type WHERE problem_type_id = $1 AND user_id = $2`
+	sqlString := `SELECT id, description FROM problem_type WHERE problem_type_id = $1 AND user_id = $2` +
+		hiddenCondition(c, "")
 	var blankProblems []BlankProblemResponse
 	if err := global.Database.Select(&blankProblems, sqlString, BlankProblemType, userId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
@@ -387,11 +390,22 @@ func GetChoiceProblem(c *gin.Context) {
 	}
 	var choices []Choice
 	for _, choice := range problemChoices {
+		choiceImages, err := GetProblemImageURLs(choiceProblem.ID, ProblemImageChoice, choice.Choice)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "获取选项失败")
+			return
+		}
 		choices = append(choices, Choice{
 			Choice:      choice.Choice,
 			Description: choice.Description,
+			Images:      choiceImages,
 		})
 	}
+	images, err := GetProblemImageURLs(choiceProblem.ID, ProblemImageStem, "")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 
 	// 获取收藏数
 	var favoriteCount int
@@ -410,6 +424,7 @@ func GetChoiceProblem(c *gin.Context) {
 		IsPublic:      choiceProblem.IsPublic,
 		Choices:       choices,
 		FavoriteCount: favoriteCount,
+		Images:        images,
 	}
 	c.JSON(http.StatusOK, choiceProblemResponse)
 }
@@ -427,7 +442,8 @@ func GetChoiceProblem(c *gin.Context) {
 // @Deprecated
 func GetProblemSetContainsProblem(c *gin.Context) {
 	var problemSetList []model.ProblemSet
-	sqlString := `SELECT * FROM problem_set WHERE id IN (SELECT problem_set_id FROM problem_in_problem_set WHERE problem_id = $1)`
+	sqlString := `SELECT * FROM problem_set WHERE id IN (SELECT problem_set_id FROM problem_in_problem_set WHERE problem_id = $1)` +
+		hiddenCondition(c, "")
 	if err := global.Database.Select(&problemSetList, sqlString, c.Param("id")); err != nil {
 		c.String(http.StatusNotFound, "题目不存在")
 		return
@@ -488,6 +504,11 @@ func GetBlankProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	images, err := GetProblemImageURLs(blankProblem.ID, ProblemImageStem, "")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	blankProblemResponse := BlankProblemResponse{
 		ID:            blankProblem.ID,
 		Description:   blankProblem.Description,
@@ -496,6 +517,7 @@ func GetBlankProblem(c *gin.Context) {
 		UserId:        blankProblem.UserId,
 		IsPublic:      blankProblem.IsPublic,
 		FavoriteCount: favoriteCount,
+		Images:        images,
 	}
 	c.JSON(http.StatusOK, blankProblemResponse)
 }
@@ -535,5 +557,8 @@ func AddUserToGroup(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if groupId, err := strconv.Atoi(c.Param("id")); err == nil {
+		recordMemberJoin(c, groupId, userId)
+	}
 	c.String(http.StatusOK, "添加成功")
 }
@@ -32,6 +32,8 @@ type DiscussionResponse struct {
 	IsFavorite    bool             `json:"is_favorite" db:"is_favorite"`
 	LikeCount     int              `json:"like_count" db:"like_count"`
 	FavoriteCount int              `json:"favorite_count" db:"favorite_count"`
+	IsPinned      bool             `json:"is_pinned" db:"is_pinned"`
+	IsLocked      bool             `json:"is_locked" db:"is_locked"`
 }
 type AllDiscussionResponse struct {
 	TotalCount  int                  `json:"total_count"`
@@ -52,7 +54,7 @@ type DiscussionUpdateRequest struct {
 
 // GetDiscussions godoc
 // @Schemes http
-// @Description 获取符合filter要求的当前用户视角下的所有讨论
+// @Description 获取符合filter要求的当前用户视角下的所有讨论，置顶的讨论排在最前面
 // @Tags Discussion
 // @Param filter query DiscussionFilter false "筛选条件"
 // @Success 200 {object} AllDiscussionResponse "讨论列表"
@@ -73,6 +75,7 @@ func GetDiscussions(c *gin.Context) {
 		return
 	}
 	sqlString = `SELECT * FROM discussion WHERE group_id = $1 AND (is_public = true OR user_id = $2)`
+	sqlString += hiddenCondition(c, "")
 	if filter.ID != nil {
 		sqlString += fmt.Sprint(" AND id = ", *filter.ID)
 	}
@@ -93,11 +96,13 @@ func GetDiscussions(c *gin.Context) {
 			sqlString += fmt.Sprint(" AND id NOT IN (SELECT discussion_id FROM user_favorite_discussion WHERE user_id = ", c.GetInt("UserId"), ")")
 		}
 	}
+	// 置顶的讨论总是排在最前面，多个置顶讨论按置顶时间倒序
+	sqlString += " ORDER BY is_pinned DESC, pinned_at DESC"
 	if filter.SortByLike != nil {
 		if *filter.SortByLike {
-			sqlString += " ORDER BY like_count DESC"
+			sqlString += ", like_count DESC"
 		} else {
-			sqlString += " ORDER BY created_at DESC"
+			sqlString += ", created_at DESC"
 		}
 	}
 	if filter.Limit != nil {
@@ -149,6 +154,8 @@ func GetDiscussions(c *gin.Context) {
 			IsFavorite:    isFavorite > 0,
 			LikeCount:     discussion.LikeCount,
 			FavoriteCount: discussion.FavoriteCount,
+			IsPinned:      discussion.IsPinned,
+			IsLocked:      discussion.IsLocked,
 		})
 	}
 	c.JSON(http.StatusOK, AllDiscussionResponse{
@@ -162,7 +169,7 @@ func GetDiscussions(c *gin.Context) {
 // @Tags Discussion
 // @Param note body DiscussionCreateRequest true "讨论信息"
 // @Success 200 {object} DiscussionResponse "笔记信息"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure 403 {string} string "没有权限"
 // @Failure default {string} string "服务器错误"
 // @Router /discussion/create [post]
@@ -173,6 +180,10 @@ func CreateDiscussion(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, "服务器错误")
 		return
 	}
+	review, ok := filterSensitiveWords(c, true, &request.Title, &request.Content)
+	if !ok {
+		return
+	}
 	sqlString := `SELECT count(*) FROM group_member WHERE group_id = $1 AND user_id = $2`
 	var count int
 	if err := global.Database.Get(&count, sqlString, request.GroupId, c.GetInt("UserId")); err != nil {
@@ -183,10 +194,23 @@ func CreateDiscussion(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
+	tx := global.Database.MustBegin()
 	sqlString = `INSERT INTO discussion (title, content, user_id, group_id, created_at, updated_at, is_public) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 	var discussionId int
-	if err := global.Database.Get(&discussionId, sqlString, request.Title, request.Content, c.GetInt("UserId"),
+	if err := tx.Get(&discussionId, sqlString, request.Title, request.Content, c.GetInt("UserId"),
 		request.GroupId, time.Now().Local(), time.Now().Local(), request.IsPublic); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if review != nil {
+		if err := queueForReview(tx, ReportTargetDiscussion, discussionId, c.GetInt("UserId"), review); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
@@ -220,6 +244,8 @@ func CreateDiscussion(c *gin.Context) {
 		IsFavorite:    false,
 		LikeCount:     discussion.LikeCount,
 		FavoriteCount: discussion.FavoriteCount,
+		IsPinned:      discussion.IsPinned,
+		IsLocked:      discussion.IsLocked,
 	})
 }
 
@@ -229,7 +255,7 @@ func CreateDiscussion(c *gin.Context) {
 // @Tags Discussion
 // @Param discussion body DiscussionUpdateRequest true "讨论信息"
 // @Success 200 {string} string "更新成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "讨论不存在"
 // @Failure default {string} string "服务器错误"
@@ -251,6 +277,10 @@ func UpdateDiscussion(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
+	review, ok := filterSensitiveWords(c, true, request.Title, request.Content)
+	if !ok {
+		return
+	}
 	if request.Title == nil {
 		request.Title = &discussion.Title
 	}
@@ -260,12 +290,39 @@ func UpdateDiscussion(c *gin.Context) {
 	if request.IsPublic == nil {
 		request.IsPublic = &discussion.IsPublic
 	}
+	tx := global.Database.MustBegin()
 	sqlString = `UPDATE discussion SET title = $1, content = $2, updated_at = $3, is_public = $4 WHERE id = $5`
-	if _, err := global.Database.Exec(sqlString, request.Title, request.Content,
+	if _, err := tx.Exec(sqlString, request.Title, request.Content,
 		time.Now().Local(), request.IsPublic, request.ID); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if review != nil {
+		if err := queueForReview(tx, ReportTargetDiscussion, discussion.ID, discussion.UserId, review); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if isAdminOverride(c, discussion.UserId) {
+		var updated model.Discussion
+		if err := global.Database.Get(&updated, `SELECT * FROM discussion WHERE id = $1`, discussion.ID); err == nil {
+			recordAudit(c, auditEvent{
+				Action:     AuditActionUpdate,
+				TargetType: ReportTargetDiscussion,
+				TargetId:   discussion.ID,
+				GroupId:    discussion.GroupId,
+				OwnerId:    discussion.UserId,
+				Before:     discussion,
+				After:      updated,
+			})
+		}
+	}
 	c.String(http.StatusOK, "更新成功")
 }
 
@@ -302,6 +359,14 @@ func DeleteDiscussion(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: ReportTargetDiscussion,
+		TargetId:   discussion.ID,
+		GroupId:    discussion.GroupId,
+		OwnerId:    discussion.UserId,
+		Before:     discussion,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"net/http"
+	"time"
+)
+
+// 每个被采纳的回答为作者增加的声望
+const acceptedAnswerReputation = 10
+
+type DiscussionPinRequest struct {
+	IsPinned bool `json:"is_pinned"`
+}
+
+type DiscussionLockRequest struct {
+	IsLocked bool `json:"is_locked"`
+}
+
+type DiscussionReviewAcceptRequest struct {
+	IsAccepted bool `json:"is_accepted"`
+}
+
+// canModerateDiscussion 判断当前用户能否管理讨论，需要是讨论所在小组的组长或管理员
+func canModerateDiscussion(c *gin.Context, discussion *model.Discussion) (bool, error) {
+	if role, _ := c.Get("Role"); role == global.ADMIN {
+		return true, nil
+	}
+	return isGroupAdmin(discussion.GroupId, c.GetInt("UserId"))
+}
+
+// getUserReputation 返回用户的声望，目前由讨论中被采纳的回答数计算
+func getUserReputation(userId int) (int, error) {
+	var accepted int
+	sqlString := `SELECT count(*) FROM discussion_review WHERE user_id = $1 AND is_accepted = true`
+	if err := global.Database.Get(&accepted, sqlString, userId); err != nil {
+		return 0, err
+	}
+	return accepted * acceptedAnswerReputation, nil
+}
+
+// PinDiscussion godoc
+// @Schemes http
+// @Description 置顶或取消置顶讨论（需要是小组的组长或管理员），置顶的讨论在列表中排在最前面
+// @Tags Discussion
+// @Param id path int true "讨论ID"
+// @Param pin body DiscussionPinRequest true "是否置顶"
+// @Success 200 {string} string "设置成功"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "讨论不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /discussion/pin/{id} [put]
+// @Security ApiKeyAuth
+func PinDiscussion(c *gin.Context) {
+	var request DiscussionPinRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM discussion WHERE id = $1`
+	var discussion model.Discussion
+	if err := global.Database.Get(&discussion, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "讨论不存在")
+		return
+	}
+	if ok, err := canModerateDiscussion(c, &discussion); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if !ok {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var pinnedAt *time.Time
+	if request.IsPinned {
+		now := time.Now().Local()
+		pinnedAt = &now
+	}
+	sqlString = `UPDATE discussion SET is_pinned = $1, pinned_at = $2 WHERE id = $3`
+	if _, err := global.Database.Exec(sqlString, request.IsPinned, pinnedAt, discussion.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "设置成功")
+}
+
+// LockDiscussion godoc
+// @Schemes http
+// @Description 锁定或解锁讨论（需要是小组的组长或管理员），锁定的讨论不能再添加评论
+// @Tags Discussion
+// @Param id path int true "讨论ID"
+// @Param lock body DiscussionLockRequest true "是否锁定"
+// @Success 200 {string} string "设置成功"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "讨论不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /discussion/lock/{id} [put]
+// @Security ApiKeyAuth
+func LockDiscussion(c *gin.Context) {
+	var request DiscussionLockRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM discussion WHERE id = $1`
+	var discussion model.Discussion
+	if err := global.Database.Get(&discussion, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "讨论不存在")
+		return
+	}
+	if ok, err := canModerateDiscussion(c, &discussion); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if !ok {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	sqlString = `UPDATE discussion SET is_locked = $1 WHERE id = $2`
+	if _, err := global.Database.Exec(sqlString, request.IsLocked, discussion.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "设置成功")
+}
+
+// AcceptDiscussionReview godoc
+// @Schemes http
+// @Description 采纳或取消采纳评论为讨论的最佳回答（需要是讨论的作者或小组的组长、管理员），
+// @Description 每个讨论只有一个被采纳的回答，被采纳的回答排在评论列表最前面并计入作者的声望。
+// @Description 只能采纳一级评论，讨论作者自己的评论不能被采纳
+// @Tags DiscussionReview
+// @Param id path int true "评论ID"
+// @Param accept body DiscussionReviewAcceptRequest true "是否采纳"
+// @Success 200 {string} string "设置成功"
+// @Failure 400 {string} string "请求解析失败"/"不能采纳讨论作者自己的评论"/"只能采纳一级评论"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "评论不存在"
+// @Failure 409 {string} string "讨论已有其他被采纳的回答"
+// @Failure default {string} string "服务器错误"
+// @Router /discussion_review/accept/{id} [put]
+// @Security ApiKeyAuth
+func AcceptDiscussionReview(c *gin.Context) {
+	var request DiscussionReviewAcceptRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM discussion_review WHERE id = $1`
+	var review model.DiscussionReview
+	if err := global.Database.Get(&review, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "评论不存在")
+		return
+	}
+	sqlString = `SELECT * FROM discussion WHERE id = $1`
+	var discussion model.Discussion
+	if err := global.Database.Get(&discussion, sqlString, review.DiscussionId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if discussion.UserId != c.GetInt("UserId") {
+		if ok, err := canModerateDiscussion(c, &discussion); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		} else if !ok {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	if review.IsAccepted == request.IsAccepted {
+		c.String(http.StatusOK, "设置成功")
+		return
+	}
+	if request.IsAccepted && review.UserId == discussion.UserId {
+		c.String(http.StatusBadRequest, "不能采纳讨论作者自己的评论")
+		return
+	}
+	if request.IsAccepted && review.ParentId != nil {
+		c.String(http.StatusBadRequest, "只能采纳一级评论")
+		return
+	}
+	tx := global.Database.MustBegin()
+	if request.IsAccepted {
+		sqlString = `UPDATE discussion_review SET is_accepted = false WHERE discussion_id = $1 AND is_accepted = true`
+		if _, err := tx.Exec(sqlString, discussion.ID); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	sqlString = `UPDATE discussion_review SET is_accepted = $1 WHERE id = $2`
+	if _, err := tx.Exec(sqlString, request.IsAccepted, review.ID); err != nil {
+		_ = tx.Rollback()
+		// 并发采纳同一讨论的不同回答时，唯一索引保证只有一个成功
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			c.String(http.StatusConflict, "讨论已有其他被采纳的回答")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if request.IsAccepted {
+		CreateNotification(c, review.UserId, NotificationAnswerAccepted, c.GetInt("UserId"), discussion.ID, discussion.Title)
+	}
+	c.String(http.StatusOK, "设置成功")
+}
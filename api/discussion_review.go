@@ -4,6 +4,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"kayak-backend/global"
 	"kayak-backend/model"
+	"kayak-backend/utils"
+	"log"
 	"net/http"
 	"time"
 )
@@ -12,32 +14,119 @@ type DiscussionReviewCreateRequest struct {
 	Title        string `json:"title"`
 	Content      string `json:"content"`
 	DiscussionId int    `json:"discussion_id"`
+	ParentId     *int   `json:"parent_id"`
+}
+type DiscussionReviewUpdateRequest struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
 }
 type DiscussionReviewResponse struct {
-	ID           int              `json:"id"`
-	Title        string           `json:"title"`
-	Content      string           `json:"content"`
-	DiscussionId int              `json:"discussion_id"`
-	UserInfo     UserInfoResponse `json:"user_info"`
-	CreatedAt    string           `json:"created_at"`
-	UpdatedAt    string           `json:"updated_at"`
-	IsLiked      bool             `json:"is_liked"`
-	LikeCount    int              `json:"like_count"`
+	ID              int                        `json:"id"`
+	Title           string                     `json:"title"`
+	Content         string                     `json:"content"`
+	RenderedContent string                     `json:"rendered_content"`
+	DiscussionId    int                        `json:"discussion_id"`
+	ParentId        *int                       `json:"parent_id"`
+	UserInfo        UserInfoResponse           `json:"user_info"`
+	CreatedAt       string                     `json:"created_at"`
+	UpdatedAt       string                     `json:"updated_at"`
+	IsLiked         bool                       `json:"is_liked"`
+	LikeCount       int                        `json:"like_count"`
+	IsAccepted      bool                       `json:"is_accepted"`
+	Mentions        []MentionResponse          `json:"mentions"`
+	ReplyCount      int                        `json:"reply_count"`
+	Replies         []DiscussionReviewResponse `json:"replies"`
 }
 type AllDiscussionReviewResponse struct {
 	TotalCount        int                        `json:"total_count"`
 	DiscussionReviews []DiscussionReviewResponse `json:"discussion_reviews"`
 }
 
+// newDiscussionReviewResponse 组装单条评论的作者、点赞和提及信息，不包含回复
+func newDiscussionReviewResponse(review *model.DiscussionReview, userId int) (DiscussionReviewResponse, error) {
+	user := model.User{}
+	sqlString := `SELECT id, avatar_url, nick_name FROM "user" WHERE id = $1`
+	if err := global.Database.Get(&user, sqlString, review.UserId); err != nil {
+		return DiscussionReviewResponse{}, err
+	}
+	sqlString = `SELECT count(*) FROM user_like_discussion_review WHERE discussion_review_id = $1 AND user_id = $2`
+	var isLiked int
+	if err := global.Database.Get(&isLiked, sqlString, review.ID, userId); err != nil {
+		return DiscussionReviewResponse{}, err
+	}
+	mentions, err := getReviewMentions("discussion_review_mention", "discussion_review_id", review.ID)
+	if err != nil {
+		return DiscussionReviewResponse{}, err
+	}
+	return DiscussionReviewResponse{
+		ID:              review.ID,
+		Title:           review.Title,
+		Content:         review.Content,
+		RenderedContent: renderMentions(review.Content, mentions),
+		DiscussionId:    review.DiscussionId,
+		ParentId:        review.ParentId,
+		UserInfo: UserInfoResponse{
+			UserId:     user.ID,
+			AvatarPath: user.AvatarURL,
+			NickName:   user.NickName,
+		},
+		CreatedAt:  review.CreatedAt,
+		UpdatedAt:  review.UpdatedAt,
+		IsLiked:    isLiked > 0,
+		LikeCount:  review.LikeCount,
+		IsAccepted: review.IsAccepted,
+		Mentions:   mentions,
+		Replies:    make([]DiscussionReviewResponse, 0),
+	}, nil
+}
+
+// getDiscussionReviewThread 按时间顺序返回 parentId 下的一页评论（parentId 为 nil 时为第一层评论）及总数，
+// 被采纳的回答排在最前，每条评论再展开 depth-1 层、每层最多 replyLimit 条回复，被隐藏的评论只有作者能看到
+func getDiscussionReviewThread(discussionId int, parentId *int, offset int, limit int, depth int, replyLimit int,
+	userId int) ([]DiscussionReviewResponse, int, error) {
+	var totalCount int
+	sqlString := `SELECT count(*) FROM discussion_review WHERE discussion_id = $1 AND parent_id IS NOT DISTINCT FROM $2
+		AND (is_hidden = false OR user_id = $3)`
+	if err := global.Database.Get(&totalCount, sqlString, discussionId, parentId, userId); err != nil {
+		return nil, 0, err
+	}
+	var reviews []model.DiscussionReview
+	sqlString = paginate(`SELECT * FROM discussion_review WHERE discussion_id = $1 AND parent_id IS NOT DISTINCT FROM $2
+		AND (is_hidden = false OR user_id = $3)
+		ORDER BY is_accepted DESC, created_at, id`, offset, limit)
+	if err := global.Database.Select(&reviews, sqlString, discussionId, parentId, userId); err != nil {
+		return nil, 0, err
+	}
+	responses := make([]DiscussionReviewResponse, 0, len(reviews))
+	for i := range reviews {
+		response, err := newDiscussionReviewResponse(&reviews[i], userId)
+		if err != nil {
+			return nil, 0, err
+		}
+		if depth > 1 {
+			response.Replies, response.ReplyCount, err = getDiscussionReviewThread(discussionId, &reviews[i].ID, 0,
+				replyLimit, depth-1, replyLimit, userId)
+		} else {
+			sqlString = `SELECT count(*) FROM discussion_review WHERE parent_id = $1 AND (is_hidden = false OR user_id = $2)`
+			err = global.Database.Get(&response.ReplyCount, sqlString, reviews[i].ID, userId)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, totalCount, nil
+}
+
 // AddDiscussionReview godoc
 // @Schemes http
-// @Description 添加评论
+// @Description 添加评论，指定 parent_id 时回复同一讨论下的另一条评论，内容中的 @用户名 会通知对应用户
 // @Tags DiscussionReview
 // @Param review body DiscussionReviewCreateRequest true "评论信息"
 // @Success 200 {string} DiscussionReviewResponse "评论信息"
-// @Failure 400 {string} string "请求解析失败"
-// @Failure 403 {string} string "没有权限"
-// @Failure 404 {string} string "讨论不存在"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
+// @Failure 403 {string} string "没有权限"/"讨论已锁定"
+// @Failure 404 {string} string "讨论不存在"/"回复的评论不存在"
 // @Failure default {string} string "服务器错误"
 // @Router /discussion_review/add [post]
 // @Security ApiKeyAuth
@@ -47,6 +136,10 @@ func AddDiscussionReview(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	reviewWords, ok := filterSensitiveWords(c, true, &request.Title, &request.Content)
+	if !ok {
+		return
+	}
 	sqlString := `SELECT * FROM discussion WHERE id = $1`
 	var discussion model.Discussion
 	if err := global.Database.Get(&discussion, sqlString, request.DiscussionId); err != nil {
@@ -62,20 +155,51 @@ func AddDiscussionReview(c *gin.Context) {
 	if role, _ := c.Get("Role"); role != global.ADMIN && (count == 0 ||
 		discussion.UserId != c.GetInt("UserId") && !discussion.IsPublic) {
 		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if discussion.IsLocked {
+		c.String(http.StatusForbidden, "讨论已锁定")
+		return
+	}
+	var parent model.DiscussionReview
+	if request.ParentId != nil {
+		sqlString = `SELECT * FROM discussion_review WHERE id = $1`
+		if err := global.Database.Get(&parent, sqlString, *request.ParentId); err != nil ||
+			parent.DiscussionId != discussion.ID {
+			c.String(http.StatusNotFound, "回复的评论不存在")
+			return
+		}
 	}
 	tx := global.Database.MustBegin()
-	sqlString = `INSERT INTO discussion_review (title, content, created_at, updated_at, discussion_id, user_id) 
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	sqlString = `INSERT INTO discussion_review (title, content, created_at, updated_at, discussion_id, user_id, parent_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 	var reviewId int
-	if err := global.Database.Get(&reviewId, sqlString, request.Title, request.Content, time.Now().Local(),
-		time.Now().Local(), request.DiscussionId, c.GetInt("UserId")); err != nil {
+	if err := tx.Get(&reviewId, sqlString, request.Title, request.Content, time.Now().Local(),
+		time.Now().Local(), request.DiscussionId, c.GetInt("UserId"), request.ParentId); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if reviewWords != nil {
+		if err := queueForReview(tx, ReportTargetDiscussionReview, reviewId, c.GetInt("UserId"), reviewWords); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
 	sqlString = `SELECT * FROM discussion_review WHERE id = $1`
 	var review model.DiscussionReview
-	if err := global.Database.Get(&review, sqlString, reviewId); err != nil {
+	if err := tx.Get(&review, sqlString, reviewId); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 只通知能查看讨论的被提及用户
+	mentioned, err := saveReviewMentions(tx, "discussion_review_mention", "discussion_review_id", review.ID, review.Content)
+	if err == nil {
+		mentioned, err = discussionMentionReaders(mentioned, &discussion)
+	}
+	if err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -84,28 +208,33 @@ func AddDiscussionReview(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	user := model.User{}
-	sqlString = `SELECT id, avatar_url, nick_name FROM "user" WHERE id = $1`
-	if err := global.Database.Get(&user, sqlString, discussion.UserId); err != nil {
+	response, err := newDiscussionReviewResponse(&review, c.GetInt("UserId"))
+	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	userInfo := UserInfoResponse{
-		UserId:     user.ID,
-		AvatarPath: user.AvatarURL,
-		NickName:   user.NickName,
-	}
-	c.JSON(http.StatusOK, DiscussionReviewResponse{
-		ID:           review.ID,
-		Title:        review.Title,
-		Content:      review.Content,
-		DiscussionId: review.DiscussionId,
-		UserInfo:     userInfo,
-		CreatedAt:    review.CreatedAt,
-		UpdatedAt:    review.UpdatedAt,
-		IsLiked:      false,
-		LikeCount:    0,
-	})
+	// 待审核的评论不发送通知和推送
+	if review.IsHidden {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	notified := map[int]bool{discussion.UserId: true}
+	CreateNotification(c, discussion.UserId, NotificationDiscussionReply, c.GetInt("UserId"), discussion.ID, discussion.Title)
+	if request.ParentId != nil && !notified[parent.UserId] {
+		notified[parent.UserId] = true
+		CreateNotification(c, parent.UserId, NotificationDiscussionReply, c.GetInt("UserId"), discussion.ID, discussion.Title)
+	}
+	notifyMentions(c, mentioned, notified, NotificationDiscussionMention, c.GetInt("UserId"), discussion.ID, discussion.Title)
+	// 公开的讨论推送给小组所有成员，非公开的讨论只有作者能看到回复
+	if discussion.IsPublic {
+		err = utils.PublishToGroup(c, discussion.GroupId, utils.PushDiscussionReview, &response)
+	} else {
+		err = utils.PublishToUser(c, discussion.UserId, utils.PushDiscussionReview, &response)
+	}
+	if err != nil {
+		log.Printf("推送讨论回复失败: %v", err)
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // RemoveDiscussionReview godoc
@@ -147,21 +276,40 @@ func RemoveDiscussionReview(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: ReportTargetDiscussionReview,
+		TargetId:   review.ID,
+		GroupId:    discussion.GroupId,
+		OwnerId:    review.UserId,
+		Before:     review,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
 // GetDiscussionReviews godoc
 // @Schemes http
-// @Description 获取评论列表
+// @Description 获取评论列表，按时间顺序分页返回第一层评论，每条评论按 depth 逐层展开前 reply_limit 条回复，
+// @Description 没有展开的回复可以通过 /discussion_review/replies/{id} 继续获取
 // @Tags DiscussionReview
 // @Param discussion_id query int true "讨论ID"
+// @Param offset query int false "第一层评论的偏移量"
+// @Param limit query int false "第一层评论的数量, 默认不限制"
+// @Param depth query int false "展开的层数, 默认为3, 最多为5"
+// @Param reply_limit query int false "每条评论展开的回复数, 默认为5, 最多为50"
 // @Success 200 {string} AllDiscussionReviewResponse "评论列表"
+// @Failure 400 {string} string "请求解析失败"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "讨论不存在"
 // @Failure default {string} string "服务器错误"
 // @Router /discussion_review/get [get]
 // @Security ApiKeyAuth
 func GetDiscussionReviews(c *gin.Context) {
+	query, ok := bindReviewThreadQuery(c)
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
 	var discussion model.Discussion
 	discussionId := c.Query("discussion_id")
 	sqlString := `SELECT * FROM discussion WHERE id = $1`
@@ -173,47 +321,168 @@ func GetDiscussionReviews(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
-	sqlString = `SELECT * FROM discussion_review WHERE discussion_id = $1`
-	var reviews []model.DiscussionReview
-	if err := global.Database.Select(&reviews, sqlString, discussionId); err != nil {
+	reviews, totalCount, err := getDiscussionReviewThread(discussion.ID, nil, query.Offset, query.Limit, query.Depth,
+		query.ReplyLimit, c.GetInt("UserId"))
+	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	var reviewResponses []DiscussionReviewResponse
-	for _, review := range reviews {
-		user := model.User{}
-		sqlString = `SELECT id, avatar_url, nick_name FROM "user" WHERE id = $1`
-		if err := global.Database.Get(&user, sqlString, review.UserId); err != nil {
-			c.String(http.StatusInternalServerError, "服务器错误")
-			return
-		}
-		userInfo := UserInfoResponse{
-			UserId:     user.ID,
-			AvatarPath: user.AvatarURL,
-			NickName:   user.NickName,
-		}
-		sqlString = `SELECT count(*) FROM user_like_discussion_review WHERE discussion_review_id = $1 AND user_id = $2`
-		var isLiked int
-		if err := global.Database.Get(&isLiked, sqlString, review.ID, c.GetInt("UserId")); err != nil {
+	c.JSON(http.StatusOK, AllDiscussionReviewResponse{
+		TotalCount:        totalCount,
+		DiscussionReviews: reviews,
+	})
+}
+
+// GetDiscussionReviewReplies godoc
+// @Schemes http
+// @Description 分页获取一条评论下的回复，每条回复按 depth 逐层展开前 reply_limit 条回复
+// @Tags DiscussionReview
+// @Param id path int true "评论ID"
+// @Param offset query int false "回复的偏移量"
+// @Param limit query int false "回复的数量, 默认不限制"
+// @Param depth query int false "展开的层数, 默认为3, 最多为5"
+// @Param reply_limit query int false "每条回复展开的回复数, 默认为5, 最多为50"
+// @Success 200 {string} AllDiscussionReviewResponse "回复列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "评论不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /discussion_review/replies/{id} [get]
+// @Security ApiKeyAuth
+func GetDiscussionReviewReplies(c *gin.Context) {
+	query, ok := bindReviewThreadQuery(c)
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM discussion_review WHERE id = $1`
+	var review model.DiscussionReview
+	if err := global.Database.Get(&review, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "评论不存在")
+		return
+	}
+	sqlString = `SELECT * FROM discussion WHERE id = $1`
+	var discussion model.Discussion
+	if err := global.Database.Get(&discussion, sqlString, review.DiscussionId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && !discussion.IsPublic {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	replies, totalCount, err := getDiscussionReviewThread(discussion.ID, &review.ID, query.Offset, query.Limit,
+		query.Depth, query.ReplyLimit, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllDiscussionReviewResponse{
+		TotalCount:        totalCount,
+		DiscussionReviews: replies,
+	})
+}
+
+// UpdateDiscussionReview godoc
+// @Schemes http
+// @Description 修改评论（只有评论的作者可以修改），修改后新 @ 到的用户会收到通知
+// @Tags DiscussionReview
+// @Param id path int true "评论ID"
+// @Param review body DiscussionReviewUpdateRequest true "修改的评论信息"
+// @Success 200 {object} DiscussionReviewResponse "评论信息"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "评论不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /discussion_review/update/{id} [put]
+// @Security ApiKeyAuth
+func UpdateDiscussionReview(c *gin.Context) {
+	var request DiscussionReviewUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM discussion_review WHERE id = $1`
+	var review model.DiscussionReview
+	if err := global.Database.Get(&review, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "评论不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && review.UserId != c.GetInt("UserId") {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	reviewWords, ok := filterSensitiveWords(c, true, request.Title, request.Content)
+	if !ok {
+		return
+	}
+	sqlString = `SELECT * FROM discussion WHERE id = $1`
+	var discussion model.Discussion
+	if err := global.Database.Get(&discussion, sqlString, review.DiscussionId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	before := review
+	if request.Title != nil {
+		review.Title = *request.Title
+	}
+	if request.Content != nil {
+		review.Content = *request.Content
+	}
+	tx := global.Database.MustBegin()
+	sqlString = `UPDATE discussion_review SET title = $1, content = $2, updated_at = $3 WHERE id = $4 RETURNING *`
+	if err := tx.Get(&review, sqlString, review.Title, review.Content, time.Now().Local(), review.ID); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if reviewWords != nil {
+		if err := queueForReview(tx, ReportTargetDiscussionReview, review.ID, review.UserId, reviewWords); err != nil {
+			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
-		reviewResponses = append(reviewResponses, DiscussionReviewResponse{
-			ID:           review.ID,
-			Title:        review.Title,
-			Content:      review.Content,
-			DiscussionId: review.DiscussionId,
-			UserInfo:     userInfo,
-			CreatedAt:    review.CreatedAt,
-			UpdatedAt:    review.UpdatedAt,
-			IsLiked:      isLiked > 0,
-			LikeCount:    review.LikeCount,
+		review.IsHidden = true
+	}
+	// 只通知能查看讨论的被提及用户
+	mentioned, err := saveReviewMentions(tx, "discussion_review_mention", "discussion_review_id", review.ID, review.Content)
+	if err == nil {
+		mentioned, err = discussionMentionReaders(mentioned, &discussion)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if isAdminOverride(c, review.UserId) {
+		recordAudit(c, auditEvent{
+			Action:     AuditActionUpdate,
+			TargetType: ReportTargetDiscussionReview,
+			TargetId:   review.ID,
+			GroupId:    discussion.GroupId,
+			OwnerId:    review.UserId,
+			Before:     before,
+			After:      review,
 		})
 	}
-	c.JSON(http.StatusOK, AllDiscussionReviewResponse{
-		TotalCount:        len(reviewResponses),
-		DiscussionReviews: reviewResponses,
-	})
+	if !review.IsHidden {
+		notifyMentions(c, mentioned, map[int]bool{}, NotificationDiscussionMention, c.GetInt("UserId"), discussion.ID,
+			discussion.Title)
+	}
+	response, err := newDiscussionReviewResponse(&review, c.GetInt("UserId"))
+	if err == nil {
+		sqlString = `SELECT count(*) FROM discussion_review WHERE parent_id = $1 AND (is_hidden = false OR user_id = $2)`
+		err = global.Database.Get(&response.ReplyCount, sqlString, review.ID, c.GetInt("UserId"))
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // LikeDiscussionReview godoc
@@ -1,12 +1,15 @@
 package api
 
 import (
+	"database/sql"
+	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"kayak-backend/global"
 	"kayak-backend/model"
 	"kayak-backend/utils"
 	"net/http"
+	"strconv"
 	"time"
 )
 
@@ -23,16 +26,18 @@ type GroupFilter struct {
 	AreaId  *int `json:"area_id" form:"area_id"`
 }
 type GroupResponse struct {
-	Id          int              `json:"id"`
-	Name        string           `json:"name"`
-	Description string           `json:"description"`
-	Invitation  string           `json:"invitation"`
-	UserId      int              `json:"owner_id"`
-	UserInfo    UserInfoResponse `json:"user_info"`
-	MemberCount int              `json:"member_count"`
-	CreatedAt   time.Time        `json:"created_at"`
-	AreaName    string           `json:"area_name"`
-	AvatarURL   string           `json:"avatar_url"`
+	Id             int              `json:"id"`
+	Name           string           `json:"name"`
+	Description    string           `json:"description"`
+	Invitation     string           `json:"invitation"`
+	UserId         int              `json:"owner_id"`
+	UserInfo       UserInfoResponse `json:"user_info"`
+	MemberCount    int              `json:"member_count"`
+	CreatedAt      time.Time        `json:"created_at"`
+	AreaName       string           `json:"area_name"`
+	AvatarURL      string           `json:"avatar_url"`
+	JoinPolicy     string           `json:"join_policy"`
+	EntryQuestions []string         `json:"entry_questions"`
 }
 type GroupCreateRequest struct {
 	Name        string `json:"name"`
@@ -104,15 +109,17 @@ func GetGroups(c *gin.Context) {
 			return
 		}
 		groupResponses = append(groupResponses, GroupResponse{
-			Id:          group.Id,
-			Name:        group.Name,
-			Description: group.Description,
-			UserId:      group.UserId,
-			UserInfo:    userInfo,
-			MemberCount: count,
-			CreatedAt:   group.CreatedAt,
-			AreaName:    area,
-			AvatarURL:   group.AvatarURL,
+			Id:             group.Id,
+			Name:           group.Name,
+			Description:    group.Description,
+			UserId:         group.UserId,
+			UserInfo:       userInfo,
+			MemberCount:    count,
+			CreatedAt:      group.CreatedAt,
+			AreaName:       area,
+			AvatarURL:      group.AvatarURL,
+			JoinPolicy:     group.JoinPolicy,
+			EntryQuestions: parseEntryQuestions(group.EntryQuestions),
 		})
 	}
 	c.JSON(http.StatusOK, AllGroupResponse{
@@ -127,7 +134,7 @@ func GetGroups(c *gin.Context) {
 // @Tags Group
 // @Param group body GroupCreateRequest true "小组信息"
 // @Success 200 {object} GroupResponse "小组信息"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure default {string} string "服务器错误"
 // @Router /group/create [post]
 // @Security ApiKeyAuth
@@ -137,6 +144,9 @@ func CreateGroup(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	if _, ok := filterSensitiveWords(c, false, &request.Name, &request.Description); !ok {
+		return
+	}
 	if request.AreaId == nil {
 		request.AreaId = new(int)
 		*request.AreaId = 100
@@ -166,20 +176,22 @@ func CreateGroup(c *gin.Context) {
 		return
 	}
 	c.JSON(http.StatusOK, GroupResponse{
-		Id:          group.Id,
-		Name:        group.Name,
-		Description: group.Description,
-		Invitation:  group.Invitation,
-		UserId:      group.UserId,
-		CreatedAt:   group.CreatedAt,
-		AreaName:    area,
-		AvatarURL:   group.AvatarURL,
+		Id:             group.Id,
+		Name:           group.Name,
+		Description:    group.Description,
+		Invitation:     group.Invitation,
+		UserId:         group.UserId,
+		CreatedAt:      group.CreatedAt,
+		AreaName:       area,
+		AvatarURL:      group.AvatarURL,
+		JoinPolicy:     group.JoinPolicy,
+		EntryQuestions: parseEntryQuestions(group.EntryQuestions),
 	})
 }
 
 // GetGroupInvitation godoc
 // @Schemes http
-// @Description 获取小组邀请码
+// @Description 获取小组的旧版永久邀请码，新的邀请码请使用 /group_invitation 相关接口管理
 // @Tags Group
 // @Param id path int true "小组id"
 // @Success 200 {string} string "邀请码"
@@ -208,7 +220,7 @@ func GetGroupInvitation(c *gin.Context) {
 
 // DeleteGroup godoc
 // @Schemes http
-// @Description 删除小组
+// @Description 删除小组（只有组长可以删除）
 // @Tags Group
 // @Param id path int true "小组ID"
 // @Success 200 {string} string "删除成功"
@@ -218,18 +230,18 @@ func GetGroupInvitation(c *gin.Context) {
 // @Router /group/delete/{id} [delete]
 // @Security ApiKeyAuth
 func DeleteGroup(c *gin.Context) {
-	sqlString := `SELECT user_id FROM "group" WHERE id = $1`
-	var groupUserId int
-	if err := global.Database.Get(&groupUserId, sqlString, c.Param("id")); err != nil {
+	var group model.Group
+	sqlString := `SELECT * FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&group, sqlString, c.Param("id")); err != nil {
 		c.String(http.StatusNotFound, "小组不存在")
 		return
 	}
-	if role, _ := c.Get("Role"); groupUserId != c.GetInt("UserId") && role != global.ADMIN {
+	if role, _ := c.Get("Role"); group.UserId != c.GetInt("UserId") && role != global.ADMIN {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
 	tx := global.Database.MustBegin()
-	// 删除小组成员关系
+	// 删除小组成员关系和入组申请
 	sqlString = `DELETE FROM group_member WHERE group_id = $1`
 	if _, err := tx.Exec(sqlString, c.Param("id")); err != nil {
 		if err := tx.Rollback(); err != nil {
@@ -239,6 +251,15 @@ func DeleteGroup(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	sqlString = `DELETE FROM group_application WHERE group_id = $1`
+	if _, err := tx.Exec(sqlString, c.Param("id")); err != nil {
+		if err := tx.Rollback(); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	sqlString = `DELETE FROM "group" WHERE id = $1`
 	if _, err := tx.Exec(sqlString, c.Param("id")); err != nil {
 		if err := tx.Rollback(); err != nil {
@@ -252,12 +273,22 @@ func DeleteGroup(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: AuditTargetGroup,
+		TargetId:   group.Id,
+		GroupId:    group.Id,
+		OwnerId:    group.UserId,
+		Before:     group,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
 type AllUserResponse struct {
 	TotalCount int                `json:"total_count"`
 	User       []UserInfoResponse `json:"user"`
+	OwnerId    int                `json:"owner_id"`
+	AdminIds   []int              `json:"admin_ids"`
 }
 
 // GetUsersInGroup godoc
@@ -295,40 +326,86 @@ func GetUsersInGroup(c *gin.Context) {
 			NickName:   user.NickName,
 		})
 	}
+	adminIds := make([]int, 0)
+	sqlString = `SELECT user_id FROM group_member WHERE group_id = $1 AND is_admin = true AND is_owner = false`
+	if err := global.Database.Select(&adminIds, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	c.JSON(http.StatusOK, AllUserResponse{
 		TotalCount: len(userResponses),
 		User:       userResponses,
+		OwnerId:    groupUserId,
+		AdminIds:   adminIds,
 	})
 }
 
 // RemoveUserFromGroup godoc
 // @Schemes http
-// @Description 从小组移除用户
+// @Description 从小组移除用户，组长可以移除管理员和普通成员，管理员只能移除普通成员，组长不能被移除
 // @Tags Group
 // @Param id path int true "小组ID"
 // @Param user_id query int true "用户ID"
 // @Success 200 {string} string "移除成功"
-// @Failure 403 {string} string "没有权限"
-// @Failure 404 {string} string "小组不存在"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"/"不能移除组长"
+// @Failure 404 {string} string "小组不存在"/"用户未加入此小组"
 // @Failure default {string} string "服务器错误"
 // @Router /group/remove/{id} [delete]
 // @Security ApiKeyAuth
 func RemoveUserFromGroup(c *gin.Context) {
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	userId, err := strconv.Atoi(c.Query("user_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
 	sqlString := `SELECT user_id FROM "group" WHERE id = $1`
 	var groupUserId int
-	if err := global.Database.Get(&groupUserId, sqlString, c.Param("id")); err != nil {
+	if err := global.Database.Get(&groupUserId, sqlString, groupId); err != nil {
 		c.String(http.StatusNotFound, "小组不存在")
 		return
 	}
-	if role, _ := c.Get("Role"); groupUserId != c.GetInt("UserId") && role != global.ADMIN {
-		c.String(http.StatusForbidden, "没有权限")
+	target, err := getGroupMember(groupId, userId)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "用户未加入此小组")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if target.IsOwner {
+		c.String(http.StatusForbidden, "不能移除组长")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		operator, err := getGroupMember(groupId, c.GetInt("UserId"))
+		if err != nil && err != sql.ErrNoRows {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if err == sql.ErrNoRows || !operator.IsOwner && (!operator.IsAdmin || target.IsAdmin) {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
 	sqlString = `DELETE FROM group_member WHERE user_id = $1 AND group_id = $2`
-	if _, err := global.Database.Exec(sqlString, c.Query("user_id"), c.Param("id")); err != nil {
+	if _, err := global.Database.Exec(sqlString, userId, groupId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionMemberRemove,
+		TargetType: AuditTargetGroupMember,
+		TargetId:   userId,
+		GroupId:    groupId,
+		OwnerId:    groupUserId,
+		Before:     target,
+	})
 	c.String(http.StatusOK, "移除成功")
 }
 
@@ -339,7 +416,7 @@ func RemoveUserFromGroup(c *gin.Context) {
 // @Param id path int true "小组ID"
 // @Success 200 {string} string "退出成功"
 // @Failure 404 {string} string "小组不存在或用户未加入此小组"
-// @Failure 403 {string} string "创建者不能退出创建的小组"
+// @Failure 403 {string} string "组长需要先转让小组才能退出"
 // @Failure default {string} string "服务器错误"
 // @Router /group/quit/{id} [delete]
 // @Security ApiKeyAuth
@@ -356,7 +433,7 @@ func QuitGroup(c *gin.Context) {
 		c.String(http.StatusNotFound, "小组不存在或用户未加入此小组")
 		return
 	}
-	// 如果是创建者，自己不能退出
+	// 组长需要先转让小组或者删除小组，不能直接退出
 	sqlString = `SELECT user_id FROM "group" WHERE id = $1`
 	var groupUserId int
 	if err := global.Database.Get(&groupUserId, sqlString, groupId); err != nil {
@@ -364,22 +441,33 @@ func QuitGroup(c *gin.Context) {
 		return
 	}
 	if groupUserId == userId {
-		c.String(http.StatusForbidden, "创建者不能退出创建的小组")
+		c.String(http.StatusForbidden, "组长需要先转让小组才能退出")
 		return
 	}
-	sqlString = `DELETE FROM group_member WHERE user_id = $1 AND group_id = $2`
-	if _, err := global.Database.Exec(sqlString, userId, groupId); err != nil {
+	var member model.GroupMember
+	sqlString = `DELETE FROM group_member WHERE user_id = $1 AND group_id = $2 RETURNING *`
+	if err := global.Database.Get(&member, sqlString, userId, groupId); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionMemberQuit,
+		TargetType: AuditTargetGroupMember,
+		TargetId:   userId,
+		GroupId:    member.GroupId,
+		Before:     member,
+	})
 	c.String(http.StatusOK, "退出成功")
 }
 
 type UpdateGroupInfoRequest struct {
-	Name        *string `json:"name"`
-	Description *string `json:"description"`
-	Invitation  *string `json:"invitation"`
-	AreaId      *int    `json:"area_id"`
+	Name           *string   `json:"name"`
+	Description    *string   `json:"description"`
+	Invitation     *string   `json:"invitation"`
+	AreaId         *int      `json:"area_id"`
+	JoinPolicy     *string   `json:"join_policy"`
+	EntryQuestions *[]string `json:"entry_questions"`
+	ApplicationTTL *int      `json:"application_ttl"`
 }
 
 // UpdateGroupInfo godoc
@@ -387,8 +475,9 @@ type UpdateGroupInfoRequest struct {
 // @Description 编辑小组信息
 // @Tags Group
 // @Param id path int true "小组ID"
-// @Param group body UpdateGroupInfoRequest true "编辑信息，如果希望不改变的字段传入原值"
+// @Param group body UpdateGroupInfoRequest true "编辑信息，不传的字段保持不变；加入方式可选 open/approval/invite_only/closed，入组问题最多5个，申请有效天数为0时不过期"
 // @Success 200 {string} string "编辑成功"
+// @Failure 400 {string} string "参数错误"/"内容包含敏感词"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "小组不存在"
 // @Failure default {string} string "服务器错误"
@@ -410,6 +499,9 @@ func UpdateGroupInfo(c *gin.Context) {
 		c.String(http.StatusBadRequest, "参数错误")
 		return
 	}
+	if _, ok := filterSensitiveWords(c, false, request.Name, request.Description); !ok {
+		return
+	}
 	if request.Name == nil {
 		request.Name = &group.Name
 	}
@@ -422,27 +514,64 @@ func UpdateGroupInfo(c *gin.Context) {
 	if request.AreaId == nil {
 		request.AreaId = &group.AreaId
 	}
-	sqlString = `UPDATE "group" SET name = $1, description = $2, invitation = $3, area_id = $4 WHERE id = $5`
-	if _, err := global.Database.Exec(sqlString, request.Name, request.Description,
-		request.Invitation, request.AreaId, c.Param("id")); err != nil {
+	if request.JoinPolicy == nil {
+		request.JoinPolicy = &group.JoinPolicy
+	}
+	entryQuestions := group.EntryQuestions
+	if request.EntryQuestions != nil {
+		if !validateEntryQuestions(*request.EntryQuestions) {
+			c.String(http.StatusBadRequest, "参数错误")
+			return
+		}
+		raw, _ := json.Marshal(*request.EntryQuestions)
+		entryQuestions = string(raw)
+	}
+	if request.ApplicationTTL == nil {
+		request.ApplicationTTL = &group.ApplicationTTL
+	}
+	if !isGroupJoinPolicy(*request.JoinPolicy) || *request.ApplicationTTL < 0 {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	sqlString = `UPDATE "group" SET name = $1, description = $2, invitation = $3, area_id = $4, join_policy = $5,
+		entry_questions = $6, application_ttl = $7 WHERE id = $8`
+	if _, err := global.Database.Exec(sqlString, request.Name, request.Description, request.Invitation,
+		request.AreaId, request.JoinPolicy, entryQuestions, request.ApplicationTTL, c.Param("id")); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if isAdminOverride(c, group.UserId) {
+		var updated model.Group
+		if err := global.Database.Get(&updated, `SELECT * FROM "group" WHERE id = $1`, group.Id); err == nil {
+			recordAudit(c, auditEvent{
+				Action:     AuditActionUpdate,
+				TargetType: AuditTargetGroup,
+				TargetId:   group.Id,
+				GroupId:    group.Id,
+				OwnerId:    group.UserId,
+				Before:     group,
+				After:      updated,
+			})
+		}
+	}
 	c.String(http.StatusOK, "编辑成功")
 }
 
 type ApplyToJoinGroupRequest struct {
-	Message *string `json:"message"`
-	GroupId int     `json:"group_id"`
+	Message *string  `json:"message"`
+	GroupId int      `json:"group_id"`
+	Answers []string `json:"answers"`
 }
 
 // ApplyToJoinGroup godoc
 // @Schemes http
-// @Description 申请加入小组
+// @Description 申请加入小组，open 的小组直接加入，approval 的小组需要按顺序回答所有入组问题并等待审核，
+// @Description invite_only 和 closed 的小组不能申请
 // @Tags Group
 // @Param apply body ApplyToJoinGroupRequest true "申请信息"
-// @Success 200 {string} string "申请成功"
-// @Failure 403 {string} string "已经加入此小组或已经申请过"
+// @Success 200 {string} string "申请成功"/"加入成功"
+// @Failure 400 {string} string "请回答所有入组问题"
+// @Failure 403 {string} string "已经加入此小组或已经申请过"/"该小组只能通过邀请加入"/"该小组不接受新成员"
 // @Failure 404 {string} string "小组不存在"
 // @Failure default {string} string "服务器错误"
 // @Router /group/apply [post]
@@ -459,6 +588,14 @@ func ApplyToJoinGroup(c *gin.Context) {
 		c.String(http.StatusNotFound, "小组不存在")
 		return
 	}
+	switch group.JoinPolicy {
+	case GroupJoinInviteOnly:
+		c.String(http.StatusForbidden, "该小组只能通过邀请加入")
+		return
+	case GroupJoinClosed:
+		c.String(http.StatusForbidden, "该小组不接受新成员")
+		return
+	}
 	userId := c.GetInt("UserId")
 	sqlString = `SELECT count(*) FROM group_member WHERE user_id = $1 AND group_id = $2`
 	var count int
@@ -479,8 +616,23 @@ func ApplyToJoinGroup(c *gin.Context) {
 		c.String(http.StatusForbidden, "已经加入此小组或已经申请过")
 		return
 	}
-	sqlString = `INSERT INTO group_application (user_id, group_id, message, status, created_at) VALUES ($1, $2, $3, $4, $5)`
-	if _, err := global.Database.Exec(sqlString, userId, request.GroupId, request.Message, Pending, time.Now()); err != nil {
+	if group.JoinPolicy == GroupJoinOpen {
+		sqlString = `INSERT INTO group_member (user_id, group_id, is_admin, is_owner, created_at) VALUES ($1, $2, false, false, $3)`
+		if _, err := global.Database.Exec(sqlString, userId, request.GroupId, time.Now()); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		recordMemberJoin(c, request.GroupId, userId)
+		c.String(http.StatusOK, "加入成功")
+		return
+	}
+	answers, ok := buildEntryAnswers(&group, request.Answers)
+	if !ok {
+		c.String(http.StatusBadRequest, "请回答所有入组问题")
+		return
+	}
+	sqlString = `INSERT INTO group_application (user_id, group_id, message, answers, status, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	if _, err := global.Database.Exec(sqlString, userId, request.GroupId, request.Message, answers, Pending, time.Now()); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
@@ -490,6 +642,7 @@ func ApplyToJoinGroup(c *gin.Context) {
 type GroupApplicationEntry struct {
 	Application model.GroupApplication `json:"application"`
 	UserInfo    UserInfoResponse       `json:"user_info"`
+	Answers     []GroupEntryAnswer     `json:"answers"`
 }
 
 type GroupApplicationResponse struct {
@@ -576,6 +729,7 @@ func GetGroupApplication(c *gin.Context) {
 				Email:      user.Email,
 				Phone:      user.Phone,
 			},
+			Answers: parseEntryAnswers(application.Answers),
 		})
 	}
 	c.JSON(http.StatusOK, response)
@@ -625,19 +779,214 @@ func HandleGroupApplication(c *gin.Context) {
 		c.String(http.StatusBadRequest, "该申请已被处理")
 		return
 	}
-	// 更新申请状态
-	sqlString = `UPDATE group_application SET status = $1 WHERE id = $2`
-	if _, err := global.Database.Exec(sqlString, handleRequest.Status, handleRequest.ApplicationId); err != nil {
+	if handleRequest.Status != Accepted && handleRequest.Status != Rejected {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	reason := "已被拒绝"
+	if handleRequest.Status == Accepted {
+		reason = "已通过"
+	}
+	handled, err := handleGroupApplication(c, &application, handleRequest.Status, c.GetInt("UserId"), reason)
+	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	// 如果申请被通过, 则添加用户到小组成员列表
+	if !handled {
+		c.String(http.StatusBadRequest, "该申请已被处理")
+		return
+	}
 	if handleRequest.Status == Accepted {
-		sqlString = `INSERT INTO group_member (user_id, group_id, is_admin, is_owner, created_at) VALUES ($1, $2, false, false, $3)`
-		if _, err := global.Database.Exec(sqlString, application.UserId, application.GroupId, time.Now()); err != nil {
+		recordMemberJoin(c, application.GroupId, application.UserId)
+	}
+	c.String(http.StatusOK, "处理成功")
+}
+
+func getGroupMember(groupId int, userId int) (*model.GroupMember, error) {
+	var member model.GroupMember
+	sqlString := `SELECT * FROM group_member WHERE group_id = $1 AND user_id = $2`
+	if err := global.Database.Get(&member, sqlString, groupId, userId); err != nil {
+		return nil, err
+	}
+	return &member, nil
+}
+
+type GroupAdminRequest struct {
+	UserId  int  `json:"user_id" binding:"required"`
+	IsAdmin bool `json:"is_admin"`
+}
+
+// SetGroupAdmin godoc
+// @Schemes http
+// @Description 设置或取消小组管理员（只有组长可以操作），组长本身不能被设置
+// @Tags Group
+// @Param id path int true "小组ID"
+// @Param admin body GroupAdminRequest true "用户ID和是否为管理员"
+// @Success 200 {string} string "设置成功"
+// @Failure 400 {string} string "请求解析失败"/"不能修改组长的权限"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "小组不存在"/"用户未加入此小组"
+// @Failure default {string} string "服务器错误"
+// @Router /group/admin/{id} [put]
+// @Security ApiKeyAuth
+func SetGroupAdmin(c *gin.Context) {
+	var request GroupAdminRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var group model.Group
+	sqlString := `SELECT * FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&group, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "小组不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); group.UserId != c.GetInt("UserId") && role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	member, err := getGroupMember(group.Id, request.UserId)
+	if err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "用户未加入此小组")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if member.IsOwner {
+		c.String(http.StatusBadRequest, "不能修改组长的权限")
+		return
+	}
+	var updated model.GroupMember
+	sqlString = `UPDATE group_member SET is_admin = $1 WHERE group_id = $2 AND user_id = $3 RETURNING *`
+	if err := global.Database.Get(&updated, sqlString, request.IsAdmin, group.Id, request.UserId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionMemberRole,
+		TargetType: AuditTargetGroupMember,
+		TargetId:   request.UserId,
+		GroupId:    group.Id,
+		OwnerId:    group.UserId,
+		Before:     member,
+		After:      updated,
+	})
+	if member.IsAdmin != request.IsAdmin {
+		content := "你已被设置为小组「" + group.Name + "」的管理员"
+		if !request.IsAdmin {
+			content = "你已不再是小组「" + group.Name + "」的管理员"
+		}
+		CreateNotification(c, request.UserId, NotificationGroupRole, c.GetInt("UserId"), group.Id, content)
+	}
+	c.String(http.StatusOK, "设置成功")
+}
+
+type GroupTransferRequest struct {
+	UserId int `json:"user_id" binding:"required"`
+}
+
+// TransferGroup godoc
+// @Schemes http
+// @Description 将小组转让给另一名成员（只有组长可以操作），新组长同时成为管理员，原组长保留管理员身份
+// @Tags Group
+// @Param id path int true "小组ID"
+// @Param transfer body GroupTransferRequest true "新组长的用户ID"
+// @Success 200 {string} string "转让成功"
+// @Failure 400 {string} string "请求解析失败"/"该用户已经是组长"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "小组不存在"/"用户未加入此小组"
+// @Failure default {string} string "服务器错误"
+// @Router /group/transfer/{id} [put]
+// @Security ApiKeyAuth
+func TransferGroup(c *gin.Context) {
+	var request GroupTransferRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var group model.Group
+	sqlString := `SELECT * FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&group, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "小组不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); group.UserId != c.GetInt("UserId") && role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if request.UserId == group.UserId {
+		c.String(http.StatusBadRequest, "该用户已经是组长")
+		return
+	}
+	if _, err := getGroupMember(group.Id, request.UserId); err == sql.ErrNoRows {
+		c.String(http.StatusNotFound, "用户未加入此小组")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	tx := global.Database.MustBegin()
+	// 锁住小组后重新检查组长，避免并发转让时已经不是组长的用户再次转让
+	var ownerId int
+	sqlString = `SELECT user_id FROM "group" WHERE id = $1 FOR UPDATE`
+	if err := tx.Get(&ownerId, sqlString, group.Id); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if role, _ := c.Get("Role"); ownerId != c.GetInt("UserId") && role != global.ADMIN {
+		_ = tx.Rollback()
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if ownerId == request.UserId {
+		_ = tx.Rollback()
+		c.String(http.StatusBadRequest, "该用户已经是组长")
+		return
+	}
+	group.UserId = ownerId
+	sqlString = `UPDATE group_member SET is_owner = false, is_admin = true WHERE group_id = $1 AND is_owner = true`
+	if _, err := tx.Exec(sqlString, group.Id); err != nil {
+		if err := tx.Rollback(); err != nil {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
 	}
-	c.String(http.StatusOK, "处理成功")
+	sqlString = `UPDATE group_member SET is_owner = true, is_admin = true WHERE group_id = $1 AND user_id = $2`
+	if _, err := tx.Exec(sqlString, group.Id, request.UserId); err != nil {
+		if err := tx.Rollback(); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `UPDATE "group" SET user_id = $1 WHERE id = $2`
+	if _, err := tx.Exec(sqlString, request.UserId, group.Id); err != nil {
+		if err := tx.Rollback(); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionGroupTransfer,
+		TargetType: AuditTargetGroup,
+		TargetId:   group.Id,
+		GroupId:    group.Id,
+		OwnerId:    group.UserId,
+		Before:     map[string]int{"owner_id": group.UserId},
+		After:      map[string]int{"owner_id": request.UserId},
+	})
+	CreateNotification(c, request.UserId, NotificationGroupRole, c.GetInt("UserId"), group.Id,
+		"小组「"+group.Name+"」已转让给你")
+	c.String(http.StatusOK, "转让成功")
 }
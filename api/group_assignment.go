@@ -0,0 +1,897 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	AnswerVisibleAfterSubmit   = "after_submit"
+	AnswerVisibleAfterDeadline = "after_deadline"
+	AnswerVisibleNever         = "never"
+)
+
+const (
+	AssignmentNotStarted = "not_started"
+	AssignmentPending    = "pending"
+	AssignmentCompleted  = "completed"
+	AssignmentOverdue    = "overdue"
+)
+
+type GroupAssignmentCreateRequest struct {
+	GroupId      int        `json:"group_id" binding:"required"`
+	ProblemSetId int        `json:"problem_set_id" binding:"required"`
+	Title        string     `json:"title" binding:"required"`
+	Description  string     `json:"description"`
+	StartTime    *time.Time `json:"start_time"`
+	Deadline     time.Time  `json:"deadline" binding:"required"`
+	// MaxAttempts 每个成员最多提交的次数，0表示不限制
+	MaxAttempts      int    `json:"max_attempts"`
+	AnswerVisibility string `json:"answer_visibility"`
+}
+
+type GroupAssignmentUpdateRequest struct {
+	ID               int        `json:"id" binding:"required"`
+	Title            *string    `json:"title"`
+	Description      *string    `json:"description"`
+	StartTime        *time.Time `json:"start_time"`
+	Deadline         *time.Time `json:"deadline"`
+	MaxAttempts      *int       `json:"max_attempts"`
+	AnswerVisibility *string    `json:"answer_visibility"`
+}
+
+type GroupAssignmentResponse struct {
+	ID               int              `json:"id"`
+	GroupId          int              `json:"group_id"`
+	ProblemSetId     int              `json:"problem_set_id"`
+	CreatorInfo      UserInfoResponse `json:"creator_info"`
+	Title            string           `json:"title"`
+	Description      string           `json:"description"`
+	StartTime        time.Time        `json:"start_time"`
+	Deadline         time.Time        `json:"deadline"`
+	MaxAttempts      int              `json:"max_attempts"`
+	AnswerVisibility string           `json:"answer_visibility"`
+	ProblemCount     int              `json:"problem_count"`
+	Status           string           `json:"status"`
+	AttemptCount     int              `json:"attempt_count"`
+	BestScore        *int             `json:"best_score"`
+	CreatedAt        time.Time        `json:"created_at"`
+	UpdatedAt        time.Time        `json:"updated_at"`
+}
+
+type AllGroupAssignmentResponse struct {
+	TotalCount  int                       `json:"total_count"`
+	Assignments []GroupAssignmentResponse `json:"assignments"`
+}
+
+type GroupAssignmentFilter struct {
+	GroupId int  `json:"group_id" form:"group_id" binding:"required"`
+	Offset  *int `json:"offset" form:"offset"`
+	Limit   *int `json:"limit" form:"limit"`
+}
+
+type AssignmentAnswer struct {
+	ProblemId int    `json:"problem_id"`
+	Answer    string `json:"answer"`
+}
+
+type GroupAssignmentSubmitRequest struct {
+	Answers []AssignmentAnswer `json:"answers" binding:"required"`
+	// TimeSpent 本次作答用时（秒）
+	TimeSpent int `json:"time_spent"`
+}
+
+type AssignmentProblemResult struct {
+	ProblemId     int     `json:"problem_id"`
+	Answer        string  `json:"answer"`
+	IsCorrect     bool    `json:"is_correct"`
+	CorrectAnswer *string `json:"correct_answer,omitempty"`
+}
+
+type GroupAssignmentSubmissionResponse struct {
+	ID           int                       `json:"id"`
+	Attempt      int                       `json:"attempt"`
+	Score        int                       `json:"score"`
+	CorrectCount int                       `json:"correct_count"`
+	TotalCount   int                       `json:"total_count"`
+	TimeSpent    int                       `json:"time_spent"`
+	SubmittedAt  time.Time                 `json:"submitted_at"`
+	Results      []AssignmentProblemResult `json:"results"`
+}
+
+type GroupAssignmentMatrixRow struct {
+	UserInfo        UserInfoResponse `json:"user_info"`
+	Status          string           `json:"status"`
+	AttemptCount    int              `json:"attempt_count"`
+	BestScore       *int             `json:"best_score"`
+	TimeSpent       int              `json:"time_spent"`
+	LastSubmittedAt *time.Time       `json:"last_submitted_at"`
+}
+
+type GroupAssignmentMatrixResponse struct {
+	Assignment GroupAssignmentResponse    `json:"assignment"`
+	Members    []GroupAssignmentMatrixRow `json:"members"`
+}
+
+func isAnswerVisibility(visibility string) bool {
+	return visibility == AnswerVisibleAfterSubmit || visibility == AnswerVisibleAfterDeadline ||
+		visibility == AnswerVisibleNever
+}
+
+// canSeeAssignmentAnswers 判断成员提交后能否看到正确答案，小组管理员总是可以看到
+func canSeeAssignmentAnswers(assignment *model.GroupAssignment, isAdmin bool) bool {
+	switch {
+	case isAdmin:
+		return true
+	case assignment.AnswerVisibility == AnswerVisibleAfterSubmit:
+		return true
+	case assignment.AnswerVisibility == AnswerVisibleAfterDeadline:
+		return time.Now().After(assignment.Deadline)
+	}
+	return false
+}
+
+// assignmentHidesAnswers 判断题目是否属于用户所在小组中还不能查看答案的作业，用户是小组管理员的小组不受限制。
+// 提交后可见的作业需要用户已经提交过，截止后可见的作业需要已经截止
+func assignmentHidesAnswers(problemId int, userId int) (bool, error) {
+	var assignments []model.GroupAssignment
+	sqlString := `SELECT group_assignment.* FROM group_assignment
+		JOIN problem_in_problem_set ON problem_in_problem_set.problem_set_id = group_assignment.problem_set_id
+		JOIN group_member ON group_member.group_id = group_assignment.group_id
+		WHERE problem_in_problem_set.problem_id = $1 AND group_member.user_id = $2
+		AND group_member.is_admin = false AND group_member.is_owner IS NOT TRUE`
+	if err := global.Database.Select(&assignments, sqlString, problemId, userId); err != nil {
+		return false, err
+	}
+	for i := range assignments {
+		if !canSeeAssignmentAnswers(&assignments[i], false) {
+			return true, nil
+		}
+		if assignments[i].AnswerVisibility != AnswerVisibleAfterSubmit {
+			continue
+		}
+		var submitted bool
+		sqlString = `SELECT EXISTS (SELECT 1 FROM group_assignment_submission WHERE assignment_id = $1 AND user_id = $2)`
+		if err := global.Database.Get(&submitted, sqlString, assignments[i].ID, userId); err != nil {
+			return false, err
+		}
+		if !submitted {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func getAssignmentStatus(assignment *model.GroupAssignment, attemptCount int) string {
+	now := time.Now()
+	switch {
+	case attemptCount > 0:
+		return AssignmentCompleted
+	case now.Before(assignment.StartTime):
+		return AssignmentNotStarted
+	case now.After(assignment.Deadline):
+		return AssignmentOverdue
+	}
+	return AssignmentPending
+}
+
+// getGroupAssignmentResponse 返回作业信息，状态、提交次数和最高分为 userId 的完成情况
+func getGroupAssignmentResponse(assignment *model.GroupAssignment, userId int) (*GroupAssignmentResponse, error) {
+	creatorInfo, err := getBriefUserInfo(assignment.UserId)
+	if err != nil {
+		return nil, err
+	}
+	var problemCount int
+	sqlString := `SELECT count(*) FROM problem_in_problem_set WHERE problem_set_id = $1`
+	if err := global.Database.Get(&problemCount, sqlString, assignment.ProblemSetId); err != nil {
+		return nil, err
+	}
+	var summary struct {
+		AttemptCount int  `db:"attempt_count"`
+		BestScore    *int `db:"best_score"`
+	}
+	sqlString = `SELECT count(*) AS attempt_count, max(score) AS best_score FROM group_assignment_submission
+		WHERE assignment_id = $1 AND user_id = $2`
+	if err := global.Database.Get(&summary, sqlString, assignment.ID, userId); err != nil {
+		return nil, err
+	}
+	return &GroupAssignmentResponse{
+		ID:               assignment.ID,
+		GroupId:          assignment.GroupId,
+		ProblemSetId:     assignment.ProblemSetId,
+		CreatorInfo:      creatorInfo,
+		Title:            assignment.Title,
+		Description:      assignment.Description,
+		StartTime:        assignment.StartTime,
+		Deadline:         assignment.Deadline,
+		MaxAttempts:      assignment.MaxAttempts,
+		AnswerVisibility: assignment.AnswerVisibility,
+		ProblemCount:     problemCount,
+		Status:           getAssignmentStatus(assignment, summary.AttemptCount),
+		AttemptCount:     summary.AttemptCount,
+		BestScore:        summary.BestScore,
+		CreatedAt:        assignment.CreatedAt,
+		UpdatedAt:        assignment.UpdatedAt,
+	}, nil
+}
+
+func getGroupAssignmentSubmissionResponse(submission *model.GroupAssignmentSubmission,
+	showAnswers bool) (*GroupAssignmentSubmissionResponse, error) {
+	var results []AssignmentProblemResult
+	if err := json.Unmarshal([]byte(submission.Answers), &results); err != nil {
+		return nil, err
+	}
+	if showAnswers {
+		for i := range results {
+			var problem model.ProblemType
+			sqlString := `SELECT * FROM problem_type WHERE id = $1`
+			if err := global.Database.Get(&problem, sqlString, results[i].ProblemId); err != nil {
+				// 题目已被删除
+				continue
+			}
+			correctAnswer, err := getProblemCorrectAnswer(&problem)
+			if err != nil {
+				return nil, err
+			}
+			results[i].CorrectAnswer = &correctAnswer
+		}
+	}
+	return &GroupAssignmentSubmissionResponse{
+		ID:           submission.ID,
+		Attempt:      submission.Attempt,
+		Score:        submission.Score,
+		CorrectCount: submission.CorrectCount,
+		TotalCount:   submission.TotalCount,
+		TimeSpent:    submission.TimeSpent,
+		SubmittedAt:  submission.SubmittedAt,
+		Results:      results,
+	}, nil
+}
+
+func getGroupAssignmentMatrix(assignment *model.GroupAssignment) ([]GroupAssignmentMatrixRow, error) {
+	var members []model.GroupMember
+	sqlString := `SELECT * FROM group_member WHERE group_id = $1 ORDER BY created_at, user_id`
+	if err := global.Database.Select(&members, sqlString, assignment.GroupId); err != nil {
+		return nil, err
+	}
+	var summaries []struct {
+		UserId          int        `db:"user_id"`
+		AttemptCount    int        `db:"attempt_count"`
+		BestScore       *int       `db:"best_score"`
+		TimeSpent       int        `db:"time_spent"`
+		LastSubmittedAt *time.Time `db:"last_submitted_at"`
+	}
+	sqlString = `SELECT user_id, count(*) AS attempt_count, max(score) AS best_score, sum(time_spent) AS time_spent,
+		max(submitted_at) AS last_submitted_at FROM group_assignment_submission WHERE assignment_id = $1 GROUP BY user_id`
+	if err := global.Database.Select(&summaries, sqlString, assignment.ID); err != nil {
+		return nil, err
+	}
+	rows := make([]GroupAssignmentMatrixRow, 0, len(members))
+	for _, member := range members {
+		userInfo, err := getBriefUserInfo(member.UserId)
+		if err != nil {
+			return nil, err
+		}
+		row := GroupAssignmentMatrixRow{UserInfo: userInfo}
+		for _, summary := range summaries {
+			if summary.UserId == member.UserId {
+				row.AttemptCount = summary.AttemptCount
+				row.BestScore = summary.BestScore
+				row.TimeSpent = summary.TimeSpent
+				row.LastSubmittedAt = summary.LastSubmittedAt
+			}
+		}
+		row.Status = getAssignmentStatus(assignment, row.AttemptCount)
+		rows = append(rows, row)
+	}
+	return rows, nil
+}
+
+// CreateGroupAssignment godoc
+// @Schemes http
+// @Description 给小组布置作业（只有小组管理员和组长可以布置），题集需要属于该小组、公开或者由自己创建；
+// @Description 开始时间默认为现在，答案可见性可选 after_submit（默认）/after_deadline/never
+// @Tags GroupAssignment
+// @Param assignment body GroupAssignmentCreateRequest true "作业信息"
+// @Success 200 {object} GroupAssignmentResponse "作业信息"
+// @Failure 400 {string} string "请求解析失败"/"截止时间不能早于开始时间"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "题集不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/create [post]
+// @Security ApiKeyAuth
+func CreateGroupAssignment(c *gin.Context) {
+	var request GroupAssignmentCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if request.AnswerVisibility == "" {
+		request.AnswerVisibility = AnswerVisibleAfterSubmit
+	}
+	if request.StartTime == nil {
+		now := time.Now().Local()
+		request.StartTime = &now
+	}
+	if !isAnswerVisibility(request.AnswerVisibility) || request.MaxAttempts < 0 {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if !request.Deadline.After(*request.StartTime) {
+		c.String(http.StatusBadRequest, "截止时间不能早于开始时间")
+		return
+	}
+	isAdmin, err := isGroupAdmin(request.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isAdmin {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var problemSet model.ProblemSet
+	sqlString := `SELECT * FROM problem_set WHERE id = $1`
+	if err := global.Database.Get(&problemSet, sqlString, request.ProblemSetId); err != nil {
+		c.String(http.StatusNotFound, "题集不存在")
+		return
+	}
+	if problemSet.GroupId != request.GroupId && !problemSet.IsPublic && problemSet.UserId != c.GetInt("UserId") {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var assignment model.GroupAssignment
+	sqlString = `INSERT INTO group_assignment (group_id, problem_set_id, user_id, title, description, start_time, deadline,
+		max_attempts, answer_visibility, created_at, updated_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $10) RETURNING *`
+	if err := global.Database.Get(&assignment, sqlString, request.GroupId, request.ProblemSetId, c.GetInt("UserId"),
+		request.Title, request.Description, request.StartTime.Local(), request.Deadline.Local(), request.MaxAttempts,
+		request.AnswerVisibility, time.Now().Local()); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := getGroupAssignmentResponse(&assignment, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// UpdateGroupAssignment godoc
+// @Schemes http
+// @Description 修改作业（只有小组管理员和组长可以修改）
+// @Tags GroupAssignment
+// @Param assignment body GroupAssignmentUpdateRequest true "作业信息"
+// @Success 200 {object} GroupAssignmentResponse "作业信息"
+// @Failure 400 {string} string "请求解析失败"/"截止时间不能早于开始时间"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "作业不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/update [put]
+// @Security ApiKeyAuth
+func UpdateGroupAssignment(c *gin.Context) {
+	var request GroupAssignmentUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var assignment model.GroupAssignment
+	sqlString := `SELECT * FROM group_assignment WHERE id = $1`
+	if err := global.Database.Get(&assignment, sqlString, request.ID); err != nil {
+		c.String(http.StatusNotFound, "作业不存在")
+		return
+	}
+	isAdmin, err := isGroupAdmin(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isAdmin {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if request.Title != nil {
+		assignment.Title = *request.Title
+	}
+	if request.Description != nil {
+		assignment.Description = *request.Description
+	}
+	if request.StartTime != nil {
+		assignment.StartTime = request.StartTime.Local()
+	}
+	if request.Deadline != nil {
+		assignment.Deadline = request.Deadline.Local()
+	}
+	if request.MaxAttempts != nil {
+		assignment.MaxAttempts = *request.MaxAttempts
+	}
+	if request.AnswerVisibility != nil {
+		assignment.AnswerVisibility = *request.AnswerVisibility
+	}
+	if !isAnswerVisibility(assignment.AnswerVisibility) || assignment.MaxAttempts < 0 {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if !assignment.Deadline.After(assignment.StartTime) {
+		c.String(http.StatusBadRequest, "截止时间不能早于开始时间")
+		return
+	}
+	sqlString = `UPDATE group_assignment SET title = $1, description = $2, start_time = $3, deadline = $4, max_attempts = $5,
+		answer_visibility = $6, updated_at = $7 WHERE id = $8 RETURNING *`
+	if err := global.Database.Get(&assignment, sqlString, assignment.Title, assignment.Description, assignment.StartTime,
+		assignment.Deadline, assignment.MaxAttempts, assignment.AnswerVisibility, time.Now().Local(), assignment.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := getGroupAssignmentResponse(&assignment, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// DeleteGroupAssignment godoc
+// @Schemes http
+// @Description 删除作业及其提交记录（只有小组管理员和组长可以删除）
+// @Tags GroupAssignment
+// @Param id path int true "作业ID"
+// @Success 200 {string} string "删除成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "作业不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/delete/{id} [delete]
+// @Security ApiKeyAuth
+func DeleteGroupAssignment(c *gin.Context) {
+	var assignment model.GroupAssignment
+	sqlString := `SELECT * FROM group_assignment WHERE id = $1`
+	if err := global.Database.Get(&assignment, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "作业不存在")
+		return
+	}
+	isAdmin, err := isGroupAdmin(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isAdmin {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	sqlString = `DELETE FROM group_assignment WHERE id = $1`
+	if _, err := global.Database.Exec(sqlString, assignment.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "删除成功")
+}
+
+// GetGroupAssignments godoc
+// @Schemes http
+// @Description 获取小组的作业（只有小组成员可以查看），按截止时间倒序，状态为当前用户的完成情况
+// @Tags GroupAssignment
+// @Param filter query GroupAssignmentFilter true "小组ID和分页"
+// @Success 200 {object} AllGroupAssignmentResponse "作业列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/all [get]
+// @Security ApiKeyAuth
+func GetGroupAssignments(c *gin.Context) {
+	var filter GroupAssignmentFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isMember, err := isGroupMember(filter.GroupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isMember {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	var totalCount int
+	sqlString := `SELECT count(*) FROM group_assignment WHERE group_id = $1`
+	if err := global.Database.Get(&totalCount, sqlString, filter.GroupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT * FROM group_assignment WHERE group_id = $1 ORDER BY deadline DESC, id DESC`
+	if filter.Limit != nil {
+		sqlString += ` LIMIT ` + strconv.Itoa(*filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += ` OFFSET ` + strconv.Itoa(*filter.Offset)
+	}
+	var assignments []model.GroupAssignment
+	if err := global.Database.Select(&assignments, sqlString, filter.GroupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]GroupAssignmentResponse, 0, len(assignments))
+	for i := range assignments {
+		response, err := getGroupAssignmentResponse(&assignments[i], c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		responses = append(responses, *response)
+	}
+	c.JSON(http.StatusOK, AllGroupAssignmentResponse{
+		TotalCount:  totalCount,
+		Assignments: responses,
+	})
+}
+
+// GetPendingGroupAssignments godoc
+// @Schemes http
+// @Description 获取当前用户所在小组中已开始、未截止且还没有提交过的作业，按截止时间排序
+// @Tags GroupAssignment
+// @Success 200 {object} AllGroupAssignmentResponse "作业列表"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/pending [get]
+// @Security ApiKeyAuth
+func GetPendingGroupAssignments(c *gin.Context) {
+	var assignments []model.GroupAssignment
+	sqlString := `SELECT a.* FROM group_assignment a JOIN group_member m ON m.group_id = a.group_id AND m.user_id = $1
+		WHERE a.start_time <= $2 AND a.deadline >= $2 AND NOT EXISTS (SELECT 1 FROM group_assignment_submission s
+		WHERE s.assignment_id = a.id AND s.user_id = $1) ORDER BY a.deadline, a.id`
+	if err := global.Database.Select(&assignments, sqlString, c.GetInt("UserId"), time.Now().Local()); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]GroupAssignmentResponse, 0, len(assignments))
+	for i := range assignments {
+		response, err := getGroupAssignmentResponse(&assignments[i], c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		responses = append(responses, *response)
+	}
+	c.JSON(http.StatusOK, AllGroupAssignmentResponse{
+		TotalCount:  len(responses),
+		Assignments: responses,
+	})
+}
+
+// SubmitGroupAssignment godoc
+// @Schemes http
+// @Description 提交作业答案（只有小组成员可以在开始时间和截止时间之间提交），服务器立即批改，
+// @Description 得分为答对题目的百分比；是否返回正确答案由作业的答案可见性决定
+// @Tags GroupAssignment
+// @Param id path int true "作业ID"
+// @Param submission body GroupAssignmentSubmitRequest true "每道题的答案和用时"
+// @Success 200 {object} GroupAssignmentSubmissionResponse "批改结果"
+// @Failure 400 {string} string "请求解析失败"/"作业尚未开始"/"作业已经截止"/"提交次数已用完"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "作业不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/submit/{id} [post]
+// @Security ApiKeyAuth
+func SubmitGroupAssignment(c *gin.Context) {
+	var request GroupAssignmentSubmitRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var assignment model.GroupAssignment
+	sqlString := `SELECT * FROM group_assignment WHERE id = $1`
+	if err := global.Database.Get(&assignment, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "作业不存在")
+		return
+	}
+	isMember, err := isGroupMember(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isMember {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	now := time.Now().Local()
+	if now.Before(assignment.StartTime) {
+		c.String(http.StatusBadRequest, "作业尚未开始")
+		return
+	}
+	if now.After(assignment.Deadline) {
+		c.String(http.StatusBadRequest, "作业已经截止")
+		return
+	}
+	var attemptCount int
+	sqlString = `SELECT count(*) FROM group_assignment_submission WHERE assignment_id = $1 AND user_id = $2`
+	if err := global.Database.Get(&attemptCount, sqlString, assignment.ID, c.GetInt("UserId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if assignment.MaxAttempts > 0 && attemptCount >= assignment.MaxAttempts {
+		c.String(http.StatusBadRequest, "提交次数已用完")
+		return
+	}
+	problemIds, err := getProblemSetProblemIds(assignment.ProblemSetId)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	answers := make(map[int]string)
+	for _, answer := range request.Answers {
+		answers[answer.ProblemId] = answer.Answer
+	}
+	results := make([]AssignmentProblemResult, 0, len(problemIds))
+	correctCount := 0
+	for _, problemId := range problemIds {
+		var problem model.ProblemType
+		sqlString = `SELECT * FROM problem_type WHERE id = $1`
+		if err := global.Database.Get(&problem, sqlString, problemId); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		correctAnswer, err := getProblemCorrectAnswer(&problem)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		answer, ok := answers[problemId]
+		result := AssignmentProblemResult{
+			ProblemId: problemId,
+			Answer:    answer,
+			IsCorrect: ok && checkProblemAnswer(&problem, correctAnswer, answer),
+		}
+		if result.IsCorrect {
+			correctCount++
+		}
+		results = append(results, result)
+	}
+	score := 0
+	if len(problemIds) > 0 {
+		score = correctCount * 100 / len(problemIds)
+	}
+	// 客户端上报的用时不能超过作业开始至今的时间
+	timeSpent := request.TimeSpent
+	if maxTimeSpent := int(now.Sub(assignment.StartTime).Seconds()); timeSpent > maxTimeSpent {
+		timeSpent = maxTimeSpent
+	}
+	if timeSpent < 0 {
+		timeSpent = 0
+	}
+	raw, _ := json.Marshal(results)
+	submission := model.GroupAssignmentSubmission{
+		AssignmentId: assignment.ID,
+		UserId:       c.GetInt("UserId"),
+		Score:        score,
+		CorrectCount: correctCount,
+		TotalCount:   len(problemIds),
+		TimeSpent:    timeSpent,
+		Answers:      string(raw),
+		SubmittedAt:  now,
+	}
+	if ok, err := insertAssignmentSubmission(&submission, assignment.MaxAttempts); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if !ok {
+		c.String(http.StatusBadRequest, "提交次数已用完")
+		return
+	}
+	for _, result := range results {
+		if _, ok := answers[result.ProblemId]; !ok {
+			continue
+		}
+		if err := RecordProblemAttempt(c, c.GetInt("UserId"), result.ProblemId, assignment.ProblemSetId,
+			result.IsCorrect); err != nil {
+			log.Printf("记录作答失败: %v", err)
+		}
+	}
+	isAdmin, err := isGroupAdmin(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := getGroupAssignmentSubmissionResponse(&submission, canSeeAssignmentAnswers(&assignment, isAdmin))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// insertAssignmentSubmission 以下一个提交次数保存提交，提交次数已经用完时返回 false。
+// 并发提交时 (assignment_id, user_id, attempt) 的唯一约束保证同一个次数只有一个提交成功，失败的一方重新计算次数
+func insertAssignmentSubmission(submission *model.GroupAssignmentSubmission, maxAttempts int) (bool, error) {
+	for {
+		var attemptCount int
+		sqlString := `SELECT count(*) FROM group_assignment_submission WHERE assignment_id = $1 AND user_id = $2`
+		if err := global.Database.Get(&attemptCount, sqlString, submission.AssignmentId, submission.UserId); err != nil {
+			return false, err
+		}
+		if maxAttempts > 0 && attemptCount >= maxAttempts {
+			return false, nil
+		}
+		sqlString = `INSERT INTO group_assignment_submission (assignment_id, user_id, attempt, score, correct_count,
+			total_count, time_spent, answers, submitted_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) RETURNING *`
+		err := global.Database.Get(submission, sqlString, submission.AssignmentId, submission.UserId, attemptCount+1,
+			submission.Score, submission.CorrectCount, submission.TotalCount, submission.TimeSpent, submission.Answers,
+			submission.SubmittedAt)
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			continue
+		}
+		return err == nil, err
+	}
+}
+
+// GetGroupAssignmentSubmissions godoc
+// @Schemes http
+// @Description 获取当前用户对某个作业的所有提交，是否包含正确答案由作业的答案可见性决定
+// @Tags GroupAssignment
+// @Param id path int true "作业ID"
+// @Success 200 {object} []GroupAssignmentSubmissionResponse "提交记录"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "作业不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/submissions/{id} [get]
+// @Security ApiKeyAuth
+func GetGroupAssignmentSubmissions(c *gin.Context) {
+	var assignment model.GroupAssignment
+	sqlString := `SELECT * FROM group_assignment WHERE id = $1`
+	if err := global.Database.Get(&assignment, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "作业不存在")
+		return
+	}
+	isMember, err := isGroupMember(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isMember {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	isAdmin, err := isGroupAdmin(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	var submissions []model.GroupAssignmentSubmission
+	sqlString = `SELECT * FROM group_assignment_submission WHERE assignment_id = $1 AND user_id = $2 ORDER BY attempt`
+	if err := global.Database.Select(&submissions, sqlString, assignment.ID, c.GetInt("UserId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	showAnswers := canSeeAssignmentAnswers(&assignment, isAdmin)
+	responses := make([]GroupAssignmentSubmissionResponse, 0, len(submissions))
+	for i := range submissions {
+		response, err := getGroupAssignmentSubmissionResponse(&submissions[i], showAnswers)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		responses = append(responses, *response)
+	}
+	c.JSON(http.StatusOK, responses)
+}
+
+// GetGroupAssignmentMatrix godoc
+// @Schemes http
+// @Description 获取小组每个成员的作业完成情况、最高分和总用时（只有小组管理员和组长可以查看）
+// @Tags GroupAssignment
+// @Param id path int true "作业ID"
+// @Success 200 {object} GroupAssignmentMatrixResponse "完成情况"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "作业不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/matrix/{id} [get]
+// @Security ApiKeyAuth
+func GetGroupAssignmentMatrix(c *gin.Context) {
+	var assignment model.GroupAssignment
+	sqlString := `SELECT * FROM group_assignment WHERE id = $1`
+	if err := global.Database.Get(&assignment, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "作业不存在")
+		return
+	}
+	isAdmin, err := isGroupAdmin(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && !isAdmin {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	response, err := getGroupAssignmentResponse(&assignment, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	rows, err := getGroupAssignmentMatrix(&assignment)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, GroupAssignmentMatrixResponse{
+		Assignment: *response,
+		Members:    rows,
+	})
+}
+
+// csvSafeCell 在以 = + - @ 或制表符、回车开头的单元格前加单引号，防止表格软件把用户填写的内容当作公式执行
+func csvSafeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportGroupAssignmentMatrix godoc
+// @Schemes http
+// @Description 以 CSV 格式导出小组每个成员的作业完成情况（只有小组管理员和组长可以导出）
+// @Tags GroupAssignment
+// @Param id path int true "作业ID"
+// @Produce text/csv
+// @Success 200 {string} string "CSV文件"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "作业不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_assignment/export/{id} [get]
+// @Security ApiKeyAuth
+func ExportGroupAssignmentMatrix(c *gin.Context) {
+	var assignment model.GroupAssignment
+	sqlString := `SELECT * FROM group_assignment WHERE id = $1`
+	if err := global.Database.Get(&assignment, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "作业不存在")
+		return
+	}
+	isAdmin, err := isGroupAdmin(assignment.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && !isAdmin {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	rows, err := getGroupAssignmentMatrix(&assignment)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="assignment_%d.csv"`, assignment.ID))
+	c.Status(http.StatusOK)
+	// 写入 BOM，使 Excel 能正确识别中文
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	writer := csv.NewWriter(c.Writer)
+	_ = writer.Write([]string{"用户ID", "昵称", "状态", "提交次数", "最高分", "总用时（秒）", "最后提交时间"})
+	for _, row := range rows {
+		bestScore, lastSubmittedAt := "", ""
+		if row.BestScore != nil {
+			bestScore = strconv.Itoa(*row.BestScore)
+		}
+		if row.LastSubmittedAt != nil {
+			lastSubmittedAt = row.LastSubmittedAt.Format("2006-01-02 15:04:05")
+		}
+		_ = writer.Write([]string{
+			strconv.Itoa(row.UserInfo.UserId),
+			csvSafeCell(row.UserInfo.NickName),
+			row.Status,
+			strconv.Itoa(row.AttemptCount),
+			bestScore,
+			strconv.Itoa(row.TimeSpent),
+			lastSubmittedAt,
+		})
+	}
+	writer.Flush()
+}
@@ -0,0 +1,410 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	invitationCodeLength = 8
+	// 未配置 GroupJoinURL 时小程序使用的加入链接前缀
+	defaultGroupJoinURL = "kayak://group/join?code="
+)
+
+const (
+	JoinGroupJoined  = "joined"
+	JoinGroupPending = "pending"
+)
+
+type GroupInvitationCreateRequest struct {
+	GroupId     int        `json:"group_id" binding:"required"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+	MaxUses     int        `json:"max_uses"`
+	AutoApprove bool       `json:"auto_approve"`
+}
+
+type GroupInvitationResponse struct {
+	model.GroupInvitation
+	JoinURL  string           `json:"join_url"`
+	UserInfo UserInfoResponse `json:"user_info"`
+}
+
+type AllGroupInvitationResponse struct {
+	TotalCount  int                       `json:"total_count"`
+	Invitations []GroupInvitationResponse `json:"invitations"`
+}
+
+type JoinGroupRequest struct {
+	Code    string   `json:"code" binding:"required"`
+	Message *string  `json:"message"`
+	Answers []string `json:"answers"`
+}
+
+type JoinGroupResponse struct {
+	GroupId int    `json:"group_id"`
+	Status  string `json:"status"`
+}
+
+func getGroupJoinURL(code string) string {
+	base := viper.GetString("GroupJoinURL")
+	if base == "" {
+		base = defaultGroupJoinURL
+	}
+	return base + code
+}
+
+func getGroupInvitationResponse(invitation *model.GroupInvitation) (*GroupInvitationResponse, error) {
+	userInfo, err := getBriefUserInfo(invitation.UserId)
+	if err != nil {
+		return nil, err
+	}
+	return &GroupInvitationResponse{
+		GroupInvitation: *invitation,
+		JoinURL:         getGroupJoinURL(invitation.Code),
+		UserInfo:        userInfo,
+	}, nil
+}
+
+// insertGroupInvitation 生成新的邀请码，与已有邀请码冲突时重新生成
+func insertGroupInvitation(invitation *model.GroupInvitation) error {
+	sqlString := `INSERT INTO group_invitation (group_id, user_id, code, expires_at, max_uses, use_count, auto_approve,
+		revoked, created_at) VALUES ($1, $2, $3, $4, $5, 0, $6, false, $7) RETURNING *`
+	var err error
+	for i := 0; i < 5; i++ {
+		err = global.Database.Get(invitation, sqlString, invitation.GroupId, invitation.UserId,
+			utils.GenerateInvitationCode(invitationCodeLength), invitation.ExpiresAt, invitation.MaxUses,
+			invitation.AutoApprove, time.Now().Local())
+		if pqErr, ok := err.(*pq.Error); !ok || pqErr.Code != "23505" {
+			return err
+		}
+	}
+	return err
+}
+
+// getManagedGroupInvitation 获取邀请码，当前用户需要是该小组的管理员或组长
+func getManagedGroupInvitation(c *gin.Context) (*model.GroupInvitation, bool) {
+	var invitation model.GroupInvitation
+	sqlString := `SELECT * FROM group_invitation WHERE id = $1`
+	if err := global.Database.Get(&invitation, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "邀请码不存在")
+		return nil, false
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isAdmin, err := isGroupAdmin(invitation.GroupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return nil, false
+		}
+		if !isAdmin {
+			c.String(http.StatusForbidden, "没有权限")
+			return nil, false
+		}
+	}
+	return &invitation, true
+}
+
+// CreateGroupInvitation godoc
+// @Schemes http
+// @Description 创建小组邀请码（只有小组管理员和组长可以创建），可以设置过期时间、最大使用次数（0为不限）和是否无需审核直接加入
+// @Tags GroupInvitation
+// @Param invitation body GroupInvitationCreateRequest true "邀请码设置"
+// @Success 200 {object} GroupInvitationResponse "邀请码信息"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "小组不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_invitation/create [post]
+// @Security ApiKeyAuth
+func CreateGroupInvitation(c *gin.Context) {
+	var request GroupInvitationCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.MaxUses < 0 {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if request.ExpiresAt != nil && request.ExpiresAt.Before(time.Now()) {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var count int
+	sqlString := `SELECT count(*) FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&count, sqlString, request.GroupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if count == 0 {
+		c.String(http.StatusNotFound, "小组不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isAdmin, err := isGroupAdmin(request.GroupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isAdmin {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	invitation := model.GroupInvitation{
+		GroupId:     request.GroupId,
+		UserId:      c.GetInt("UserId"),
+		ExpiresAt:   request.ExpiresAt,
+		MaxUses:     request.MaxUses,
+		AutoApprove: request.AutoApprove,
+	}
+	if err := insertGroupInvitation(&invitation); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := getGroupInvitationResponse(&invitation)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetGroupInvitations godoc
+// @Schemes http
+// @Description 获取小组的所有邀请码（只有小组管理员和组长可以查看），包括已撤销和已过期的
+// @Tags GroupInvitation
+// @Param group_id query int true "小组ID"
+// @Success 200 {object} AllGroupInvitationResponse "邀请码列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /group_invitation/all [get]
+// @Security ApiKeyAuth
+func GetGroupInvitations(c *gin.Context) {
+	groupId, err := strconv.Atoi(c.Query("group_id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isAdmin, err := isGroupAdmin(groupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isAdmin {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	var invitations []model.GroupInvitation
+	sqlString := `SELECT * FROM group_invitation WHERE group_id = $1 ORDER BY created_at DESC`
+	if err := global.Database.Select(&invitations, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response := AllGroupInvitationResponse{Invitations: make([]GroupInvitationResponse, 0, len(invitations))}
+	for i := range invitations {
+		item, err := getGroupInvitationResponse(&invitations[i])
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		response.Invitations = append(response.Invitations, *item)
+	}
+	response.TotalCount = len(response.Invitations)
+	c.JSON(http.StatusOK, response)
+}
+
+// RegenerateGroupInvitation godoc
+// @Schemes http
+// @Description 撤销邀请码并生成一个设置相同的新邀请码（使用次数重新计算），用于邀请码泄露时更换
+// @Tags GroupInvitation
+// @Param id path int true "邀请码ID"
+// @Success 200 {object} GroupInvitationResponse "新的邀请码信息"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "邀请码不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_invitation/regenerate/{id} [put]
+// @Security ApiKeyAuth
+func RegenerateGroupInvitation(c *gin.Context) {
+	invitation, ok := getManagedGroupInvitation(c)
+	if !ok {
+		return
+	}
+	sqlString := `UPDATE group_invitation SET revoked = true WHERE id = $1`
+	if _, err := global.Database.Exec(sqlString, invitation.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	invitation.UserId = c.GetInt("UserId")
+	if err := insertGroupInvitation(invitation); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := getGroupInvitationResponse(invitation)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// RevokeGroupInvitation godoc
+// @Schemes http
+// @Description 撤销邀请码，撤销后不能再用于加入小组
+// @Tags GroupInvitation
+// @Param id path int true "邀请码ID"
+// @Success 200 {string} string "撤销成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "邀请码不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_invitation/revoke/{id} [delete]
+// @Security ApiKeyAuth
+func RevokeGroupInvitation(c *gin.Context) {
+	invitation, ok := getManagedGroupInvitation(c)
+	if !ok {
+		return
+	}
+	sqlString := `UPDATE group_invitation SET revoked = true WHERE id = $1`
+	if _, err := global.Database.Exec(sqlString, invitation.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "撤销成功")
+}
+
+// GetGroupInvitationQRCode godoc
+// @Schemes http
+// @Description 获取邀请码加入链接的二维码图片
+// @Tags GroupInvitation
+// @Produce png
+// @Param id path int true "邀请码ID"
+// @Param scale query int false "每个模块的像素数，默认为8，最大为32"
+// @Success 200 {file} file "二维码图片"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "邀请码不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_invitation/qrcode/{id} [get]
+// @Security ApiKeyAuth
+func GetGroupInvitationQRCode(c *gin.Context) {
+	invitation, ok := getManagedGroupInvitation(c)
+	if !ok {
+		return
+	}
+	scale, _ := strconv.Atoi(c.Query("scale"))
+	if scale <= 0 || scale > 32 {
+		scale = 8
+	}
+	image, err := utils.EncodeQRCode(getGroupJoinURL(invitation.Code), scale)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.Data(http.StatusOK, "image/png", image)
+}
+
+// JoinGroup godoc
+// @Schemes http
+// @Description 使用邀请码加入小组，无需审核的邀请码直接加入（status 为 joined），否则提交入组申请（status 为 pending），
+// @Description 提交申请时需要回答小组的入组问题；不接受新成员（closed）的小组不能加入
+// @Tags Group
+// @Param join body JoinGroupRequest true "邀请码、申请留言和入组问题的回答"
+// @Success 200 {object} JoinGroupResponse "加入结果"
+// @Failure 400 {string} string "请求解析失败"/"邀请码已过期"/"邀请码使用次数已达上限"/"请回答所有入组问题"
+// @Failure 403 {string} string "已经加入此小组或已经申请过"/"该小组不接受新成员"
+// @Failure 404 {string} string "邀请码无效"
+// @Failure default {string} string "服务器错误"
+// @Router /group/join [post]
+// @Security ApiKeyAuth
+func JoinGroup(c *gin.Context) {
+	var request JoinGroupRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var invitation model.GroupInvitation
+	sqlString := `SELECT * FROM group_invitation WHERE code = $1 AND revoked = false`
+	if err := global.Database.Get(&invitation, sqlString, request.Code); err != nil {
+		c.String(http.StatusNotFound, "邀请码无效")
+		return
+	}
+	now := time.Now().Local()
+	if invitation.ExpiresAt != nil && invitation.ExpiresAt.Before(now) {
+		c.String(http.StatusBadRequest, "邀请码已过期")
+		return
+	}
+	var group model.Group
+	sqlString = `SELECT * FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&group, sqlString, invitation.GroupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if group.JoinPolicy == GroupJoinClosed {
+		c.String(http.StatusForbidden, "该小组不接受新成员")
+		return
+	}
+	var answers *string
+	if !invitation.AutoApprove {
+		var ok bool
+		if answers, ok = buildEntryAnswers(&group, request.Answers); !ok {
+			c.String(http.StatusBadRequest, "请回答所有入组问题")
+			return
+		}
+	}
+	userId := c.GetInt("UserId")
+	var count int
+	sqlString = `SELECT (SELECT count(*) FROM group_member WHERE user_id = $1 AND group_id = $2) +
+		(SELECT count(*) FROM group_application WHERE user_id = $1 AND group_id = $2 AND status = $3)`
+	if err := global.Database.Get(&count, sqlString, userId, invitation.GroupId, Pending); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if count != 0 {
+		c.String(http.StatusForbidden, "已经加入此小组或已经申请过")
+		return
+	}
+	tx := global.Database.MustBegin()
+	// 在同一条语句中检查并增加使用次数，避免并发使用超过上限
+	sqlString = `UPDATE group_invitation SET use_count = use_count + 1
+		WHERE id = $1 AND revoked = false AND (max_uses = 0 OR use_count < max_uses) RETURNING id`
+	var invitationId int
+	if err := tx.Get(&invitationId, sqlString, invitation.ID); err != nil {
+		_ = tx.Rollback()
+		if err == sql.ErrNoRows {
+			c.String(http.StatusBadRequest, "邀请码使用次数已达上限")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response := JoinGroupResponse{GroupId: invitation.GroupId, Status: JoinGroupPending}
+	sqlString = `INSERT INTO group_application (user_id, group_id, message, answers, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`
+	args := []interface{}{userId, invitation.GroupId, request.Message, answers, Pending, now}
+	if invitation.AutoApprove {
+		response.Status = JoinGroupJoined
+		sqlString = `INSERT INTO group_member (user_id, group_id, is_admin, is_owner, created_at) VALUES ($1, $2, false, false, $3)`
+		args = []interface{}{userId, invitation.GroupId, now}
+	}
+	if _, err := tx.Exec(sqlString, args...); err != nil {
+		if err := tx.Rollback(); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if invitation.AutoApprove {
+		recordMemberJoin(c, invitation.GroupId, userId)
+	}
+	c.JSON(http.StatusOK, response)
+}
@@ -0,0 +1,227 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	// GroupJoinOpen 申请后直接加入
+	GroupJoinOpen = "open"
+	// GroupJoinApproval 申请需要管理员审核
+	GroupJoinApproval = "approval"
+	// GroupJoinInviteOnly 只能通过邀请码加入
+	GroupJoinInviteOnly = "invite_only"
+	// GroupJoinClosed 不接受新成员
+	GroupJoinClosed = "closed"
+)
+
+const (
+	maxEntryQuestions      = 5
+	maxEntryQuestionLength = 200
+	// 检查过期入组申请的间隔
+	applicationExpiryInterval = time.Hour
+)
+
+type GroupEntryAnswer struct {
+	Question string `json:"question"`
+	Answer   string `json:"answer"`
+}
+
+type BatchGroupApplicationRequest struct {
+	ApplicationIds []int `json:"application_ids" binding:"required"`
+	Status         int   `json:"status" binding:"required"`
+}
+
+type BatchGroupApplicationResponse struct {
+	Handled int `json:"handled"`
+	Skipped int `json:"skipped"`
+}
+
+func isGroupJoinPolicy(policy string) bool {
+	return policy == GroupJoinOpen || policy == GroupJoinApproval ||
+		policy == GroupJoinInviteOnly || policy == GroupJoinClosed
+}
+
+func parseEntryQuestions(raw string) []string {
+	questions := make([]string, 0)
+	_ = json.Unmarshal([]byte(raw), &questions)
+	return questions
+}
+
+func parseEntryAnswers(raw *string) []GroupEntryAnswer {
+	answers := make([]GroupEntryAnswer, 0)
+	if raw != nil {
+		_ = json.Unmarshal([]byte(*raw), &answers)
+	}
+	return answers
+}
+
+func validateEntryQuestions(questions []string) bool {
+	if len(questions) > maxEntryQuestions {
+		return false
+	}
+	for _, question := range questions {
+		if question == "" || len([]rune(question)) > maxEntryQuestionLength {
+			return false
+		}
+	}
+	return true
+}
+
+// buildEntryAnswers 将回答与小组的入组问题一一对应，小组设置了问题时每个问题都需要回答
+func buildEntryAnswers(group *model.Group, answers []string) (*string, bool) {
+	questions := parseEntryQuestions(group.EntryQuestions)
+	if len(questions) == 0 {
+		return nil, true
+	}
+	if len(answers) != len(questions) {
+		return nil, false
+	}
+	entryAnswers := make([]GroupEntryAnswer, len(questions))
+	for i, question := range questions {
+		if answers[i] == "" {
+			return nil, false
+		}
+		entryAnswers[i] = GroupEntryAnswer{Question: question, Answer: answers[i]}
+	}
+	raw, _ := json.Marshal(entryAnswers)
+	result := string(raw)
+	return &result, true
+}
+
+// handleGroupApplication 更新待处理申请的状态，通过时将用户加入小组，并通知申请人。
+// 申请已经被其他请求处理时返回 false，不做任何修改
+func handleGroupApplication(ctx context.Context, application *model.GroupApplication, status int, operatorId int,
+	reason string) (bool, error) {
+	tx := global.Database.MustBegin()
+	sqlString := `UPDATE group_application SET status = $1 WHERE id = $2 AND status = $3`
+	result, err := tx.Exec(sqlString, status, application.ID, Pending)
+	if err != nil {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		_ = tx.Rollback()
+		return false, err
+	}
+	if status == Accepted {
+		sqlString = `INSERT INTO group_member (user_id, group_id, is_admin, is_owner, created_at) VALUES ($1, $2, false, false, $3)
+			ON CONFLICT DO NOTHING`
+		if _, err := tx.Exec(sqlString, application.UserId, application.GroupId, time.Now()); err != nil {
+			_ = tx.Rollback()
+			return false, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	var groupName string
+	sqlString = `SELECT name FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&groupName, sqlString, application.GroupId); err == nil {
+		content := "加入小组「" + groupName + "」的申请" + reason
+		CreateNotification(ctx, application.UserId, NotificationGroupApplication, operatorId, application.GroupId, content)
+	}
+	return true, nil
+}
+
+// BatchHandleGroupApplication godoc
+// @Schemes http
+// @Description 批量通过或拒绝入组申请（需要是申请所在小组的管理员或组长），已处理或没有权限的申请会被跳过
+// @Tags Group
+// @Param batch body BatchGroupApplicationRequest true "申请ID列表和处理结果, 1: 通过, 2: 拒绝"
+// @Success 200 {object} BatchGroupApplicationResponse "处理结果"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure default {string} string "服务器错误"
+// @Router /group/application/batch [put]
+// @Security ApiKeyAuth
+func BatchHandleGroupApplication(c *gin.Context) {
+	var request BatchGroupApplicationRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.Status != Accepted && request.Status != Rejected {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var response BatchGroupApplicationResponse
+	adminOf := make(map[int]bool)
+	for _, id := range request.ApplicationIds {
+		var application model.GroupApplication
+		sqlString := `SELECT * FROM group_application WHERE id = $1`
+		if err := global.Database.Get(&application, sqlString, id); err != nil || application.Status != Pending {
+			response.Skipped++
+			continue
+		}
+		isAdmin, checked := adminOf[application.GroupId]
+		if !checked {
+			var err error
+			if isAdmin, err = isGroupAdmin(application.GroupId, c.GetInt("UserId")); err != nil {
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
+			adminOf[application.GroupId] = isAdmin
+		}
+		if !isAdmin {
+			response.Skipped++
+			continue
+		}
+		reason := "已被拒绝"
+		if request.Status == Accepted {
+			reason = "已通过"
+		}
+		handled, err := handleGroupApplication(c, &application, request.Status, c.GetInt("UserId"), reason)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !handled {
+			response.Skipped++
+			continue
+		}
+		if request.Status == Accepted {
+			recordMemberJoin(c, application.GroupId, application.UserId)
+		}
+		response.Handled++
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// ExpireGroupApplications 自动拒绝超过小组设置的有效天数仍未处理的入组申请，返回拒绝的数量
+func ExpireGroupApplications(ctx context.Context) (int, error) {
+	var applications []model.GroupApplication
+	sqlString := `SELECT a.* FROM group_application a JOIN "group" g ON g.id = a.group_id
+		WHERE a.status = $1 AND g.application_ttl > 0 AND a.created_at < $2 - g.application_ttl * interval '1 day'`
+	if err := global.Database.Select(&applications, sqlString, Pending, time.Now()); err != nil {
+		return 0, err
+	}
+	count := 0
+	for i := range applications {
+		handled, err := handleGroupApplication(ctx, &applications[i], Rejected, 0, "长时间未处理，已自动拒绝")
+		if err != nil {
+			return count, err
+		}
+		if handled {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// StartGroupApplicationExpiry 定期清理过期的入组申请，每个进程只需要启动一次
+func StartGroupApplicationExpiry() {
+	go func() {
+		ticker := time.NewTicker(applicationExpiryInterval)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			if count, err := ExpireGroupApplications(context.Background()); err != nil {
+				log.Printf("清理过期入组申请失败: %v", err)
+			} else if count > 0 {
+				log.Printf("已自动拒绝 %d 个过期入组申请", count)
+			}
+		}
+	}()
+}
@@ -0,0 +1,946 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"golang.org/x/net/websocket"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	GroupQuizWaiting  = "waiting"
+	GroupQuizRunning  = "running"
+	GroupQuizFinished = "finished"
+)
+
+const (
+	GroupQuizJoinedEvent      = "quiz_joined"
+	GroupQuizQuestionEvent    = "quiz_question"
+	GroupQuizAnswerEvent      = "quiz_answer"
+	GroupQuizLeaderboardEvent = "quiz_leaderboard"
+	GroupQuizFinishedEvent    = "quiz_finished"
+)
+
+const (
+	defaultQuizQuestionSeconds = 20
+	minQuizQuestionSeconds     = 5
+	maxQuizQuestionSeconds     = 300
+	// 每道题结束后公布答案和排行榜的时间
+	quizRevealInterval = 3 * time.Second
+	// 答对的基础得分，剩余时间越多额外得分越高，最多再得同样的分数
+	quizBasePoints       = 500
+	quizLeaderboardSize  = 10
+	quizStateExpiration  = 24 * time.Hour
+	quizAnswerPollPeriod = 200 * time.Millisecond
+	// 运行竞赛的进程持有租约并定期续期，进程退出后租约过期，其他进程接手继续运行
+	quizRunnerLease = 15 * time.Second
+)
+
+type GroupQuizCreateRequest struct {
+	GroupId         int `json:"group_id" binding:"required"`
+	ProblemSetId    int `json:"problem_set_id" binding:"required"`
+	QuestionSeconds int `json:"question_seconds"`
+}
+
+type GroupQuizRankItem struct {
+	Rank         int              `json:"rank"`
+	UserInfo     UserInfoResponse `json:"user_info"`
+	Score        int              `json:"score"`
+	CorrectCount int              `json:"correct_count"`
+}
+
+type GroupQuizResponse struct {
+	ID              int                 `json:"id"`
+	GroupId         int                 `json:"group_id"`
+	ProblemSetId    int                 `json:"problem_set_id"`
+	HostInfo        UserInfoResponse    `json:"host_info"`
+	Status          string              `json:"status"`
+	QuestionSeconds int                 `json:"question_seconds"`
+	QuestionCount   int                 `json:"question_count"`
+	CreatedAt       time.Time           `json:"created_at"`
+	StartedAt       *time.Time          `json:"started_at"`
+	FinishedAt      *time.Time          `json:"finished_at"`
+	Results         []GroupQuizRankItem `json:"results"`
+}
+
+type AllGroupQuizResponse struct {
+	TotalCount int                 `json:"total_count"`
+	Quizzes    []GroupQuizResponse `json:"quizzes"`
+}
+
+type GroupQuizFilter struct {
+	GroupId int  `json:"group_id" form:"group_id" binding:"required"`
+	Offset  *int `json:"offset" form:"offset"`
+	Limit   *int `json:"limit" form:"limit"`
+}
+
+// GroupQuizQuestion 是推送给参赛者的题目，不包含答案
+type GroupQuizQuestion struct {
+	Index       int       `json:"index"`
+	Total       int       `json:"total"`
+	ProblemId   int       `json:"problem_id"`
+	ProblemType int       `json:"problem_type"`
+	Description string    `json:"description"`
+	Images      []string  `json:"images"`
+	Choices     []Choice  `json:"choices"`
+	IsMultiple  bool      `json:"is_multiple"`
+	Seconds     int       `json:"seconds"`
+	StartedAt   time.Time `json:"started_at"`
+	Deadline    time.Time `json:"deadline"`
+}
+
+// GroupQuizAnswerRequest 是参赛者通过 WebSocket 发送的答案，选择题的答案为选项字母（如 AC），
+// 判断题为 正确/错误（或 true/false）
+type GroupQuizAnswerRequest struct {
+	ProblemId int    `json:"problem_id"`
+	Answer    string `json:"answer"`
+}
+
+type GroupQuizAnswerResult struct {
+	ProblemId int    `json:"problem_id"`
+	IsCorrect bool   `json:"is_correct"`
+	Points    int    `json:"points"`
+	Score     int    `json:"score"`
+	Error     string `json:"error,omitempty"`
+}
+
+type GroupQuizLeaderboardResponse struct {
+	Index         int                 `json:"index"`
+	ProblemId     int                 `json:"problem_id"`
+	Answer        string              `json:"answer"`
+	AnsweredCount int                 `json:"answered_count"`
+	PlayerCount   int                 `json:"player_count"`
+	Leaderboard   []GroupQuizRankItem `json:"leaderboard"`
+}
+
+type GroupQuizJoinedResponse struct {
+	UserInfo    UserInfoResponse `json:"user_info"`
+	PlayerCount int              `json:"player_count"`
+}
+
+func groupQuizKey(quizId int, name string) string {
+	return fmt.Sprintf("group_quiz:%d:%s", quizId, name)
+}
+
+func groupQuizTopic(quizId int) string {
+	return "group_quiz:" + strconv.Itoa(quizId)
+}
+
+func isGroupAdmin(groupId int, userId int) (bool, error) {
+	var count int
+	sqlString := `SELECT count(*) FROM group_member WHERE group_id = $1 AND user_id = $2 AND (is_admin = true OR is_owner = true)`
+	if err := global.Database.Get(&count, sqlString, groupId, userId); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func isGroupMember(groupId int, userId int) (bool, error) {
+	var count int
+	sqlString := `SELECT count(*) FROM group_member WHERE group_id = $1 AND user_id = $2`
+	if err := global.Database.Get(&count, sqlString, groupId, userId); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+func getProblemSetProblemIds(problemSetId int) ([]int, error) {
+	problemIds := make([]int, 0)
+	sqlString := `SELECT problem_id FROM problem_in_problem_set WHERE problem_set_id = $1 ORDER BY problem_id`
+	if err := global.Database.Select(&problemIds, sqlString, problemSetId); err != nil {
+		return nil, err
+	}
+	return problemIds, nil
+}
+
+// getProblemCorrectAnswer 返回题目答案的文本形式：选择题为正确选项字母，填空题为答案，判断题为 true/false
+func getProblemCorrectAnswer(problem *model.ProblemType) (string, error) {
+	switch problem.ProblemTypeId {
+	case ChoiceProblemType:
+		var choices []string
+		sqlString := `SELECT choice FROM problem_choice WHERE id = $1 AND is_correct = true ORDER BY choice`
+		if err := global.Database.Select(&choices, sqlString, problem.ID); err != nil {
+			return "", err
+		}
+		return strings.Join(choices, ""), nil
+	case BlankProblemType:
+		var answer string
+		sqlString := `SELECT answer FROM problem_answer WHERE id = $1`
+		err := global.Database.Get(&answer, sqlString, problem.ID)
+		return answer, err
+	case JudgeProblemType:
+		var isCorrect bool
+		sqlString := `SELECT is_correct FROM problem_judge WHERE id = $1`
+		err := global.Database.Get(&isCorrect, sqlString, problem.ID)
+		return strconv.FormatBool(isCorrect), err
+	}
+	return "", errors.New("unknown problem type")
+}
+
+func normalizeChoiceAnswer(answer string) string {
+	var letters []string
+	seen := make(map[rune]bool)
+	for _, r := range strings.ToUpper(answer) {
+		if unicode.IsLetter(r) && !seen[r] {
+			seen[r] = true
+			letters = append(letters, string(r))
+		}
+	}
+	sort.Strings(letters)
+	return strings.Join(letters, "")
+}
+
+// checkProblemAnswer 判断 answer 是否是题目的正确答案
+func checkProblemAnswer(problem *model.ProblemType, correctAnswer string, answer string) bool {
+	switch problem.ProblemTypeId {
+	case ChoiceProblemType:
+		return normalizeChoiceAnswer(answer) == normalizeChoiceAnswer(correctAnswer)
+	case BlankProblemType:
+		return strings.EqualFold(strings.TrimSpace(answer), strings.TrimSpace(correctAnswer))
+	case JudgeProblemType:
+		value, ok := parseJudgeAnswer(answer)
+		return ok && strconv.FormatBool(value) == correctAnswer
+	}
+	return false
+}
+
+func buildGroupQuizQuestion(problemId int) (*GroupQuizQuestion, error) {
+	var problem model.ProblemType
+	sqlString := `SELECT * FROM problem_type WHERE id = $1`
+	if err := global.Database.Get(&problem, sqlString, problemId); err != nil {
+		return nil, err
+	}
+	images, err := GetProblemImageURLs(problem.ID, ProblemImageStem, "")
+	if err != nil {
+		return nil, err
+	}
+	question := &GroupQuizQuestion{
+		ProblemId:   problem.ID,
+		ProblemType: problem.ProblemTypeId,
+		Description: problem.Description,
+		Images:      images,
+		Choices:     make([]Choice, 0),
+	}
+	if problem.ProblemTypeId == ChoiceProblemType {
+		var choices []model.ProblemChoice
+		sqlString = `SELECT * FROM problem_choice WHERE id = $1 ORDER BY choice`
+		if err := global.Database.Select(&choices, sqlString, problem.ID); err != nil {
+			return nil, err
+		}
+		correctCount := 0
+		for _, choice := range choices {
+			choiceImages, err := GetProblemImageURLs(problem.ID, ProblemImageChoice, choice.Choice)
+			if err != nil {
+				return nil, err
+			}
+			question.Choices = append(question.Choices, Choice{
+				Choice:      choice.Choice,
+				Description: choice.Description,
+				Images:      choiceImages,
+			})
+			if choice.IsCorrect {
+				correctCount++
+			}
+		}
+		question.IsMultiple = correctCount > 1
+	}
+	return question, nil
+}
+
+// getGroupQuizLeaderboard 返回前 limit 名的排行，limit 小于等于0时返回全部，分数相同的名次相同
+func getGroupQuizLeaderboard(ctx context.Context, quizId int, limit int) ([]GroupQuizRankItem, error) {
+	scores, err := global.Redis.ZRevRangeWithScores(ctx, groupQuizKey(quizId, "scores"), 0, int64(limit-1)).Result()
+	if err != nil {
+		return nil, err
+	}
+	correctCounts, err := global.Redis.HGetAll(ctx, groupQuizKey(quizId, "correct")).Result()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]GroupQuizRankItem, 0, len(scores))
+	for i, score := range scores {
+		userId, _ := strconv.Atoi(score.Member.(string))
+		userInfo, err := getBriefUserInfo(userId)
+		if err != nil {
+			return nil, err
+		}
+		item := GroupQuizRankItem{Rank: i + 1, UserInfo: userInfo, Score: int(score.Score)}
+		if i > 0 && items[i-1].Score == item.Score {
+			item.Rank = items[i-1].Rank
+		}
+		item.CorrectCount, _ = strconv.Atoi(correctCounts[score.Member.(string)])
+		items = append(items, item)
+	}
+	return items, nil
+}
+
+func getGroupQuizResponse(quiz *model.GroupQuiz) (*GroupQuizResponse, error) {
+	hostInfo, err := getBriefUserInfo(quiz.HostId)
+	if err != nil {
+		return nil, err
+	}
+	var results []model.GroupQuizResult
+	sqlString := `SELECT * FROM group_quiz_result WHERE quiz_id = $1 ORDER BY rank, user_id`
+	if err := global.Database.Select(&results, sqlString, quiz.ID); err != nil {
+		return nil, err
+	}
+	items := make([]GroupQuizRankItem, 0, len(results))
+	for _, result := range results {
+		userInfo, err := getBriefUserInfo(result.UserId)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, GroupQuizRankItem{
+			Rank:         result.Rank,
+			UserInfo:     userInfo,
+			Score:        result.Score,
+			CorrectCount: result.CorrectCount,
+		})
+	}
+	return &GroupQuizResponse{
+		ID:              quiz.ID,
+		GroupId:         quiz.GroupId,
+		ProblemSetId:    quiz.ProblemSetId,
+		HostInfo:        hostInfo,
+		Status:          quiz.Status,
+		QuestionSeconds: quiz.QuestionSeconds,
+		QuestionCount:   quiz.QuestionCount,
+		CreatedAt:       quiz.CreatedAt,
+		StartedAt:       quiz.StartedAt,
+		FinishedAt:      quiz.FinishedAt,
+		Results:         items,
+	}, nil
+}
+
+// renewGroupQuizRunnerScript 只在租约仍然属于当前运行者时续期，返回 0 表示租约已经被其他进程取得
+var renewGroupQuizRunnerScript = redis.NewScript(`
+if redis.call('GET', KEYS[1]) == ARGV[1] then
+	return redis.call('PEXPIRE', KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// acquireGroupQuizRunner 尝试取得运行竞赛的租约，成功后由当前进程以返回的运行者ID运行竞赛
+func acquireGroupQuizRunner(ctx context.Context, quizId int) (string, bool, error) {
+	runnerId := uuid.New().String()
+	acquired, err := global.Redis.SetNX(ctx, groupQuizKey(quizId, "runner"), runnerId, quizRunnerLease).Result()
+	return runnerId, acquired, err
+}
+
+// keepGroupQuizRunner 定期续期运行竞赛的租约，返回的函数用于停止续期，
+// 租约丢失后关闭返回的通道，运行者应当立即停止
+func keepGroupQuizRunner(ctx context.Context, quizId int, runnerId string) (func(), <-chan struct{}) {
+	done := make(chan struct{})
+	lost := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(quizRunnerLease / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				renewed, err := renewGroupQuizRunnerScript.Run(ctx, global.Redis,
+					[]string{groupQuizKey(quizId, "runner")}, runnerId, quizRunnerLease.Milliseconds()).Int()
+				if err != nil {
+					log.Printf("竞赛 %d 续期租约失败: %v", quizId, err)
+					continue
+				}
+				if renewed == 0 {
+					close(lost)
+					return
+				}
+			}
+		}
+	}()
+	return func() {
+		close(done)
+	}, lost
+}
+
+// runGroupQuiz 由持有租约的进程运行，从第 start 道题开始按固定时间推送每一道题，所有参赛者都作答后提前结束当前题。
+// 当前题号保存在 Redis 中，进程退出后其他进程从这道题重新开始
+func runGroupQuiz(quiz model.GroupQuiz, problemIds []int, start int, runnerId string) {
+	ctx := context.Background()
+	stop, lost := keepGroupQuizRunner(ctx, quiz.ID, runnerId)
+	defer stop()
+	leaseLost := func() bool {
+		select {
+		case <-lost:
+			log.Printf("竞赛 %d 的租约已经被其他进程取得，停止运行", quiz.ID)
+			return true
+		default:
+			return false
+		}
+	}
+	topic := groupQuizTopic(quiz.ID)
+	for i := start; i < len(problemIds); i++ {
+		if leaseLost() {
+			return
+		}
+		problemId := problemIds[i]
+		if err := global.Redis.Set(ctx, groupQuizKey(quiz.ID, "index"), i, quizStateExpiration).Err(); err != nil {
+			log.Printf("竞赛 %d 保存进度失败: %v", quiz.ID, err)
+		}
+		question, err := buildGroupQuizQuestion(problemId)
+		if err != nil {
+			log.Printf("竞赛 %d 读取题目 %d 失败: %v", quiz.ID, problemId, err)
+			continue
+		}
+		question.Index = i
+		question.Total = len(problemIds)
+		question.Seconds = quiz.QuestionSeconds
+		question.StartedAt = time.Now().Local()
+		question.Deadline = question.StartedAt.Add(time.Duration(quiz.QuestionSeconds) * time.Second)
+		raw, _ := json.Marshal(question)
+		if err := global.Redis.Set(ctx, groupQuizKey(quiz.ID, "current"), raw, quizStateExpiration).Err(); err != nil {
+			log.Printf("竞赛 %d 保存题目失败: %v", quiz.ID, err)
+			continue
+		}
+		if err := utils.PublishToTopic(ctx, topic, GroupQuizQuestionEvent, question); err != nil {
+			log.Printf("竞赛 %d 推送题目失败: %v", quiz.ID, err)
+		}
+		answeredKey := groupQuizKey(quiz.ID, "answered:"+strconv.Itoa(i))
+		for time.Now().Before(question.Deadline) {
+			answered, _ := global.Redis.HLen(ctx, answeredKey).Result()
+			players, _ := global.Redis.SCard(ctx, groupQuizKey(quiz.ID, "players")).Result()
+			if players > 0 && answered >= players {
+				break
+			}
+			if leaseLost() {
+				return
+			}
+			time.Sleep(quizAnswerPollPeriod)
+		}
+		global.Redis.Del(ctx, groupQuizKey(quiz.ID, "current"))
+		var problem model.ProblemType
+		sqlString := `SELECT * FROM problem_type WHERE id = $1`
+		answer := ""
+		if err := global.Database.Get(&problem, sqlString, problemId); err == nil {
+			answer, _ = getProblemCorrectAnswer(&problem)
+		}
+		response := GroupQuizLeaderboardResponse{Index: i, ProblemId: problemId, Answer: answer}
+		answered, _ := global.Redis.HLen(ctx, answeredKey).Result()
+		players, _ := global.Redis.SCard(ctx, groupQuizKey(quiz.ID, "players")).Result()
+		response.AnsweredCount, response.PlayerCount = int(answered), int(players)
+		if response.Leaderboard, err = getGroupQuizLeaderboard(ctx, quiz.ID, quizLeaderboardSize); err != nil {
+			log.Printf("竞赛 %d 读取排行榜失败: %v", quiz.ID, err)
+		}
+		if err := utils.PublishToTopic(ctx, topic, GroupQuizLeaderboardEvent, &response); err != nil {
+			log.Printf("竞赛 %d 推送排行榜失败: %v", quiz.ID, err)
+		}
+		if i < len(problemIds)-1 {
+			time.Sleep(quizRevealInterval)
+		}
+	}
+	if leaseLost() {
+		return
+	}
+	if err := finishGroupQuiz(ctx, &quiz); err != nil {
+		log.Printf("竞赛 %d 保存结果失败: %v", quiz.ID, err)
+	}
+}
+
+// finishGroupQuiz 把最终成绩写入小组的竞赛记录并清理 Redis 中的状态
+func finishGroupQuiz(ctx context.Context, quiz *model.GroupQuiz) error {
+	items, err := getGroupQuizLeaderboard(ctx, quiz.ID, 0)
+	if err != nil {
+		return err
+	}
+	tx := global.Database.MustBegin()
+	sqlString := `INSERT INTO group_quiz_result (quiz_id, user_id, score, correct_count, rank) VALUES ($1, $2, $3, $4, $5)`
+	for _, item := range items {
+		if _, err := tx.Exec(sqlString, quiz.ID, item.UserInfo.UserId, item.Score, item.CorrectCount, item.Rank); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+	}
+	sqlString = `UPDATE group_quiz SET status = $1, finished_at = $2 WHERE id = $3 RETURNING *`
+	if err := tx.Get(quiz, sqlString, GroupQuizFinished, time.Now().Local(), quiz.ID); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	keys := []string{groupQuizKey(quiz.ID, "current"), groupQuizKey(quiz.ID, "players"),
+		groupQuizKey(quiz.ID, "scores"), groupQuizKey(quiz.ID, "correct"), groupQuizKey(quiz.ID, "problems"),
+		groupQuizKey(quiz.ID, "index"), groupQuizKey(quiz.ID, "runner")}
+	for i := 0; i < quiz.QuestionCount; i++ {
+		keys = append(keys, groupQuizKey(quiz.ID, "answered:"+strconv.Itoa(i)))
+	}
+	global.Redis.Del(ctx, keys...)
+	response, err := getGroupQuizResponse(quiz)
+	if err != nil {
+		return err
+	}
+	return utils.PublishToTopic(ctx, groupQuizTopic(quiz.ID), GroupQuizFinishedEvent, response)
+}
+
+// ResumeGroupQuizzes 接手租约已经过期的进行中竞赛，从中断的题目继续运行。
+// Redis 中的进度已经丢失的竞赛无法继续，按已有的成绩结束
+func ResumeGroupQuizzes(ctx context.Context) error {
+	var quizzes []model.GroupQuiz
+	sqlString := `SELECT * FROM group_quiz WHERE status = $1`
+	if err := global.Database.Select(&quizzes, sqlString, GroupQuizRunning); err != nil {
+		return err
+	}
+	for _, quiz := range quizzes {
+		runnerId, acquired, err := acquireGroupQuizRunner(ctx, quiz.ID)
+		if err != nil {
+			return err
+		}
+		if !acquired {
+			continue
+		}
+		var problemIds []int
+		raw, err := global.Redis.Get(ctx, groupQuizKey(quiz.ID, "problems")).Bytes()
+		if err == nil {
+			err = json.Unmarshal(raw, &problemIds)
+		}
+		if err != nil {
+			log.Printf("竞赛 %d 的进度已经丢失，直接结束", quiz.ID)
+			if err := finishGroupQuiz(ctx, &quiz); err != nil {
+				log.Printf("竞赛 %d 保存结果失败: %v", quiz.ID, err)
+			}
+			continue
+		}
+		start, err := global.Redis.Get(ctx, groupQuizKey(quiz.ID, "index")).Int()
+		if err != nil && err != redis.Nil {
+			return err
+		}
+		log.Printf("继续运行竞赛 %d，从第 %d 题开始", quiz.ID, start+1)
+		go runGroupQuiz(quiz, problemIds, start, runnerId)
+	}
+	return nil
+}
+
+// StartGroupQuizRecovery 启动时和之后定期接手中断的竞赛，每个进程只需要启动一次
+func StartGroupQuizRecovery() {
+	go func() {
+		ticker := time.NewTicker(quizRunnerLease)
+		defer ticker.Stop()
+		for ; true; <-ticker.C {
+			if err := ResumeGroupQuizzes(context.Background()); err != nil {
+				log.Printf("恢复竞赛失败: %v", err)
+			}
+		}
+	}()
+}
+
+// isGroupQuizCurrentProblem 判断题目是否是某个进行中竞赛正在作答的题目，此时不能通过其他接口查看答案
+func isGroupQuizCurrentProblem(ctx context.Context, problemId int) (bool, error) {
+	var quizIds []int
+	sqlString := `SELECT group_quiz.id FROM group_quiz
+		JOIN problem_in_problem_set ON problem_in_problem_set.problem_set_id = group_quiz.problem_set_id
+		WHERE group_quiz.status = $1 AND problem_in_problem_set.problem_id = $2`
+	if err := global.Database.Select(&quizIds, sqlString, GroupQuizRunning, problemId); err != nil {
+		return false, err
+	}
+	for _, quizId := range quizIds {
+		raw, err := global.Redis.Get(ctx, groupQuizKey(quizId, "current")).Bytes()
+		if err == redis.Nil {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+		var question GroupQuizQuestion
+		if json.Unmarshal(raw, &question) == nil && question.ProblemId == problemId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// answerGroupQuiz 立即批改参赛者对当前题目的答案，每道题只接受第一次作答
+func answerGroupQuiz(ctx context.Context, quizId int, userId int, request *GroupQuizAnswerRequest) GroupQuizAnswerResult {
+	result := GroupQuizAnswerResult{ProblemId: request.ProblemId}
+	now := time.Now().Local()
+	raw, err := global.Redis.Get(ctx, groupQuizKey(quizId, "current")).Bytes()
+	var question GroupQuizQuestion
+	if err != nil || json.Unmarshal(raw, &question) != nil || question.ProblemId != request.ProblemId {
+		result.Error = "该题目不在作答时间内"
+		return result
+	}
+	if now.After(question.Deadline) {
+		result.Error = "作答已超时"
+		return result
+	}
+	member := strconv.Itoa(userId)
+	answeredKey := groupQuizKey(quizId, "answered:"+strconv.Itoa(question.Index))
+	if ok, err := global.Redis.HSetNX(ctx, answeredKey, member, request.Answer).Result(); err != nil || !ok {
+		result.Error = "已经作答过该题目"
+		return result
+	}
+	global.Redis.Expire(ctx, answeredKey, quizStateExpiration)
+	var problem model.ProblemType
+	sqlString := `SELECT * FROM problem_type WHERE id = $1`
+	if err := global.Database.Get(&problem, sqlString, question.ProblemId); err != nil {
+		result.Error = "题目不存在"
+		return result
+	}
+	correctAnswer, err := getProblemCorrectAnswer(&problem)
+	if err != nil {
+		result.Error = "服务器错误"
+		return result
+	}
+	result.IsCorrect = checkProblemAnswer(&problem, correctAnswer, request.Answer)
+	if err := RecordProblemAttempt(ctx, userId, problem.ID, 0, result.IsCorrect); err != nil {
+		log.Printf("记录作答失败: %v", err)
+	}
+	if result.IsCorrect {
+		remaining := question.Deadline.Sub(now)
+		total := question.Deadline.Sub(question.StartedAt)
+		result.Points = quizBasePoints + int(float64(quizBasePoints)*float64(remaining)/float64(total))
+		global.Redis.HIncrBy(ctx, groupQuizKey(quizId, "correct"), member, 1)
+	}
+	score, err := global.Redis.ZIncrBy(ctx, groupQuizKey(quizId, "scores"), float64(result.Points), member).Result()
+	if err == nil {
+		result.Score = int(score)
+	}
+	return result
+}
+
+// CreateGroupQuiz godoc
+// @Schemes http
+// @Description 创建小组竞赛（只有小组管理员和组长可以创建），题集需要属于该小组、公开或者由自己创建
+// @Tags GroupQuiz
+// @Param quiz body GroupQuizCreateRequest true "小组ID、题集ID和每道题的作答时间（秒，默认20）"
+// @Success 200 {object} GroupQuizResponse "竞赛信息"
+// @Failure 400 {string} string "请求解析失败"/"题集中没有题目"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "题集不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_quiz/create [post]
+// @Security ApiKeyAuth
+func CreateGroupQuiz(c *gin.Context) {
+	var request GroupQuizCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if request.QuestionSeconds == 0 {
+		request.QuestionSeconds = defaultQuizQuestionSeconds
+	}
+	if request.QuestionSeconds < minQuizQuestionSeconds || request.QuestionSeconds > maxQuizQuestionSeconds {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	isAdmin, err := isGroupAdmin(request.GroupId, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isAdmin {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var problemSet model.ProblemSet
+	sqlString := `SELECT * FROM problem_set WHERE id = $1`
+	if err := global.Database.Get(&problemSet, sqlString, request.ProblemSetId); err != nil {
+		c.String(http.StatusNotFound, "题集不存在")
+		return
+	}
+	if problemSet.GroupId != request.GroupId && !problemSet.IsPublic && problemSet.UserId != c.GetInt("UserId") {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	problemIds, err := getProblemSetProblemIds(problemSet.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if len(problemIds) == 0 {
+		c.String(http.StatusBadRequest, "题集中没有题目")
+		return
+	}
+	var quiz model.GroupQuiz
+	sqlString = `INSERT INTO group_quiz (group_id, problem_set_id, host_id, status, question_seconds, question_count, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING *`
+	if err := global.Database.Get(&quiz, sqlString, request.GroupId, request.ProblemSetId, c.GetInt("UserId"),
+		GroupQuizWaiting, request.QuestionSeconds, len(problemIds), time.Now().Local()); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := getGroupQuizResponse(&quiz)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// StartGroupQuiz godoc
+// @Schemes http
+// @Description 开始小组竞赛（只有创建者和小组管理员可以开始），之后由服务器按时推送题目
+// @Tags GroupQuiz
+// @Param id path int true "竞赛ID"
+// @Success 200 {string} string "开始成功"
+// @Failure 400 {string} string "竞赛已经开始"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "竞赛不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_quiz/start/{id} [post]
+// @Security ApiKeyAuth
+func StartGroupQuiz(c *gin.Context) {
+	var quiz model.GroupQuiz
+	sqlString := `SELECT * FROM group_quiz WHERE id = $1`
+	if err := global.Database.Get(&quiz, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "竞赛不存在")
+		return
+	}
+	if quiz.HostId != c.GetInt("UserId") {
+		isAdmin, err := isGroupAdmin(quiz.GroupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isAdmin {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	problemIds, err := getProblemSetProblemIds(quiz.ProblemSetId)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 只有一个请求能把竞赛从等待状态改为进行中
+	sqlString = `UPDATE group_quiz SET status = $1, started_at = $2, question_count = $3
+		WHERE id = $4 AND status = $5 RETURNING *`
+	if err := global.Database.Get(&quiz, sqlString, GroupQuizRunning, time.Now().Local(), len(problemIds),
+		quiz.ID, GroupQuizWaiting); err != nil {
+		c.String(http.StatusBadRequest, "竞赛已经开始")
+		return
+	}
+	raw, _ := json.Marshal(problemIds)
+	if err := global.Redis.Set(c, groupQuizKey(quiz.ID, "problems"), raw, quizStateExpiration).Err(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	runnerId := uuid.New().String()
+	if err := global.Redis.Set(c, groupQuizKey(quiz.ID, "runner"), runnerId, quizRunnerLease).Err(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	go runGroupQuiz(quiz, problemIds, 0, runnerId)
+	c.String(http.StatusOK, "开始成功")
+}
+
+// GroupQuizWebSocket godoc
+// @Schemes http
+// @Description 以 WebSocket 加入小组竞赛（只有小组成员可以加入）。服务器推送的消息为 utils.PushEvent，类型包括
+// @Description quiz_joined（有人加入）、quiz_question（新题目）、quiz_answer（自己答案的批改结果）、
+// @Description quiz_leaderboard（每道题结束后的答案和排行榜）和 quiz_finished（最终成绩）；
+// @Description 客户端发送 GroupQuizAnswerRequest 作答，答对得分随剩余时间增加
+// @Tags GroupQuiz
+// @Param id path int true "竞赛ID"
+// @Success 101 {object} utils.PushEvent "事件流"
+// @Failure 400 {string} string "竞赛已经结束"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "竞赛不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_quiz/ws/{id} [get]
+// @Security ApiKeyAuth
+func GroupQuizWebSocket(c *gin.Context) {
+	var quiz model.GroupQuiz
+	sqlString := `SELECT * FROM group_quiz WHERE id = $1`
+	if err := global.Database.Get(&quiz, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "竞赛不存在")
+		return
+	}
+	userId := c.GetInt("UserId")
+	isMember, err := isGroupMember(quiz.GroupId, userId)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !isMember {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if quiz.Status == GroupQuizFinished {
+		c.String(http.StatusBadRequest, "竞赛已经结束")
+		return
+	}
+	userInfo, err := getBriefUserInfo(userId)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	server := websocket.Server{Handler: func(conn *websocket.Conn) {
+		ctx := context.Background()
+		subscriber := utils.SubscribePushTopic(userId, groupQuizTopic(quiz.ID))
+		defer utils.UnsubscribePush(subscriber)
+		member := strconv.Itoa(userId)
+		global.Redis.SAdd(ctx, groupQuizKey(quiz.ID, "players"), member)
+		// 断开后不再计入参赛人数，否则所有人作答后无法提前结束当前题；成绩仍然保留在排行榜中
+		defer global.Redis.SRem(ctx, groupQuizKey(quiz.ID, "players"), member)
+		global.Redis.Expire(ctx, groupQuizKey(quiz.ID, "players"), quizStateExpiration)
+		global.Redis.ZAddNX(ctx, groupQuizKey(quiz.ID, "scores"), &redis.Z{Member: member})
+		global.Redis.Expire(ctx, groupQuizKey(quiz.ID, "scores"), quizStateExpiration)
+		global.Redis.Expire(ctx, groupQuizKey(quiz.ID, "correct"), quizStateExpiration)
+		playerCount, _ := global.Redis.SCard(ctx, groupQuizKey(quiz.ID, "players")).Result()
+		_ = utils.PublishToTopic(ctx, groupQuizTopic(quiz.ID), GroupQuizJoinedEvent, &GroupQuizJoinedResponse{
+			UserInfo:    userInfo,
+			PlayerCount: int(playerCount),
+		})
+		// 竞赛进行中加入时补发当前题目
+		if raw, err := global.Redis.Get(ctx, groupQuizKey(quiz.ID, "current")).Bytes(); err == nil {
+			_ = websocket.JSON.Send(conn, &utils.PushEvent{Type: GroupQuizQuestionEvent, Data: raw, CreatedAt: time.Now().Local()})
+		}
+		closed := make(chan struct{})
+		go func() {
+			defer close(closed)
+			for {
+				var request GroupQuizAnswerRequest
+				if err := websocket.JSON.Receive(conn, &request); err != nil {
+					var syntaxError *json.SyntaxError
+					var typeError *json.UnmarshalTypeError
+					if errors.As(err, &syntaxError) || errors.As(err, &typeError) {
+						continue
+					}
+					return
+				}
+				result := answerGroupQuiz(ctx, quiz.ID, userId, &request)
+				data, _ := json.Marshal(&result)
+				if err := websocket.JSON.Send(conn, &utils.PushEvent{
+					Type:      GroupQuizAnswerEvent,
+					Data:      data,
+					CreatedAt: time.Now().Local(),
+				}); err != nil {
+					return
+				}
+			}
+		}()
+		for {
+			select {
+			case <-closed:
+				return
+			case event, ok := <-subscriber.Events:
+				if !ok {
+					return
+				}
+				if err := websocket.JSON.Send(conn, &event); err != nil {
+					return
+				}
+				if event.Type == GroupQuizFinishedEvent {
+					return
+				}
+			}
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
+
+// GetGroupQuizzes godoc
+// @Schemes http
+// @Description 获取小组的竞赛记录（只有小组成员可以查看），按创建时间倒序
+// @Tags GroupQuiz
+// @Param filter query GroupQuizFilter true "小组ID和分页"
+// @Success 200 {object} AllGroupQuizResponse "竞赛记录"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /group_quiz/all [get]
+// @Security ApiKeyAuth
+func GetGroupQuizzes(c *gin.Context) {
+	var filter GroupQuizFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isMember, err := isGroupMember(filter.GroupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isMember {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	var totalCount int
+	sqlString := `SELECT count(*) FROM group_quiz WHERE group_id = $1`
+	if err := global.Database.Get(&totalCount, sqlString, filter.GroupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT * FROM group_quiz WHERE group_id = $1 ORDER BY created_at DESC, id DESC`
+	if filter.Limit != nil {
+		sqlString += ` LIMIT ` + strconv.Itoa(*filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += ` OFFSET ` + strconv.Itoa(*filter.Offset)
+	}
+	var quizzes []model.GroupQuiz
+	if err := global.Database.Select(&quizzes, sqlString, filter.GroupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]GroupQuizResponse, 0, len(quizzes))
+	for i := range quizzes {
+		response, err := getGroupQuizResponse(&quizzes[i])
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		responses = append(responses, *response)
+	}
+	c.JSON(http.StatusOK, AllGroupQuizResponse{
+		TotalCount: totalCount,
+		Quizzes:    responses,
+	})
+}
+
+// GetGroupQuiz godoc
+// @Schemes http
+// @Description 获取小组竞赛的信息和最终成绩（只有小组成员可以查看）
+// @Tags GroupQuiz
+// @Param id path int true "竞赛ID"
+// @Success 200 {object} GroupQuizResponse "竞赛信息"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "竞赛不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group_quiz/get/{id} [get]
+// @Security ApiKeyAuth
+func GetGroupQuiz(c *gin.Context) {
+	var quiz model.GroupQuiz
+	sqlString := `SELECT * FROM group_quiz WHERE id = $1`
+	if err := global.Database.Get(&quiz, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "竞赛不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isMember, err := isGroupMember(quiz.GroupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isMember {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	response, err := getGroupQuizResponse(&quiz)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
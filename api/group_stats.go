@@ -0,0 +1,243 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultStatsWeeks   = 12
+	maxStatsWeeks       = 52
+	hardestProblemCount = 10
+	// 超过该天数没有任何活动的成员视为落后
+	inactiveMemberDays = 14
+)
+
+type GroupMemberGrowth struct {
+	Week   time.Time `json:"week" db:"week"`
+	Joined int       `json:"joined" db:"joined"`
+	Total  int       `json:"total" db:"total"`
+}
+
+type GroupWeeklyActivity struct {
+	Week          time.Time `json:"week" db:"week"`
+	Discussions   int       `json:"discussions" db:"discussions"`
+	Replies       int       `json:"replies" db:"replies"`
+	ActiveMembers int       `json:"active_members" db:"active_members"`
+}
+
+type GroupProblemSetStats struct {
+	ProblemSetId int     `json:"problem_set_id" db:"problem_set_id"`
+	Name         string  `json:"name" db:"name"`
+	ProblemCount int     `json:"problem_count" db:"problem_count"`
+	Attempts     int     `json:"attempts" db:"attempts"`
+	Correct      int     `json:"correct" db:"correct"`
+	Accuracy     float64 `json:"accuracy" db:"accuracy"`
+	WrongRecords int     `json:"wrong_records" db:"wrong_records"`
+}
+
+type GroupProblemStats struct {
+	ProblemId    int     `json:"problem_id" db:"problem_id"`
+	Description  string  `json:"description" db:"description"`
+	WrongMembers int     `json:"wrong_members" db:"wrong_members"`
+	WrongCount   int     `json:"wrong_count" db:"wrong_count"`
+	Attempts     int     `json:"attempts" db:"attempts"`
+	Accuracy     float64 `json:"accuracy" db:"accuracy"`
+}
+
+type GroupMemberProgress struct {
+	UserId       int              `json:"-" db:"user_id"`
+	UserInfo     UserInfoResponse `json:"user_info" db:"-"`
+	Solved       int              `json:"solved" db:"solved"`
+	WrongCount   int              `json:"wrong_count" db:"wrong_count"`
+	LastActiveAt *time.Time       `json:"last_active_at" db:"last_active_at"`
+	Reason       string           `json:"reason" db:"-"` // inactive: 长时间没有活动, low_progress: 做对的题目数不到平均值的一半
+}
+
+type GroupStatsResponse struct {
+	MemberCount     int                    `json:"member_count"`
+	ActiveMembers   int                    `json:"active_members"`
+	ProblemCount    int                    `json:"problem_count"`
+	MemberGrowth    []GroupMemberGrowth    `json:"member_growth"`
+	WeeklyActivity  []GroupWeeklyActivity  `json:"weekly_activity"`
+	ProblemSets     []GroupProblemSetStats `json:"problem_sets"`
+	HardestProblems []GroupProblemStats    `json:"hardest_problems"`
+	BehindMembers   []GroupMemberProgress  `json:"behind_members"`
+}
+
+// 小组题集中的所有题目
+const groupProblemsSql = `SELECT DISTINCT p.problem_id FROM problem_in_problem_set p
+	JOIN problem_set s ON s.id = p.problem_set_id WHERE s.group_id = $1`
+
+// GetGroupStats godoc
+// @Schemes http
+// @Description 获取小组的统计数据（只有小组管理员和组长可以查看）：按周统计的成员增长（只统计当前成员）、讨论和回复数、活跃成员数，
+// @Description 小组各题集的正确率、小组成员错得最多的题目，以及落后的成员（超过14天没有活动，或做对的小组题目数不到平均值的一半，不包括管理员）
+// @Tags Group
+// @Param id path int true "小组ID"
+// @Param weeks query int false "统计的周数，默认为12，最大为52"
+// @Success 200 {object} GroupStatsResponse "统计数据"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "小组不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /group/stats/{id} [get]
+// @Security ApiKeyAuth
+func GetGroupStats(c *gin.Context) {
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	weeks := defaultStatsWeeks
+	if c.Query("weeks") != "" {
+		if weeks, err = strconv.Atoi(c.Query("weeks")); err != nil || weeks <= 0 || weeks > maxStatsWeeks {
+			c.String(http.StatusBadRequest, "请求解析失败")
+			return
+		}
+	}
+	var count int
+	sqlString := `SELECT count(*) FROM "group" WHERE id = $1`
+	if err := global.Database.Get(&count, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if count == 0 {
+		c.String(http.StatusNotFound, "小组不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isAdmin, err := isGroupAdmin(groupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isAdmin {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	now := time.Now().Local()
+	response := GroupStatsResponse{
+		MemberGrowth:    make([]GroupMemberGrowth, 0),
+		WeeklyActivity:  make([]GroupWeeklyActivity, 0),
+		ProblemSets:     make([]GroupProblemSetStats, 0),
+		HardestProblems: make([]GroupProblemStats, 0),
+		BehindMembers:   make([]GroupMemberProgress, 0),
+	}
+	sqlString = `SELECT count(*) FROM group_member WHERE group_id = $1`
+	if err := global.Database.Get(&response.MemberCount, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT count(*) FROM (` + groupProblemsSql + `) t`
+	if err := global.Database.Get(&response.ProblemCount, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	// 成员的活动包括发起讨论、回复讨论和作答小组题集中的题目
+	activitySql := `SELECT user_id, created_at FROM discussion WHERE group_id = $1
+		UNION ALL SELECT r.user_id, r.created_at FROM discussion_review r JOIN discussion d ON d.id = r.discussion_id
+			WHERE d.group_id = $1
+		UNION ALL SELECT user_id, created_at FROM user_problem_attempt WHERE problem_id IN (` + groupProblemsSql + `)`
+	sqlString = `SELECT count(DISTINCT a.user_id) FROM (` + activitySql + `) a
+		JOIN group_member m ON m.user_id = a.user_id AND m.group_id = $1 WHERE a.created_at >= $2`
+	if err := global.Database.Get(&response.ActiveMembers, sqlString, groupId, now.AddDate(0, 0, -7)); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	weeksSql := `SELECT week FROM generate_series(date_trunc('week', $2::timestamp) - ($3 - 1) * interval '1 week',
+		date_trunc('week', $2::timestamp), interval '1 week') AS week`
+	sqlString = `SELECT w.week,
+		(SELECT count(*) FROM group_member WHERE group_id = $1 AND created_at >= w.week
+			AND created_at < w.week + interval '1 week') AS joined,
+		(SELECT count(*) FROM group_member WHERE group_id = $1 AND created_at < w.week + interval '1 week') AS total
+		FROM (` + weeksSql + `) w ORDER BY w.week`
+	if err := global.Database.Select(&response.MemberGrowth, sqlString, groupId, now, weeks); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT w.week,
+		(SELECT count(*) FROM discussion WHERE group_id = $1 AND created_at >= w.week
+			AND created_at < w.week + interval '1 week') AS discussions,
+		(SELECT count(*) FROM discussion_review r JOIN discussion d ON d.id = r.discussion_id WHERE d.group_id = $1
+			AND r.created_at >= w.week AND r.created_at < w.week + interval '1 week') AS replies,
+		(SELECT count(DISTINCT a.user_id) FROM (` + activitySql + `) a
+			JOIN group_member m ON m.user_id = a.user_id AND m.group_id = $1
+			WHERE a.created_at >= w.week AND a.created_at < w.week + interval '1 week') AS active_members
+		FROM (` + weeksSql + `) w ORDER BY w.week`
+	if err := global.Database.Select(&response.WeeklyActivity, sqlString, groupId, now, weeks); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	// 正确率只统计小组成员的作答
+	sqlString = `SELECT s.id AS problem_set_id, s.name,
+		(SELECT count(*) FROM problem_in_problem_set WHERE problem_set_id = s.id) AS problem_count,
+		count(a.id) AS attempts, count(a.id) FILTER (WHERE a.is_correct) AS correct,
+		COALESCE(round(100.0 * count(a.id) FILTER (WHERE a.is_correct) / NULLIF(count(a.id), 0), 2), 0) AS accuracy,
+		(SELECT count(*) FROM user_wrong_record w JOIN group_member m ON m.user_id = w.user_id AND m.group_id = $1
+			WHERE w.problem_id IN (SELECT problem_id FROM problem_in_problem_set WHERE problem_set_id = s.id)) AS wrong_records
+		FROM problem_set s
+		LEFT JOIN problem_in_problem_set p ON p.problem_set_id = s.id
+		LEFT JOIN user_problem_attempt a ON a.problem_id = p.problem_id
+			AND a.user_id IN (SELECT user_id FROM group_member WHERE group_id = $1)
+		WHERE s.group_id = $1 GROUP BY s.id, s.name ORDER BY s.id`
+	if err := global.Database.Select(&response.ProblemSets, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT t.problem_id, p.description, t.wrong_members, t.wrong_count,
+		(SELECT count(*) FROM user_problem_attempt a JOIN group_member m ON m.user_id = a.user_id AND m.group_id = $1
+			WHERE a.problem_id = t.problem_id) AS attempts,
+		COALESCE((SELECT round(100.0 * count(*) FILTER (WHERE a.is_correct) / NULLIF(count(*), 0), 2)
+			FROM user_problem_attempt a JOIN group_member m ON m.user_id = a.user_id AND m.group_id = $1
+			WHERE a.problem_id = t.problem_id), 0) AS accuracy
+		FROM (SELECT w.problem_id, count(*) AS wrong_members, sum(w.count) AS wrong_count
+			FROM user_wrong_record w JOIN group_member m ON m.user_id = w.user_id AND m.group_id = $1
+			WHERE w.problem_id IN (` + groupProblemsSql + `) GROUP BY w.problem_id) t
+		JOIN problem_type p ON p.id = t.problem_id
+		ORDER BY t.wrong_members DESC, t.wrong_count DESC, t.problem_id LIMIT $2`
+	if err := global.Database.Select(&response.HardestProblems, sqlString, groupId, hardestProblemCount); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+
+	var progress []GroupMemberProgress
+	sqlString = `SELECT m.user_id,
+		(SELECT count(DISTINCT problem_id) FROM user_problem_attempt WHERE user_id = m.user_id AND is_correct
+			AND problem_id IN (` + groupProblemsSql + `)) AS solved,
+		(SELECT COALESCE(sum(count), 0) FROM user_wrong_record WHERE user_id = m.user_id
+			AND problem_id IN (` + groupProblemsSql + `)) AS wrong_count,
+		(SELECT max(a.created_at) FROM (` + activitySql + `) a WHERE a.user_id = m.user_id) AS last_active_at
+		FROM group_member m WHERE m.group_id = $1 AND m.is_admin = false AND m.is_owner = false ORDER BY m.user_id`
+	if err := global.Database.Select(&progress, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	totalSolved := 0
+	for _, member := range progress {
+		totalSolved += member.Solved
+	}
+	inactiveSince := now.AddDate(0, 0, -inactiveMemberDays)
+	for _, member := range progress {
+		if member.LastActiveAt == nil || member.LastActiveAt.Before(inactiveSince) {
+			member.Reason = "inactive"
+		} else if response.ProblemCount > 0 && member.Solved*2*len(progress) < totalSolved {
+			member.Reason = "low_progress"
+		} else {
+			continue
+		}
+		if member.UserInfo, err = getBriefUserInfo(member.UserId); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		response.BehindMembers = append(response.BehindMembers, member)
+	}
+	c.JSON(http.StatusOK, response)
+}
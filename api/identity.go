@@ -0,0 +1,286 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+type OAuthLoginRequest struct {
+	Code string `json:"code" binding:"required"`
+	// RedirectURI 是客户端发起授权时使用的回调地址，微信登录不需要
+	RedirectURI string `json:"redirect_uri"`
+	Device      string `json:"device"`
+	RememberMe  bool   `json:"remember_me"`
+}
+
+// OAuthLoginResponse 中 Code 为201表示新注册或未设置密码的用户，需要通过 /weixin-complete 完善信息
+type OAuthLoginResponse struct {
+	Code         int    `json:"code"`
+	Message      string `json:"message"`
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int    `json:"expires_in,omitempty"`
+}
+
+type IdentityBindRequest struct {
+	Code        string `json:"code" binding:"required"`
+	RedirectURI string `json:"redirect_uri"`
+}
+
+type IdentityResponse struct {
+	Provider  string    `json:"provider"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type AllIdentityResponse struct {
+	TotalCount int                `json:"total_count"`
+	Identities []IdentityResponse `json:"identities"`
+}
+
+// exchangeIdentity 用授权码换取第三方身份，失败时已经写好了响应
+func exchangeIdentity(c *gin.Context, providerName string, code string, redirectURI string) (*utils.ExternalIdentity, bool) {
+	provider, ok := utils.GetIdentityProvider(providerName)
+	if !ok {
+		c.String(http.StatusNotFound, "登录方式不存在")
+		return nil, false
+	}
+	identity, err := provider.Exchange(c, code, redirectURI)
+	if err != nil {
+		log.Printf("第三方登录 %s 失败: %v", providerName, err)
+		c.String(http.StatusBadRequest, "第三方登录失败")
+		return nil, false
+	}
+	return identity, true
+}
+
+// registerIdentityUser 为第一次登录的第三方身份创建用户，用户名随机生成，之后需要完善信息。
+// 第三方昵称经过敏感词过滤，命中 block 或 review 词时改用随机用户名
+func registerIdentityUser(identity *utils.ExternalIdentity) (*model.User, error) {
+	randomUsername := uuid.New().String()
+	nickName := randomUsername
+	if result := utils.FilterText(identity.Name); identity.Name != "" && !result.Blocked && !result.NeedReview {
+		nickName = result.Text
+	}
+	var user model.User
+	tx := global.Database.MustBegin()
+	sqlString := `INSERT INTO "user" (name, email, phone, password, created_at, nick_name)
+		VALUES ($1, '', '', '', $2, $3) RETURNING *`
+	if err := tx.Get(&user, sqlString, randomUsername, time.Now().Local(), nickName); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	sqlString = `INSERT INTO user_identity (user_id, provider, subject, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := tx.Exec(sqlString, user.ID, identity.Provider, identity.Subject, time.Now().Local()); err != nil {
+		_ = tx.Rollback()
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// oauthLogin 用第三方身份登录，身份没有绑定用户时自动注册
+func oauthLogin(c *gin.Context, providerName string, request OAuthLoginRequest) {
+	identity, ok := exchangeIdentity(c, providerName, request.Code, request.RedirectURI)
+	if !ok {
+		return
+	}
+	user := &model.User{}
+	sqlString := `SELECT "user".* FROM "user" JOIN user_identity ON user_identity.user_id = "user".id
+		WHERE user_identity.provider = $1 AND user_identity.subject = $2`
+	err := global.Database.Get(user, sqlString, identity.Provider, identity.Subject)
+	if err == sql.ErrNoRows {
+		if user, err = registerIdentityUser(identity); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if ban, err := getActiveBan(user.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if ban != nil {
+		recordLoginHistory(c, user.ID, providerName, LoginFailBanned)
+		c.String(http.StatusForbidden, "账号已被封禁")
+		return
+	}
+	tokens, err := createUserSession(c, user.ID, global.Role(user.Role), request.Device, request.RememberMe)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	recordLoginHistory(c, user.ID, providerName, "")
+	c.Set("Role", global.Role(user.Role))
+	c.Set("UserId", user.ID)
+	response := OAuthLoginResponse{
+		Code:         200,
+		Message:      "登录成功",
+		Token:        tokens.Token,
+		RefreshToken: tokens.RefreshToken,
+		ExpiresIn:    tokens.ExpiresIn,
+	}
+	if user.Email == "" || user.Password == "" {
+		response.Code = 201
+		response.Message = "待完善信息"
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// bindIdentity 把第三方身份绑定到当前用户，每种登录方式只能绑定一个第三方账号
+func bindIdentity(c *gin.Context, providerName string, code string, redirectURI string) {
+	identity, ok := exchangeIdentity(c, providerName, code, redirectURI)
+	if !ok {
+		return
+	}
+	userId := c.GetInt("UserId")
+	var existing model.UserIdentity
+	sqlString := `SELECT * FROM user_identity WHERE (provider = $1 AND subject = $2) OR (provider = $1 AND user_id = $3)`
+	if err := global.Database.Get(&existing, sqlString, identity.Provider, identity.Subject, userId); err == nil {
+		if existing.UserId == userId {
+			c.String(http.StatusConflict, "已绑定该登录方式")
+		} else {
+			c.String(http.StatusConflict, "该第三方账号已被其他用户绑定")
+		}
+		return
+	} else if err != sql.ErrNoRows {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `INSERT INTO user_identity (user_id, provider, subject, created_at) VALUES ($1, $2, $3, $4)`
+	if _, err := global.Database.Exec(sqlString, userId, identity.Provider, identity.Subject, time.Now().Local()); err != nil {
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			c.String(http.StatusConflict, "该第三方账号已被其他用户绑定")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "绑定成功")
+}
+
+// OAuthLogin godoc
+// @Schemes http
+// @Description 第三方登录，用客户端拿到的授权码登录，第三方账号没有绑定用户时自动注册
+// @Tags Authentication
+// @Param provider path string true "登录方式，如 weixin 或配置的 OIDC 名称"
+// @Param info body OAuthLoginRequest true "授权码"
+// @Success 200 {object} OAuthLoginResponse "用户登陆反馈"
+// @Failure 400 {string} string "请求解析失败"/"第三方登录失败"
+// @Failure 403 {string} string "账号已被封禁"
+// @Failure 404 {string} string "登录方式不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /oauth/login/{provider} [post]
+func OAuthLogin(c *gin.Context) {
+	var request OAuthLoginRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	oauthLogin(c, c.Param("provider"), request)
+}
+
+// BindIdentity godoc
+// @Schemes http
+// @Description 为当前用户绑定第三方账号
+// @Tags User
+// @Param provider path string true "登录方式"
+// @Param info body IdentityBindRequest true "授权码"
+// @Success 200 {string} string "绑定成功"
+// @Failure 400 {string} string "请求解析失败"/"第三方登录失败"
+// @Failure 404 {string} string "登录方式不存在"
+// @Failure 409 {string} string "已绑定该登录方式"/"该第三方账号已被其他用户绑定"
+// @Failure default {string} string "服务器错误"
+// @Router /user/identity/bind/{provider} [post]
+// @Security ApiKeyAuth
+func BindIdentity(c *gin.Context) {
+	var request IdentityBindRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	bindIdentity(c, c.Param("provider"), request.Code, request.RedirectURI)
+}
+
+// UnbindIdentity godoc
+// @Schemes http
+// @Description 解绑当前用户的第三方账号，没有设置密码时至少需要保留一个第三方账号
+// @Tags User
+// @Param provider path string true "登录方式"
+// @Success 200 {string} string "解绑成功"
+// @Failure 400 {string} string "至少保留一种登录方式"
+// @Failure 404 {string} string "未绑定该登录方式"
+// @Failure default {string} string "服务器错误"
+// @Router /user/identity/unbind/{provider} [delete]
+// @Security ApiKeyAuth
+func UnbindIdentity(c *gin.Context) {
+	userId := c.GetInt("UserId")
+	provider := c.Param("provider")
+	var loginMethods struct {
+		HasPassword   bool `db:"has_password"`
+		HasIdentity   bool `db:"has_identity"`
+		IdentityCount int  `db:"identity_count"`
+	}
+	sqlString := `SELECT password <> '' AS has_password,
+		EXISTS (SELECT 1 FROM user_identity WHERE user_id = $1 AND provider = $2) AS has_identity,
+		(SELECT count(*) FROM user_identity WHERE user_id = $1) AS identity_count
+		FROM "user" WHERE id = $1`
+	if err := global.Database.Get(&loginMethods, sqlString, userId, provider); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !loginMethods.HasIdentity {
+		c.String(http.StatusNotFound, "未绑定该登录方式")
+		return
+	}
+	if !loginMethods.HasPassword && loginMethods.IdentityCount <= 1 {
+		c.String(http.StatusBadRequest, "至少保留一种登录方式")
+		return
+	}
+	sqlString = `DELETE FROM user_identity WHERE user_id = $1 AND provider = $2`
+	if _, err := global.Database.Exec(sqlString, userId, provider); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "解绑成功")
+}
+
+// GetUserIdentities godoc
+// @Schemes http
+// @Description 获取当前用户绑定的第三方账号
+// @Tags User
+// @Success 200 {object} AllIdentityResponse "第三方账号"
+// @Failure default {string} string "服务器错误"
+// @Router /user/identity/all [get]
+// @Security ApiKeyAuth
+func GetUserIdentities(c *gin.Context) {
+	var identities []model.UserIdentity
+	sqlString := `SELECT * FROM user_identity WHERE user_id = $1 ORDER BY created_at`
+	if err := global.Database.Select(&identities, sqlString, c.GetInt("UserId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]IdentityResponse, 0, len(identities))
+	for _, identity := range identities {
+		responses = append(responses, IdentityResponse{
+			Provider:  identity.Provider,
+			Subject:   identity.Subject,
+			CreatedAt: identity.CreatedAt,
+		})
+	}
+	c.JSON(http.StatusOK, AllIdentityResponse{
+		TotalCount: len(responses),
+		Identities: responses,
+	})
+}
@@ -0,0 +1,156 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// InitJobHandlers 注册所有后台任务类型，需要在启动任务工作协程之前调用
+func InitJobHandlers() {
+	utils.RegisterJobHandler(PDFOCRJobType, runPDFOCRJob, utils.JobOptions{MaxAttempts: 2})
+	utils.RegisterJobHandler(utils.MailJobType, utils.DeliverMailJob, utils.JobOptions{MaxAttempts: 5, Backoff: 30 * time.Second})
+}
+
+type AllJobResponse struct {
+	TotalCount int         `json:"total_count"`
+	Jobs       []utils.Job `json:"jobs"`
+}
+
+// GetJob godoc
+// @Schemes http
+// @Description 获取后台任务的状态、进度和（部分）结果（只有任务创建者和管理员可以查看）
+// @Tags Job
+// @Param id path string true "任务ID"
+// @Success 200 {object} utils.Job "任务信息"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "任务不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /jobs/{id} [get]
+// @Security ApiKeyAuth
+func GetJob(c *gin.Context) {
+	job, err := utils.GetJob(c, c.Param("id"))
+	if err == utils.ErrJobNotFound {
+		c.String(http.StatusNotFound, "任务不存在")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && job.UserId != c.GetInt("UserId") {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	c.JSON(http.StatusOK, job)
+}
+
+// GetJobResult godoc
+// @Schemes http
+// @Description 获取已完成的后台任务的结果（只有任务创建者和管理员可以查看）
+// @Tags Job
+// @Param id path string true "任务ID"
+// @Success 200 {object} object "任务结果，结构由任务类型决定"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "任务不存在"
+// @Failure 409 {string} string "任务尚未完成"/"任务执行失败"
+// @Failure default {string} string "服务器错误"
+// @Router /jobs/{id}/result [get]
+// @Security ApiKeyAuth
+func GetJobResult(c *gin.Context) {
+	job, err := utils.GetJob(c, c.Param("id"))
+	if err == utils.ErrJobNotFound {
+		c.String(http.StatusNotFound, "任务不存在")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && job.UserId != c.GetInt("UserId") {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if job.Status == utils.JobFailed {
+		c.String(http.StatusConflict, "任务执行失败")
+		return
+	}
+	if job.Status != utils.JobSucceeded {
+		c.String(http.StatusConflict, "任务尚未完成")
+		return
+	}
+	c.Data(http.StatusOK, "application/json; charset=utf-8", job.Result)
+}
+
+// GetDeadJobs godoc
+// @Schemes http
+// @Description 获取重试耗尽后进入死信队列的任务（只有管理员可以查看）
+// @Tags Job
+// @Param offset query int false "偏移量"
+// @Param limit query int false "数量，默认为20"
+// @Success 200 {object} AllJobResponse "任务列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /jobs/dead [get]
+// @Security ApiKeyAuth
+func GetDeadJobs(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	offset, limit := 0, 20
+	var err error
+	if c.Query("offset") != "" {
+		if offset, err = strconv.Atoi(c.Query("offset")); err != nil || offset < 0 {
+			c.String(http.StatusBadRequest, "请求解析失败")
+			return
+		}
+	}
+	if c.Query("limit") != "" {
+		if limit, err = strconv.Atoi(c.Query("limit")); err != nil || limit <= 0 {
+			c.String(http.StatusBadRequest, "请求解析失败")
+			return
+		}
+	}
+	jobs, total, err := utils.GetDeadJobs(c, offset, limit)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllJobResponse{
+		TotalCount: total,
+		Jobs:       jobs,
+	})
+}
+
+// RetryDeadJob godoc
+// @Schemes http
+// @Description 重新执行死信队列中的任务（只有管理员可以操作）
+// @Tags Job
+// @Param id path string true "任务ID"
+// @Success 200 {string} string "重试成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "任务不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /jobs/dead/{id}/retry [post]
+// @Security ApiKeyAuth
+func RetryDeadJob(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	err := utils.RetryDeadJob(c, c.Param("id"))
+	if err == utils.ErrJobNotFound {
+		c.String(http.StatusNotFound, "任务不存在")
+		return
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "重试成功")
+}
@@ -0,0 +1,685 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	LeaderboardWeek  = "week"
+	LeaderboardMonth = "month"
+	LeaderboardAll   = "all"
+)
+
+const (
+	LeaderboardSolved   = "solved"
+	LeaderboardAccuracy = "accuracy"
+	LeaderboardStreak   = "streak"
+)
+
+const (
+	// 作答次数达到该值后才参与正确率排行
+	minAccuracyAttempts     = 5
+	defaultLeaderboardLimit = 50
+	leaderboardBuiltKey     = "leaderboard:built:v2"
+	leaderboardGlobalScope  = "global"
+)
+
+type LeaderboardFilter struct {
+	Period string `json:"period" form:"period"`
+	Metric string `json:"metric" form:"metric"`
+	Offset *int   `json:"offset" form:"offset"`
+	Limit  *int   `json:"limit" form:"limit"`
+}
+
+type LeaderboardItem struct {
+	Rank     int              `json:"rank"`
+	UserInfo UserInfoResponse `json:"user_info"`
+	Value    float64          `json:"value"`
+}
+
+type LeaderboardResponse struct {
+	Period     string            `json:"period"`
+	Metric     string            `json:"metric"`
+	TotalCount int               `json:"total_count"`
+	Items      []LeaderboardItem `json:"items"`
+}
+
+type LeaderboardPrivacyRequest struct {
+	Hidden bool `json:"hidden"`
+}
+
+type LeaderboardPrivacyResponse struct {
+	Hidden bool `json:"hidden"`
+}
+
+type ProblemSubmitRequest struct {
+	Answer       string `json:"answer"`
+	ProblemSetId int    `json:"problem_set_id"`
+}
+
+type ProblemSubmitResponse struct {
+	IsCorrect     bool   `json:"is_correct"`
+	CorrectAnswer string `json:"correct_answer"`
+}
+
+// leaderboardPeriodKey 返回 t 所在的周、月或总榜的周期标识
+func leaderboardPeriodKey(period string, t time.Time) string {
+	switch period {
+	case LeaderboardWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%s:%d-%02d", LeaderboardWeek, year, week)
+	case LeaderboardMonth:
+		return fmt.Sprintf("%s:%s", LeaderboardMonth, t.Format("2006-01"))
+	}
+	return LeaderboardAll
+}
+
+// leaderboardPeriodKeys 返回 t 所在的各周期标识及其过期时间（总榜不过期）
+func leaderboardPeriodKeys(t time.Time) map[string]time.Duration {
+	return map[string]time.Duration{
+		leaderboardPeriodKey(LeaderboardWeek, t):  8 * 7 * 24 * time.Hour,
+		leaderboardPeriodKey(LeaderboardMonth, t): 400 * 24 * time.Hour,
+		LeaderboardAll: 0,
+	}
+}
+
+func leaderboardKey(scope string, name string, period string) string {
+	return fmt.Sprintf("leaderboard:%s:%s:%s", scope, name, period)
+}
+
+func leaderboardAreaScope(areaId int) string {
+	return "area:" + strconv.Itoa(areaId)
+}
+
+func leaderboardGroupScope(groupId int) string {
+	return "group:" + strconv.Itoa(groupId)
+}
+
+// leaderboardDay 返回日期的天数编号，用于判断连续作答
+func leaderboardDay(t time.Time) int64 {
+	year, month, day := t.Date()
+	return time.Date(year, month, day, 0, 0, 0, 0, time.UTC).Unix() / (24 * 3600)
+}
+
+// updatePeriodScript 原子地更新一个周期的作答次数、做对次数、做对的题目、做对题目数和正确率。
+// 本周期已经做对过的题目再次做对时不计入，避免反复提交刷高正确率。
+// KEYS: attempts, correct, solved_problems, solved, accuracy；ARGV: 用户, 题目, 是否做对, 正确率的最少作答次数, 过期秒数
+var updatePeriodScript = redis.NewScript(`
+if ARGV[3] == '1' and redis.call('SISMEMBER', KEYS[3], ARGV[2]) == 1 then
+	return tonumber(redis.call('HGET', KEYS[1], ARGV[1]) or '0')
+end
+local attempts = redis.call('HINCRBY', KEYS[1], ARGV[1], 1)
+local correct = tonumber(redis.call('HGET', KEYS[2], ARGV[1]) or '0')
+if ARGV[3] == '1' then
+	correct = redis.call('HINCRBY', KEYS[2], ARGV[1], 1)
+	redis.call('SADD', KEYS[3], ARGV[2])
+	redis.call('ZINCRBY', KEYS[4], 1, ARGV[1])
+end
+if attempts >= tonumber(ARGV[4]) then
+	redis.call('ZADD', KEYS[5], math.floor(correct * 10000 / attempts) / 100, ARGV[1])
+end
+local expiration = tonumber(ARGV[5])
+if expiration > 0 then
+	for i = 1, #KEYS do
+		redis.call('EXPIRE', KEYS[i], expiration)
+	end
+end
+return attempts
+`)
+
+// updateStreakScript 原子地更新连续作答天数，当天已经作答过时不变，昨天作答过时加一，否则重新从1开始。
+// KEYS: streak_last（最后作答的天数编号）, streak；ARGV: 用户, 今天
+var updateStreakScript = redis.NewScript(`
+local today = tonumber(ARGV[2])
+local last = tonumber(redis.call('ZSCORE', KEYS[1], ARGV[1]) or '-1')
+if last == today - 1 then
+	redis.call('ZINCRBY', KEYS[2], 1, ARGV[1])
+elseif last < today - 1 then
+	redis.call('ZADD', KEYS[2], 1, ARGV[1])
+end
+if last < today then
+	redis.call('ZADD', KEYS[1], today, ARGV[1])
+end
+return 0
+`)
+
+// pruneStreakScript 移除已经中断的连续作答记录，之后排行中只剩下仍然有效的记录。
+// KEYS: streak_last, streak；ARGV: 仍然有效的最早一天
+var pruneStreakScript = redis.NewScript(`
+local broken = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+for _, member in ipairs(broken) do
+	redis.call('ZREM', KEYS[2], member)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', '(' .. ARGV[1])
+return #broken
+`)
+
+// updateLeaderboards 根据一次作答更新全站、对应领域和题目所在小组的排行：
+// 做对的不同题目数、作答次数足够时的正确率，以及连续作答的天数
+func updateLeaderboards(ctx context.Context, attempt *model.ProblemAttempt, groupIds []int) error {
+	scopes := []string{leaderboardGlobalScope}
+	if attempt.AreaId != 0 {
+		scopes = append(scopes, leaderboardAreaScope(attempt.AreaId))
+	}
+	for _, groupId := range groupIds {
+		scopes = append(scopes, leaderboardGroupScope(groupId))
+	}
+	member := strconv.Itoa(attempt.UserId)
+	isCorrect := "0"
+	if attempt.IsCorrect {
+		isCorrect = "1"
+	}
+	for _, scope := range scopes {
+		for period, expiration := range leaderboardPeriodKeys(attempt.CreatedAt) {
+			keys := []string{
+				leaderboardKey(scope, "attempts", period),
+				leaderboardKey(scope, "correct", period),
+				leaderboardKey(scope, "solved_problems:"+member, period),
+				leaderboardKey(scope, LeaderboardSolved, period),
+				leaderboardKey(scope, LeaderboardAccuracy, period),
+			}
+			if err := updatePeriodScript.Run(ctx, global.Redis, keys, member, attempt.ProblemId, isCorrect,
+				minAccuracyAttempts, int64(expiration/time.Second)).Err(); err != nil {
+				return err
+			}
+		}
+		keys := []string{
+			leaderboardKey(scope, "streak_last", LeaderboardAll),
+			leaderboardKey(scope, LeaderboardStreak, LeaderboardAll),
+		}
+		if err := updateStreakScript.Run(ctx, global.Redis, keys, member, leaderboardDay(attempt.CreatedAt)).Err(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// getProblemGroupIds 返回包含该题目的小组题集所属的小组，这些小组的排行会统计该题的作答
+func getProblemGroupIds(problemId int) ([]int, error) {
+	var groupIds []int
+	sqlString := `SELECT DISTINCT s.group_id FROM problem_set s JOIN problem_in_problem_set p ON p.problem_set_id = s.id
+		WHERE p.problem_id = $1 AND s.group_id <> 0`
+	if err := global.Database.Select(&groupIds, sqlString, problemId); err != nil {
+		return nil, err
+	}
+	return groupIds, nil
+}
+
+// RecordProblemAttempt 记录一次作答并更新排行榜，problemSetId 为0时使用题目所在的第一个题集的领域
+func RecordProblemAttempt(ctx context.Context, userId int, problemId int, problemSetId int, isCorrect bool) error {
+	var areaIds []int
+	sqlString := `SELECT area_id FROM problem_set WHERE id = $1`
+	args := []interface{}{problemSetId}
+	if problemSetId == 0 {
+		sqlString = `SELECT s.area_id FROM problem_set s JOIN problem_in_problem_set p ON p.problem_set_id = s.id
+			WHERE p.problem_id = $1 ORDER BY s.id LIMIT 1`
+		args = []interface{}{problemId}
+	}
+	if err := global.Database.Select(&areaIds, sqlString, args...); err != nil {
+		return err
+	}
+	groupIds, err := getProblemGroupIds(problemId)
+	if err != nil {
+		return err
+	}
+	attempt := model.ProblemAttempt{UserId: userId, ProblemId: problemId, IsCorrect: isCorrect}
+	if len(areaIds) > 0 {
+		attempt.AreaId = areaIds[0]
+	}
+	sqlString = `INSERT INTO user_problem_attempt (user_id, problem_id, area_id, is_correct, created_at)
+		VALUES ($1, $2, $3, $4, $5) RETURNING *`
+	if err := global.Database.Get(&attempt, sqlString, attempt.UserId, attempt.ProblemId, attempt.AreaId,
+		attempt.IsCorrect, time.Now().Local()); err != nil {
+		return err
+	}
+	return updateLeaderboards(ctx, &attempt, groupIds)
+}
+
+// RebuildLeaderboards 清空 Redis 中的排行榜并根据作答记录重新计算，小组排行按题目当前所在的小组题集计算
+func RebuildLeaderboards(ctx context.Context) error {
+	iter := global.Redis.Scan(ctx, 0, "leaderboard:*", 1000).Iterator()
+	for iter.Next(ctx) {
+		global.Redis.Del(ctx, iter.Val())
+	}
+	if err := iter.Err(); err != nil {
+		return err
+	}
+	var problemGroups []struct {
+		ProblemId int `db:"problem_id"`
+		GroupId   int `db:"group_id"`
+	}
+	sqlString := `SELECT DISTINCT p.problem_id, s.group_id FROM problem_set s
+		JOIN problem_in_problem_set p ON p.problem_set_id = s.id WHERE s.group_id <> 0`
+	if err := global.Database.Select(&problemGroups, sqlString); err != nil {
+		return err
+	}
+	groupIds := make(map[int][]int)
+	for _, problemGroup := range problemGroups {
+		groupIds[problemGroup.ProblemId] = append(groupIds[problemGroup.ProblemId], problemGroup.GroupId)
+	}
+	var attempts []model.ProblemAttempt
+	sqlString = `SELECT * FROM user_problem_attempt ORDER BY created_at, id`
+	if err := global.Database.Select(&attempts, sqlString); err != nil {
+		return err
+	}
+	for i := range attempts {
+		if err := updateLeaderboards(ctx, &attempts[i], groupIds[attempts[i].ProblemId]); err != nil {
+			return err
+		}
+	}
+	return global.Redis.Set(ctx, leaderboardBuiltKey, time.Now().Local().String(), 0).Err()
+}
+
+// EnsureLeaderboards 在 Redis 中没有排行榜数据时（例如 Redis 被清空后）重新计算
+func EnsureLeaderboards(ctx context.Context) error {
+	built, err := global.Redis.Exists(ctx, leaderboardBuiltKey).Result()
+	if err != nil || built > 0 {
+		return err
+	}
+	return RebuildLeaderboards(ctx)
+}
+
+func getLeaderboardHiddenUsers() (map[int]bool, error) {
+	var userIds []int
+	sqlString := `SELECT user_id FROM leaderboard_opt_out`
+	if err := global.Database.Select(&userIds, sqlString); err != nil {
+		return nil, err
+	}
+	hidden := make(map[int]bool, len(userIds))
+	for _, id := range userIds {
+		hidden[id] = true
+	}
+	return hidden, nil
+}
+
+func parseLeaderboardFilter(c *gin.Context) (*LeaderboardFilter, bool) {
+	var filter LeaderboardFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		return nil, false
+	}
+	if filter.Period == "" {
+		filter.Period = LeaderboardWeek
+	}
+	if filter.Metric == "" {
+		filter.Metric = LeaderboardSolved
+	}
+	if filter.Period != LeaderboardWeek && filter.Period != LeaderboardMonth && filter.Period != LeaderboardAll {
+		return nil, false
+	}
+	if filter.Metric != LeaderboardSolved && filter.Metric != LeaderboardAccuracy && filter.Metric != LeaderboardStreak {
+		return nil, false
+	}
+	return &filter, true
+}
+
+// buildLeaderboard 从高到低分批读取排行并跳过 excluded 中的用户，只读到请求的这一页为止，数值相同的名次相同。
+// 数值为0的记录（例如正确率为0）不参与排行
+func buildLeaderboard(ctx context.Context, key string, filter *LeaderboardFilter,
+	excluded map[int]bool) (*LeaderboardResponse, error) {
+	offset, limit := 0, defaultLeaderboardLimit
+	if filter.Offset != nil && *filter.Offset > 0 {
+		offset = *filter.Offset
+	}
+	if filter.Limit != nil && *filter.Limit > 0 {
+		limit = *filter.Limit
+	}
+	total, err := global.Redis.ZCount(ctx, key, "(0", "+inf").Result()
+	if err != nil {
+		return nil, err
+	}
+	if len(excluded) > 0 {
+		members := make([]string, 0, len(excluded))
+		for userId := range excluded {
+			members = append(members, strconv.Itoa(userId))
+		}
+		scores, err := global.Redis.ZMScore(ctx, key, members...).Result()
+		if err != nil && err != redis.Nil {
+			return nil, err
+		}
+		for _, score := range scores {
+			if score > 0 {
+				total--
+			}
+		}
+	}
+	response := &LeaderboardResponse{
+		Period:     filter.Period,
+		Metric:     filter.Metric,
+		TotalCount: int(total),
+		Items:      make([]LeaderboardItem, 0),
+	}
+	batch := int64(offset + limit)
+	var start int64
+	visible, rank := 0, 0
+	var lastScore float64
+	for len(response.Items) < limit {
+		scores, err := global.Redis.ZRevRangeByScoreWithScores(ctx, key, &redis.ZRangeBy{
+			Max: "+inf", Min: "(0", Offset: start, Count: batch,
+		}).Result()
+		if err != nil {
+			return nil, err
+		}
+		if len(scores) == 0 {
+			break
+		}
+		start += int64(len(scores))
+		for _, score := range scores {
+			userId, _ := strconv.Atoi(score.Member.(string))
+			if excluded[userId] {
+				continue
+			}
+			visible++
+			if visible == 1 || score.Score != lastScore {
+				rank = visible
+			}
+			lastScore = score.Score
+			if visible <= offset {
+				continue
+			}
+			userInfo, err := getBriefUserInfo(userId)
+			if err != nil {
+				return nil, err
+			}
+			response.Items = append(response.Items, LeaderboardItem{Rank: rank, UserInfo: userInfo, Value: score.Score})
+			if len(response.Items) == limit {
+				break
+			}
+		}
+	}
+	return response, nil
+}
+
+// getLeaderboardMetricKey 返回排行的 key，连续作答天数的排行会先移除已经中断的记录
+func getLeaderboardMetricKey(ctx context.Context, scope string, filter *LeaderboardFilter) (string, error) {
+	if filter.Metric == LeaderboardStreak {
+		keys := []string{
+			leaderboardKey(scope, "streak_last", LeaderboardAll),
+			leaderboardKey(scope, LeaderboardStreak, LeaderboardAll),
+		}
+		cutoff := leaderboardDay(time.Now().Local()) - 1
+		if err := pruneStreakScript.Run(ctx, global.Redis, keys, cutoff).Err(); err != nil {
+			return "", err
+		}
+		return keys[1], nil
+	}
+	return leaderboardKey(scope, filter.Metric, leaderboardPeriodKey(filter.Period, time.Now().Local())), nil
+}
+
+// GetGroupLeaderboard godoc
+// @Schemes http
+// @Description 获取小组成员的排行榜（只统计小组题集中的题目，只有小组成员可以查看），周期可选 week（默认）/month/all，
+// @Description 指标可选 solved（做对的题目数，默认）/accuracy（正确率，作答至少5次）/streak（当前连续作答天数，不区分周期）
+// @Tags Leaderboard
+// @Param id path int true "小组ID"
+// @Param filter query LeaderboardFilter false "周期、指标和分页"
+// @Success 200 {object} LeaderboardResponse "排行榜"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /leaderboard/group/{id} [get]
+// @Security ApiKeyAuth
+func GetGroupLeaderboard(c *gin.Context) {
+	filter, ok := parseLeaderboardFilter(c)
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	groupId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		isMember, err := isGroupMember(groupId, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if !isMember {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	var memberIds []int
+	sqlString := `SELECT user_id FROM group_member WHERE group_id = $1`
+	if err := global.Database.Select(&memberIds, sqlString, groupId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	key, err := getLeaderboardMetricKey(c, leaderboardGroupScope(groupId), filter)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	excluded, err := getLeaderboardHiddenUsers()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 小组排行的人数不超过在小组中作答过的人数，已经退出小组的用户不参与排行
+	isMember := make(map[int]bool, len(memberIds))
+	for _, memberId := range memberIds {
+		isMember[memberId] = true
+	}
+	ranked, err := global.Redis.ZRange(c, key, 0, -1).Result()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	for _, member := range ranked {
+		if userId, _ := strconv.Atoi(member); !isMember[userId] {
+			excluded[userId] = true
+		}
+	}
+	response, err := buildLeaderboard(c, key, filter, excluded)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetAreaLeaderboard godoc
+// @Schemes http
+// @Description 获取某个领域的全站排行榜，只统计该领域题集中的题目，参数含义同小组排行榜
+// @Tags Leaderboard
+// @Param id path int true "领域ID"
+// @Param filter query LeaderboardFilter false "周期、指标和分页"
+// @Success 200 {object} LeaderboardResponse "排行榜"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure default {string} string "服务器错误"
+// @Router /leaderboard/area/{id} [get]
+// @Security ApiKeyAuth
+func GetAreaLeaderboard(c *gin.Context) {
+	filter, ok := parseLeaderboardFilter(c)
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	areaId, err := strconv.Atoi(c.Param("id"))
+	if err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	key, err := getLeaderboardMetricKey(c, leaderboardAreaScope(areaId), filter)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	hidden, err := getLeaderboardHiddenUsers()
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	response, err := buildLeaderboard(c, key, filter, hidden)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// GetLeaderboardPrivacy godoc
+// @Schemes http
+// @Description 获取当前用户是否在排行榜中隐藏
+// @Tags Leaderboard
+// @Success 200 {object} LeaderboardPrivacyResponse "隐私设置"
+// @Failure default {string} string "服务器错误"
+// @Router /leaderboard/privacy [get]
+// @Security ApiKeyAuth
+func GetLeaderboardPrivacy(c *gin.Context) {
+	var count int
+	sqlString := `SELECT count(*) FROM leaderboard_opt_out WHERE user_id = $1`
+	if err := global.Database.Get(&count, sqlString, c.GetInt("UserId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, LeaderboardPrivacyResponse{Hidden: count > 0})
+}
+
+// UpdateLeaderboardPrivacy godoc
+// @Schemes http
+// @Description 设置当前用户是否在所有排行榜中隐藏，隐藏后仍然会记录作答数据
+// @Tags Leaderboard
+// @Param privacy body LeaderboardPrivacyRequest true "是否隐藏"
+// @Success 200 {string} string "设置成功"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure default {string} string "服务器错误"
+// @Router /leaderboard/privacy [put]
+// @Security ApiKeyAuth
+func UpdateLeaderboardPrivacy(c *gin.Context) {
+	var request LeaderboardPrivacyRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `DELETE FROM leaderboard_opt_out WHERE user_id = $1`
+	args := []interface{}{c.GetInt("UserId")}
+	if request.Hidden {
+		sqlString = `INSERT INTO leaderboard_opt_out (user_id, created_at) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		args = append(args, time.Now().Local())
+	}
+	if _, err := global.Database.Exec(sqlString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "设置成功")
+}
+
+// RebuildLeaderboard godoc
+// @Schemes http
+// @Description 根据作答记录重新计算所有排行榜（只有管理员可以操作）
+// @Tags Leaderboard
+// @Success 200 {string} string "重新计算成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /leaderboard/rebuild [post]
+// @Security ApiKeyAuth
+func RebuildLeaderboard(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if err := RebuildLeaderboards(c); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "重新计算成功")
+}
+
+// SubmitProblemAnswer godoc
+// @Schemes http
+// @Description 提交题目答案，由服务器批改并记录作答（用于排行榜统计），返回是否正确和正确答案；
+// @Description 选择题的答案为选项字母（如 AC），判断题为 正确/错误（或 true/false）；
+// @Description 作业中还不能查看答案的题目不返回正确答案，小组竞赛正在作答的题目不能提交；同一周期内重复做对的题目不计入正确率
+// @Tags Problem
+// @Param id path int true "题目ID"
+// @Param answer body ProblemSubmitRequest true "答案和所在题集（可选）"
+// @Success 200 {object} ProblemSubmitResponse "批改结果"
+// @Failure 400 {string} string "请求解析失败/题集中没有该题目"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "题目不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /problem/submit/{id} [post]
+// @Security ApiKeyAuth
+func SubmitProblemAnswer(c *gin.Context) {
+	var request ProblemSubmitRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var problem model.ProblemType
+	sqlString := `SELECT * FROM problem_type WHERE id = $1`
+	if err := global.Database.Get(&problem, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "题目不存在")
+		return
+	}
+	if request.ProblemSetId != 0 {
+		var count int
+		sqlString = `SELECT count(*) FROM problem_in_problem_set WHERE problem_set_id = $1 AND problem_id = $2`
+		if err := global.Database.Get(&count, sqlString, request.ProblemSetId, problem.ID); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if count == 0 {
+			c.String(http.StatusBadRequest, "题集中没有该题目")
+			return
+		}
+	}
+	role, _ := c.Get("Role")
+	restricted := role != global.ADMIN && problem.UserId != c.GetInt("UserId")
+	if restricted && !problem.IsPublic {
+		// 非公开的题目只有所在小组题集的成员可以作答
+		var count int
+		sqlString = `SELECT count(*) FROM problem_in_problem_set p JOIN problem_set s ON s.id = p.problem_set_id
+			JOIN group_member m ON m.group_id = s.group_id WHERE p.problem_id = $1 AND m.user_id = $2`
+		if err := global.Database.Get(&count, sqlString, problem.ID, c.GetInt("UserId")); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if count == 0 {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	// 竞赛正在作答的题目不能通过这里提交，作业中还不能查看答案的题目只批改不返回答案
+	hideAnswer := false
+	if restricted {
+		if current, err := isGroupQuizCurrentProblem(c, problem.ID); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		} else if current {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+		hidden, err := assignmentHidesAnswers(problem.ID, c.GetInt("UserId"))
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		hideAnswer = hidden
+	}
+	correctAnswer, err := getProblemCorrectAnswer(&problem)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	isCorrect := checkProblemAnswer(&problem, correctAnswer, request.Answer)
+	if err := RecordProblemAttempt(c, c.GetInt("UserId"), problem.ID, request.ProblemSetId, isCorrect); err != nil {
+		log.Printf("记录作答失败: %v", err)
+	}
+	response := ProblemSubmitResponse{IsCorrect: isCorrect}
+	if !hideAnswer {
+		response.CorrectAnswer = correctAnswer
+	}
+	c.JSON(http.StatusOK, response)
+}
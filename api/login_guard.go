@@ -0,0 +1,254 @@
+package api
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
+	"github.com/spf13/viper"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"log"
+	"math"
+	"net/http"
+	"time"
+)
+
+// 未配置时使用的登录限制：同一用户名连续失败3次后需要验证码，失败5次后开始锁定；
+// 同一IP的阈值更高，避免同一出口IP下的正常用户互相影响
+const (
+	defaultLoginCaptchaThreshold = 3
+	defaultLoginLockThreshold    = 5
+	defaultLoginIPLockThreshold  = 50
+	// 最后一次失败之后这么长时间没有新的失败，计数清零
+	loginFailWindow = time.Hour
+	// 锁定时间从 loginLockBase 开始，每多失败一次翻倍，最长 loginLockMax
+	loginLockBase = time.Minute
+	loginLockMax  = time.Hour
+)
+
+const (
+	LoginMethodPassword = "password"
+	LoginMethodWeixin   = "weixin"
+)
+
+const (
+	LoginFailWrongPassword = "wrong_password"
+	LoginFailCaptcha       = "captcha"
+	LoginFailLocked        = "locked"
+	LoginFailBanned        = "banned"
+)
+
+func getLoginThreshold(key string, defaultValue int) int {
+	if threshold := viper.GetInt(key); threshold > 0 {
+		return threshold
+	}
+	return defaultValue
+}
+
+func loginFailKey(kind string, value string) string {
+	return fmt.Sprintf("login_fail:%s:%s", kind, value)
+}
+
+func loginLockKey(kind string, value string) string {
+	return fmt.Sprintf("login_lock:%s:%s", kind, value)
+}
+
+// loginThrottle 是一次登录请求对应的限制状态
+type loginThrottle struct {
+	LockedFor   time.Duration
+	NeedCaptcha bool
+	// 本次请求预先计入的失败计数和预先加上的锁定，登录没有失败时需要撤销
+	failKeys []string
+	lockKeys []string
+}
+
+// releaseLoginFailScript 撤销一次预先计入的失败，计数已经过期或被清除时不做任何事
+var releaseLoginFailScript = redis.NewScript(`
+if tonumber(redis.call('GET', KEYS[1]) or '0') > 0 then
+	redis.call('DECR', KEYS[1])
+end
+return 0
+`)
+
+// reserveLoginAttempt 检查用户名和IP是否被锁定，没有锁定时先把本次登录计入失败次数再比较阈值，
+// 这样并发的请求不会都在计数增加之前通过检查。本次登录可能达到锁定阈值时预先加上锁定，
+// 加锁失败说明其他请求已经锁定。登录没有失败时调用 release 撤销
+func reserveLoginAttempt(c *gin.Context, username string, ip string) (*loginThrottle, error) {
+	throttle := &loginThrottle{}
+	values := map[string]string{"user": username, "ip": ip}
+	for kind, value := range values {
+		ttl, err := global.Redis.PTTL(c, loginLockKey(kind, value)).Result()
+		if err != nil {
+			return throttle, err
+		}
+		if ttl > throttle.LockedFor {
+			throttle.LockedFor = ttl
+		}
+	}
+	if throttle.LockedFor > 0 {
+		return throttle, nil
+	}
+	thresholds := map[string]int{
+		"user": getLoginThreshold("LoginLockThreshold", defaultLoginLockThreshold),
+		"ip":   getLoginThreshold("LoginIPLockThreshold", defaultLoginIPLockThreshold),
+	}
+	failures := make(map[string]int)
+	for kind, value := range values {
+		key := loginFailKey(kind, value)
+		var incr *redis.IntCmd
+		if _, err := global.Redis.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			incr = pipe.Incr(c, key)
+			pipe.Expire(c, key, loginFailWindow)
+			return nil
+		}); err != nil {
+			_ = throttle.release(c)
+			return throttle, err
+		}
+		throttle.failKeys = append(throttle.failKeys, key)
+		failures[kind] = int(incr.Val())
+		duration := loginLockDuration(failures[kind], thresholds[kind])
+		if duration == 0 {
+			continue
+		}
+		lockKey := loginLockKey(kind, value)
+		ok, err := global.Redis.SetNX(c, lockKey, 1, duration).Result()
+		if err != nil {
+			_ = throttle.release(c)
+			return throttle, err
+		}
+		if !ok {
+			ttl, _ := global.Redis.PTTL(c, lockKey).Result()
+			if ttl <= 0 {
+				ttl = duration
+			}
+			if err := throttle.release(c); err != nil {
+				return throttle, err
+			}
+			throttle.LockedFor = ttl
+			return throttle, nil
+		}
+		throttle.lockKeys = append(throttle.lockKeys, lockKey)
+	}
+	// 是否需要验证码按本次之前的失败次数判断
+	throttle.NeedCaptcha = failures["user"]-1 >= getLoginThreshold("LoginCaptchaThreshold", defaultLoginCaptchaThreshold) ||
+		failures["ip"]-1 >= thresholds["ip"]/2
+	return throttle, nil
+}
+
+// release 撤销预先计入的失败次数和预先加上的锁定
+func (t *loginThrottle) release(c *gin.Context) error {
+	for _, key := range t.failKeys {
+		if err := releaseLoginFailScript.Run(c, global.Redis, []string{key}).Err(); err != nil {
+			return err
+		}
+	}
+	if len(t.lockKeys) > 0 {
+		if err := global.Redis.Del(c, t.lockKeys...).Err(); err != nil {
+			return err
+		}
+	}
+	t.failKeys, t.lockKeys = nil, nil
+	return nil
+}
+
+// loginLockDuration 返回第 failures 次失败后的锁定时间，未达到阈值时为0
+func loginLockDuration(failures int, threshold int) time.Duration {
+	if failures < threshold {
+		return 0
+	}
+	exponent := failures - threshold
+	if exponent > 16 {
+		exponent = 16
+	}
+	return time.Duration(math.Min(float64(loginLockBase)*math.Pow(2, float64(exponent)), float64(loginLockMax)))
+}
+
+// clearLoginFailures 登录成功后清除用户名的失败计数，IP的计数保留到自然过期，只撤销本次预先计入的部分
+func clearLoginFailures(c *gin.Context, username string, throttle *loginThrottle) error {
+	if err := global.Redis.Del(c, loginFailKey("user", username), loginLockKey("user", username)).Err(); err != nil {
+		return err
+	}
+	return throttle.release(c)
+}
+
+// recordLoginHistory 记录一次登录，写入失败不影响登录本身
+func recordLoginHistory(c *gin.Context, userId int, method string, reason string) {
+	var failReason *string
+	if reason != "" {
+		failReason = &reason
+	}
+	sqlString := `INSERT INTO login_history (user_id, method, success, reason, ip, user_agent, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)`
+	if _, err := global.Database.Exec(sqlString, userId, method, reason == "", failReason, c.ClientIP(),
+		c.Request.UserAgent(), time.Now().Local()); err != nil {
+		log.Printf("记录登录历史失败: %v", err)
+	}
+}
+
+// GetCaptcha godoc
+// @Schemes http
+// @Description 获取登录验证码，登录失败次数过多后登录时需要带上验证码
+// @Tags Authentication
+// @Success 200 {object} utils.CaptchaChallenge "验证码"
+// @Failure default {string} string "服务器错误"
+// @Router /captcha [get]
+func GetCaptcha(c *gin.Context) {
+	challenge, err := utils.Captcha.Generate(c)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, challenge)
+}
+
+type LoginHistoryFilter struct {
+	Offset *int `json:"offset" form:"offset"`
+	Limit  *int `json:"limit" form:"limit"`
+}
+
+type AllLoginHistoryResponse struct {
+	TotalCount int                  `json:"total_count"`
+	Items      []model.LoginHistory `json:"items"`
+}
+
+// GetUserLoginHistory godoc
+// @Schemes http
+// @Description 获取当前用户的登录历史，按时间倒序返回
+// @Tags User
+// @Param filter query LoginHistoryFilter false "分页"
+// @Success 200 {object} AllLoginHistoryResponse "登录历史"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure default {string} string "服务器错误"
+// @Router /user/login_history [get]
+// @Security ApiKeyAuth
+func GetUserLoginHistory(c *gin.Context) {
+	var filter LoginHistoryFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	userId := c.GetInt("UserId")
+	var totalCount int
+	sqlString := `SELECT count(*) FROM login_history WHERE user_id = $1`
+	if err := global.Database.Get(&totalCount, sqlString, userId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT * FROM login_history WHERE user_id = $1 ORDER BY created_at DESC, id DESC`
+	if filter.Limit != nil {
+		sqlString += fmt.Sprint(" LIMIT ", *filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += fmt.Sprint(" OFFSET ", *filter.Offset)
+	}
+	items := make([]model.LoginHistory, 0)
+	if err := global.Database.Select(&items, sqlString, userId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllLoginHistoryResponse{
+		TotalCount: totalCount,
+		Items:      items,
+	})
+}
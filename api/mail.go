@@ -0,0 +1,113 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+)
+
+type MailOutboxFilter struct {
+	Status    *string `json:"status" form:"status"`
+	Recipient *string `json:"recipient" form:"recipient"`
+	Offset    *int    `json:"offset" form:"offset"`
+	Limit     *int    `json:"limit" form:"limit"`
+}
+
+type AllMailOutboxResponse struct {
+	TotalCount int                `json:"total_count"`
+	Mails      []model.MailOutbox `json:"mails"`
+}
+
+// GetMailOutbox godoc
+// @Schemes http
+// @Description 查看发件箱中邮件的投递状态（只有管理员可以查看）
+// @Tags Mail
+// @Param filter query MailOutboxFilter false "筛选条件，status 可选 pending/sending/sent/failed"
+// @Success 200 {object} AllMailOutboxResponse "邮件列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /mail/outbox [get]
+// @Security ApiKeyAuth
+func GetMailOutbox(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var filter MailOutboxFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM mail_outbox WHERE 1 = 1`
+	countString := `SELECT count(*) FROM mail_outbox WHERE 1 = 1`
+	var args []interface{}
+	if filter.Status != nil {
+		args = append(args, *filter.Status)
+		sqlString += ` AND status = $` + strconv.Itoa(len(args))
+		countString += ` AND status = $` + strconv.Itoa(len(args))
+	}
+	if filter.Recipient != nil {
+		args = append(args, *filter.Recipient)
+		sqlString += ` AND recipient = $` + strconv.Itoa(len(args))
+		countString += ` AND recipient = $` + strconv.Itoa(len(args))
+	}
+	sqlString += ` ORDER BY id DESC`
+	if filter.Limit != nil {
+		sqlString += ` LIMIT ` + strconv.Itoa(*filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += ` OFFSET ` + strconv.Itoa(*filter.Offset)
+	}
+	var totalCount int
+	if err := global.Database.Get(&totalCount, countString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	mails := make([]model.MailOutbox, 0)
+	if err := global.Database.Select(&mails, sqlString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllMailOutboxResponse{
+		TotalCount: totalCount,
+		Mails:      mails,
+	})
+}
+
+// RetryMail godoc
+// @Schemes http
+// @Description 重新发送投递失败的邮件（只有管理员可以操作）
+// @Tags Mail
+// @Param id path int true "邮件ID"
+// @Success 200 {string} string "重试成功"
+// @Failure 400 {string} string "邮件未投递失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "邮件不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /mail/outbox/retry/{id} [post]
+// @Security ApiKeyAuth
+func RetryMail(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var mail model.MailOutbox
+	sqlString := `SELECT * FROM mail_outbox WHERE id = $1`
+	if err := global.Database.Get(&mail, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "邮件不存在")
+		return
+	}
+	if mail.Status != utils.MailFailed {
+		c.String(http.StatusBadRequest, "邮件未投递失败")
+		return
+	}
+	if err := utils.RetryMail(c, mail.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "重试成功")
+}
@@ -76,6 +76,7 @@ func GetNotes(c *gin.Context) {
 	} else {
 		sqlString += ` WHERE 1 = 1`
 	}
+	sqlString += hiddenCondition(c, "note_table.")
 	var filter NoteFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
 		c.String(http.StatusBadRequest, "请求解析失败")
@@ -168,7 +169,7 @@ func GetNotes(c *gin.Context) {
 // @Tags Note
 // @Param note body NoteCreateRequest true "笔记信息"
 // @Success 200 {object} NoteResponse "笔记信息"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure default {string} string "服务器错误"
 // @Router /note/create [post]
 // @Security ApiKeyAuth
@@ -178,10 +179,14 @@ func CreateNote(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	review, ok := filterSensitiveWords(c, true, &request.Title, &request.Content)
+	if !ok {
+		return
+	}
 	tx := global.Database.MustBegin()
 	sqlString := `INSERT INTO note (title, content, created_at, updated_at, user_id, is_public) VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
 	var noteId int
-	if err := global.Database.Get(&noteId, sqlString, request.Title, request.Content, time.Now().Local(),
+	if err := tx.Get(&noteId, sqlString, request.Title, request.Content, time.Now().Local(),
 		time.Now().Local(), c.GetInt("UserId"), request.IsPublic); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
@@ -189,7 +194,7 @@ func CreateNote(c *gin.Context) {
 	}
 	sqlString = `SELECT * FROM note WHERE id = $1`
 	var note model.Note
-	if err := global.Database.Get(&note, sqlString, noteId); err != nil {
+	if err := tx.Get(&note, sqlString, noteId); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -202,6 +207,13 @@ func CreateNote(c *gin.Context) {
 			return
 		}
 	}
+	if review != nil {
+		if err := queueForReview(tx, ReportTargetNote, noteId, note.UserId, review); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -226,7 +238,7 @@ func CreateNote(c *gin.Context) {
 // @Tags Note
 // @Param note body NoteUpdateRequest true "笔记信息"
 // @Success 200 {string} string "更新成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "笔记不存在"
 // @Failure default {string} string "服务器错误"
@@ -248,6 +260,10 @@ func UpdateNote(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
+	review, ok := filterSensitiveWords(c, true, request.Title, request.Content)
+	if !ok {
+		return
+	}
 	if request.Title == nil {
 		request.Title = &note.Title
 	}
@@ -257,12 +273,38 @@ func UpdateNote(c *gin.Context) {
 	if request.IsPublic == nil {
 		request.IsPublic = &note.IsPublic
 	}
+	tx := global.Database.MustBegin()
 	sqlString = `UPDATE note SET title = $1, content = $2, updated_at = $3, is_public = $4 WHERE id = $5`
-	if _, err := global.Database.Exec(sqlString, request.Title, request.Content,
+	if _, err := tx.Exec(sqlString, request.Title, request.Content,
 		time.Now().Local(), request.IsPublic, request.ID); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if review != nil {
+		if err := queueForReview(tx, ReportTargetNote, note.ID, note.UserId, review); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if err := tx.Commit(); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if isAdminOverride(c, note.UserId) {
+		var updated model.Note
+		if err := global.Database.Get(&updated, `SELECT * FROM note WHERE id = $1`, note.ID); err == nil {
+			recordAudit(c, auditEvent{
+				Action:     AuditActionUpdate,
+				TargetType: ReportTargetNote,
+				TargetId:   note.ID,
+				OwnerId:    note.UserId,
+				Before:     note,
+				After:      updated,
+			})
+		}
+	}
 	c.String(http.StatusOK, "更新成功")
 }
 
@@ -278,13 +320,13 @@ func UpdateNote(c *gin.Context) {
 // @Router /note/delete/{id} [delete]
 // @Security ApiKeyAuth
 func DeleteNote(c *gin.Context) {
-	sqlString := `SELECT user_id FROM note WHERE id = $1`
-	var noteUserId int
-	if err := global.Database.Get(&noteUserId, sqlString, c.Param("id")); err != nil {
+	sqlString := `SELECT * FROM note WHERE id = $1`
+	var note model.Note
+	if err := global.Database.Get(&note, sqlString, c.Param("id")); err != nil {
 		c.String(http.StatusNotFound, "笔记不存在")
 		return
 	}
-	if role, _ := c.Get("Role"); c.GetInt("UserId") != noteUserId && role != global.ADMIN {
+	if role, _ := c.Get("Role"); c.GetInt("UserId") != note.UserId && role != global.ADMIN {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
@@ -293,6 +335,13 @@ func DeleteNote(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: ReportTargetNote,
+		TargetId:   note.ID,
+		OwnerId:    note.UserId,
+		Before:     note,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
@@ -318,11 +367,20 @@ func LikeNote(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
+	var liked int
+	sqlString = `SELECT count(*) FROM user_like_note WHERE user_id = $1 AND note_id = $2`
+	if err := global.Database.Get(&liked, sqlString, c.GetInt("UserId"), note.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	sqlString = `INSERT INTO user_like_note (user_id, note_id, created_at) VALUES ($1, $2, $3) ON CONFLICT (user_id, note_id) do update set created_at = $3`
 	if _, err := global.Database.Exec(sqlString, c.GetInt("UserId"), c.Param("id"), time.Now().Local()); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if liked == 0 {
+		CreateNotification(c, note.UserId, NotificationNoteLike, c.GetInt("UserId"), note.ID, note.Title)
+	}
 	c.String(http.StatusOK, "点赞成功")
 }
 
@@ -9,35 +9,116 @@ import (
 )
 
 type NoteReviewCreateRequest struct {
-	Title   string `json:"title"`
-	Content string `json:"content"`
-	NoteId  int    `json:"note_id"`
+	Title    string `json:"title"`
+	Content  string `json:"content"`
+	NoteId   int    `json:"note_id"`
+	ParentId *int   `json:"parent_id"`
+}
+type NoteReviewUpdateRequest struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
 }
 type NoteReviewResponse struct {
-	ID        int       `json:"id"`
-	Title     string    `json:"title"`
-	Content   string    `json:"content"`
-	NoteId    int       `json:"note_id"`
-	UserId    int       `json:"user_id"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
-	IsLiked   bool      `json:"is_liked"`
-	LikeCount int       `json:"like_count"`
+	ID              int                  `json:"id"`
+	Title           string               `json:"title"`
+	Content         string               `json:"content"`
+	RenderedContent string               `json:"rendered_content"`
+	NoteId          int                  `json:"note_id"`
+	ParentId        *int                 `json:"parent_id"`
+	UserId          int                  `json:"user_id"`
+	CreatedAt       time.Time            `json:"created_at"`
+	UpdatedAt       time.Time            `json:"updated_at"`
+	IsLiked         bool                 `json:"is_liked"`
+	LikeCount       int                  `json:"like_count"`
+	Mentions        []MentionResponse    `json:"mentions"`
+	ReplyCount      int                  `json:"reply_count"`
+	Replies         []NoteReviewResponse `json:"replies"`
 }
 type AllNoteReviewResponse struct {
 	TotalCount  int                  `json:"total_count"`
 	NoteReviews []NoteReviewResponse `json:"note_reviews"`
 }
 
+// newNoteReviewResponse 组装单条评论的点赞和提及信息，不包含回复
+func newNoteReviewResponse(review *model.NoteReview, userId int) (NoteReviewResponse, error) {
+	var isLiked int
+	sqlString := `SELECT COUNT(*) FROM user_like_note_review WHERE note_review_id = $1 AND user_id = $2`
+	if err := global.Database.Get(&isLiked, sqlString, review.ID, userId); err != nil {
+		return NoteReviewResponse{}, err
+	}
+	var likeCount int
+	sqlString = `SELECT COUNT(*) FROM user_like_note_review WHERE note_review_id = $1`
+	if err := global.Database.Get(&likeCount, sqlString, review.ID); err != nil {
+		return NoteReviewResponse{}, err
+	}
+	mentions, err := getReviewMentions("note_review_mention", "note_review_id", review.ID)
+	if err != nil {
+		return NoteReviewResponse{}, err
+	}
+	return NoteReviewResponse{
+		ID:              review.ID,
+		Title:           review.Title,
+		Content:         review.Content,
+		RenderedContent: renderMentions(review.Content, mentions),
+		NoteId:          review.NoteId,
+		ParentId:        review.ParentId,
+		UserId:          review.UserId,
+		CreatedAt:       review.CreatedAt,
+		UpdatedAt:       review.UpdatedAt,
+		IsLiked:         isLiked > 0,
+		LikeCount:       likeCount,
+		Mentions:        mentions,
+		Replies:         make([]NoteReviewResponse, 0),
+	}, nil
+}
+
+// getNoteReviewThread 按时间顺序返回 parentId 下的一页评论（parentId 为 nil 时为第一层评论）及总数，
+// 每条评论再展开 depth-1 层、每层最多 replyLimit 条回复，被隐藏的评论只有作者能看到
+func getNoteReviewThread(noteId int, parentId *int, offset int, limit int, depth int, replyLimit int,
+	userId int) ([]NoteReviewResponse, int, error) {
+	var totalCount int
+	sqlString := `SELECT count(*) FROM note_review WHERE note_id = $1 AND parent_id IS NOT DISTINCT FROM $2
+		AND (is_hidden = false OR user_id = $3)`
+	if err := global.Database.Get(&totalCount, sqlString, noteId, parentId, userId); err != nil {
+		return nil, 0, err
+	}
+	var reviews []model.NoteReview
+	sqlString = paginate(`SELECT * FROM note_review WHERE note_id = $1 AND parent_id IS NOT DISTINCT FROM $2
+		AND (is_hidden = false OR user_id = $3)
+		ORDER BY created_at, id`, offset, limit)
+	if err := global.Database.Select(&reviews, sqlString, noteId, parentId, userId); err != nil {
+		return nil, 0, err
+	}
+	responses := make([]NoteReviewResponse, 0, len(reviews))
+	for i := range reviews {
+		response, err := newNoteReviewResponse(&reviews[i], userId)
+		if err != nil {
+			return nil, 0, err
+		}
+		if depth > 1 {
+			response.Replies, response.ReplyCount, err = getNoteReviewThread(noteId, &reviews[i].ID, 0, replyLimit,
+				depth-1, replyLimit, userId)
+		} else {
+			sqlString = `SELECT count(*) FROM note_review WHERE parent_id = $1 AND (is_hidden = false OR user_id = $2)`
+			err = global.Database.Get(&response.ReplyCount, sqlString, reviews[i].ID, userId)
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		responses = append(responses, response)
+	}
+	return responses, totalCount, nil
+}
+
 // AddNoteReview godoc
 // @Schemes http
-// @Description 添加评论
+// @Description 添加评论，指定 parent_id 时回复同一笔记下的另一条评论，内容中的 @用户名 会通知对应用户
 // @Tags NoteReview
 // @Param review body NoteReviewCreateRequest true "评论信息"
 // @Success 200 {string} NoteReviewResponse "评论信息"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
 // @Failure 403 {string} string "没有权限"
-// @Failure 404 {string} string "笔记不存在"
+// @Failure 404 {string} string "笔记不存在"/"回复的评论不存在"
 // @Failure default {string} string "服务器错误"
 // @Router /note_review/add [post]
 // @Security ApiKeyAuth
@@ -47,6 +128,10 @@ func AddNoteReview(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	reviewWords, ok := filterSensitiveWords(c, true, &request.Title, &request.Content)
+	if !ok {
+		return
+	}
 	sqlString := `SELECT * FROM note WHERE id = $1`
 	var note model.Note
 	if err := global.Database.Get(&note, sqlString, request.NoteId); err != nil {
@@ -57,19 +142,44 @@ func AddNoteReview(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
+	var parent model.NoteReview
+	if request.ParentId != nil {
+		sqlString = `SELECT * FROM note_review WHERE id = $1`
+		if err := global.Database.Get(&parent, sqlString, *request.ParentId); err != nil || parent.NoteId != note.ID {
+			c.String(http.StatusNotFound, "回复的评论不存在")
+			return
+		}
+	}
 	tx := global.Database.MustBegin()
-	sqlString = `INSERT INTO note_review (title, content, note_id, user_id, created_at, updated_at) 
-		VALUES ($1, $2, $3, $4, $5, $6) RETURNING id`
+	sqlString = `INSERT INTO note_review (title, content, note_id, user_id, created_at, updated_at, parent_id) 
+		VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
 	var reviewId int
-	if err := global.Database.Get(&reviewId, sqlString, request.Title, request.Content, request.NoteId,
-		c.GetInt("UserId"), time.Now().Local(), time.Now().Local()); err != nil {
+	if err := tx.Get(&reviewId, sqlString, request.Title, request.Content, request.NoteId,
+		c.GetInt("UserId"), time.Now().Local(), time.Now().Local(), request.ParentId); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if reviewWords != nil {
+		if err := queueForReview(tx, ReportTargetNoteReview, reviewId, c.GetInt("UserId"), reviewWords); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
 	sqlString = `SELECT * FROM note_review WHERE id = $1`
 	var review model.NoteReview
-	if err := global.Database.Get(&review, sqlString, reviewId); err != nil {
+	if err := tx.Get(&review, sqlString, reviewId); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 只通知能查看笔记的被提及用户
+	mentioned, err := saveReviewMentions(tx, "note_review_mention", "note_review_id", review.ID, review.Content)
+	if err == nil {
+		mentioned, err = noteMentionReaders(mentioned, &note)
+	}
+	if err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -78,17 +188,23 @@ func AddNoteReview(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	c.JSON(http.StatusOK, NoteReviewResponse{
-		ID:        review.ID,
-		Title:     review.Title,
-		Content:   review.Content,
-		NoteId:    review.NoteId,
-		UserId:    review.UserId,
-		CreatedAt: review.CreatedAt,
-		UpdatedAt: review.UpdatedAt,
-		IsLiked:   false,
-		LikeCount: 0,
-	})
+	response, err := newNoteReviewResponse(&review, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 待审核的评论不发送通知
+	if review.IsHidden {
+		c.JSON(http.StatusOK, response)
+		return
+	}
+	notified := make(map[int]bool)
+	if request.ParentId != nil {
+		notified[parent.UserId] = true
+		CreateNotification(c, parent.UserId, NotificationNoteReply, c.GetInt("UserId"), note.ID, note.Title)
+	}
+	notifyMentions(c, mentioned, notified, NotificationNoteMention, c.GetInt("UserId"), note.ID, note.Title)
+	c.JSON(http.StatusOK, response)
 }
 
 // RemoveNoteReview godoc
@@ -125,21 +241,39 @@ func RemoveNoteReview(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: ReportTargetNoteReview,
+		TargetId:   noteReview.ID,
+		OwnerId:    noteReview.UserId,
+		Before:     noteReview,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
 // GetNoteReviews godoc
 // @Schemes http
-// @Description 获取笔记的评论
+// @Description 获取笔记的评论，按时间顺序分页返回第一层评论，每条评论按 depth 逐层展开前 reply_limit 条回复，
+// @Description 没有展开的回复可以通过 /note_review/replies/{id} 继续获取
 // @Tags NoteReview
 // @Param note_id query int true "笔记id"
+// @Param offset query int false "第一层评论的偏移量"
+// @Param limit query int false "第一层评论的数量, 默认不限制"
+// @Param depth query int false "展开的层数, 默认为3, 最多为5"
+// @Param reply_limit query int false "每条评论展开的回复数, 默认为5, 最多为50"
 // @Success 200 {object} AllNoteReviewResponse "评论列表"
+// @Failure 400 {string} string "请求解析失败"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "笔记不存在"
 // @Failure default {string} string "服务器错误"
 // @Router /note_review/get [get]
 // @Security ApiKeyAuth
 func GetNoteReviews(c *gin.Context) {
+	query, ok := bindReviewThreadQuery(c)
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
 	var note model.Note
 	noteId := c.Query("note_id")
 	sqlString := `SELECT * FROM note WHERE id = $1`
@@ -151,42 +285,166 @@ func GetNoteReviews(c *gin.Context) {
 		c.String(http.StatusForbidden, "没有权限")
 		return
 	}
-	sqlString = `SELECT * FROM note_review WHERE note_id = $1`
-	var reviews []model.NoteReview
-	if err := global.Database.Select(&reviews, sqlString, noteId); err != nil {
+	reviews, totalCount, err := getNoteReviewThread(note.ID, nil, query.Offset, query.Limit, query.Depth,
+		query.ReplyLimit, c.GetInt("UserId"))
+	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
-	var reviewResponses []NoteReviewResponse
-	for _, review := range reviews {
-		var isLiked int
-		sqlString = `SELECT COUNT(*) FROM user_like_note_review WHERE note_review_id = $1 AND user_id = $2`
-		if err := global.Database.Get(&isLiked, sqlString, review.ID, c.GetInt("UserId")); err != nil {
-			c.String(http.StatusInternalServerError, "服务器错误")
-			return
-		}
-		var likeCount int
-		sqlString = `SELECT COUNT(*) FROM user_like_note_review WHERE note_review_id = $1`
-		if err := global.Database.Get(&likeCount, sqlString, review.ID); err != nil {
+	c.JSON(http.StatusOK, AllNoteReviewResponse{
+		TotalCount:  totalCount,
+		NoteReviews: reviews,
+	})
+}
+
+// GetNoteReviewReplies godoc
+// @Schemes http
+// @Description 分页获取一条评论下的回复，每条回复按 depth 逐层展开前 reply_limit 条回复
+// @Tags NoteReview
+// @Param id path int true "评论id"
+// @Param offset query int false "回复的偏移量"
+// @Param limit query int false "回复的数量, 默认不限制"
+// @Param depth query int false "展开的层数, 默认为3, 最多为5"
+// @Param reply_limit query int false "每条回复展开的回复数, 默认为5, 最多为50"
+// @Success 200 {object} AllNoteReviewResponse "回复列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "评论不存在"/"评论所属的笔记不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /note_review/replies/{id} [get]
+// @Security ApiKeyAuth
+func GetNoteReviewReplies(c *gin.Context) {
+	query, ok := bindReviewThreadQuery(c)
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM note_review WHERE id = $1`
+	var review model.NoteReview
+	if err := global.Database.Get(&review, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "评论不存在")
+		return
+	}
+	sqlString = `SELECT * FROM note WHERE id = $1`
+	var note model.Note
+	if err := global.Database.Get(&note, sqlString, review.NoteId); err != nil {
+		c.String(http.StatusNotFound, "评论所属的笔记不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && note.UserId != c.GetInt("UserId") && !note.IsPublic {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	replies, totalCount, err := getNoteReviewThread(note.ID, &review.ID, query.Offset, query.Limit, query.Depth,
+		query.ReplyLimit, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllNoteReviewResponse{
+		TotalCount:  totalCount,
+		NoteReviews: replies,
+	})
+}
+
+// UpdateNoteReview godoc
+// @Schemes http
+// @Description 修改评论（只有评论的作者可以修改），修改后新 @ 到的用户会收到通知
+// @Tags NoteReview
+// @Param id path int true "评论id"
+// @Param review body NoteReviewUpdateRequest true "修改的评论信息"
+// @Success 200 {object} NoteReviewResponse "评论信息"
+// @Failure 400 {string} string "请求解析失败"/"内容包含敏感词"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "评论不存在"/"评论所属的笔记不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /note_review/update/{id} [put]
+// @Security ApiKeyAuth
+func UpdateNoteReview(c *gin.Context) {
+	var request NoteReviewUpdateRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM note_review WHERE id = $1`
+	var review model.NoteReview
+	if err := global.Database.Get(&review, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "评论不存在")
+		return
+	}
+	if role, _ := c.Get("Role"); role != global.ADMIN && review.UserId != c.GetInt("UserId") {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	reviewWords, ok := filterSensitiveWords(c, true, request.Title, request.Content)
+	if !ok {
+		return
+	}
+	sqlString = `SELECT * FROM note WHERE id = $1`
+	var note model.Note
+	if err := global.Database.Get(&note, sqlString, review.NoteId); err != nil {
+		c.String(http.StatusNotFound, "评论所属的笔记不存在")
+		return
+	}
+	before := review
+	if request.Title != nil {
+		review.Title = *request.Title
+	}
+	if request.Content != nil {
+		review.Content = *request.Content
+	}
+	tx := global.Database.MustBegin()
+	sqlString = `UPDATE note_review SET title = $1, content = $2, updated_at = $3 WHERE id = $4 RETURNING *`
+	if err := tx.Get(&review, sqlString, review.Title, review.Content, time.Now().Local(), review.ID); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if reviewWords != nil {
+		if err := queueForReview(tx, ReportTargetNoteReview, review.ID, review.UserId, reviewWords); err != nil {
+			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
-		reviewResponses = append(reviewResponses, NoteReviewResponse{
-			ID:        review.ID,
-			Title:     review.Title,
-			Content:   review.Content,
-			NoteId:    review.NoteId,
-			UserId:    review.UserId,
-			CreatedAt: review.CreatedAt,
-			UpdatedAt: review.UpdatedAt,
-			IsLiked:   isLiked > 0,
-			LikeCount: likeCount,
+		review.IsHidden = true
+	}
+	// 只通知能查看笔记的被提及用户
+	mentioned, err := saveReviewMentions(tx, "note_review_mention", "note_review_id", review.ID, review.Content)
+	if err == nil {
+		mentioned, err = noteMentionReaders(mentioned, &note)
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if isAdminOverride(c, review.UserId) {
+		recordAudit(c, auditEvent{
+			Action:     AuditActionUpdate,
+			TargetType: ReportTargetNoteReview,
+			TargetId:   review.ID,
+			OwnerId:    review.UserId,
+			Before:     before,
+			After:      review,
 		})
 	}
-	c.JSON(http.StatusOK, AllNoteReviewResponse{
-		TotalCount:  len(reviewResponses),
-		NoteReviews: reviewResponses,
-	})
+	if !review.IsHidden {
+		notifyMentions(c, mentioned, map[int]bool{}, NotificationNoteMention, c.GetInt("UserId"), note.ID, note.Title)
+	}
+	response, err := newNoteReviewResponse(&review, c.GetInt("UserId"))
+	if err == nil {
+		sqlString = `SELECT count(*) FROM note_review WHERE parent_id = $1 AND (is_hidden = false OR user_id = $2)`
+		err = global.Database.Get(&response.ReplyCount, sqlString, review.ID, c.GetInt("UserId"))
+	}
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
 }
 
 // LikeNoteReview godoc
@@ -0,0 +1,315 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	NotificationNoteLike          = "note_like"
+	NotificationDiscussionReply   = "discussion_reply"
+	NotificationGroupApplication  = "group_application"
+	NotificationGroupRole         = "group_role"
+	NotificationDiscussionMention = "discussion_mention"
+	NotificationNoteMention       = "note_mention"
+	NotificationNoteReply         = "note_reply"
+	NotificationAnswerAccepted    = "answer_accepted"
+	NotificationModeration        = "moderation"
+)
+
+var notificationTypes = []string{
+	NotificationNoteLike,
+	NotificationDiscussionReply,
+	NotificationGroupApplication,
+	NotificationGroupRole,
+	NotificationDiscussionMention,
+	NotificationNoteMention,
+	NotificationNoteReply,
+	NotificationAnswerAccepted,
+	NotificationModeration,
+}
+
+func isNotificationType(notificationType string) bool {
+	for _, t := range notificationTypes {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// CreateNotification 给 userId 发送一条通知并实时推送，自己触发的操作和用户屏蔽的类型不会产生通知，
+// actorId 为0表示系统通知。通知只是附带效果，失败时只记录日志，不影响调用方的主流程
+func CreateNotification(c context.Context, userId int, notificationType string, actorId int, targetId int, content string) {
+	if userId == actorId {
+		return
+	}
+	var notification model.Notification
+	sqlString := `INSERT INTO notification (user_id, type, actor_id, target_id, content, is_read, created_at)
+		SELECT $1, $2, NULLIF($3, 0), $4, $5, false, $6
+		WHERE NOT EXISTS (SELECT 1 FROM notification_mute WHERE user_id = $1 AND type = $2) RETURNING *`
+	err := global.Database.Get(&notification, sqlString, userId, notificationType, actorId, targetId, content, time.Now().Local())
+	if err == sql.ErrNoRows {
+		return
+	}
+	if err != nil {
+		log.Printf("创建通知失败: %v", err)
+		return
+	}
+	response := NotificationResponse{
+		ID:        notification.ID,
+		Type:      notification.Type,
+		TargetId:  notification.TargetId,
+		Content:   notification.Content,
+		IsRead:    notification.IsRead,
+		CreatedAt: notification.CreatedAt,
+	}
+	user := model.User{}
+	sqlString = `SELECT id, avatar_url, nick_name FROM "user" WHERE id = $1`
+	if err := global.Database.Get(&user, sqlString, actorId); err == nil {
+		response.ActorInfo = &UserInfoResponse{
+			UserId:     user.ID,
+			AvatarPath: user.AvatarURL,
+			NickName:   user.NickName,
+		}
+	}
+	if err := utils.PublishToUser(c, userId, utils.PushNotification, &response); err != nil {
+		log.Printf("推送通知失败: %v", err)
+	}
+}
+
+type NotificationFilter struct {
+	Type   *string `json:"type" form:"type"`
+	IsRead *bool   `json:"is_read" form:"is_read"`
+	Offset *int    `json:"offset" form:"offset"`
+	Limit  *int    `json:"limit" form:"limit"`
+}
+
+type NotificationResponse struct {
+	ID        int               `json:"id"`
+	Type      string            `json:"type"`
+	TargetId  int               `json:"target_id"`
+	Content   string            `json:"content"`
+	IsRead    bool              `json:"is_read"`
+	CreatedAt time.Time         `json:"created_at"`
+	ActorInfo *UserInfoResponse `json:"actor_info"`
+}
+
+type AllNotificationResponse struct {
+	TotalCount    int                    `json:"total_count"`
+	Notifications []NotificationResponse `json:"notifications"`
+}
+
+type UnreadNotificationCountResponse struct {
+	Count int `json:"count"`
+}
+
+type NotificationMuteRequest struct {
+	Type string `json:"type" binding:"required"`
+	Mute bool   `json:"mute"`
+}
+
+type NotificationMuteResponse struct {
+	MutedTypes []string `json:"muted_types"`
+}
+
+// GetNotifications godoc
+// @Schemes http
+// @Description 获取当前用户的通知（按时间倒序）
+// @Tags Notification
+// @Param filter query NotificationFilter false "筛选条件"
+// @Success 200 {object} AllNotificationResponse "通知列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure default {string} string "服务器错误"
+// @Router /notification/all [get]
+// @Security ApiKeyAuth
+func GetNotifications(c *gin.Context) {
+	var filter NotificationFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sqlString := `SELECT * FROM notification WHERE user_id = $1`
+	countString := `SELECT count(*) FROM notification WHERE user_id = $1`
+	args := []interface{}{c.GetInt("UserId")}
+	if filter.Type != nil {
+		args = append(args, *filter.Type)
+		sqlString += ` AND type = $` + strconv.Itoa(len(args))
+		countString += ` AND type = $` + strconv.Itoa(len(args))
+	}
+	if filter.IsRead != nil {
+		args = append(args, *filter.IsRead)
+		sqlString += ` AND is_read = $` + strconv.Itoa(len(args))
+		countString += ` AND is_read = $` + strconv.Itoa(len(args))
+	}
+	sqlString += ` ORDER BY created_at DESC, id DESC`
+	if filter.Limit != nil {
+		sqlString += ` LIMIT ` + strconv.Itoa(*filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += ` OFFSET ` + strconv.Itoa(*filter.Offset)
+	}
+	var totalCount int
+	if err := global.Database.Get(&totalCount, countString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	var notifications []model.Notification
+	if err := global.Database.Select(&notifications, sqlString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]NotificationResponse, 0, len(notifications))
+	for _, notification := range notifications {
+		var actorInfo *UserInfoResponse
+		if notification.ActorId != nil {
+			user := model.User{}
+			sqlString = `SELECT id, avatar_url, nick_name FROM "user" WHERE id = $1`
+			if err := global.Database.Get(&user, sqlString, *notification.ActorId); err != nil {
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
+			actorInfo = &UserInfoResponse{
+				UserId:     user.ID,
+				AvatarPath: user.AvatarURL,
+				NickName:   user.NickName,
+			}
+		}
+		responses = append(responses, NotificationResponse{
+			ID:        notification.ID,
+			Type:      notification.Type,
+			TargetId:  notification.TargetId,
+			Content:   notification.Content,
+			IsRead:    notification.IsRead,
+			CreatedAt: notification.CreatedAt,
+			ActorInfo: actorInfo,
+		})
+	}
+	c.JSON(http.StatusOK, AllNotificationResponse{
+		TotalCount:    totalCount,
+		Notifications: responses,
+	})
+}
+
+// GetUnreadNotificationCount godoc
+// @Schemes http
+// @Description 获取当前用户的未读通知数
+// @Tags Notification
+// @Success 200 {object} UnreadNotificationCountResponse "未读通知数"
+// @Failure default {string} string "服务器错误"
+// @Router /notification/unread_count [get]
+// @Security ApiKeyAuth
+func GetUnreadNotificationCount(c *gin.Context) {
+	var count int
+	sqlString := `SELECT count(*) FROM notification WHERE user_id = $1 AND is_read = false`
+	if err := global.Database.Get(&count, sqlString, c.GetInt("UserId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, UnreadNotificationCountResponse{Count: count})
+}
+
+// ReadNotification godoc
+// @Schemes http
+// @Description 将一条通知标记为已读
+// @Tags Notification
+// @Param id path int true "通知ID"
+// @Success 200 {string} string "标记成功"
+// @Failure 404 {string} string "通知不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /notification/read/{id} [put]
+// @Security ApiKeyAuth
+func ReadNotification(c *gin.Context) {
+	sqlString := `UPDATE notification SET is_read = true WHERE id = $1 AND user_id = $2`
+	result, err := global.Database.Exec(sqlString, c.Param("id"), c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		c.String(http.StatusNotFound, "通知不存在")
+		return
+	}
+	c.String(http.StatusOK, "标记成功")
+}
+
+// ReadAllNotifications godoc
+// @Schemes http
+// @Description 将当前用户的所有通知（或某一类通知）标记为已读
+// @Tags Notification
+// @Param type query string false "通知类型"
+// @Success 200 {string} string "标记成功"
+// @Failure default {string} string "服务器错误"
+// @Router /notification/read_all [put]
+// @Security ApiKeyAuth
+func ReadAllNotifications(c *gin.Context) {
+	sqlString := `UPDATE notification SET is_read = true WHERE user_id = $1 AND is_read = false`
+	args := []interface{}{c.GetInt("UserId")}
+	if c.Query("type") != "" {
+		sqlString += ` AND type = $2`
+		args = append(args, c.Query("type"))
+	}
+	if _, err := global.Database.Exec(sqlString, args...); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "标记成功")
+}
+
+// GetNotificationMute godoc
+// @Schemes http
+// @Description 获取当前用户屏蔽的通知类型
+// @Tags Notification
+// @Success 200 {object} NotificationMuteResponse "屏蔽的通知类型"
+// @Failure default {string} string "服务器错误"
+// @Router /notification/mute [get]
+// @Security ApiKeyAuth
+func GetNotificationMute(c *gin.Context) {
+	mutedTypes := make([]string, 0)
+	sqlString := `SELECT type FROM notification_mute WHERE user_id = $1 ORDER BY type`
+	if err := global.Database.Select(&mutedTypes, sqlString, c.GetInt("UserId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, NotificationMuteResponse{MutedTypes: mutedTypes})
+}
+
+// UpdateNotificationMute godoc
+// @Schemes http
+// @Description 屏蔽或取消屏蔽某一类通知，类型可选 note_like/discussion_reply/group_application/group_role/
+// @Description discussion_mention/note_mention/note_reply/answer_accepted/moderation
+// @Tags Notification
+// @Param request body NotificationMuteRequest true "通知类型和是否屏蔽"
+// @Success 200 {string} string "设置成功"
+// @Failure 400 {string} string "请求解析失败"/"通知类型不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /notification/mute [put]
+// @Security ApiKeyAuth
+func UpdateNotificationMute(c *gin.Context) {
+	var request NotificationMuteRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if !isNotificationType(request.Type) {
+		c.String(http.StatusBadRequest, "通知类型不存在")
+		return
+	}
+	sqlString := `DELETE FROM notification_mute WHERE user_id = $1 AND type = $2`
+	if request.Mute {
+		sqlString = `INSERT INTO notification_mute (user_id, type) VALUES ($1, $2) ON CONFLICT DO NOTHING`
+	}
+	if _, err := global.Database.Exec(sqlString, c.GetInt("UserId"), request.Type); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "设置成功")
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"io"
+	"io/ioutil"
+	"kayak-backend/utils"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const PDFOCRJobType = "pdf_ocr"
+
+const (
+	maxPDFOCRPages    = 100
+	maxPDFOCRFileSize = 20 << 20
+	// 合并多页识别结果时给每一页的纵坐标加上的偏移量，保证跨页的行顺序
+	pdfPageOffset = 1 << 20
+)
+
+type PDFOCRPageResult struct {
+	Page  int             `json:"page"`
+	Text  string          `json:"text"`
+	Lines []utils.OCRLine `json:"lines"`
+	Error string          `json:"error,omitempty"`
+}
+
+type PDFOCRJobResult struct {
+	FirstPage int                `json:"first_page"`
+	LastPage  int                `json:"last_page"`
+	Pages     []PDFOCRPageResult `json:"pages"`
+	Text      string             `json:"text"`
+	Problems  []OCRDraftProblem  `json:"problems"`
+}
+
+// pdfOCRJobPayload 只保存PDF在 utils.JobFiles 中的键，文件内容不写入 Redis
+type pdfOCRJobPayload struct {
+	FileKey   string `json:"file_key"`
+	FirstPage int    `json:"first_page"`
+	LastPage  int    `json:"last_page"`
+}
+
+type CreateJobResponse struct {
+	JobId string `json:"job_id"`
+}
+
+// CreatePDFOCRJob godoc
+// @Schemes http
+// @Description 创建多页PDF识别的后台任务，PDF文件不能超过20MB，通过 GET /jobs/{id} 查询进度，已完成页面的结果会随进度逐步返回，全部完成后返回合并文本和题目草稿
+// @Tags Special
+// @Param file formData file true "PDF文件"
+// @Param first_page query int false "起始页，从1开始，默认为1"
+// @Param last_page query int false "结束页，默认为最后一页（无法识别页数时必填）"
+// @Success 200 {object} CreateJobResponse "任务ID"
+// @Failure 400 {string} string "参数错误"/"文件过大"/"无法识别PDF页数，请指定结束页"/"页数过多"
+// @Failure default {string} string "服务器错误"
+// @Router /special/pdf_ocr_job [post]
+// @Security ApiKeyAuth
+func CreatePDFOCRJob(c *gin.Context) {
+	// 给 multipart 的边界和其他字段留出余量，超出时解析失败
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxPDFOCRFileSize+1<<20)
+	file, fileHeader, err := c.Request.FormFile("file")
+	if err != nil {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	if fileHeader.Size > maxPDFOCRFileSize {
+		c.String(http.StatusBadRequest, "文件过大")
+		return
+	}
+	fileBytes, err := ioutil.ReadAll(io.LimitReader(file, maxPDFOCRFileSize+1))
+	if err == nil && len(fileBytes) > maxPDFOCRFileSize {
+		c.String(http.StatusBadRequest, "文件过大")
+		return
+	}
+	if err != nil || !bytes.HasPrefix(fileBytes, []byte("%PDF")) {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	firstPage, lastPage := 1, utils.PDFPageCount(fileBytes)
+	if c.Query("first_page") != "" {
+		if firstPage, err = strconv.Atoi(c.Query("first_page")); err != nil || firstPage < 1 {
+			c.String(http.StatusBadRequest, "参数错误")
+			return
+		}
+	}
+	if c.Query("last_page") != "" {
+		if lastPage, err = strconv.Atoi(c.Query("last_page")); err != nil {
+			c.String(http.StatusBadRequest, "参数错误")
+			return
+		}
+	}
+	if lastPage == 0 {
+		c.String(http.StatusBadRequest, "无法识别PDF页数，请指定结束页")
+		return
+	}
+	if lastPage < firstPage {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	if lastPage-firstPage+1 > maxPDFOCRPages {
+		c.String(http.StatusBadRequest, "页数过多")
+		return
+	}
+	fileKey := uuid.New().String() + ".pdf"
+	if err := utils.JobFiles.Put(c, fileKey, fileBytes); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	job, err := utils.EnqueueJob(c, PDFOCRJobType, c.GetInt("UserId"), lastPage-firstPage+1, &pdfOCRJobPayload{
+		FileKey:   fileKey,
+		FirstPage: firstPage,
+		LastPage:  lastPage,
+	})
+	if err != nil {
+		_ = utils.JobFiles.Delete(c, fileKey)
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, CreateJobResponse{JobId: job.ID})
+}
+
+func runPDFOCRJob(ctx context.Context, job *utils.Job, payload []byte) (res interface{}, err error) {
+	var request pdfOCRJobPayload
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, utils.PermanentJobError(err)
+	}
+	// 任务成功、不再重试或者已经用完重试次数时删除PDF文件
+	defer func() {
+		if err == nil || utils.IsPermanentJobError(err) || job.Attempts >= job.MaxAttempts {
+			if err := utils.JobFiles.Delete(context.Background(), request.FileKey); err != nil {
+				log.Printf("PDF识别任务 %s 删除文件失败: %v", job.ID, err)
+			}
+		}
+	}()
+	data, err := utils.JobFiles.Get(ctx, request.FileKey)
+	if err != nil {
+		return nil, err
+	}
+	firstPage, lastPage := request.FirstPage, request.LastPage
+	result := PDFOCRJobResult{FirstPage: firstPage, LastPage: lastPage, Pages: make([]PDFOCRPageResult, 0)}
+	job.Progress = 0
+	if err := utils.SetJobResult(ctx, job, &result); err != nil {
+		return nil, err
+	}
+	var texts []string
+	var allLines []utils.OCRLine
+	failed := 0
+	quotaExceeded := false
+	for page := firstPage; page <= lastPage; page++ {
+		pageResult := PDFOCRPageResult{Page: page, Lines: make([]utils.OCRLine, 0)}
+		lines, _, err := utils.RecognizeWithCache(ctx, job.UserId, data, true, page)
+		if err == utils.ErrOCRQuotaExceeded {
+			quotaExceeded = true
+			break
+		}
+		if err != nil {
+			log.Printf("PDF识别任务 %s 第%d页识别失败: %v", job.ID, page, err)
+			pageResult.Error = "识别失败"
+			failed++
+		} else {
+			pageResult.Lines = lines
+			pageResult.Text = joinOCRLines(lines)
+			texts = append(texts, pageResult.Text)
+			for _, line := range lines {
+				line.Y += (page - firstPage) * pdfPageOffset
+				allLines = append(allLines, line)
+			}
+		}
+		result.Pages = append(result.Pages, pageResult)
+		job.Progress++
+		if err := utils.SetJobResult(ctx, job, &result); err != nil {
+			log.Printf("PDF识别任务 %s 保存失败: %v", job.ID, err)
+		}
+	}
+	result.Text = strings.Join(texts, "\n")
+	result.Problems = BuildOCRDraftProblems(allLines)
+	if len(texts) == 0 {
+		if quotaExceeded {
+			return nil, utils.PermanentJobError(errors.New("今日OCR次数已用完"))
+		}
+		return nil, errors.New("识别失败")
+	}
+	// 部分页面识别失败时仍然返回已识别的结果
+	if quotaExceeded {
+		job.Error = "今日OCR次数已用完，部分页面未识别"
+	} else if failed > 0 {
+		job.Error = fmt.Sprintf("%d页识别失败", failed)
+	}
+	return &result, nil
+}
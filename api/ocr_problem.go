@@ -0,0 +1,391 @@
+package api
+
+import (
+	"bytes"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"io/ioutil"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+type OCRDraftProblem struct {
+	ProblemType int             `json:"problem_type"`
+	Description string          `json:"description"`
+	Choices     []ChoiceRequest `json:"choices"`
+	Answer      string          `json:"answer"`
+	Analysis    string          `json:"analysis"`
+}
+
+type OCRDraftResponse struct {
+	TotalCount int               `json:"total_count"`
+	Problems   []OCRDraftProblem `json:"problems"`
+	Lines      []utils.OCRLine   `json:"lines"`
+}
+
+type OCRCommitRequest struct {
+	ProblemSetId int               `json:"problem_set_id" binding:"required"`
+	IsPublic     bool              `json:"is_public"`
+	Problems     []OCRDraftProblem `json:"problems" binding:"required"`
+}
+
+var (
+	ocrProblemStart   = regexp.MustCompile(`^\s*(\d+)\s*[.．、)）]\s*`)
+	ocrChoiceStart    = regexp.MustCompile(`^\s*([A-H])\s*[.．、)）]\s*`)
+	ocrInlineChoice   = regexp.MustCompile(`(?:^|\s)([A-H])\s*[.．、)）]`)
+	ocrAnswerStart    = regexp.MustCompile(`^\s*[\[【(（]?\s*(?:答案|参考答案)\s*[\]】)）]?\s*[:：]?\s*`)
+	ocrAnalysisStart  = regexp.MustCompile(`^\s*[\[【(（]?\s*(?:解析|分析)\s*[\]】)）]?\s*[:：]?\s*`)
+	ocrInlineAnalysis = regexp.MustCompile(`[\[【(（]?\s*解析\s*[\]】)）]?\s*[:：]?\s*`)
+	ocrSection        = regexp.MustCompile(`^\s*(?:[一二三四五六七八九十]+\s*[、.．]\s*)?(选择题|判断题|填空题)`)
+	// 答案开头连续的选项字母，可以用空格、逗号或顿号分隔，后面紧跟其他字母时不是选项（如 "Because"）
+	ocrAnswerLetters = regexp.MustCompile(`^([A-H](?:[\s,，、]*[A-H])*)(?:[^A-Za-z]|$)`)
+)
+
+// groupOCRRows 把纵向位置重叠的文本行合并为同一行（例如横排的多个选项），行内按横坐标排序
+func groupOCRRows(lines []utils.OCRLine) [][]utils.OCRLine {
+	sorted := make([]utils.OCRLine, len(lines))
+	copy(sorted, lines)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Y < sorted[j].Y
+	})
+	var rows [][]utils.OCRLine
+	for _, line := range sorted {
+		if len(rows) > 0 {
+			last := rows[len(rows)-1]
+			anchor := last[0]
+			center := line.Y + line.Height/2
+			if line.Height > 0 && anchor.Height > 0 && center >= anchor.Y && center <= anchor.Y+anchor.Height {
+				rows[len(rows)-1] = append(last, line)
+				continue
+			}
+		}
+		rows = append(rows, []utils.OCRLine{line})
+	}
+	for _, row := range rows {
+		sort.SliceStable(row, func(i, j int) bool {
+			return row[i].X < row[j].X
+		})
+	}
+	return rows
+}
+
+// joinOCRText 拼接被换行截断的文本，只有两侧都是字母或数字时才补空格
+func joinOCRText(a string, b string) string {
+	a = strings.TrimRight(a, " ")
+	b = strings.TrimLeft(b, " ")
+	if a == "" || b == "" {
+		return a + b
+	}
+	ra, rb := []rune(a), []rune(b)
+	last, first := ra[len(ra)-1], rb[0]
+	if last < unicode.MaxASCII && first < unicode.MaxASCII &&
+		(unicode.IsLetter(last) || unicode.IsDigit(last)) && (unicode.IsLetter(first) || unicode.IsDigit(first)) {
+		return a + " " + b
+	}
+	return a + b
+}
+
+// splitInlineChoices 拆分同一段文字中的多个选项，如 "A.1 B.2 C.3"
+func splitInlineChoices(text string) []ChoiceRequest {
+	locs := ocrInlineChoice.FindAllStringSubmatchIndex(text, -1)
+	var choices []ChoiceRequest
+	for i, loc := range locs {
+		end := len(text)
+		if i+1 < len(locs) {
+			end = locs[i+1][0]
+		}
+		choices = append(choices, ChoiceRequest{
+			Choice:      text[loc[2]:loc[3]],
+			Description: strings.TrimSpace(text[loc[1]:end]),
+		})
+	}
+	return choices
+}
+
+func parseJudgeAnswer(answer string) (bool, bool) {
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "正确", "对", "√", "t", "true", "是":
+		return true, true
+	case "错误", "错", "×", "x", "f", "false", "否":
+		return false, true
+	}
+	return false, false
+}
+
+// BuildOCRDraftProblems 根据OCR文本行的位置重建题目结构：题号开启新题，字母编号识别为选项，
+// [答案]/[解析] 切换字段，其余行视为上一字段的续行
+func BuildOCRDraftProblems(lines []utils.OCRLine) []OCRDraftProblem {
+	const (
+		fieldStem = iota
+		fieldChoice
+		fieldAnswer
+		fieldAnalysis
+	)
+	var problems []OCRDraftProblem
+	var current *OCRDraftProblem
+	field := fieldStem
+	// -1 表示尚未遇到"选择题"/"判断题"/"填空题"等分区标题
+	sectionType := -1
+	appendText := func(text string) {
+		if current == nil || strings.TrimSpace(text) == "" {
+			return
+		}
+		switch field {
+		case fieldStem:
+			current.Description = joinOCRText(current.Description, text)
+		case fieldChoice:
+			last := &current.Choices[len(current.Choices)-1]
+			last.Description = joinOCRText(last.Description, text)
+		case fieldAnswer:
+			current.Answer = joinOCRText(current.Answer, text)
+		case fieldAnalysis:
+			current.Analysis = joinOCRText(current.Analysis, text)
+		}
+	}
+	for _, row := range groupOCRRows(lines) {
+		for _, line := range row {
+			text := strings.TrimSpace(line.Text)
+			if text == "" {
+				continue
+			}
+			if match := ocrSection.FindStringSubmatch(text); match != nil && len([]rune(text)) <= 20 {
+				switch match[1] {
+				case "选择题":
+					sectionType = ChoiceProblemType
+				case "判断题":
+					sectionType = JudgeProblemType
+				case "填空题":
+					sectionType = BlankProblemType
+				}
+				continue
+			}
+			if loc := ocrProblemStart.FindStringIndex(text); loc != nil {
+				problems = append(problems, OCRDraftProblem{ProblemType: sectionType})
+				current = &problems[len(problems)-1]
+				field = fieldStem
+				text = text[loc[1]:]
+			}
+			if current == nil {
+				continue
+			}
+			if loc := ocrAnswerStart.FindStringIndex(text); loc != nil {
+				field = fieldAnswer
+				text = text[loc[1]:]
+			} else if loc := ocrAnalysisStart.FindStringIndex(text); loc != nil {
+				field = fieldAnalysis
+				text = text[loc[1]:]
+			} else if ocrChoiceStart.MatchString(text) && field != fieldAnalysis {
+				current.Choices = append(current.Choices, splitInlineChoices(text)...)
+				field = fieldChoice
+				continue
+			}
+			// 解析可能和答案在同一行
+			if field == fieldAnswer {
+				if loc := ocrInlineAnalysis.FindStringIndex(text); loc != nil {
+					appendText(text[:loc[0]])
+					field = fieldAnalysis
+					text = text[loc[1]:]
+				}
+			}
+			appendText(text)
+		}
+	}
+	for i := range problems {
+		problem := &problems[i]
+		problem.Description = strings.TrimSpace(problem.Description)
+		problem.Answer = strings.TrimSpace(problem.Answer)
+		problem.Analysis = strings.TrimSpace(problem.Analysis)
+		if len(problem.Choices) > 0 {
+			problem.ProblemType = ChoiceProblemType
+			letters := ""
+			if match := ocrAnswerLetters.FindStringSubmatch(strings.ToUpper(problem.Answer)); match != nil {
+				letters = match[1]
+			}
+			for j := range problem.Choices {
+				problem.Choices[j].IsCorrect = strings.Contains(letters, problem.Choices[j].Choice)
+			}
+		} else if _, ok := parseJudgeAnswer(problem.Answer); ok && problem.ProblemType != BlankProblemType {
+			problem.ProblemType = JudgeProblemType
+		} else if problem.ProblemType != JudgeProblemType {
+			problem.ProblemType = BlankProblemType
+		}
+	}
+	return problems
+}
+
+// OCRProblemDraft godoc
+// @Schemes http
+// @Description 上传图片或PDF，OCR识别后根据文字位置重建题干、选项、答案和解析，返回题目草稿供确认（不写入数据库）
+// @Tags Special
+// @Param file formData file true "图片或PDF文件"
+// @Param page query int false "PDF页码，从1开始，默认为1"
+// @Success 200 {object} OCRDraftResponse "题目草稿"
+// @Failure 400 {string} string "参数错误"/"识别失败"
+// @Failure 429 {string} string "今日OCR次数已用完"
+// @Failure default {string} string "服务器错误"
+// @Router /special/ocr_problem/draft [post]
+// @Security ApiKeyAuth
+func OCRProblemDraft(c *gin.Context) {
+	file, _, err := c.Request.FormFile("file")
+	if err != nil {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	fileBytes, err := ioutil.ReadAll(file)
+	if err != nil || len(fileBytes) == 0 {
+		c.String(http.StatusBadRequest, "参数错误")
+		return
+	}
+	page := 1
+	if c.Query("page") != "" {
+		if page, err = strconv.Atoi(c.Query("page")); err != nil || page < 1 {
+			c.String(http.StatusBadRequest, "参数错误")
+			return
+		}
+	}
+	isPdf := bytes.HasPrefix(fileBytes, []byte("%PDF"))
+	status, message, lines := DoOCR(c, fileBytes, isPdf, page)
+	if status != http.StatusOK {
+		c.String(status, message)
+		return
+	}
+	problems := BuildOCRDraftProblems(lines)
+	c.JSON(http.StatusOK, OCRDraftResponse{
+		TotalCount: len(problems),
+		Problems:   problems,
+		Lines:      lines,
+	})
+}
+
+func validateOCRDraftProblem(problem *OCRDraftProblem) error {
+	if strings.TrimSpace(problem.Description) == "" {
+		return errors.New("题干为空")
+	}
+	switch problem.ProblemType {
+	case ChoiceProblemType:
+		if len(problem.Choices) < 2 {
+			return errors.New("选项不足")
+		}
+	case JudgeProblemType:
+		if _, ok := parseJudgeAnswer(problem.Answer); !ok {
+			return errors.New("判断题答案无效")
+		}
+	case BlankProblemType:
+	default:
+		return errors.New("题目类型无效")
+	}
+	return nil
+}
+
+// OCRProblemCommit godoc
+// @Schemes http
+// @Description 将确认后的题目草稿写入指定题集（需要有题集的修改权限，全部成功或全部失败）
+// @Tags Special
+// @Param request body OCRCommitRequest true "题集ID和题目草稿"
+// @Success 200 {object} BatchProblemResponse "添加成功，返回添加题目的编号列表"
+// @Failure 400 {string} string "请求解析失败"/"第n题：原因"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "题集不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /special/ocr_problem/commit [post]
+// @Security ApiKeyAuth
+func OCRProblemCommit(c *gin.Context) {
+	var request OCRCommitRequest
+	if err := c.ShouldBindJSON(&request); err != nil || len(request.Problems) == 0 {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var problemSet model.ProblemSet
+	sqlString := `SELECT * FROM problem_set WHERE id = $1`
+	if err := global.Database.Get(&problemSet, sqlString, request.ProblemSetId); err != nil {
+		c.String(http.StatusNotFound, "题集不存在")
+		return
+	}
+	role, _ := c.Get("Role")
+	if problemSet.GroupId == 0 {
+		if role != global.ADMIN && problemSet.UserId != c.GetInt("UserId") {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	} else {
+		sqlString = `SELECT count(*) FROM group_member WHERE group_id = $1 AND user_id = $2`
+		var count int
+		if err := global.Database.Get(&count, sqlString, problemSet.GroupId, c.GetInt("UserId")); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if role != global.ADMIN && count == 0 {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
+	for i := range request.Problems {
+		if err := validateOCRDraftProblem(&request.Problems[i]); err != nil {
+			c.String(http.StatusBadRequest, "第"+strconv.Itoa(i+1)+"题："+err.Error())
+			return
+		}
+	}
+	tx := global.Database.MustBegin()
+	var problemList []ProblemBatch
+	for _, problem := range request.Problems {
+		var problemId int
+		sqlString = `INSERT INTO problem_type (description, created_at, updated_at, user_id, problem_type_id, is_public, analysis)
+			VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
+		if err := tx.Get(&problemId, sqlString, strings.TrimSpace(problem.Description), time.Now().Local(), time.Now().Local(),
+			c.GetInt("UserId"), problem.ProblemType, request.IsPublic, problem.Analysis); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		var err error
+		switch problem.ProblemType {
+		case ChoiceProblemType:
+			sqlString = `INSERT INTO problem_choice (id, choice, description, is_correct) VALUES ($1, $2, $3, $4)`
+			for _, choice := range problem.Choices {
+				if _, err = tx.Exec(sqlString, problemId, choice.Choice, choice.Description, choice.IsCorrect); err != nil {
+					break
+				}
+			}
+		case BlankProblemType:
+			sqlString = `INSERT INTO problem_answer (id, answer) VALUES ($1, $2)`
+			_, err = tx.Exec(sqlString, problemId, problem.Answer)
+		case JudgeProblemType:
+			isCorrect, _ := parseJudgeAnswer(problem.Answer)
+			sqlString = `INSERT INTO problem_judge (id, is_correct) VALUES ($1, $2)`
+			_, err = tx.Exec(sqlString, problemId, isCorrect)
+		}
+		if err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		sqlString = `INSERT INTO problem_in_problem_set (problem_set_id, problem_id) VALUES ($1, $2)`
+		if _, err := tx.Exec(sqlString, problemSet.ID, problemId); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		problemList = append(problemList, ProblemBatch{
+			ProblemId:   problemId,
+			ProblemType: problem.ProblemType,
+			Description: problem.Description,
+			Analysis:    problem.Analysis,
+			Answer:      problem.Answer,
+		})
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, BatchProblemResponse{
+		Problems: problemList,
+	})
+}
@@ -18,11 +18,31 @@ const (
 	JudgeProblemType
 )
 
+// recordProblemOverride 管理员修改别人的题目后记录审计日志，快照只包含题目本身
+func recordProblemOverride(c *gin.Context, before model.ProblemType, groupId int) {
+	if !isAdminOverride(c, before.UserId) {
+		return
+	}
+	var after model.ProblemType
+	if err := global.Database.Get(&after, `SELECT * FROM problem_type WHERE id = $1`, before.ID); err != nil {
+		return
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionUpdate,
+		TargetType: ReportTargetProblem,
+		TargetId:   before.ID,
+		GroupId:    groupId,
+		OwnerId:    before.UserId,
+		Before:     before,
+		After:      after,
+	})
+}
+
 func DeleteProblem(c *gin.Context) {
 	problemId := c.Param("id")
-	sqlString := `SELECT user_id FROM problem_type WHERE id = $1`
-	var problemUserId int
-	if err := global.Database.Get(&problemUserId, sqlString, problemId); err != nil {
+	sqlString := `SELECT * FROM problem_type WHERE id = $1`
+	var problem model.ProblemType
+	if err := global.Database.Get(&problem, sqlString, problemId); err != nil {
 		c.String(http.StatusNotFound, "题目不存在")
 		return
 	}
@@ -40,7 +60,7 @@ func DeleteProblem(c *gin.Context) {
 		return
 	}
 	if groupId == 0 {
-		if role != global.ADMIN && problemUserId != c.GetInt("UserId") {
+		if role != global.ADMIN && problem.UserId != c.GetInt("UserId") {
 			c.String(http.StatusForbidden, "没有权限")
 			return
 		}
@@ -79,6 +99,14 @@ func DeleteProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: ReportTargetProblem,
+		TargetId:   problem.ID,
+		GroupId:    groupId,
+		OwnerId:    problem.UserId,
+		Before:     problem,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
@@ -101,32 +129,39 @@ type ChoiceProblemResponse struct {
 	IsFavorite    bool      `json:"is_favorite"`
 	FavoriteCount int       `json:"favorite_count"`
 	Choices       []Choice  `json:"choices"`
+	Images        []string  `json:"images"`
 }
 type Choice struct {
-	Choice      string `json:"choice"`
-	Description string `json:"description"`
+	Choice      string   `json:"choice"`
+	Description string   `json:"description"`
+	Images      []string `json:"images"`
 }
 type AllChoiceProblemResponse struct {
 	TotalCount int                     `json:"total_count"`
 	Problems   []ChoiceProblemResponse `json:"problems"`
 }
 type ChoiceProblemCreateRequest struct {
-	Description string          `json:"description"`
-	IsPublic    bool            `json:"is_public"`
-	Choices     []ChoiceRequest `json:"choices"`
-	Analysis    *string         `json:"analysis"`
+	Description    string          `json:"description"`
+	IsPublic       bool            `json:"is_public"`
+	Choices        []ChoiceRequest `json:"choices"`
+	Analysis       *string         `json:"analysis"`
+	Images         []string        `json:"images"`
+	AnalysisImages []string        `json:"analysis_images"`
 }
 type ChoiceProblemUpdateRequest struct {
-	ID          int             `json:"id"`
-	Description *string         `json:"description"`
-	IsPublic    *bool           `json:"is_public"`
-	Choices     []ChoiceRequest `json:"choices"`
-	Analysis    *string         `json:"analysis"`
+	ID             int             `json:"id"`
+	Description    *string         `json:"description"`
+	IsPublic       *bool           `json:"is_public"`
+	Choices        []ChoiceRequest `json:"choices"`
+	Analysis       *string         `json:"analysis"`
+	Images         []string        `json:"images"`
+	AnalysisImages []string        `json:"analysis_images"`
 }
 type ChoiceRequest struct {
-	Choice      string `json:"choice"`
-	Description string `json:"description"`
-	IsCorrect   bool   `json:"is_correct"`
+	Choice      string   `json:"choice"`
+	Description string   `json:"description"`
+	IsCorrect   bool     `json:"is_correct"`
+	Images      []string `json:"images"`
 }
 
 // GetChoiceProblems godoc
@@ -147,6 +182,7 @@ func GetChoiceProblems(c *gin.Context) {
 	} else if role == global.USER {
 		sqlString += ` AND (is_public = true OR user_id = ` + strconv.Itoa(c.GetInt("UserId")) + `)`
 	}
+	sqlString += hiddenCondition(c, "")
 	var filter ProblemFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
 		c.String(http.StatusBadRequest, "请求解析失败")
@@ -186,9 +222,15 @@ func GetChoiceProblems(c *gin.Context) {
 		}
 		var choices []Choice
 		for _, choice := range problemChoices {
+			choiceImages, err := GetProblemImageURLs(problem.ID, ProblemImageChoice, choice.Choice)
+			if err != nil {
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
 			choices = append(choices, Choice{
 				Choice:      choice.Choice,
 				Description: choice.Description,
+				Images:      choiceImages,
 			})
 		}
 		var CorrectChoiceCount int
@@ -197,6 +239,11 @@ func GetChoiceProblems(c *gin.Context) {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
+		images, err := GetProblemImageURLs(problem.ID, ProblemImageStem, "")
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 		var isFavorite int
 		sqlString = `SELECT COUNT(*) FROM user_favorite_problem WHERE user_id = $1 AND problem_id = $2`
 		if err := global.Database.Get(&isFavorite, sqlString, c.GetInt("UserId"), problem.ID); err != nil {
@@ -234,6 +281,7 @@ func GetChoiceProblems(c *gin.Context) {
 			IsMultiple:    CorrectChoiceCount > 1,
 			IsFavorite:    isFavorite > 0,
 			FavoriteCount: favoriteCount,
+			Images:        images,
 		})
 	}
 	c.JSON(http.StatusOK, AllChoiceProblemResponse{
@@ -248,7 +296,7 @@ func GetChoiceProblems(c *gin.Context) {
 // @Tags Problem
 // @Param problem body ChoiceProblemCreateRequest true "选择题信息"
 // @Success 200 {object} ChoiceProblemResponse "选择题信息"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败/图片地址无效"
 // @Failure default {string} string "服务器错误"
 // @Router /problem/choice/create [post]
 // @Security ApiKeyAuth
@@ -258,6 +306,13 @@ func CreateChoiceProblem(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	imageLists := [][]string{request.Images, request.AnalysisImages}
+	for _, choice := range request.Choices {
+		imageLists = append(imageLists, choice.Images)
+	}
+	if !checkProblemImages(c, 0, imageLists...) {
+		return
+	}
 	tx := global.Database.MustBegin()
 	var problemId int
 	sqlString := `INSERT INTO problem_type (description, user_id, problem_type_id, is_public, created_at, updated_at, analysis) 
@@ -275,6 +330,21 @@ func CreateChoiceProblem(c *gin.Context) {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
+		if err := SetProblemImages(tx, problemId, ProblemImageChoice, choice.Choice, choice.Images); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if err := SetProblemImages(tx, problemId, ProblemImageStem, "", request.Images); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := SetProblemImages(tx, problemId, ProblemImageAnalysis, "", request.AnalysisImages); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
 	}
 	if err := tx.Commit(); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
@@ -295,9 +365,15 @@ func CreateChoiceProblem(c *gin.Context) {
 	}
 	var choices []Choice
 	for _, choice := range problemChoices {
+		choiceImages, err := GetProblemImageURLs(problem.ID, ProblemImageChoice, choice.Choice)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 		choices = append(choices, Choice{
 			Choice:      choice.Choice,
 			Description: choice.Description,
+			Images:      choiceImages,
 		})
 	}
 	var CorrectChoiceCount int
@@ -306,6 +382,11 @@ func CreateChoiceProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	images, err := GetProblemImageURLs(problem.ID, ProblemImageStem, "")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	c.JSON(http.StatusOK, ChoiceProblemResponse{
 		ID:            problem.ID,
 		Description:   problem.Description,
@@ -317,16 +398,17 @@ func CreateChoiceProblem(c *gin.Context) {
 		IsFavorite:    false,
 		FavoriteCount: 0,
 		Choices:       choices,
+		Images:        images,
 	})
 }
 
 // UpdateChoiceProblem godoc
 // @Schemes http
-// @Description 更新选择题（只需传需要修改的字段,传原值也行）(只有管理员和题目创建者可以更新题目)(会直接清空原有选项)
+// @Description 更新选择题（只需传需要修改的字段,传原值也行）(只有管理员和题目创建者可以更新题目)(会直接清空原有选项及选项图片)(images/analysis_images不传则保持不变)
 // @Tags Problem
 // @Param problem body ChoiceProblemUpdateRequest true "选择题信息"
 // @Success 200 {string} string "更新成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败/图片地址无效"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "选择题不存在"
 // @Failure default {string} string "服务器错误"
@@ -374,6 +456,13 @@ func UpdateChoiceProblem(c *gin.Context) {
 			return
 		}
 	}
+	imageLists := [][]string{request.Images, request.AnalysisImages}
+	for _, choice := range request.Choices {
+		imageLists = append(imageLists, choice.Images)
+	}
+	if !checkProblemImages(c, request.ID, imageLists...) {
+		return
+	}
 	tx := global.Database.MustBegin()
 	if request.Description == nil {
 		request.Description = &choiceProblem.Description
@@ -397,6 +486,12 @@ func UpdateChoiceProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	sqlString = `DELETE FROM problem_image WHERE problem_id = $1 AND target = $2`
+	if _, err := tx.Exec(sqlString, request.ID, ProblemImageChoice); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	for _, choice := range request.Choices {
 		sqlString = `INSERT INTO problem_choice (id, choice, description, is_correct) VALUES ($1, $2, $3, $4) 
 			ON CONFLICT (id, choice) DO UPDATE SET description = $3, is_correct = $4`
@@ -406,11 +501,31 @@ func UpdateChoiceProblem(c *gin.Context) {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
+		if err := SetProblemImages(tx, request.ID, ProblemImageChoice, choice.Choice, choice.Images); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if request.Images != nil {
+		if err := SetProblemImages(tx, request.ID, ProblemImageStem, "", request.Images); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if request.AnalysisImages != nil {
+		if err := SetProblemImages(tx, request.ID, ProblemImageAnalysis, "", request.AnalysisImages); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 	}
 	if err := tx.Commit(); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordProblemOverride(c, choiceProblem, groupId)
 	c.String(http.StatusOK, "更新成功")
 }
 
@@ -430,14 +545,16 @@ func DeleteChoiceProblem(c *gin.Context) {
 }
 
 type ChoiceProblemAnswerItem struct {
-	Choice      string `json:"choice" db:"choice"`
-	Description string `json:"description" db:"description"`
-	IsCorrect   bool   `json:"is_correct" db:"is_correct"`
+	Choice      string   `json:"choice" db:"choice"`
+	Description string   `json:"description" db:"description"`
+	IsCorrect   bool     `json:"is_correct" db:"is_correct"`
+	Images      []string `json:"images" db:"-"`
 }
 
 type ChoiceProblemAnswerResponse struct {
 	ChoiceProblemAnswer []ChoiceProblemAnswerItem `json:"choice_problem_answer"`
 	Analysis            *string                   `json:"analysis"`
+	AnalysisImages      []string                  `json:"analysis_images"`
 }
 
 // GetChoiceProblemAnswer godoc
@@ -488,6 +605,16 @@ func GetChoiceProblemAnswer(c *gin.Context) {
 			return
 		}
 	}
+	// 作业中的题目按作业的答案公开设置限制查看
+	if role != global.ADMIN && choiceProblem.UserId != c.GetInt("UserId") {
+		if hidden, err := assignmentHidesAnswers(choiceProblem.ID, c.GetInt("UserId")); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		} else if hidden {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
 	sqlString = `SELECT * FROM problem_choice WHERE id = $1`
 	var choices []model.ProblemChoice
 	if err := global.Database.Select(&choices, sqlString, c.Param("id")); err != nil {
@@ -496,15 +623,27 @@ func GetChoiceProblemAnswer(c *gin.Context) {
 	}
 	var choiceProblemAnswerItems []ChoiceProblemAnswerItem
 	for _, choice := range choices {
+		choiceImages, err := GetProblemImageURLs(choiceProblem.ID, ProblemImageChoice, choice.Choice)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 		choiceProblemAnswerItems = append(choiceProblemAnswerItems, ChoiceProblemAnswerItem{
 			Choice:      choice.Choice,
 			Description: choice.Description,
 			IsCorrect:   choice.IsCorrect,
+			Images:      choiceImages,
 		})
 	}
+	analysisImages, err := GetProblemImageURLs(choiceProblem.ID, ProblemImageAnalysis, "")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	c.JSON(http.StatusOK, ChoiceProblemAnswerResponse{
 		ChoiceProblemAnswer: choiceProblemAnswerItems,
 		Analysis:            choiceProblem.Analysis,
+		AnalysisImages:      analysisImages,
 	})
 }
 
@@ -517,24 +656,29 @@ type BlankProblemResponse struct {
 	IsPublic      bool      `json:"is_public"`
 	IsFavorite    bool      `json:"is_favorite"`
 	FavoriteCount int       `json:"favorite_count"`
+	Images        []string  `json:"images"`
 }
 type AllBlankProblemResponse struct {
 	TotalCount int                    `json:"total_count"`
 	Problems   []BlankProblemResponse `json:"problems"`
 }
 type BlankProblemCreateRequest struct {
-	Description   string  `json:"description"`
-	IsPublic      bool    `json:"is_public"`
-	Answer        string  `json:"answer"`
-	AnswerExplain string  `json:"answer_explanation"`
-	Analysis      *string `json:"analysis"`
+	Description    string   `json:"description"`
+	IsPublic       bool     `json:"is_public"`
+	Answer         string   `json:"answer"`
+	AnswerExplain  string   `json:"answer_explanation"`
+	Analysis       *string  `json:"analysis"`
+	Images         []string `json:"images"`
+	AnalysisImages []string `json:"analysis_images"`
 }
 type BlankProblemUpdateRequest struct {
-	ID          int     `json:"id"`
-	Description *string `json:"description"`
-	IsPublic    *bool   `json:"is_public"`
-	Answer      *string `json:"answer"`
-	Analysis    *string `json:"analysis"`
+	ID             int      `json:"id"`
+	Description    *string  `json:"description"`
+	IsPublic       *bool    `json:"is_public"`
+	Answer         *string  `json:"answer"`
+	Analysis       *string  `json:"analysis"`
+	Images         []string `json:"images"`
+	AnalysisImages []string `json:"analysis_images"`
 }
 
 // GetBlankProblems godoc
@@ -555,6 +699,7 @@ func GetBlankProblems(c *gin.Context) {
 	} else if role == global.USER {
 		sqlString += ` AND (is_public = true OR user_id = ` + strconv.Itoa(c.GetInt("UserId")) + `)`
 	}
+	sqlString += hiddenCondition(c, "")
 	var filter ProblemFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
 		c.String(http.StatusBadRequest, "请求解析失败")
@@ -612,6 +757,11 @@ func GetBlankProblems(c *gin.Context) {
 				continue
 			}
 		}
+		images, err := GetProblemImageURLs(blankProblem.ID, ProblemImageStem, "")
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 		blankProblemResponses = append(blankProblemResponses, BlankProblemResponse{
 			ID:            blankProblem.ID,
 			Description:   blankProblem.Description,
@@ -621,6 +771,7 @@ func GetBlankProblems(c *gin.Context) {
 			IsPublic:      blankProblem.IsPublic,
 			IsFavorite:    isFavorite > 0,
 			FavoriteCount: favoriteCount,
+			Images:        images,
 		})
 	}
 	c.JSON(http.StatusOK, AllBlankProblemResponse{
@@ -635,7 +786,7 @@ func GetBlankProblems(c *gin.Context) {
 // @Tags Problem
 // @Param problem body BlankProblemCreateRequest true "填空题信息"
 // @Success 200 {object} BlankProblemResponse "创建成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败/图片地址无效"
 // @Failure default {string} string "服务器错误"
 // @Router /problem/blank/create [post]
 // @Security ApiKeyAuth
@@ -645,6 +796,9 @@ func CreateBlankProblem(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	if !checkProblemImages(c, 0, request.Images, request.AnalysisImages) {
+		return
+	}
 	tx := global.Database.MustBegin()
 	var problemId int
 	sqlString := `INSERT INTO problem_type (problem_type_id, description, is_public, user_id, created_at, updated_at, analysis) 
@@ -661,10 +815,28 @@ func CreateBlankProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if err := SetProblemImages(tx, problemId, ProblemImageStem, "", request.Images); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := SetProblemImages(tx, problemId, ProblemImageAnalysis, "", request.AnalysisImages); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	var problem model.ProblemType
 	sqlString = `SELECT * FROM problem_type WHERE id = $1`
 	if err := global.Database.Get(&problem, sqlString, problemId); err != nil {
-		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	images, err := GetProblemImageURLs(problem.ID, ProblemImageStem, "")
+	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
@@ -677,6 +849,7 @@ func CreateBlankProblem(c *gin.Context) {
 		IsPublic:      problem.IsPublic,
 		IsFavorite:    false,
 		FavoriteCount: 0,
+		Images:        images,
 	})
 }
 
@@ -686,7 +859,7 @@ func CreateBlankProblem(c *gin.Context) {
 // @Tags Problem
 // @Param problem body BlankProblemUpdateRequest true "填空题信息"
 // @Success 200 {string} string "更新成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败/图片地址无效"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "填空题不存在"/"答案不存在"
 // @Failure default {string} string "服务器错误"
@@ -752,6 +925,9 @@ func UpdateBlankProblem(c *gin.Context) {
 		}
 		request.Answer = &answer.Answer
 	}
+	if !checkProblemImages(c, request.ID, request.Images, request.AnalysisImages) {
+		return
+	}
 	tx := global.Database.MustBegin()
 	sqlString = `UPDATE problem_type SET description = $1, is_public = $2, updated_at = $3, analysis = $4 WHERE id = $5`
 	if _, err := global.Database.Exec(sqlString, request.Description,
@@ -766,11 +942,26 @@ func UpdateBlankProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if request.Images != nil {
+		if err := SetProblemImages(tx, request.ID, ProblemImageStem, "", request.Images); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if request.AnalysisImages != nil {
+		if err := SetProblemImages(tx, request.ID, ProblemImageAnalysis, "", request.AnalysisImages); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordProblemOverride(c, blankProblem, groupId)
 	c.String(http.StatusOK, "更新成功")
 }
 
@@ -790,8 +981,9 @@ func DeleteBlankProblem(c *gin.Context) {
 }
 
 type BlankProblemAnswerResponse struct {
-	Answer   string  `json:"answer"`
-	Analysis *string `json:"analysis"`
+	Answer         string   `json:"answer"`
+	Analysis       *string  `json:"analysis"`
+	AnalysisImages []string `json:"analysis_images"`
 }
 
 // GetBlankProblemAnswer godoc
@@ -842,15 +1034,31 @@ func GetBlankProblemAnswer(c *gin.Context) {
 			return
 		}
 	}
+	// 作业中的题目按作业的答案公开设置限制查看
+	if role != global.ADMIN && problem.UserId != c.GetInt("UserId") {
+		if hidden, err := assignmentHidesAnswers(problem.ID, c.GetInt("UserId")); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		} else if hidden {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
 	sqlString = `SELECT answer FROM problem_answer WHERE id = $1`
 	var answer string
 	if err := global.Database.Get(&answer, sqlString, c.Param("id")); err != nil {
 		c.String(http.StatusNotFound, "填空题不存在")
 		return
 	}
+	analysisImages, err := GetProblemImageURLs(problem.ID, ProblemImageAnalysis, "")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	c.JSON(http.StatusOK, BlankProblemAnswerResponse{
-		Answer:   answer,
-		Analysis: problem.Analysis,
+		Answer:         answer,
+		Analysis:       problem.Analysis,
+		AnalysisImages: analysisImages,
 	})
 }
 
@@ -863,23 +1071,28 @@ type JudgeProblemResponse struct {
 	IsPublic      bool      `json:"is_public"`
 	IsFavorite    bool      `json:"is_favorite"`
 	FavoriteCount int       `json:"favorite_count"`
+	Images        []string  `json:"images"`
 }
 type AllJudgeProblemResponse struct {
 	TotalCount int                    `json:"total_count"`
 	Problems   []JudgeProblemResponse `json:"problems"`
 }
 type JudgeProblemCreateRequest struct {
-	Description string  `json:"description"`
-	IsPublic    bool    `json:"is_public"`
-	IsCorrect   bool    `json:"is_correct"`
-	Analysis    *string `json:"analysis"`
+	Description    string   `json:"description"`
+	IsPublic       bool     `json:"is_public"`
+	IsCorrect      bool     `json:"is_correct"`
+	Analysis       *string  `json:"analysis"`
+	Images         []string `json:"images"`
+	AnalysisImages []string `json:"analysis_images"`
 }
 type JudgeProblemUpdateRequest struct {
-	ID          int     `json:"id"`
-	Description *string `json:"description"`
-	IsPublic    *bool   `json:"is_public"`
-	IsCorrect   *bool   `json:"is_correct"`
-	Analysis    *string `json:"analysis"`
+	ID             int      `json:"id"`
+	Description    *string  `json:"description"`
+	IsPublic       *bool    `json:"is_public"`
+	IsCorrect      *bool    `json:"is_correct"`
+	Analysis       *string  `json:"analysis"`
+	Images         []string `json:"images"`
+	AnalysisImages []string `json:"analysis_images"`
 }
 
 // GetJudgeProblems godoc
@@ -900,6 +1113,7 @@ func GetJudgeProblems(c *gin.Context) {
 	} else if role == global.USER {
 		sqlString += ` AND (is_public = true OR user_id = ` + strconv.Itoa(c.GetInt("UserId")) + `)`
 	}
+	sqlString += hiddenCondition(c, "")
 	var filter ProblemFilter
 	if err := c.ShouldBindQuery(&filter); err != nil {
 		c.String(http.StatusBadRequest, "请求解析失败")
@@ -957,6 +1171,11 @@ func GetJudgeProblems(c *gin.Context) {
 				continue
 			}
 		}
+		images, err := GetProblemImageURLs(judgeProblem.ID, ProblemImageStem, "")
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 		judgeProblemResponses = append(judgeProblemResponses, JudgeProblemResponse{
 			ID:            judgeProblem.ID,
 			Description:   judgeProblem.Description,
@@ -966,6 +1185,7 @@ func GetJudgeProblems(c *gin.Context) {
 			IsPublic:      judgeProblem.IsPublic,
 			IsFavorite:    isFavorite > 0,
 			FavoriteCount: favoriteCount,
+			Images:        images,
 		})
 	}
 	c.JSON(http.StatusOK, AllJudgeProblemResponse{
@@ -980,7 +1200,7 @@ func GetJudgeProblems(c *gin.Context) {
 // @Tags Problem
 // @Param problem body JudgeProblemCreateRequest true "判断题信息"
 // @Success 200 {object} JudgeProblemResponse "创建成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败/图片地址无效"
 // @Failure default {string} string "服务器错误"
 // @Router /problem/judge/create [post]
 // @Security ApiKeyAuth
@@ -990,6 +1210,9 @@ func CreateJudgeProblem(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求解析失败")
 		return
 	}
+	if !checkProblemImages(c, 0, request.Images, request.AnalysisImages) {
+		return
+	}
 	tx := global.Database.MustBegin()
 	var problemId int
 	sqlString := `INSERT INTO problem_type (problem_type_id, description, is_public, user_id, created_at, updated_at, analysis) 
@@ -1006,10 +1229,28 @@ func CreateJudgeProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if err := SetProblemImages(tx, problemId, ProblemImageStem, "", request.Images); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := SetProblemImages(tx, problemId, ProblemImageAnalysis, "", request.AnalysisImages); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	var problem model.ProblemType
 	sqlString = `SELECT * FROM problem_type WHERE id = $1`
 	if err := global.Database.Get(&problem, sqlString, problemId); err != nil {
-		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	images, err := GetProblemImageURLs(problem.ID, ProblemImageStem, "")
+	if err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
@@ -1022,6 +1263,7 @@ func CreateJudgeProblem(c *gin.Context) {
 		IsPublic:      problem.IsPublic,
 		IsFavorite:    false,
 		FavoriteCount: 0,
+		Images:        images,
 	})
 }
 
@@ -1031,7 +1273,7 @@ func CreateJudgeProblem(c *gin.Context) {
 // @Tags Problem
 // @Param problem body JudgeProblemUpdateRequest true "判断题信息"
 // @Success 200 {string} string "更新成功"
-// @Failure 400 {string} string "请求解析失败"
+// @Failure 400 {string} string "请求解析失败/图片地址无效"
 // @Failure 403 {string} string "没有权限"
 // @Failure 404 {string} string "判断题不存在"/"答案不存在"
 // @Failure default {string} string "服务器错误"
@@ -1097,6 +1339,9 @@ func UpdateJudgeProblem(c *gin.Context) {
 		}
 		request.IsCorrect = &judge.IsCorrect
 	}
+	if !checkProblemImages(c, request.ID, request.Images, request.AnalysisImages) {
+		return
+	}
 	tx := global.Database.MustBegin()
 	sqlString = `UPDATE problem_type SET description = $1, is_public = $2, updated_at = $3, analysis = $4 WHERE id = $5`
 	if _, err := global.Database.Exec(sqlString, request.Description,
@@ -1111,11 +1356,26 @@ func UpdateJudgeProblem(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if request.Images != nil {
+		if err := SetProblemImages(tx, request.ID, ProblemImageStem, "", request.Images); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	if request.AnalysisImages != nil {
+		if err := SetProblemImages(tx, request.ID, ProblemImageAnalysis, "", request.AnalysisImages); err != nil {
+			_ = tx.Rollback()
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordProblemOverride(c, judgeProblem, groupId)
 	c.String(http.StatusOK, "更新成功")
 }
 
@@ -1135,8 +1395,9 @@ func DeleteJudgeProblem(c *gin.Context) {
 }
 
 type JudgeProblemAnswerResponse struct {
-	IsCorrect bool   `json:"is_correct"`
-	Analysis  string `json:"analysis"`
+	IsCorrect      bool     `json:"is_correct"`
+	Analysis       string   `json:"analysis"`
+	AnalysisImages []string `json:"analysis_images"`
 }
 
 // GetJudgeProblemAnswer godoc
@@ -1187,22 +1448,39 @@ func GetJudgeProblemAnswer(c *gin.Context) {
 			return
 		}
 	}
+	// 作业中的题目按作业的答案公开设置限制查看
+	if role != global.ADMIN && problem.UserId != c.GetInt("UserId") {
+		if hidden, err := assignmentHidesAnswers(problem.ID, c.GetInt("UserId")); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		} else if hidden {
+			c.String(http.StatusForbidden, "没有权限")
+			return
+		}
+	}
 	sqlString = `SELECT is_correct FROM problem_judge WHERE id = $1`
 	var isCorrect bool
 	if err := global.Database.Get(&isCorrect, sqlString, c.Param("id")); err != nil {
 		c.String(http.StatusNotFound, "判断题不存在")
 		return
 	}
+	analysisImages, err := GetProblemImageURLs(problem.ID, ProblemImageAnalysis, "")
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	if problem.Analysis == nil {
 		c.JSON(http.StatusOK, JudgeProblemAnswerResponse{
-			IsCorrect: isCorrect,
-			Analysis:  "",
+			IsCorrect:      isCorrect,
+			Analysis:       "",
+			AnalysisImages: analysisImages,
 		})
 		return
 	}
 	c.JSON(http.StatusOK, JudgeProblemAnswerResponse{
-		IsCorrect: isCorrect,
-		Analysis:  *problem.Analysis,
+		IsCorrect:      isCorrect,
+		Analysis:       *problem.Analysis,
+		AnalysisImages: analysisImages,
 	})
 }
 
@@ -0,0 +1,218 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/spf13/viper"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	ProblemImageStem = iota
+	ProblemImageChoice
+	ProblemImageAnalysis
+)
+
+type ProblemImageResponse struct {
+	ID        int    `json:"id"`
+	ProblemId int    `json:"problem_id"`
+	Target    int    `json:"target"`
+	Choice    string `json:"choice"`
+	URL       string `json:"url"`
+	SortOrder int    `json:"sort_order"`
+}
+
+// GetProblemImageURLs 按顺序返回题目某一部分（题干/选项/解析）的图片地址
+func GetProblemImageURLs(problemId int, target int, choice string) ([]string, error) {
+	urls := make([]string, 0)
+	sqlString := `SELECT url FROM problem_image WHERE problem_id = $1 AND target = $2 AND choice = $3 ORDER BY sort_order, id`
+	if err := global.Database.Select(&urls, sqlString, problemId, target, choice); err != nil {
+		return nil, err
+	}
+	return urls, nil
+}
+
+// SetProblemImages 用 urls 覆盖题目某一部分的图片，urls 的顺序即为展示顺序
+func SetProblemImages(tx *sqlx.Tx, problemId int, target int, choice string, urls []string) error {
+	sqlString := `DELETE FROM problem_image WHERE problem_id = $1 AND target = $2 AND choice = $3`
+	if _, err := tx.Exec(sqlString, problemId, target, choice); err != nil {
+		return err
+	}
+	sqlString = `INSERT INTO problem_image (problem_id, target, choice, url, sort_order, created_at) VALUES ($1, $2, $3, $4, $5, $6)`
+	for i, url := range urls {
+		if _, err := tx.Exec(sqlString, problemId, target, choice, url, i, time.Now().Local()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CopyProblemImages 把 fromId 题目的全部图片复制给 toId 题目
+func CopyProblemImages(tx *sqlx.Tx, fromId int, toId int) error {
+	sqlString := `INSERT INTO problem_image (problem_id, target, choice, url, sort_order, created_at)
+		SELECT $1, target, choice, url, sort_order, $2 FROM problem_image WHERE problem_id = $3`
+	_, err := tx.Exec(sqlString, toId, time.Now().Local(), fromId)
+	return err
+}
+
+// checkProblemImages 检查请求中的图片地址，只接受题目已有的图片和当前用户通过上传接口上传到公开存储桶中的图片，
+// 不接受任意外部地址。不通过时写入响应并返回 false，problemId 为0表示新建的题目
+func checkProblemImages(c *gin.Context, problemId int, lists ...[]string) bool {
+	existing := make(map[string]bool)
+	if problemId != 0 {
+		var urls []string
+		sqlString := `SELECT url FROM problem_image WHERE problem_id = $1`
+		if err := global.Database.Select(&urls, sqlString, problemId); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return false
+		}
+		for _, url := range urls {
+			existing[url] = true
+		}
+	}
+	prefix := viper.GetString("S3PublicBucketRoute") + "/" + strconv.Itoa(c.GetInt("UserId")) + "/"
+	for _, urls := range lists {
+		for _, url := range urls {
+			if existing[url] || strings.HasPrefix(url, prefix) && !strings.Contains(url, "..") &&
+				!strings.ContainsAny(url, "?#") {
+				continue
+			}
+			c.String(http.StatusBadRequest, "图片地址无效")
+			return false
+		}
+	}
+	return true
+}
+
+func checkProblemWriteAuth(c *gin.Context, problem *model.ProblemType) (int, string) {
+	role, _ := c.Get("Role")
+	if role == global.ADMIN || problem.UserId == c.GetInt("UserId") {
+		return http.StatusOK, ""
+	}
+	// 题目可能在多个题集中，只要当前用户是其中任意一个小组题集所在小组的成员就可以修改
+	var count int
+	sqlString := `SELECT count(*) FROM problem_in_problem_set p JOIN problem_set s ON s.id = p.problem_set_id
+		JOIN group_member m ON m.group_id = s.group_id WHERE p.problem_id = $1 AND s.group_id <> 0 AND m.user_id = $2`
+	if err := global.Database.Get(&count, sqlString, problem.ID, c.GetInt("UserId")); err != nil {
+		return http.StatusInternalServerError, "服务器错误"
+	}
+	if count == 0 {
+		return http.StatusForbidden, "没有权限"
+	}
+	return http.StatusOK, ""
+}
+
+// UploadProblemImage godoc
+// @Schemes http
+// @Description 上传题目图片（追加到题干/选项/解析图片列表末尾，只有管理员和有权修改题目的用户可以上传）
+// @Tags Upload
+// @Param file formData file true "图片"
+// @Param problem_id query int true "题目ID"
+// @Param target query int true "图片位置, 0: 题干, 1: 选项, 2: 解析"
+// @Param choice query string false "选项（target为1时必填）"
+// @Success 200 {object} ProblemImageResponse "图片信息"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "题目不存在"/"选项不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /upload/problem_image [post]
+// @Security ApiKeyAuth
+func UploadProblemImage(c *gin.Context) {
+	target, err := strconv.Atoi(c.Query("target"))
+	if err != nil || target < ProblemImageStem || target > ProblemImageAnalysis {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	choice := ""
+	if target == ProblemImageChoice {
+		choice = c.Query("choice")
+		if choice == "" {
+			c.String(http.StatusBadRequest, "请求解析失败")
+			return
+		}
+	}
+	var problem model.ProblemType
+	sqlString := `SELECT * FROM problem_type WHERE id = $1`
+	if err := global.Database.Get(&problem, sqlString, c.Query("problem_id")); err != nil {
+		c.String(http.StatusNotFound, "题目不存在")
+		return
+	}
+	if status, message := checkProblemWriteAuth(c, &problem); status != http.StatusOK {
+		c.String(status, message)
+		return
+	}
+	if target == ProblemImageChoice {
+		var count int
+		sqlString = `SELECT count(*) FROM problem_choice WHERE id = $1 AND choice = $2`
+		if err := global.Database.Get(&count, sqlString, problem.ID, choice); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if count == 0 {
+			c.String(http.StatusNotFound, "选项不存在")
+			return
+		}
+	}
+	status, url := DoUploadPublic(c)
+	if status != http.StatusOK {
+		c.String(status, "上传失败")
+		return
+	}
+	var image model.ProblemImage
+	sqlString = `INSERT INTO problem_image (problem_id, target, choice, url, sort_order, created_at)
+		VALUES ($1, $2, $3, $4, (SELECT COALESCE(MAX(sort_order), -1) + 1 FROM problem_image
+		WHERE problem_id = $1 AND target = $2 AND choice = $3), $5) RETURNING *`
+	if err := global.Database.Get(&image, sqlString, problem.ID, target, choice, url, time.Now().Local()); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, ProblemImageResponse{
+		ID:        image.ID,
+		ProblemId: image.ProblemId,
+		Target:    image.Target,
+		Choice:    image.Choice,
+		URL:       image.URL,
+		SortOrder: image.SortOrder,
+	})
+}
+
+// DeleteProblemImage godoc
+// @Schemes http
+// @Description 删除题目图片（只有管理员和有权修改题目的用户可以删除）
+// @Tags Upload
+// @Param id path int true "图片ID"
+// @Success 200 {string} string "删除成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "图片不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /upload/problem_image/{id} [delete]
+// @Security ApiKeyAuth
+func DeleteProblemImage(c *gin.Context) {
+	var image model.ProblemImage
+	sqlString := `SELECT * FROM problem_image WHERE id = $1`
+	if err := global.Database.Get(&image, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "图片不存在")
+		return
+	}
+	var problem model.ProblemType
+	sqlString = `SELECT * FROM problem_type WHERE id = $1`
+	if err := global.Database.Get(&problem, sqlString, image.ProblemId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if status, message := checkProblemWriteAuth(c, &problem); status != http.StatusOK {
+		c.String(status, message)
+		return
+	}
+	sqlString = `DELETE FROM problem_image WHERE id = $1`
+	if _, err := global.Database.Exec(sqlString, image.ID); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "删除成功")
+}
@@ -93,6 +93,7 @@ func GetProblemSets(c *gin.Context) {
 	} else {
 		sqlString += ` WHERE group_id = 0`
 	}
+	sqlString += hiddenCondition(c, "")
 	if filter.ID != nil {
 		sqlString += fmt.Sprintf(` AND id = %d`, *filter.ID)
 	}
@@ -323,6 +324,20 @@ func UpdateProblemSet(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	if isAdminOverride(c, problemSet.UserId) {
+		var updated model.ProblemSet
+		if err := global.Database.Get(&updated, `SELECT * FROM problem_set WHERE id = $1`, problemSet.ID); err == nil {
+			recordAudit(c, auditEvent{
+				Action:     AuditActionUpdate,
+				TargetType: ReportTargetProblemSet,
+				TargetId:   problemSet.ID,
+				GroupId:    problemSet.GroupId,
+				OwnerId:    problemSet.UserId,
+				Before:     problemSet,
+				After:      updated,
+			})
+		}
+	}
 	c.String(http.StatusOK, "更新成功")
 }
 
@@ -343,6 +358,7 @@ type ProblemResponse struct {
 	IsFavorite    bool      `json:"is_favorite"`
 	FavoriteCount int       `json:"favorite_count"`
 	ProblemTypeId int       `json:"problem_type_id"`
+	Images        []string  `json:"images"`
 }
 type AllProblemResponse struct {
 	TotalCount int               `json:"total_count"`
@@ -365,7 +381,8 @@ type AllProblemResponse struct {
 func GetProblemsInProblemSet(c *gin.Context) {
 	sqlString := `SELECT * FROM problem_set WHERE id = $1`
 	var problemSet model.ProblemSet
-	if err := global.Database.Get(&problemSet, sqlString, c.Param("id")); err != nil {
+	if err := global.Database.Get(&problemSet, sqlString, c.Param("id")); err != nil ||
+		isHiddenFrom(c, problemSet.IsHidden, problemSet.UserId) {
 		c.String(http.StatusNotFound, "题集不存在")
 		return
 	}
@@ -393,6 +410,7 @@ func GetProblemsInProblemSet(c *gin.Context) {
 		return
 	}
 	sqlString = `SELECT * FROM problem_type` + fmt.Sprintf(" WHERE id IN (SELECT problem_id FROM problem_in_problem_set WHERE problem_set_id = %d)", problemSet.ID)
+	sqlString += hiddenCondition(c, "")
 	if filter.IsFavorite != nil {
 		if *filter.IsFavorite {
 			sqlString += fmt.Sprintf(" AND id IN (SELECT problem_id FROM user_favorite_problem WHERE user_id = %d)", c.GetInt("UserId"))
@@ -435,6 +453,11 @@ func GetProblemsInProblemSet(c *gin.Context) {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
+		images, err := GetProblemImageURLs(problem.ID, ProblemImageStem, "")
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
 		problemResponses = append(problemResponses, ProblemResponse{
 			ID:            problem.ID,
 			Description:   problem.Description,
@@ -445,6 +468,7 @@ func GetProblemsInProblemSet(c *gin.Context) {
 			IsFavorite:    isFavorite > 0,
 			FavoriteCount: favoriteCount,
 			ProblemTypeId: problem.ProblemTypeId,
+			Images:        images,
 		})
 	}
 	c.JSON(http.StatusOK, AllProblemResponse{
@@ -551,46 +575,32 @@ func MigrateProblemToProblemSet(c *gin.Context) {
 		c.String(http.StatusNotFound, "题目不存在")
 		return
 	}
-	var problemSetIds []int
-	sqlString = `SELECT problem_set_id FROM problem_in_problem_set WHERE problem_id = $1`
-	if err := global.Database.Select(&problemSetIds, sqlString, c.Query("problem_id")); err != nil {
-		c.String(http.StatusInternalServerError, "服务器错误")
-		return
-	}
-	var groupId int
-	sqlString = `SELECT group_id FROM problem_set WHERE id = $1`
-	if err := global.Database.Get(&groupId, sqlString, problemSetIds[0]); err != nil {
-		c.String(http.StatusInternalServerError, "服务器错误")
-		return
-	}
-	if groupId == 0 {
-		if role != global.ADMIN && problem.UserId != c.GetInt("UserId") && !problem.IsPublic {
-			c.String(http.StatusForbidden, "没有权限")
-			return
-		}
-	} else {
-		sqlString = `SELECT count(*) FROM group_member WHERE group_id = $1 AND user_id = $2`
+	// 非公开的题目只有作者和题目所在任意一个小组题集的小组成员可以复制
+	if role != global.ADMIN && problem.UserId != c.GetInt("UserId") && !problem.IsPublic {
 		var count int
-		if err := global.Database.Get(&count, sqlString, groupId, c.GetInt("UserId")); err != nil {
+		sqlString = `SELECT count(*) FROM problem_in_problem_set p JOIN problem_set s ON s.id = p.problem_set_id
+			JOIN group_member m ON m.group_id = s.group_id WHERE p.problem_id = $1 AND s.group_id <> 0 AND m.user_id = $2`
+		if err := global.Database.Get(&count, sqlString, problem.ID, c.GetInt("UserId")); err != nil {
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
-		if role != global.ADMIN && count == 0 && !problem.IsPublic {
+		if count == 0 {
 			c.String(http.StatusForbidden, "没有权限")
 			return
 		}
 	}
+	originalId := problem.ID
 	tx := global.Database.MustBegin()
 	sqlString = `INSERT INTO problem_type (description, created_at, updated_at, user_id, 
   		is_public, problem_type_id, analysis) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING id`
-	if err := global.Database.Get(&problem.ID, sqlString, problem.Description, time.Now().Local(), time.Now().Local(),
+	if err := tx.Get(&problem.ID, sqlString, problem.Description, time.Now().Local(), time.Now().Local(),
 		c.GetInt("UserId"), problem.IsPublic, problem.ProblemTypeId, problem.Analysis); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
 	sqlString = `INSERT INTO problem_in_problem_set (problem_set_id, problem_id) VALUES ($1, $2)`
-	if _, err := global.Database.Exec(sqlString, c.Param("id"), problem.ID); err != nil {
+	if _, err := tx.Exec(sqlString, c.Param("id"), problem.ID); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
@@ -598,14 +608,14 @@ func MigrateProblemToProblemSet(c *gin.Context) {
 	if problem.ProblemTypeId == ChoiceProblemType {
 		var choices []model.ProblemChoice
 		sqlString = `SELECT * FROM problem_choice WHERE id = $1`
-		if err := global.Database.Select(&choices, sqlString, c.Query("problem_id")); err != nil {
+		if err := tx.Select(&choices, sqlString, c.Query("problem_id")); err != nil {
 			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
 		for _, choice := range choices {
 			sqlString = `INSERT INTO problem_choice (id, choice, description, is_correct) VALUES ($1, $2, $3, $4)`
-			if _, err := global.Database.Exec(sqlString, problem.ID, choice.Choice, choice.Description, choice.IsCorrect); err != nil {
+			if _, err := tx.Exec(sqlString, problem.ID, choice.Choice, choice.Description, choice.IsCorrect); err != nil {
 				_ = tx.Rollback()
 				c.String(http.StatusInternalServerError, "服务器错误")
 				return
@@ -614,13 +624,13 @@ func MigrateProblemToProblemSet(c *gin.Context) {
 	} else if problem.ProblemTypeId == BlankProblemType {
 		var answer model.ProblemAnswer
 		sqlString = `SELECT * FROM problem_answer WHERE id = $1`
-		if err := global.Database.Get(&answer, sqlString, c.Query("problem_id")); err != nil {
+		if err := tx.Get(&answer, sqlString, c.Query("problem_id")); err != nil {
 			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
 		sqlString = `INSERT INTO problem_answer (id, answer) VALUES ($1, $2)`
-		if _, err := global.Database.Exec(sqlString, problem.ID, answer.Answer); err != nil {
+		if _, err := tx.Exec(sqlString, problem.ID, answer.Answer); err != nil {
 			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
@@ -628,18 +638,23 @@ func MigrateProblemToProblemSet(c *gin.Context) {
 	} else if problem.ProblemTypeId == JudgeProblemType {
 		var judge model.ProblemJudge
 		sqlString = `SELECT * FROM problem_judge WHERE id = $1`
-		if err := global.Database.Get(&judge, sqlString, c.Query("problem_id")); err != nil {
+		if err := tx.Get(&judge, sqlString, c.Query("problem_id")); err != nil {
 			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
 		sqlString = `INSERT INTO problem_judge (id, is_correct) VALUES ($1, $2)`
-		if _, err := global.Database.Exec(sqlString, problem.ID, judge.IsCorrect); err != nil {
+		if _, err := tx.Exec(sqlString, problem.ID, judge.IsCorrect); err != nil {
 			_ = tx.Rollback()
 			c.String(http.StatusInternalServerError, "服务器错误")
 			return
 		}
 	}
+	if err := CopyProblemImages(tx, originalId, problem.ID); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	if err := tx.Commit(); err != nil {
 		_ = tx.Rollback()
 		c.String(http.StatusInternalServerError, "服务器错误")
@@ -744,6 +759,14 @@ func DeleteProblemSet(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionDelete,
+		TargetType: ReportTargetProblemSet,
+		TargetId:   problemSet.ID,
+		GroupId:    problemSet.GroupId,
+		OwnerId:    problemSet.UserId,
+		Before:     problemSet,
+	})
 	c.String(http.StatusOK, "删除成功")
 }
 
@@ -0,0 +1,152 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"golang.org/x/net/websocket"
+	"io"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"log"
+	"net/http"
+	"time"
+)
+
+// PushHeartbeatInterval 是实时连接的心跳间隔，每次心跳时检查会话是否仍然有效并刷新用户所在的小组
+var PushHeartbeatInterval = 30 * time.Second
+
+func getUserGroupIds(userId int) ([]int, error) {
+	groupIds := make([]int, 0)
+	sqlString := `SELECT group_id FROM group_member WHERE user_id = $1`
+	if err := global.Database.Select(&groupIds, sqlString, userId); err != nil {
+		return nil, err
+	}
+	return groupIds, nil
+}
+
+// refreshPushSubscriber 在心跳时检查连接所属的会话，会话已经注销、过期或用户被封禁时返回 false，连接应当关闭。
+// 查询失败时保留连接，等下一次心跳再检查
+func refreshPushSubscriber(ctx context.Context, subscriber *utils.PushSubscriber, sessionId string) bool {
+	active, err := global.IsSessionActive(ctx, subscriber.UserId, sessionId)
+	if err != nil {
+		log.Printf("检查用户 %d 的会话失败: %v", subscriber.UserId, err)
+		return true
+	}
+	if !active {
+		return false
+	}
+	groupIds, err := getUserGroupIds(subscriber.UserId)
+	if err != nil {
+		log.Printf("刷新用户 %d 的小组失败: %v", subscriber.UserId, err)
+		return true
+	}
+	subscriber.SetGroups(groupIds)
+	return true
+}
+
+// PushStream godoc
+// @Schemes http
+// @Description 以 Server-Sent Events 的形式实时推送通知（notification）、所在小组的讨论回复（discussion_review）和后台任务结束（job）事件，
+// @Description 事件名为事件类型，数据为 utils.PushEvent 的 JSON；每30秒发送一次 ping 事件作为心跳，
+// @Description 心跳时会话已经注销、过期或用户被封禁则关闭连接
+// @Tags Push
+// @Produce text/event-stream
+// @Success 200 {object} utils.PushEvent "事件流"
+// @Failure 401 {string} string "未登录"
+// @Failure default {string} string "服务器错误"
+// @Router /push/stream [get]
+// @Security ApiKeyAuth
+func PushStream(c *gin.Context) {
+	groupIds, err := getUserGroupIds(c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	subscriber := utils.SubscribePush(c.GetInt("UserId"), groupIds)
+	defer utils.UnsubscribePush(subscriber)
+	c.Header("Cache-Control", "no-cache")
+	c.Header("Connection", "keep-alive")
+	// 禁止 nginx 缓冲事件流
+	c.Header("X-Accel-Buffering", "no")
+	c.SSEvent("ping", time.Now().Local())
+	c.Writer.Flush()
+	sessionId := c.GetString("SessionId")
+	ticker := time.NewTicker(PushHeartbeatInterval)
+	defer ticker.Stop()
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case event, ok := <-subscriber.Events:
+			if !ok {
+				return false
+			}
+			c.SSEvent(event.Type, event)
+			return true
+		case <-ticker.C:
+			if !refreshPushSubscriber(c, subscriber, sessionId) {
+				return false
+			}
+			c.SSEvent("ping", time.Now().Local())
+			return true
+		}
+	})
+}
+
+// PushWebSocket godoc
+// @Schemes http
+// @Description 以 WebSocket 的形式推送与 /push/stream 相同的事件，每条消息为 utils.PushEvent 的 JSON，心跳消息的类型为 ping；
+// @Description 客户端发送的消息会被忽略；心跳时会话已经注销、过期或用户被封禁则关闭连接
+// @Tags Push
+// @Success 101 {object} utils.PushEvent "事件流"
+// @Failure 401 {string} string "未登录"
+// @Failure default {string} string "服务器错误"
+// @Router /push/ws [get]
+// @Security ApiKeyAuth
+func PushWebSocket(c *gin.Context) {
+	groupIds, err := getUserGroupIds(c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	userId := c.GetInt("UserId")
+	sessionId := c.GetString("SessionId")
+	// 小程序的 WebSocket 请求不带 Origin，因此不使用默认的 Origin 检查
+	server := websocket.Server{Handler: func(conn *websocket.Conn) {
+		subscriber := utils.SubscribePush(userId, groupIds)
+		defer utils.UnsubscribePush(subscriber)
+		closed := make(chan struct{})
+		go func() {
+			var message string
+			for websocket.Message.Receive(conn, &message) == nil {
+			}
+			close(closed)
+		}()
+		ctx := context.Background()
+		ticker := time.NewTicker(PushHeartbeatInterval)
+		defer ticker.Stop()
+		for {
+			var event utils.PushEvent
+			select {
+			case <-closed:
+				return
+			case e, ok := <-subscriber.Events:
+				if !ok {
+					return
+				}
+				event = e
+			case <-ticker.C:
+				if !refreshPushSubscriber(ctx, subscriber, sessionId) {
+					return
+				}
+				data, _ := json.Marshal(time.Now().Local())
+				event = utils.PushEvent{Type: "ping", Data: data, CreatedAt: time.Now().Local()}
+			}
+			if err := websocket.JSON.Send(conn, &event); err != nil {
+				return
+			}
+		}
+	}}
+	server.ServeHTTP(c.Writer, c.Request)
+}
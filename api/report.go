@@ -0,0 +1,494 @@
+package api
+
+import (
+	"database/sql"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/lib/pq"
+	"github.com/spf13/viper"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"net/http"
+	"time"
+)
+
+const (
+	ReportTargetNote             = "note"
+	ReportTargetNoteReview       = "note_review"
+	ReportTargetDiscussion       = "discussion"
+	ReportTargetDiscussionReview = "discussion_review"
+	ReportTargetProblem          = "problem"
+	ReportTargetProblemSet       = "problem_set"
+)
+
+const (
+	ReportReasonSpam        = "spam"
+	ReportReasonAbuse       = "abuse"
+	ReportReasonPornography = "pornography"
+	ReportReasonIllegal     = "illegal"
+	ReportReasonCopyright   = "copyright"
+	ReportReasonOther       = "other"
+	// ReportReasonSensitiveWord 内容命中需要审核的敏感词，由系统自动举报
+	ReportReasonSensitiveWord = "sensitive_word"
+)
+
+const (
+	ReportPending   = "pending"
+	ReportResolved  = "resolved"
+	ReportDismissed = "dismissed"
+)
+
+const (
+	// ReportActionDismiss 驳回举报，自动隐藏的内容会恢复显示
+	ReportActionDismiss = "dismiss"
+	ReportActionHide    = "hide"
+	ReportActionDelete  = "delete"
+	// ReportActionWarn 给作者发送警告通知
+	ReportActionWarn = "warn"
+	// ReportActionBan 隐藏内容并封禁作者，BanDays 为0时永久封禁
+	ReportActionBan = "ban"
+)
+
+// 未配置 ReportHideThreshold 时，内容被这么多用户举报后自动隐藏
+const defaultReportHideThreshold = 5
+
+// 举报对象对应的数据表，所有表都有 user_id 和 is_hidden 列
+var reportTargetTables = map[string]string{
+	ReportTargetNote:             "note",
+	ReportTargetNoteReview:       "note_review",
+	ReportTargetDiscussion:       "discussion",
+	ReportTargetDiscussionReview: "discussion_review",
+	ReportTargetProblem:          "problem_type",
+	ReportTargetProblemSet:       "problem_set",
+}
+
+var reportReasons = []string{
+	ReportReasonSpam,
+	ReportReasonAbuse,
+	ReportReasonPornography,
+	ReportReasonIllegal,
+	ReportReasonCopyright,
+	ReportReasonOther,
+}
+
+type ReportCreateRequest struct {
+	TargetType  string `json:"target_type" binding:"required"`
+	TargetId    int    `json:"target_id" binding:"required"`
+	Reason      string `json:"reason" binding:"required"`
+	Description string `json:"description"`
+}
+
+type ReportFilter struct {
+	Status     *string `json:"status" form:"status"`
+	TargetType *string `json:"target_type" form:"target_type"`
+	Offset     *int    `json:"offset" form:"offset"`
+	Limit      *int    `json:"limit" form:"limit"`
+}
+
+type ReportHandleRequest struct {
+	Action  string `json:"action" binding:"required"`
+	Message string `json:"message"`
+	BanDays int    `json:"ban_days"`
+}
+
+type ReportResponse struct {
+	ID             int              `json:"id"`
+	TargetType     string           `json:"target_type"`
+	TargetId       int              `json:"target_id"`
+	TargetUserInfo UserInfoResponse `json:"target_user_info"`
+	ReporterInfo   UserInfoResponse `json:"reporter_info"`
+	Reason         string           `json:"reason"`
+	Description    string           `json:"description"`
+	Status         string           `json:"status"`
+	Action         *string          `json:"action"`
+	HandledAt      *time.Time       `json:"handled_at"`
+	CreatedAt      time.Time        `json:"created_at"`
+	ReportCount    int              `json:"report_count"`
+	IsHidden       bool             `json:"is_hidden"`
+}
+
+type AllReportResponse struct {
+	TotalCount int              `json:"total_count"`
+	Reports    []ReportResponse `json:"reports"`
+}
+
+type HandleReportResponse struct {
+	Handled int `json:"handled"`
+}
+
+func isReportReason(reason string) bool {
+	for _, r := range reportReasons {
+		if r == reason {
+			return true
+		}
+	}
+	return false
+}
+
+func getReportHideThreshold() int {
+	if threshold := viper.GetInt("ReportHideThreshold"); threshold > 0 {
+		return threshold
+	}
+	return defaultReportHideThreshold
+}
+
+// hiddenCondition 返回过滤被隐藏内容的 SQL 条件，被隐藏的内容只有作者和管理员可以看到，prefix 是表名或别名加上点
+func hiddenCondition(c *gin.Context, prefix string) string {
+	if role, _ := c.Get("Role"); role == global.ADMIN {
+		return ""
+	}
+	return fmt.Sprintf(" AND (%sis_hidden = false OR %suser_id = %d)", prefix, prefix, c.GetInt("UserId"))
+}
+
+// isHiddenFrom 判断内容是否对当前用户隐藏，规则和 hiddenCondition 相同
+func isHiddenFrom(c *gin.Context, isHidden bool, ownerId int) bool {
+	role, _ := c.Get("Role")
+	return isHidden && role != global.ADMIN && ownerId != c.GetInt("UserId")
+}
+
+// getActiveBan 返回用户当前生效的封禁记录，没有被封禁时返回 nil
+func getActiveBan(userId int) (*model.UserBan, error) {
+	var ban model.UserBan
+	sqlString := `SELECT * FROM user_ban WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY expires_at DESC NULLS FIRST LIMIT 1`
+	if err := global.Database.Get(&ban, sqlString, userId, time.Now().Local()); err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &ban, nil
+}
+
+// CreateReport godoc
+// @Schemes http
+// @Description 举报笔记、笔记评论、讨论、讨论评论、题目或题集，被举报的用户数达到阈值后内容会被自动隐藏，等待管理员处理
+// @Tags Report
+// @Param report body ReportCreateRequest true "举报信息, target_type: note/note_review/discussion/discussion_review/problem/problem_set, reason: spam/abuse/pornography/illegal/copyright/other"
+// @Success 200 {string} string "举报成功"
+// @Failure 400 {string} string "请求解析失败"/"不能举报自己的内容"
+// @Failure 404 {string} string "举报的内容不存在"
+// @Failure 409 {string} string "已经举报过该内容"
+// @Failure default {string} string "服务器错误"
+// @Router /report/create [post]
+// @Security ApiKeyAuth
+func CreateReport(c *gin.Context) {
+	var request ReportCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil || !isReportReason(request.Reason) {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	table, ok := reportTargetTables[request.TargetType]
+	if !ok {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var target struct {
+		UserId   int  `db:"user_id"`
+		IsHidden bool `db:"is_hidden"`
+	}
+	sqlString := `SELECT user_id, is_hidden FROM ` + table + ` WHERE id = $1`
+	if err := global.Database.Get(&target, sqlString, request.TargetId); err != nil {
+		c.String(http.StatusNotFound, "举报的内容不存在")
+		return
+	}
+	if target.UserId == c.GetInt("UserId") {
+		c.String(http.StatusBadRequest, "不能举报自己的内容")
+		return
+	}
+	var reportId int
+	sqlString = `INSERT INTO content_report (user_id, target_type, target_id, target_user_id, reason, description, status,
+		created_at) VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`
+	if err := global.Database.Get(&reportId, sqlString, c.GetInt("UserId"), request.TargetType, request.TargetId,
+		target.UserId, request.Reason, request.Description, ReportPending, time.Now().Local()); err != nil {
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			c.String(http.StatusConflict, "已经举报过该内容")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if !target.IsHidden {
+		var count int
+		sqlString = `SELECT count(*) FROM content_report WHERE target_type = $1 AND target_id = $2 AND status = $3`
+		if err := global.Database.Get(&count, sqlString, request.TargetType, request.TargetId, ReportPending); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if count >= getReportHideThreshold() {
+			// 记录是哪条举报隐藏了内容，驳回时只恢复自动隐藏的内容
+			tx := global.Database.MustBegin()
+			sqlString = `UPDATE ` + table + ` SET is_hidden = true WHERE id = $1 AND is_hidden = false`
+			res, err := tx.Exec(sqlString, request.TargetId)
+			var hidden int64
+			if err == nil {
+				hidden, err = res.RowsAffected()
+			}
+			if err == nil && hidden > 0 {
+				_, err = tx.Exec(`UPDATE content_report SET auto_hidden = true WHERE id = $1`, reportId)
+			}
+			if err != nil {
+				_ = tx.Rollback()
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
+			if err := tx.Commit(); err != nil {
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
+		}
+	}
+	c.String(http.StatusOK, "举报成功")
+}
+
+// GetReports godoc
+// @Schemes http
+// @Description 管理员查看举报队列，默认只返回待处理的举报，按举报时间排序
+// @Tags Report
+// @Param filter query ReportFilter false "筛选条件, status: pending/resolved/dismissed"
+// @Success 200 {object} AllReportResponse "举报列表"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/report/all [get]
+// @Security ApiKeyAuth
+func GetReports(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var filter ReportFilter
+	if err := c.ShouldBindQuery(&filter); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	status := ReportPending
+	if filter.Status != nil {
+		status = *filter.Status
+	}
+	targetType := ""
+	if filter.TargetType != nil {
+		if _, ok := reportTargetTables[*filter.TargetType]; !ok {
+			c.String(http.StatusBadRequest, "请求解析失败")
+			return
+		}
+		targetType = *filter.TargetType
+	}
+	var totalCount int
+	sqlString := `SELECT count(*) FROM content_report WHERE status = $1 AND ($2 = '' OR target_type = $2)`
+	if err := global.Database.Get(&totalCount, sqlString, status, targetType); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `SELECT * FROM content_report WHERE status = $1 AND ($2 = '' OR target_type = $2) ORDER BY created_at, id`
+	if filter.Limit != nil {
+		sqlString += fmt.Sprint(" LIMIT ", *filter.Limit)
+	}
+	if filter.Offset != nil {
+		sqlString += fmt.Sprint(" OFFSET ", *filter.Offset)
+	}
+	var reports []model.ContentReport
+	if err := global.Database.Select(&reports, sqlString, status, targetType); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	responses := make([]ReportResponse, 0, len(reports))
+	for _, report := range reports {
+		// 敏感词触发的系统举报没有举报人
+		var reporterInfo UserInfoResponse
+		if report.UserId != nil {
+			var err error
+			if reporterInfo, err = getBriefUserInfo(*report.UserId); err != nil {
+				c.String(http.StatusInternalServerError, "服务器错误")
+				return
+			}
+		}
+		targetUserInfo, err := getBriefUserInfo(report.TargetUserId)
+		if err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		var reportCount int
+		sqlString = `SELECT count(*) FROM content_report WHERE target_type = $1 AND target_id = $2 AND status = $3`
+		if err := global.Database.Get(&reportCount, sqlString, report.TargetType, report.TargetId, ReportPending); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		// 内容已经被删除时 is_hidden 为 false
+		var isHidden bool
+		sqlString = `SELECT is_hidden FROM ` + reportTargetTables[report.TargetType] + ` WHERE id = $1`
+		if err := global.Database.Get(&isHidden, sqlString, report.TargetId); err != nil && err != sql.ErrNoRows {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		responses = append(responses, ReportResponse{
+			ID:             report.ID,
+			TargetType:     report.TargetType,
+			TargetId:       report.TargetId,
+			TargetUserInfo: targetUserInfo,
+			ReporterInfo:   reporterInfo,
+			Reason:         report.Reason,
+			Description:    report.Description,
+			Status:         report.Status,
+			Action:         report.Action,
+			HandledAt:      report.HandledAt,
+			CreatedAt:      report.CreatedAt,
+			ReportCount:    reportCount,
+			IsHidden:       isHidden,
+		})
+	}
+	c.JSON(http.StatusOK, AllReportResponse{
+		TotalCount: totalCount,
+		Reports:    responses,
+	})
+}
+
+// HandleReport godoc
+// @Schemes http
+// @Description 管理员处理举报，同一内容所有待处理的举报会一起处理。action: dismiss 驳回并恢复因举报或敏感词自动隐藏的内容, hide 隐藏内容,
+// @Description delete 删除内容, warn 警告作者, ban 隐藏内容并封禁作者 ban_days 天（0为永久）。message 会通知给作者
+// @Tags Report
+// @Param id path int true "举报ID"
+// @Param handle body ReportHandleRequest true "处理方式"
+// @Success 200 {object} HandleReportResponse "处理的举报数"
+// @Failure 400 {string} string "请求解析失败"/"举报已处理"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "举报不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/report/handle/{id} [put]
+// @Security ApiKeyAuth
+func HandleReport(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var request ReportHandleRequest
+	if err := c.ShouldBindJSON(&request); err != nil || request.BanDays < 0 {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var report model.ContentReport
+	sqlString := `SELECT * FROM content_report WHERE id = $1`
+	if err := global.Database.Get(&report, sqlString, c.Param("id")); err != nil {
+		c.String(http.StatusNotFound, "举报不存在")
+		return
+	}
+	table := reportTargetTables[report.TargetType]
+	// 处理前内容的快照，内容已被删除时为空
+	var snapshot *string
+	sqlString = `SELECT row_to_json(t)::text FROM ` + table + ` t WHERE t.id = $1`
+	if err := global.Database.Get(&snapshot, sqlString, report.TargetId); err != nil && err != sql.ErrNoRows {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	status := ReportResolved
+	message := request.Message
+	tx := global.Database.MustBegin()
+	// 锁住同一内容所有待处理的举报，并发处理时后处理的一方看到举报已经处理
+	var pending []model.ContentReport
+	sqlString = `SELECT * FROM content_report WHERE target_type = $1 AND target_id = $2 AND status = $3 FOR UPDATE`
+	if err := tx.Select(&pending, sqlString, report.TargetType, report.TargetId, ReportPending); err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	isPending, autoHidden := false, false
+	for _, r := range pending {
+		isPending = isPending || r.ID == report.ID
+		autoHidden = autoHidden || r.AutoHidden
+	}
+	if !isPending {
+		_ = tx.Rollback()
+		c.String(http.StatusBadRequest, "举报已处理")
+		return
+	}
+	var err error
+	switch request.Action {
+	case ReportActionDismiss:
+		status = ReportDismissed
+		if autoHidden {
+			_, err = tx.Exec(`UPDATE `+table+` SET is_hidden = false WHERE id = $1`, report.TargetId)
+		}
+	case ReportActionHide:
+		_, err = tx.Exec(`UPDATE `+table+` SET is_hidden = true WHERE id = $1`, report.TargetId)
+		if message == "" {
+			message = "你发布的内容因被举报已被隐藏"
+		}
+	case ReportActionDelete:
+		_, err = tx.Exec(`DELETE FROM `+table+` WHERE id = $1`, report.TargetId)
+		if message == "" {
+			message = "你发布的内容因被举报已被删除"
+		}
+	case ReportActionWarn:
+		if message == "" {
+			message = "你发布的内容被举报，请遵守社区规范"
+		}
+	case ReportActionBan:
+		_, err = tx.Exec(`UPDATE `+table+` SET is_hidden = true WHERE id = $1`, report.TargetId)
+		if err == nil {
+			var expiresAt *time.Time
+			if request.BanDays > 0 {
+				expires := time.Now().Local().AddDate(0, 0, request.BanDays)
+				expiresAt = &expires
+			}
+			reason := request.Message
+			if reason == "" {
+				reason = "发布的内容被举报: " + report.Reason
+			}
+			_, err = tx.Exec(`INSERT INTO user_ban (user_id, reason, expires_at, created_by, created_at) VALUES ($1, $2, $3, $4, $5)`,
+				report.TargetUserId, reason, expiresAt, c.GetInt("UserId"), time.Now().Local())
+		}
+		if message == "" {
+			message = "你发布的内容被举报，账号已被封禁"
+		}
+	default:
+		_ = tx.Rollback()
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	if err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	sqlString = `UPDATE content_report SET status = $1, action = $2, handled_by = $3, handled_at = $4
+		WHERE target_type = $5 AND target_id = $6 AND status = $7`
+	res, err := tx.Exec(sqlString, status, request.Action, c.GetInt("UserId"), time.Now().Local(),
+		report.TargetType, report.TargetId, ReportPending)
+	if err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	handled, err := res.RowsAffected()
+	if err != nil {
+		_ = tx.Rollback()
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if request.Action == ReportActionBan {
+		if err := global.InvalidateUserBan(c, report.TargetUserId); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+		if err := global.DeleteUserSessions(c, report.TargetUserId); err != nil {
+			c.String(http.StatusInternalServerError, "服务器错误")
+			return
+		}
+	}
+	recordAudit(c, auditEvent{
+		Action:     AuditActionReportHandle,
+		TargetType: report.TargetType,
+		TargetId:   report.TargetId,
+		OwnerId:    report.TargetUserId,
+		Before:     rawSnapshot(snapshot),
+		After:      map[string]interface{}{"action": request.Action, "status": status, "handled": handled},
+	})
+	if request.Action != ReportActionDismiss {
+		CreateNotification(c, report.TargetUserId, NotificationModeration, 0, report.TargetId, message)
+	}
+	c.JSON(http.StatusOK, HandleReportResponse{Handled: int(handled)})
+}
@@ -0,0 +1,189 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"html"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	// 评论树默认和最多展开的层数，超过的部分通过回复列表接口继续获取
+	defaultReviewDepth = 3
+	maxReviewDepth     = 5
+	// 每条评论下默认和最多展开的回复数
+	defaultReplyLimit = 5
+	maxReplyLimit     = 50
+	// 提及链接的格式，参数为用户ID
+	mentionLinkFormat = "kayak://user/%d"
+)
+
+var mentionPattern = regexp.MustCompile(`@([\p{L}\p{N}_\-]+)`)
+
+type ReviewThreadQuery struct {
+	Offset     int `form:"offset"`
+	Limit      int `form:"limit"`
+	Depth      int `form:"depth"`
+	ReplyLimit int `form:"reply_limit"`
+}
+
+type MentionResponse struct {
+	UserId   int    `json:"user_id"`
+	UserName string `json:"user_name"`
+	NickName string `json:"nick_name"`
+}
+
+// bindReviewThreadQuery 解析评论树的分页参数，limit 为0表示不限制第一层的数量
+func bindReviewThreadQuery(c *gin.Context) (ReviewThreadQuery, bool) {
+	var query ReviewThreadQuery
+	if err := c.ShouldBindQuery(&query); err != nil || query.Offset < 0 || query.Limit < 0 ||
+		query.Depth < 0 || query.Depth > maxReviewDepth || query.ReplyLimit < 0 || query.ReplyLimit > maxReplyLimit {
+		return query, false
+	}
+	if query.Depth == 0 {
+		query.Depth = defaultReviewDepth
+	}
+	if query.ReplyLimit == 0 {
+		query.ReplyLimit = defaultReplyLimit
+	}
+	return query, true
+}
+
+func paginate(sqlString string, offset int, limit int) string {
+	if limit > 0 {
+		sqlString += fmt.Sprint(" LIMIT ", limit)
+	}
+	if offset > 0 {
+		sqlString += fmt.Sprint(" OFFSET ", offset)
+	}
+	return sqlString
+}
+
+// parseMentionNames 按出现顺序返回内容中 @ 到的用户名，重复的只保留一次
+func parseMentionNames(content string) []string {
+	names := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, match := range mentionPattern.FindAllStringSubmatch(content, -1) {
+		if !seen[match[1]] {
+			seen[match[1]] = true
+			names = append(names, match[1])
+		}
+	}
+	return names
+}
+
+// saveReviewMentions 解析评论内容中的提及并覆盖保存到 table 中，不存在的用户名会被忽略，
+// 返回本次新增的被提及用户，编辑前已经提及过的用户不会重复返回。需要和评论的修改在同一个事务中调用
+func saveReviewMentions(tx *sqlx.Tx, table string, column string, reviewId int, content string) ([]int, error) {
+	userIds := make([]int, 0)
+	if names := parseMentionNames(content); len(names) > 0 {
+		sqlString := `SELECT id FROM "user" WHERE name = ANY($1)`
+		if err := tx.Select(&userIds, sqlString, pq.Array(names)); err != nil {
+			return nil, err
+		}
+	}
+	sqlString := `DELETE FROM ` + table + ` WHERE ` + column + ` = $1 AND NOT (user_id = ANY($2))`
+	if _, err := tx.Exec(sqlString, reviewId, pq.Array(userIds)); err != nil {
+		return nil, err
+	}
+	added := make([]int, 0)
+	for _, userId := range userIds {
+		var affected int64
+		sqlString = `INSERT INTO ` + table + ` (` + column + `, user_id, created_at) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+		res, err := tx.Exec(sqlString, reviewId, userId, time.Now().Local())
+		if err == nil {
+			affected, err = res.RowsAffected()
+		}
+		if err != nil {
+			return nil, err
+		}
+		if affected > 0 {
+			added = append(added, userId)
+		}
+	}
+	return added, nil
+}
+
+// mentionReaders 返回 userIds 中能查看被评论内容的用户，站点管理员总是可以查看，
+// 其他用户需要满足 condition，condition 中的参数从 $3 开始
+func mentionReaders(userIds []int, condition string, args ...interface{}) ([]int, error) {
+	readers := make([]int, 0)
+	if len(userIds) == 0 {
+		return readers, nil
+	}
+	sqlString := `SELECT id FROM "user" WHERE id = ANY($1) AND (role = $2 OR ` + condition + `)`
+	args = append([]interface{}{pq.Array(userIds), int(global.ADMIN)}, args...)
+	if err := global.Database.Select(&readers, sqlString, args...); err != nil {
+		return nil, err
+	}
+	return readers, nil
+}
+
+// discussionMentionReaders 返回能查看讨论的被提及用户：小组成员可以查看公开的讨论，非公开的讨论只有作者能查看
+func discussionMentionReaders(userIds []int, discussion *model.Discussion) ([]int, error) {
+	return mentionReaders(userIds, `(EXISTS (SELECT 1 FROM group_member WHERE group_id = $3 AND user_id = "user".id)
+		AND ($4 OR id = $5))`, discussion.GroupId, discussion.IsPublic, discussion.UserId)
+}
+
+// noteMentionReaders 返回能查看笔记的被提及用户：公开的笔记所有人都能查看，非公开的笔记只有作者能查看
+func noteMentionReaders(userIds []int, note *model.Note) ([]int, error) {
+	return mentionReaders(userIds, `($3 OR id = $4)`, note.IsPublic, note.UserId)
+}
+
+func getReviewMentions(table string, column string, reviewId int) ([]MentionResponse, error) {
+	var users []model.User
+	sqlString := `SELECT u.id, u.name, u.nick_name FROM ` + table + ` m JOIN "user" u ON u.id = m.user_id
+		WHERE m.` + column + ` = $1`
+	if err := global.Database.Select(&users, sqlString, reviewId); err != nil {
+		return nil, err
+	}
+	mentions := make([]MentionResponse, 0, len(users))
+	for _, user := range users {
+		mentions = append(mentions, MentionResponse{
+			UserId:   user.ID,
+			UserName: user.Name,
+			NickName: user.NickName,
+		})
+	}
+	return mentions, nil
+}
+
+// renderMentions 转义评论内容并把已保存的提及替换为指向用户的链接
+func renderMentions(content string, mentions []MentionResponse) string {
+	userIds := make(map[string]int)
+	for _, mention := range mentions {
+		userIds[mention.UserName] = mention.UserId
+	}
+	var builder strings.Builder
+	last := 0
+	for _, match := range mentionPattern.FindAllStringSubmatchIndex(content, -1) {
+		name := content[match[2]:match[3]]
+		userId, ok := userIds[name]
+		if !ok {
+			continue
+		}
+		builder.WriteString(html.EscapeString(content[last:match[0]]))
+		builder.WriteString(fmt.Sprintf(`<a class="mention" href="`+mentionLinkFormat+`">@%s</a>`, userId, html.EscapeString(name)))
+		last = match[1]
+	}
+	builder.WriteString(html.EscapeString(content[last:]))
+	return builder.String()
+}
+
+// notifyMentions 通知新被提及的用户，notified 中已经收到过本次评论其他通知的用户会被跳过
+func notifyMentions(ctx context.Context, userIds []int, notified map[int]bool, notificationType string, actorId int,
+	targetId int, content string) {
+	for _, userId := range userIds {
+		if !notified[userId] {
+			notified[userId] = true
+			CreateNotification(ctx, userId, notificationType, actorId, targetId, content)
+		}
+	}
+}
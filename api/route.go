@@ -6,12 +6,15 @@ func InitRoute() {
 	global.Router.GET("/ping", Ping)
 	global.Router.GET("/logout", Logout)
 	global.Router.POST("/login", Login)
+	global.Router.GET("/captcha", GetCaptcha)
+	global.Router.POST("/refresh", RefreshToken)
+	global.Router.POST("/oauth/login/:provider", OAuthLogin)
 	global.Router.POST("/register", Register)
 	global.Router.POST("/change-password", ChangePassword)
 	global.Router.POST("/reset-password", ResetPassword)
 	global.Router.POST("/send-email", SendEmail)
 	global.Router.POST("/weixin-login", WeixinLogin)
-	global.Router.POST("/weixin-bind", WeixinBind)
+	global.Router.POST("/weixin-bind", global.CheckAuth, WeixinBind)
 	global.Router.POST("/weixin-complete", WeixinComplete)
 
 	special := global.Router.Group("/special")
@@ -23,6 +26,36 @@ func InitRoute() {
 	special.GET("/featured_group", GetFeaturedGroup)
 	special.POST("/picture_ocr", PictureOCR)
 	special.POST("/pdf_ocr", PDFFileOCR)
+	special.GET("/ocr_quota", GetOCRQuota)
+	special.POST("/pdf_ocr_job", CreatePDFOCRJob)
+	special.POST("/ocr_problem/draft", OCRProblemDraft)
+	special.POST("/ocr_problem/commit", OCRProblemCommit)
+
+	jobs := global.Router.Group("/jobs")
+	jobs.Use(global.CheckAuth)
+	jobs.GET("/dead", GetDeadJobs)
+	jobs.POST("/dead/:id/retry", RetryDeadJob)
+	jobs.GET("/:id", GetJob)
+	jobs.GET("/:id/result", GetJobResult)
+
+	mail := global.Router.Group("/mail")
+	mail.Use(global.CheckAuth)
+	mail.GET("/outbox", GetMailOutbox)
+	mail.POST("/outbox/retry/:id", RetryMail)
+
+	notification := global.Router.Group("/notification")
+	notification.Use(global.CheckAuth)
+	notification.GET("/all", GetNotifications)
+	notification.GET("/unread_count", GetUnreadNotificationCount)
+	notification.PUT("/read/:id", ReadNotification)
+	notification.PUT("/read_all", ReadAllNotifications)
+	notification.GET("/mute", GetNotificationMute)
+	notification.PUT("/mute", UpdateNotificationMute)
+
+	push := global.Router.Group("/push")
+	push.Use(global.CheckAuth)
+	push.GET("/stream", PushStream)
+	push.GET("/ws", PushWebSocket)
 
 	user := global.Router.Group("/user")
 	user.Use(global.CheckAuth)
@@ -30,12 +63,21 @@ func InitRoute() {
 	user.GET("/info/:user_id", GetUserInfoById)
 	user.PUT("/update", UpdateUserInfo)
 	user.GET("/wrong_record", GetUserWrongRecords)
+	user.GET("/login_history", GetUserLoginHistory)
+	user.GET("/sessions", GetUserSessions)
+	user.DELETE("/sessions/revoke/:id", RevokeUserSession)
+	user.DELETE("/sessions/revoke_others", RevokeOtherUserSessions)
+	user.GET("/identity/all", GetUserIdentities)
+	user.POST("/identity/bind/:provider", BindIdentity)
+	user.DELETE("/identity/unbind/:provider", UnbindIdentity)
 
 	upload := global.Router.Group("/upload")
 	upload.Use(global.CheckAuth)
 	upload.POST("/public", UploadPublicFile)
 	upload.POST("/avatar", UploadUserAvatar)
 	upload.POST("/group_avatar", UploadGroupAvatar)
+	upload.POST("/problem_image", UploadProblemImage)
+	upload.DELETE("/problem_image/:id", DeleteProblemImage)
 
 	note := global.Router.Group("/note")
 	note.Use(global.CheckAuth)
@@ -62,6 +104,7 @@ func InitRoute() {
 	problem.DELETE("/unfavorite/:id", RemoveProblemFromFavorite)
 	problem.POST("/favorite/:id", AddProblemToFavorite)
 	problem.POST("/batch", AddBatchProblem)
+	problem.POST("/submit/:id", SubmitProblemAnswer)
 
 	choiceProblem := problem.Group("/choice")
 	global.Router.GET("/problem/choice/all", GetChoiceProblems)
@@ -104,6 +147,8 @@ func InitRoute() {
 	noteReview.POST("/add", AddNoteReview)
 	noteReview.DELETE("/remove/:id", RemoveNoteReview)
 	noteReview.GET("/get", GetNoteReviews)
+	noteReview.GET("/replies/:id", GetNoteReviewReplies)
+	noteReview.PUT("/update/:id", UpdateNoteReview)
 	noteReview.POST("/like/:id", LikeNoteReview)
 	noteReview.POST("/unlike/:id", UnlikeNoteReview)
 
@@ -121,6 +166,47 @@ func InitRoute() {
 	group.POST("/apply", ApplyToJoinGroup)
 	group.GET("/application/:id", GetGroupApplication)
 	group.PUT("/application", HandleGroupApplication)
+	group.PUT("/application/batch", BatchHandleGroupApplication)
+	group.PUT("/admin/:id", SetGroupAdmin)
+	group.PUT("/transfer/:id", TransferGroup)
+	group.POST("/join", JoinGroup)
+	group.GET("/stats/:id", GetGroupStats)
+
+	groupInvitation := global.Router.Group("/group_invitation")
+	groupInvitation.Use(global.CheckAuth)
+	groupInvitation.POST("/create", CreateGroupInvitation)
+	groupInvitation.GET("/all", GetGroupInvitations)
+	groupInvitation.PUT("/regenerate/:id", RegenerateGroupInvitation)
+	groupInvitation.DELETE("/revoke/:id", RevokeGroupInvitation)
+	groupInvitation.GET("/qrcode/:id", GetGroupInvitationQRCode)
+
+	groupQuiz := global.Router.Group("/group_quiz")
+	groupQuiz.Use(global.CheckAuth)
+	groupQuiz.POST("/create", CreateGroupQuiz)
+	groupQuiz.POST("/start/:id", StartGroupQuiz)
+	groupQuiz.GET("/ws/:id", GroupQuizWebSocket)
+	groupQuiz.GET("/all", GetGroupQuizzes)
+	groupQuiz.GET("/get/:id", GetGroupQuiz)
+
+	groupAssignment := global.Router.Group("/group_assignment")
+	groupAssignment.Use(global.CheckAuth)
+	groupAssignment.POST("/create", CreateGroupAssignment)
+	groupAssignment.PUT("/update", UpdateGroupAssignment)
+	groupAssignment.DELETE("/delete/:id", DeleteGroupAssignment)
+	groupAssignment.GET("/all", GetGroupAssignments)
+	groupAssignment.GET("/pending", GetPendingGroupAssignments)
+	groupAssignment.POST("/submit/:id", SubmitGroupAssignment)
+	groupAssignment.GET("/submissions/:id", GetGroupAssignmentSubmissions)
+	groupAssignment.GET("/matrix/:id", GetGroupAssignmentMatrix)
+	groupAssignment.GET("/export/:id", ExportGroupAssignmentMatrix)
+
+	leaderboard := global.Router.Group("/leaderboard")
+	leaderboard.Use(global.CheckAuth)
+	leaderboard.GET("/group/:id", GetGroupLeaderboard)
+	leaderboard.GET("/area/:id", GetAreaLeaderboard)
+	leaderboard.GET("/privacy", GetLeaderboardPrivacy)
+	leaderboard.PUT("/privacy", UpdateLeaderboardPrivacy)
+	leaderboard.POST("/rebuild", RebuildLeaderboard)
 
 	discussion := global.Router.Group("/discussion")
 	discussion.Use(global.CheckAuth)
@@ -132,15 +218,40 @@ func InitRoute() {
 	discussion.POST("/unlike/:id", UnlikeDiscussion)
 	discussion.POST("/favorite/:id", FavoriteDiscussion)
 	discussion.POST("/unfavorite/:id", UnfavoriteDiscussion)
+	discussion.PUT("/pin/:id", PinDiscussion)
+	discussion.PUT("/lock/:id", LockDiscussion)
 
 	discussionReview := global.Router.Group("/discussion_review")
 	discussionReview.Use(global.CheckAuth)
 	discussionReview.POST("/add", AddDiscussionReview)
 	discussionReview.DELETE("/remove/:id", RemoveDiscussionReview)
 	discussionReview.GET("/get", GetDiscussionReviews)
+	discussionReview.GET("/replies/:id", GetDiscussionReviewReplies)
+	discussionReview.PUT("/update/:id", UpdateDiscussionReview)
+	discussionReview.PUT("/accept/:id", AcceptDiscussionReview)
 	discussionReview.POST("/like/:id", LikeDiscussionReview)
 	discussionReview.POST("/unlike/:id", UnlikeDiscussionReview)
 
+	report := global.Router.Group("/report")
+	report.Use(global.CheckAuth)
+	report.POST("/create", CreateReport)
+
+	admin := global.Router.Group("/admin")
+	admin.Use(global.CheckAuth)
+	admin.GET("/report/all", GetReports)
+	admin.PUT("/report/handle/:id", HandleReport)
+	admin.GET("/sensitive_word/all", GetSensitiveWords)
+	admin.POST("/sensitive_word/add", AddSensitiveWord)
+	admin.DELETE("/sensitive_word/remove/:id", RemoveSensitiveWord)
+	admin.POST("/sensitive_word/reload", ReloadSensitiveWords)
+	admin.GET("/user/search", SearchUsers)
+	admin.GET("/user/content/:id", GetUserContent)
+	admin.PUT("/user/role/:id", SetUserRole)
+	admin.POST("/user/ban/:id", BanUser)
+	admin.DELETE("/user/ban/:id", UnbanUser)
+	admin.POST("/user/logout/:id", ForceLogout)
+	admin.GET("/audit_log/all", GetAuditLogs)
+
 	search := global.Router.Group("/search")
 	search.Use(global.CheckAuth)
 	search.POST("/problem_set", SearchProblemSets)
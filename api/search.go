@@ -48,6 +48,7 @@ func SearchProblemSets(c *gin.Context) {
 	} else {
 		sqlString += ` WHERE 1 = 1`
 	}
+	sqlString += hiddenCondition(c, "problem_set.")
 	sqlString += fmt.Sprintf(`AND (query @@ document OR similarity > 0) ORDER BY rank_name, rank_description, similarity DESC NULLS LAST LIMIT $2 OFFSET $3`)
 	var problemSets []model.ProblemSet
 	if err := global.Database.Select(&problemSets, sqlString, request.Keyword, request.Limit, request.Offset); err != nil {
@@ -166,15 +167,17 @@ func SearchGroups(c *gin.Context) {
 			return
 		}
 		groupResponses = append(groupResponses, GroupResponse{
-			Id:          group.Id,
-			Name:        group.Name,
-			Description: group.Description,
-			UserId:      group.UserId,
-			UserInfo:    userInfo,
-			MemberCount: count,
-			CreatedAt:   group.CreatedAt,
-			AreaName:    area,
-			AvatarURL:   group.AvatarURL,
+			Id:             group.Id,
+			Name:           group.Name,
+			Description:    group.Description,
+			UserId:         group.UserId,
+			UserInfo:       userInfo,
+			MemberCount:    count,
+			CreatedAt:      group.CreatedAt,
+			AreaName:       area,
+			AvatarURL:      group.AvatarURL,
+			JoinPolicy:     group.JoinPolicy,
+			EntryQuestions: parseEntryQuestions(group.EntryQuestions),
 		})
 	}
 	c.JSON(http.StatusOK, AllGroupResponse{
@@ -217,6 +220,7 @@ func SearchNotes(c *gin.Context) {
 	} else {
 		sqlString += ` WHERE 1 = 1`
 	}
+	sqlString += hiddenCondition(c, "note.")
 	sqlString += fmt.Sprintf(`AND (query @@ document OR similarity > 0) ORDER BY rank_name, rank_description, similarity DESC NULLS LAST LIMIT $2 OFFSET $3`)
 	var notes []model.Note
 	if err := global.Database.Select(&notes, sqlString, request.Keyword, request.Limit, request.Offset); err != nil {
@@ -0,0 +1,206 @@
+package api
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"net/http"
+	"strings"
+	"time"
+)
+
+type SensitiveWordCreateRequest struct {
+	Word   string `json:"word" binding:"required"`
+	Action string `json:"action" binding:"required"`
+}
+
+type AllSensitiveWordResponse struct {
+	TotalCount int                   `json:"total_count"`
+	Words      []model.SensitiveWord `json:"words"`
+}
+
+func isWordAction(action string) bool {
+	return action == utils.WordActionBlock || action == utils.WordActionMask || action == utils.WordActionReview
+}
+
+// filterSensitiveWords 过滤用户提交的文本，mask 词直接替换字段内容，nil 字段会被跳过。
+// 命中 block 词时返回 400；allowReview 为 false 的场景（如昵称、小组名）没有审核流程，review 词也按 block 处理。
+// 返回的 review 非空时，需要在保存内容的事务中调用 queueForReview
+func filterSensitiveWords(c *gin.Context, allowReview bool, fields ...*string) (review []string, ok bool) {
+	for _, field := range fields {
+		if field == nil {
+			continue
+		}
+		result := utils.FilterText(*field)
+		if result.Blocked || (result.NeedReview && !allowReview) {
+			c.String(http.StatusBadRequest, "内容包含敏感词")
+			return nil, false
+		}
+		*field = result.Text
+		if result.NeedReview {
+			review = append(review, result.Matches...)
+		}
+	}
+	return review, true
+}
+
+// filterUserName 检查用作昵称的用户名，用户名不能被替换，命中 mask 词时也按 block 处理
+func filterUserName(c *gin.Context, name string) bool {
+	nickName := name
+	if _, ok := filterSensitiveWords(c, false, &nickName); !ok {
+		return false
+	}
+	if nickName != name {
+		c.String(http.StatusBadRequest, "内容包含敏感词")
+		return false
+	}
+	return true
+}
+
+// queueForReview 隐藏命中 review 词的内容，并以系统身份加入举报队列等待管理员处理，
+// tx 是保存内容的事务，保证内容不会在隐藏之前被看到，出错时由调用方回滚
+func queueForReview(tx *sqlx.Tx, targetType string, targetId int, userId int, words []string) error {
+	res, err := tx.Exec(`UPDATE `+reportTargetTables[targetType]+` SET is_hidden = true WHERE id = $1 AND is_hidden = false`,
+		targetId)
+	if err != nil {
+		return err
+	}
+	hidden, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	// 同一内容多次编辑时只保留一条待处理的系统举报
+	sqlString := `INSERT INTO content_report (user_id, target_type, target_id, target_user_id, reason, description,
+		status, auto_hidden, created_at) SELECT NULL, $1, $2, $3, $4, $5, $6, $7, $8 WHERE NOT EXISTS (SELECT 1
+		FROM content_report WHERE user_id IS NULL AND target_type = $1 AND target_id = $2 AND status = $6)`
+	_, err = tx.Exec(sqlString, targetType, targetId, userId, ReportReasonSensitiveWord,
+		strings.Join(words, ", "), ReportPending, hidden > 0, time.Now().Local())
+	return err
+}
+
+// GetSensitiveWords godoc
+// @Schemes http
+// @Description 管理员查看敏感词表
+// @Tags SensitiveWord
+// @Success 200 {object} AllSensitiveWordResponse "敏感词列表"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/sensitive_word/all [get]
+// @Security ApiKeyAuth
+func GetSensitiveWords(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	words := make([]model.SensitiveWord, 0)
+	sqlString := `SELECT * FROM sensitive_word ORDER BY id`
+	if err := global.Database.Select(&words, sqlString); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, AllSensitiveWordResponse{
+		TotalCount: len(words),
+		Words:      words,
+	})
+}
+
+// AddSensitiveWord godoc
+// @Schemes http
+// @Description 管理员添加敏感词，立即在所有实例生效（不区分大小写）
+// @Tags SensitiveWord
+// @Param word body SensitiveWordCreateRequest true "敏感词, action: block/mask/review"
+// @Success 200 {object} model.SensitiveWord "添加成功"
+// @Failure 400 {string} string "请求解析失败"
+// @Failure 403 {string} string "没有权限"
+// @Failure 409 {string} string "敏感词已存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/sensitive_word/add [post]
+// @Security ApiKeyAuth
+func AddSensitiveWord(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	var request SensitiveWordCreateRequest
+	if err := c.ShouldBindJSON(&request); err != nil || !isWordAction(request.Action) {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	request.Word = strings.ToLower(strings.TrimSpace(request.Word))
+	if request.Word == "" {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	var word model.SensitiveWord
+	sqlString := `INSERT INTO sensitive_word (word, action, created_at) VALUES ($1, $2, $3) RETURNING *`
+	if err := global.Database.Get(&word, sqlString, request.Word, request.Action, time.Now().Local()); err != nil {
+		if e, ok := err.(*pq.Error); ok && e.Code == "23505" {
+			c.String(http.StatusConflict, "敏感词已存在")
+			return
+		}
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if err := utils.SyncSensitiveWords(c); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, word)
+}
+
+// RemoveSensitiveWord godoc
+// @Schemes http
+// @Description 管理员删除敏感词，立即在所有实例生效
+// @Tags SensitiveWord
+// @Param id path int true "敏感词ID"
+// @Success 200 {string} string "删除成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure 404 {string} string "敏感词不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/sensitive_word/remove/{id} [delete]
+// @Security ApiKeyAuth
+func RemoveSensitiveWord(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	sqlString := `DELETE FROM sensitive_word WHERE id = $1`
+	result, err := global.Database.Exec(sqlString, c.Param("id"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	if affected, err := result.RowsAffected(); err != nil || affected == 0 {
+		c.String(http.StatusNotFound, "敏感词不存在")
+		return
+	}
+	if err := utils.SyncSensitiveWords(c); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "删除成功")
+}
+
+// ReloadSensitiveWords godoc
+// @Schemes http
+// @Description 管理员从数据库重新加载所有实例的敏感词表（直接修改数据库后使用）
+// @Tags SensitiveWord
+// @Success 200 {string} string "加载成功"
+// @Failure 403 {string} string "没有权限"
+// @Failure default {string} string "服务器错误"
+// @Router /admin/sensitive_word/reload [post]
+// @Security ApiKeyAuth
+func ReloadSensitiveWords(c *gin.Context) {
+	if role, _ := c.Get("Role"); role != global.ADMIN {
+		c.String(http.StatusForbidden, "没有权限")
+		return
+	}
+	if err := utils.SyncSensitiveWords(c); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "加载成功")
+}
@@ -0,0 +1,199 @@
+package api
+
+import (
+	"database/sql"
+	"github.com/gin-gonic/gin"
+	"kayak-backend/global"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// createUserSession 为登录成功的用户创建会话，客户端没有提供设备名时使用 User-Agent。
+// jwt 模式下返回访问令牌和刷新令牌，否则返回会话 token
+func createUserSession(c *gin.Context, userId int, role global.Role, device string, rememberMe bool) (LoginResponse, error) {
+	if device == "" {
+		device = c.Request.UserAgent()
+	}
+	session := &global.Session{
+		Role:       role,
+		UserId:     userId,
+		Device:     device,
+		IP:         c.ClientIP(),
+		RememberMe: rememberMe,
+	}
+	token, err := global.CreateSession(c, session)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	if global.AuthMode != global.AuthModeJWT {
+		return LoginResponse{Token: token}, nil
+	}
+	refreshToken, err := global.IssueRefreshToken(c, token, session)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return issueAccessToken(session, refreshToken)
+}
+
+func issueAccessToken(session *global.Session, refreshToken string) (LoginResponse, error) {
+	accessToken, err := global.CreateAccessToken(session)
+	if err != nil {
+		return LoginResponse{}, err
+	}
+	return LoginResponse{
+		Token:        accessToken,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int(global.AccessTokenExpiration.Seconds()),
+	}, nil
+}
+
+type RefreshTokenRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
+
+// RefreshToken godoc
+// @Schemes http
+// @Description 用刷新令牌换取新的访问令牌和刷新令牌，仅在 jwt 模式下可用。旧的刷新令牌立即失效，再次使用会注销整个会话
+// @Tags Authentication
+// @Param info body RefreshTokenRequest true "刷新令牌"
+// @Success 200 {object} LoginResponse "新的令牌"
+// @Failure 400 {string} string "请求解析失败"/"未启用刷新令牌"
+// @Failure 401 {string} string "登录已失效"
+// @Failure 403 {string} string "账号已被封禁"
+// @Failure default {string} string "服务器错误"
+// @Router /refresh [post]
+func RefreshToken(c *gin.Context) {
+	var request RefreshTokenRequest
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.String(http.StatusBadRequest, "请求解析失败")
+		return
+	}
+	sessionToken, session, refreshToken, err := global.RotateRefreshToken(c, request.RefreshToken, c.ClientIP())
+	if err == global.ErrRefreshNotSupported {
+		c.String(http.StatusBadRequest, "未启用刷新令牌")
+		return
+	} else if err == global.ErrInvalidToken || err == global.ErrRefreshTokenReused {
+		c.String(http.StatusUnauthorized, "登录已失效")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	// 访问令牌不查会话，封禁只能在这里和每个请求中检查，刷新时顺便注销被封禁用户的会话
+	if ban, err := getActiveBan(session.UserId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if ban != nil {
+		_ = global.DeleteSession(c, sessionToken)
+		c.String(http.StatusForbidden, "账号已被封禁")
+		return
+	}
+	// 访问令牌中的角色以数据库为准，登录后角色被修改时在下次刷新时生效
+	var role global.Role
+	sqlString := `SELECT role FROM "user" WHERE id = $1`
+	if err := global.Database.Get(&role, sqlString, session.UserId); err == sql.ErrNoRows {
+		_ = global.DeleteSession(c, sessionToken)
+		c.String(http.StatusUnauthorized, "登录已失效")
+		return
+	} else if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	session.Role = role
+	response, err := issueAccessToken(session, refreshToken)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+type SessionResponse struct {
+	ID         string    `json:"id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	RememberMe bool      `json:"remember_me"`
+	IsCurrent  bool      `json:"is_current"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeen   time.Time `json:"last_seen"`
+}
+
+type AllSessionResponse struct {
+	TotalCount int               `json:"total_count"`
+	Sessions   []SessionResponse `json:"sessions"`
+}
+
+// GetUserSessions godoc
+// @Schemes http
+// @Description 获取当前用户所有登录中的设备，按最后活动时间倒序返回
+// @Tags User
+// @Success 200 {object} AllSessionResponse "会话列表"
+// @Failure default {string} string "服务器错误"
+// @Router /user/sessions [get]
+// @Security ApiKeyAuth
+func GetUserSessions(c *gin.Context) {
+	sessions, err := global.GetUserSessions(c, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	currentId := c.GetString("SessionId")
+	responses := make([]SessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		responses = append(responses, SessionResponse{
+			ID:         session.ID,
+			Device:     session.Device,
+			IP:         session.IP,
+			RememberMe: session.RememberMe,
+			IsCurrent:  session.ID == currentId,
+			CreatedAt:  session.CreatedAt,
+			LastSeen:   session.LastSeen,
+		})
+	}
+	sort.Slice(responses, func(i, j int) bool {
+		return responses[i].LastSeen.After(responses[j].LastSeen)
+	})
+	c.JSON(http.StatusOK, AllSessionResponse{
+		TotalCount: len(responses),
+		Sessions:   responses,
+	})
+}
+
+// RevokeUserSession godoc
+// @Schemes http
+// @Description 注销当前用户的某个会话，可以注销当前会话
+// @Tags User
+// @Param id path string true "会话ID"
+// @Success 200 {string} string "注销成功"
+// @Failure 404 {string} string "会话不存在"
+// @Failure default {string} string "服务器错误"
+// @Router /user/sessions/revoke/{id} [delete]
+// @Security ApiKeyAuth
+func RevokeUserSession(c *gin.Context) {
+	// 只在当前用户自己的会话中查找
+	if found, err := global.DeleteSessionById(c, c.GetInt("UserId"), c.Param("id")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	} else if !found {
+		c.String(http.StatusNotFound, "会话不存在")
+		return
+	}
+	c.String(http.StatusOK, "注销成功")
+}
+
+// RevokeOtherUserSessions godoc
+// @Schemes http
+// @Description 注销当前用户除当前会话以外的所有会话
+// @Tags User
+// @Success 200 {string} string "注销成功"
+// @Failure default {string} string "服务器错误"
+// @Router /user/sessions/revoke_others [delete]
+// @Security ApiKeyAuth
+func RevokeOtherUserSessions(c *gin.Context) {
+	if err := global.DeleteOtherSessions(c, c.GetInt("UserId"), c.GetString("SessionId")); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
+	c.String(http.StatusOK, "注销成功")
+}
@@ -5,13 +5,11 @@ import (
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/spf13/cast"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
-	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
-	ocr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/ocr/v20181119"
 	"io/ioutil"
 	"kayak-backend/global"
 	"kayak-backend/model"
+	"kayak-backend/utils"
+	"log"
 	"net/http"
 )
 
@@ -148,7 +146,8 @@ func GetFavoriteProblemSet(c *gin.Context) {
 // @Security ApiKeyAuth
 func GetFeaturedProblemSet(c *gin.Context) {
 	sqlString := `SELECT ps.id, ps.name, ps.description, ps.created_at, ps.updated_at, ps.user_id, ps.is_public, ps.group_id
-		FROM problem_set ps LEFT JOIN user_favorite_problem_set ufps ON ps.id = ufps.problem_set_id WHERE ps.is_public = true GROUP BY ps.id ORDER BY count(*) DESC LIMIT 6`
+		FROM problem_set ps LEFT JOIN user_favorite_problem_set ufps ON ps.id = ufps.problem_set_id WHERE ps.is_public = true` +
+		hiddenCondition(c, "ps.") + ` GROUP BY ps.id ORDER BY count(*) DESC LIMIT 6`
 	var problemSets []model.ProblemSet
 	if err := global.Database.Select(&problemSets, sqlString); err != nil {
 		c.String(http.StatusBadRequest, "服务器错误")
@@ -217,7 +216,8 @@ func GetFeaturedProblemSet(c *gin.Context) {
 // @Security ApiKeyAuth
 func GetFeaturedNote(c *gin.Context) {
 	sqlString := `SELECT n.id, n.title, n.content, n.created_at, n.updated_at, n.user_id, n.is_public 
-		FROM note n LEFT JOIN user_favorite_note ufn ON n.id = ufn.note_id WHERE n.is_public = true GROUP BY n.id ORDER BY count(*) DESC LIMIT 6`
+		FROM note n LEFT JOIN user_favorite_note ufn ON n.id = ufn.note_id WHERE n.is_public = true` +
+		hiddenCondition(c, "n.") + ` GROUP BY n.id ORDER BY count(*) DESC LIMIT 6`
 	var notes []model.Note
 	if err := global.Database.Select(&notes, sqlString); err != nil {
 		c.String(http.StatusInternalServerError, "服务器错误")
@@ -308,15 +308,17 @@ func GetFeaturedGroup(c *gin.Context) {
 			return
 		}
 		groupResponses = append(groupResponses, GroupResponse{
-			Id:          group.Id,
-			Name:        group.Name,
-			Description: group.Description,
-			UserId:      group.UserId,
-			UserInfo:    userInfo,
-			MemberCount: count,
-			CreatedAt:   group.CreatedAt,
-			AreaName:    area,
-			AvatarURL:   group.AvatarURL,
+			Id:             group.Id,
+			Name:           group.Name,
+			Description:    group.Description,
+			UserId:         group.UserId,
+			UserInfo:       userInfo,
+			MemberCount:    count,
+			CreatedAt:      group.CreatedAt,
+			AreaName:       area,
+			AvatarURL:      group.AvatarURL,
+			JoinPolicy:     group.JoinPolicy,
+			EntryQuestions: parseEntryQuestions(group.EntryQuestions),
 		})
 	}
 	c.JSON(http.StatusOK, AllGroupResponse{
@@ -330,12 +332,41 @@ type OCRRequest struct {
 	RawResult   bool   `json:"raw_result"`
 }
 
+type OCRQuotaResponse struct {
+	DailyQuota int `json:"daily_quota"`
+	Remaining  int `json:"remaining"`
+}
+
+// DoOCR 识别图片或PDF的某一页，相同内容的识别结果会被缓存，未命中缓存时消耗当前用户当天的OCR配额
+func DoOCR(c *gin.Context, data []byte, isPdf bool, page int) (int, string, []utils.OCRLine) {
+	lines, _, err := utils.RecognizeWithCache(c, c.GetInt("UserId"), data, isPdf, page)
+	if err == utils.ErrOCRQuotaExceeded {
+		return http.StatusTooManyRequests, "今日OCR次数已用完", nil
+	}
+	if err != nil {
+		log.Printf("OCR失败: %v", err)
+		return http.StatusBadRequest, "识别失败", nil
+	}
+	return http.StatusOK, "", lines
+}
+
+func joinOCRLines(lines []utils.OCRLine) string {
+	var result string
+	for _, line := range lines {
+		result += line.Text
+		result += "\n"
+	}
+	return result
+}
+
 // PictureOCR godoc
 // @Schemes http
-// @Description 图片OCR
+// @Description 图片OCR（raw_result为true时返回腾讯云格式的原始结果）
 // @Tags Special
 // @Param image body OCRRequest true "OCR图片信息"
 // @Success 200 {string} string "识别结果"
+// @Failure 400 {string} string "参数错误"/"识别失败"
+// @Failure 429 {string} string "今日OCR次数已用完"
 // @Failure default {string} string "服务器错误"
 // @Router /special/picture_ocr [post]
 // @Security ApiKeyAuth
@@ -345,63 +376,38 @@ func PictureOCR(c *gin.Context) {
 		c.String(http.StatusBadRequest, "参数错误")
 		return
 	}
-	credential := common.NewCredential(
-		global.TencentCloudSecretID,
-		global.TencentCloudSecretKey,
-	)
-	// 实例化一个client选项，可选的，没有特殊需求可以跳过
-	cpf := profile.NewClientProfile()
-	cpf.HttpProfile.ReqMethod = "POST"
-	cpf.HttpProfile.Endpoint = "ocr.tencentcloudapi.com"
-	cpf.SignMethod = "TC3-HMAC-SHA256"
-
-	// 实例化要请求产品的client对象,clientProfile是可选的
-	client, _ := ocr.NewClient(credential, "ap-beijing", cpf)
-
-	// 实例化一个请求对象,每个接口都会对应一个request对象
-	OCRRequest := ocr.NewGeneralAccurateOCRRequest()
-	OCRRequest.ImageBase64 = common.StringPtr(request.ImageBase64)
-	OCRRequest.EnableDetectSplit = common.BoolPtr(true)
-	OCRRequest.IsPdf = common.BoolPtr(false)
-
-	// 返回的resp是一个GeneralAccurateOCRResponse的实例，与请求对象对应
-	response, err := client.GeneralAccurateOCR(OCRRequest)
-	if _, ok := err.(*errors.TencentCloudSDKError); ok {
-		c.String(http.StatusBadRequest, fmt.Sprintf("An API error has returned: %s", err))
+	data, err := base64.StdEncoding.DecodeString(request.ImageBase64)
+	if err != nil {
+		c.String(http.StatusBadRequest, "参数错误")
 		return
 	}
-	if err != nil {
-		panic(err)
+	status, message, lines := DoOCR(c, data, false, 0)
+	if status != http.StatusOK {
+		c.String(status, message)
+		return
 	}
-	// 输出json格式的字符串回包
 	if request.RawResult {
-		c.JSON(http.StatusOK, response)
+		c.JSON(http.StatusOK, utils.TencentOCRResponse(lines))
 		return
-	} else {
-		var result string
-		for _, item := range response.Response.TextDetections {
-			result += *item.DetectedText
-			result += "\n"
-		}
-		c.String(http.StatusOK, result)
 	}
+	c.String(http.StatusOK, joinOCRLines(lines))
 }
 
 // PDFFileOCR godoc
 // @Schemes http
-// @Description PDF文件OCR，仅支持PDF单页识别
+// @Description PDF文件OCR，仅支持PDF单页识别（raw_result为true时返回腾讯云格式的原始结果）
 // @Tags Special
 // @Param file formData file true "PDF文件"
 // @Param raw_result query bool false "是否返回原始结果"
 // @Param page query int false "需要识别的页数，从1开始"
 // @Success 200 {string} string "识别结果"
+// @Failure 400 {string} string "参数错误"/"识别失败"
+// @Failure 429 {string} string "今日OCR次数已用完"
 // @Failure default {string} string "服务器错误"
 // @Router /special/pdf_ocr [post]
 // @Security ApiKeyAuth
 func PDFFileOCR(c *gin.Context) {
 	file, _, err := c.Request.FormFile("file")
-	rawResult := c.Query("raw_result")
-	page := c.Query("page")
 	if err != nil {
 		c.String(http.StatusBadRequest, "参数错误")
 		return
@@ -411,47 +417,38 @@ func PDFFileOCR(c *gin.Context) {
 		c.String(http.StatusBadRequest, "参数错误")
 		return
 	}
-	base64string := base64.StdEncoding.EncodeToString(fileBytes)
-	credential := common.NewCredential(
-		global.TencentCloudSecretID,
-		global.TencentCloudSecretKey,
-	)
-
-	// 实例化一个client选项，可选的，没有特殊需求可以跳过
-	cpf := profile.NewClientProfile()
-	cpf.HttpProfile.ReqMethod = "POST"
-	cpf.HttpProfile.Endpoint = "ocr.tencentcloudapi.com"
-	cpf.SignMethod = "TC3-HMAC-SHA256"
-
-	// 实例化要请求产品的client对象,clientProfile是可选的
-	client, _ := ocr.NewClient(credential, "ap-beijing", cpf)
-
-	// 实例化一个请求对象,每个接口都会对应一个request对象
-	OCRRequest := ocr.NewGeneralAccurateOCRRequest()
-	OCRRequest.ImageBase64 = common.StringPtr(base64string)
-	OCRRequest.EnableDetectSplit = common.BoolPtr(true)
-	OCRRequest.IsPdf = common.BoolPtr(true)
-	OCRRequest.PdfPageNumber = common.Uint64Ptr(uint64(cast.ToInt(page)))
-
-	// 返回的resp是一个GeneralAccurateOCRResponse的实例，与请求对象对应
-	response, err := client.GeneralAccurateOCR(OCRRequest)
-	if _, ok := err.(*errors.TencentCloudSDKError); ok {
-		c.String(http.StatusBadRequest, fmt.Sprintf("An API error has returned: %s", err))
+	page := cast.ToInt(c.Query("page"))
+	if page < 1 {
+		page = 1
+	}
+	status, message, lines := DoOCR(c, fileBytes, true, page)
+	if status != http.StatusOK {
+		c.String(status, message)
 		return
 	}
-	if err != nil {
-		panic(err)
+	if c.Query("raw_result") == "true" {
+		c.JSON(http.StatusOK, utils.TencentOCRResponse(lines))
+		return
 	}
-	// 输出json格式的字符串回包
-	if rawResult == "true" {
-		c.JSON(http.StatusOK, response)
+	c.String(http.StatusOK, joinOCRLines(lines))
+}
+
+// GetOCRQuota godoc
+// @Schemes http
+// @Description 获取当前用户今日剩余的OCR次数（命中缓存的识别不消耗次数，不限制时为-1）
+// @Tags Special
+// @Success 200 {object} OCRQuotaResponse "OCR配额"
+// @Failure default {string} string "服务器错误"
+// @Router /special/ocr_quota [get]
+// @Security ApiKeyAuth
+func GetOCRQuota(c *gin.Context) {
+	remaining, err := utils.OCRQuotaRemaining(c, c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
 		return
-	} else {
-		var result string
-		for _, item := range response.Response.TextDetections {
-			result += *item.DetectedText
-			result += "\n"
-		}
-		c.String(http.StatusOK, result)
 	}
+	c.JSON(http.StatusOK, OCRQuotaResponse{
+		DailyQuota: utils.OCRDailyQuota,
+		Remaining:  remaining,
+	})
 }
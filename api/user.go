@@ -16,6 +16,21 @@ type UserInfoResponse struct {
 	AvatarPath string    `json:"avatar_path"`
 	CreateAt   time.Time `json:"create_at"`
 	NickName   string    `json:"nick_name"`
+	Reputation int       `json:"reputation"`
+}
+
+// getBriefUserInfo 返回用于在列表中展示的用户信息（ID、头像和昵称）
+func getBriefUserInfo(userId int) (UserInfoResponse, error) {
+	user := model.User{}
+	sqlString := `SELECT id, avatar_url, nick_name FROM "user" WHERE id = $1`
+	if err := global.Database.Get(&user, sqlString, userId); err != nil {
+		return UserInfoResponse{}, err
+	}
+	return UserInfoResponse{
+		UserId:     user.ID,
+		AvatarPath: user.AvatarURL,
+		NickName:   user.NickName,
+	}, nil
 }
 
 // GetUserInfoById godoc
@@ -35,10 +50,16 @@ func GetUserInfoById(c *gin.Context) {
 		c.String(http.StatusNotFound, "用户不存在")
 		return
 	}
+	reputation, err := getUserReputation(user.ID)
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	userInfo := UserInfoResponse{
 		UserId:     user.ID,
 		AvatarPath: user.AvatarURL,
 		NickName:   user.NickName,
+		Reputation: reputation,
 	}
 	c.JSON(http.StatusOK, userInfo)
 }
@@ -58,6 +79,11 @@ func GetUserInfo(c *gin.Context) {
 		c.String(http.StatusInternalServerError, "服务器错误")
 		return
 	}
+	reputation, err := getUserReputation(c.GetInt("UserId"))
+	if err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		return
+	}
 	userInfo := UserInfoResponse{
 		UserId:     c.GetInt("UserId"),
 		UserName:   user.Name,
@@ -66,6 +92,7 @@ func GetUserInfo(c *gin.Context) {
 		AvatarPath: user.AvatarURL,
 		CreateAt:   user.CreatedAt,
 		NickName:   user.NickName,
+		Reputation: reputation,
 	}
 	c.JSON(http.StatusOK, userInfo)
 }
@@ -83,7 +110,7 @@ type UserInfoRequest struct {
 // @Tags User
 // @Param info body UserInfoRequest true "用户信息"
 // @Success 200 {string} string "更新成功"
-// @Failure 400 {string} string "请求格式错误"
+// @Failure 400 {string} string "请求格式错误"/"内容包含敏感词"
 // @Failure default {string} string "服务器错误"
 // @Router /user/update [put]
 // @Security ApiKeyAuth
@@ -93,6 +120,9 @@ func UpdateUserInfo(c *gin.Context) {
 		c.String(http.StatusBadRequest, "请求格式错误")
 		return
 	}
+	if _, ok := filterSensitiveWords(c, false, user.NickName); !ok {
+		return
+	}
 	sqlString := `SELECT nick_name, email, phone, avatar_url FROM "user" WHERE id = $1`
 	formerUserInfo := model.User{}
 	if err := global.Database.Get(&formerUserInfo, sqlString, c.GetInt("UserId")); err != nil {
@@ -5,14 +5,12 @@ import (
 	"github.com/go-redis/redis/v8"
 	"github.com/jmoiron/sqlx"
 	"github.com/minio/minio-go/v6"
-	"net/smtp"
 )
 
 var Database *sqlx.DB
 var Redis *redis.Client
 var Router *gin.Engine
 var MinioClient *minio.Client
-var SMTPAuth smtp.Auth
 var AppID string
 var AppSecret string
 var TencentCloudSecretID string
@@ -0,0 +1,239 @@
+package global
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// opaque 模式下每个请求都用 token 查 Redis 中的会话；jwt 模式下请求携带签名的短期访问令牌，
+// 只在刷新访问令牌时查 Redis 和封禁状态，会话被注销或用户被封禁后已签发的访问令牌在过期前仍然有效。两种模式的凭证互不通用
+const (
+	AuthModeOpaque = "opaque"
+	AuthModeJWT    = "jwt"
+)
+
+const defaultAccessTokenExpiration = 15 * time.Minute
+
+var AuthMode = AuthModeOpaque
+var JWTSecret []byte
+var AccessTokenExpiration = defaultAccessTokenExpiration
+
+var (
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrTokenExpired        = errors.New("token expired")
+	ErrRefreshTokenReused  = errors.New("refresh token reused")
+	ErrRefreshNotSupported = errors.New("refresh token requires jwt auth mode")
+)
+
+func InitAuth(mode string, secret string, accessTokenMinutes int) error {
+	switch mode {
+	case "", AuthModeOpaque:
+		AuthMode = AuthModeOpaque
+	case AuthModeJWT:
+		if secret == "" {
+			return errors.New("JWTSecret is required in jwt auth mode")
+		}
+		AuthMode = AuthModeJWT
+	default:
+		return fmt.Errorf("unknown auth mode %q", mode)
+	}
+	JWTSecret = []byte(secret)
+	AccessTokenExpiration = defaultAccessTokenExpiration
+	if accessTokenMinutes > 0 {
+		AccessTokenExpiration = time.Duration(accessTokenMinutes) * time.Minute
+	}
+	return nil
+}
+
+// AccessClaims 是访问令牌中的内容，SessionId 是签发它的会话的公开ID
+type AccessClaims struct {
+	Subject   string `json:"sub"`
+	Role      Role   `json:"role"`
+	SessionId string `json:"sid"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+func signJWT(unsigned string) string {
+	mac := hmac.New(sha256.New, JWTSecret)
+	mac.Write([]byte(unsigned))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// CreateAccessToken 为会话签发一个 HS256 签名的访问令牌
+func CreateAccessToken(session *Session) (string, error) {
+	now := time.Now()
+	payload, err := json.Marshal(AccessClaims{
+		Subject:   strconv.Itoa(session.UserId),
+		Role:      session.Role,
+		SessionId: session.ID,
+		IssuedAt:  now.Unix(),
+		ExpiresAt: now.Add(AccessTokenExpiration).Unix(),
+	})
+	if err != nil {
+		return "", err
+	}
+	unsigned := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	return unsigned + "." + signJWT(unsigned), nil
+}
+
+// ParseAccessToken 校验访问令牌的签名和有效期，只接受本服务签发的 HS256 令牌
+func ParseAccessToken(token string) (*AccessClaims, error) {
+	if len(JWTSecret) == 0 || strings.Count(token, ".") != 2 {
+		return nil, ErrInvalidToken
+	}
+	parts := strings.Split(token, ".")
+	if parts[0] != jwtHeader || !hmac.Equal([]byte(signJWT(parts[0]+"."+parts[1])), []byte(parts[2])) {
+		return nil, ErrInvalidToken
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+	var claims AccessClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, ErrInvalidToken
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return nil, ErrTokenExpired
+	}
+	return &claims, nil
+}
+
+// UserId 返回令牌所属的用户ID
+func (claims *AccessClaims) UserId() int {
+	userId, _ := strconv.Atoi(claims.Subject)
+	return userId
+}
+
+func hashRefreshSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newRefreshSecret() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// refreshTokenKey 保存刷新令牌ID对应的会话 token，刷新令牌本身不包含会话 token，
+// 因此刷新令牌泄露时也不能被当作会话 token 使用
+func refreshTokenKey(refreshId string) string {
+	return "refresh_token:" + refreshId
+}
+
+// IssueRefreshToken 为会话签发新的刷新令牌，会话中只保存最新令牌的哈希，之前签发的令牌随之失效。
+// 刷新令牌的格式为 刷新令牌ID:随机串
+func IssueRefreshToken(c context.Context, sessionToken string, session *Session) (string, error) {
+	secret, err := newRefreshSecret()
+	if err != nil {
+		return "", err
+	}
+	session.RefreshId = uuid.New().String()
+	session.RefreshHash = hashRefreshSecret(secret)
+	bytes, err := json.Marshal(*session)
+	if err != nil {
+		return "", err
+	}
+	_, err = Redis.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.SetXX(c, sessionToken, bytes, session.expiration())
+		pipe.Set(c, refreshTokenKey(session.RefreshId), sessionToken, session.expiration())
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+	return session.RefreshId + ":" + secret, nil
+}
+
+// RotateRefreshToken 用刷新令牌换取新的刷新令牌，返回会话 token 和更新后的会话。
+// 如果出示的是已经轮换过的旧令牌，说明令牌可能已经泄露，整个会话会被注销
+func RotateRefreshToken(c context.Context, refreshToken string, ip string) (string, *Session, string, error) {
+	if AuthMode != AuthModeJWT {
+		return "", nil, "", ErrRefreshNotSupported
+	}
+	i := strings.LastIndex(refreshToken, ":")
+	if i < 0 {
+		return "", nil, "", ErrInvalidToken
+	}
+	refreshId, secret := refreshToken[:i], refreshToken[i+1:]
+	sessionToken, err := Redis.Get(c, refreshTokenKey(refreshId)).Result()
+	if err == redis.Nil {
+		return "", nil, "", ErrInvalidToken
+	} else if err != nil {
+		return "", nil, "", err
+	}
+	var session Session
+	newRefreshToken := ""
+	// 使用 WATCH 保证同一个刷新令牌并发使用时只有一个请求能轮换成功
+	err = Redis.Watch(c, func(tx *redis.Tx) error {
+		raw, err := tx.Get(c, sessionToken).Bytes()
+		if err == redis.Nil {
+			return ErrInvalidToken
+		} else if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(raw, &session); err != nil {
+			return err
+		}
+		if session.RefreshId != refreshId {
+			return ErrInvalidToken
+		}
+		if !hmac.Equal([]byte(session.RefreshHash), []byte(hashRefreshSecret(secret))) {
+			return ErrRefreshTokenReused
+		}
+		newSecret, err := newRefreshSecret()
+		if err != nil {
+			return err
+		}
+		session.RefreshHash = hashRefreshSecret(newSecret)
+		session.LastSeen = time.Now()
+		session.IP = ip
+		bytes, err := json.Marshal(session)
+		if err != nil {
+			return err
+		}
+		_, err = tx.TxPipelined(c, func(pipe redis.Pipeliner) error {
+			pipe.SetXX(c, sessionToken, bytes, session.expiration())
+			pipe.Expire(c, refreshTokenKey(refreshId), session.expiration())
+			return nil
+		})
+		newRefreshToken = refreshId + ":" + newSecret
+		return err
+	}, sessionToken)
+	if err == ErrRefreshTokenReused {
+		if err := DeleteSession(c, sessionToken); err != nil {
+			return "", nil, "", err
+		}
+		return "", nil, "", ErrRefreshTokenReused
+	} else if err == ErrInvalidToken {
+		// 会话已经被注销，刷新令牌也一并清理
+		if err := Redis.Del(c, refreshTokenKey(refreshId)).Err(); err != nil {
+			return "", nil, "", err
+		}
+		return "", nil, "", ErrInvalidToken
+	} else if err == redis.TxFailedErr {
+		// 并发轮换时后到的请求失败，不视为重用
+		return "", nil, "", ErrInvalidToken
+	} else if err != nil {
+		return "", nil, "", err
+	}
+	return sessionToken, &session, newRefreshToken, nil
+}
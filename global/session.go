@@ -2,11 +2,15 @@ package global
 
 import (
 	"context"
+	"database/sql"
 	"encoding/json"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/go-redis/redis/v8"
 	"github.com/google/uuid"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,9 +24,45 @@ const (
 	ADMIN
 )
 
+// 普通会话12小时不活动后过期，“记住我”的会话30天不活动后过期，每次使用都会续期
+const (
+	SessionExpiration         = time.Hour * 12
+	RememberSessionExpiration = time.Hour * 24 * 30
+	// 距离上次续期超过这么长时间才会再次续期，避免每个请求都写 Redis
+	sessionTouchInterval = time.Minute
+)
+
 type Session struct {
-	Role   Role `json:"role"`
-	UserId int  `json:"user_id"`
+	// ID 是会话的公开标识，用于会话列表和访问令牌，和保存会话的 token 无关，不能用来冒充会话
+	ID         string    `json:"id"`
+	Role       Role      `json:"role"`
+	UserId     int       `json:"user_id"`
+	Device     string    `json:"device"`
+	IP         string    `json:"ip"`
+	RememberMe bool      `json:"remember_me"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastSeen   time.Time `json:"last_seen"`
+	// RefreshId 和 RefreshHash 是当前有效的刷新令牌的ID和哈希，只在 jwt 模式下使用
+	RefreshId   string `json:"refresh_id,omitempty"`
+	RefreshHash string `json:"refresh_hash,omitempty"`
+}
+
+func (s *Session) expiration() time.Duration {
+	if s.RememberMe {
+		return RememberSessionExpiration
+	}
+	return SessionExpiration
+}
+
+// userSessionsKey 是保存用户所有会话 token 的集合，用于列出和批量删除会话
+func userSessionsKey(userId int) string {
+	return fmt.Sprintf("user_sessions:%d", userId)
+}
+
+// token 以用户ID结尾，便于删除会话时找到用户的会话集合
+func tokenUserId(token string) int {
+	userId, _ := strconv.Atoi(token[strings.LastIndex(token, "@")+1:])
+	return userId
 }
 
 func GetSessionByToken(c context.Context, token string) []byte {
@@ -33,24 +73,180 @@ func GetSessionByToken(c context.Context, token string) []byte {
 	return r
 }
 
-func CreateSession(c context.Context, session *Session) (string, error) {
-	token := fmt.Sprintf("%s@%d", uuid.New().String(), session.UserId)
+// saveSession 保存会话，续期时 renew 为 true，此时只更新仍然存在的会话，避免并发时复活已撤销的会话
+func saveSession(c context.Context, token string, session *Session, renew bool) error {
 	bytes, err := json.Marshal(*session)
 	if err != nil {
-		return "", err
+		return err
 	}
-	err = Redis.Set(c, token, bytes, time.Hour*12).Err()
-	if err != nil {
+	_, err = Redis.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		if renew {
+			pipe.SetXX(c, token, bytes, session.expiration())
+		} else {
+			pipe.Set(c, token, bytes, session.expiration())
+		}
+		pipe.SAdd(c, userSessionsKey(session.UserId), token)
+		pipe.Expire(c, userSessionsKey(session.UserId), RememberSessionExpiration)
+		return nil
+	})
+	return err
+}
+
+func CreateSession(c context.Context, session *Session) (string, error) {
+	token := fmt.Sprintf("%s@%d", uuid.New().String(), session.UserId)
+	session.ID = uuid.New().String()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	session.LastSeen = session.CreatedAt
+	if err := saveSession(c, token, session, false); err != nil {
 		return "", err
 	}
 	return token, nil
 }
 
+// touchSession 在会话被使用时更新最后活动时间和IP，并重新计算过期时间，旧版本创建的会话没有ID，顺便补上
+func touchSession(c context.Context, token string, session *Session, ip string) error {
+	if session.ID != "" && time.Since(session.LastSeen) < sessionTouchInterval && session.IP == ip {
+		return nil
+	}
+	if session.ID == "" {
+		session.ID = uuid.New().String()
+	}
+	session.LastSeen = time.Now()
+	session.IP = ip
+	return saveSession(c, token, session, true)
+}
+
 func DeleteSession(c context.Context, token string) error {
-	err := Redis.Del(c, token).Err()
+	_, err := Redis.TxPipelined(c, func(pipe redis.Pipeliner) error {
+		pipe.Del(c, token)
+		pipe.SRem(c, userSessionsKey(tokenUserId(token)), token)
+		return nil
+	})
 	return err
 }
 
+// GetUserSessions 返回用户所有未过期的会话，key 为 token，已过期的 token 会从集合中移除
+func GetUserSessions(c context.Context, userId int) (map[string]*Session, error) {
+	tokens, err := Redis.SMembers(c, userSessionsKey(userId)).Result()
+	if err != nil {
+		return nil, err
+	}
+	sessions := make(map[string]*Session)
+	for _, token := range tokens {
+		raw := GetSessionByToken(c, token)
+		if raw == nil {
+			if err := Redis.SRem(c, userSessionsKey(userId), token).Err(); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var session Session
+		if err := json.Unmarshal(raw, &session); err != nil {
+			return nil, err
+		}
+		sessions[token] = &session
+	}
+	return sessions, nil
+}
+
+// IsSessionActive 检查会话是否仍然有效：没有被注销或过期，用户也没有被封禁。
+// 实时推送等长连接只在建立时经过 Authenticate，之后定期调用它确认会话仍然有效
+func IsSessionActive(c context.Context, userId int, sessionId string) (bool, error) {
+	if banned, err := isUserBanned(c, userId); err != nil || banned {
+		return false, err
+	}
+	sessions, err := GetUserSessions(c, userId)
+	if err != nil {
+		return false, err
+	}
+	for _, session := range sessions {
+		if session.ID == sessionId {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// DeleteSessionById 按会话ID删除用户的一个会话，会话不存在时返回 false
+func DeleteSessionById(c context.Context, userId int, sessionId string) (bool, error) {
+	sessions, err := GetUserSessions(c, userId)
+	if err != nil {
+		return false, err
+	}
+	for token, session := range sessions {
+		if sessionId != "" && session.ID == sessionId {
+			return true, DeleteSession(c, token)
+		}
+	}
+	return false, nil
+}
+
+// DeleteOtherSessions 删除用户除 keepSessionId 以外的所有会话，keepSessionId 为空时删除全部会话
+func DeleteOtherSessions(c context.Context, userId int, keepSessionId string) error {
+	sessions, err := GetUserSessions(c, userId)
+	if err != nil {
+		return err
+	}
+	for token, session := range sessions {
+		if keepSessionId != "" && session.ID == keepSessionId {
+			continue
+		}
+		if err := DeleteSession(c, token); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// DeleteUserSessions 删除用户的所有登录会话
+func DeleteUserSessions(c context.Context, userId int) error {
+	return DeleteOtherSessions(c, userId, "")
+}
+
+// 封禁状态缓存在 Redis 中，封禁中的用户缓存到封禁结束，未封禁和永久封禁的用户定期重新查询。
+// 封禁和解封时需要调用 InvalidateUserBan
+const banCacheExpiration = 10 * time.Minute
+
+func userBanKey(userId int) string {
+	return fmt.Sprintf("user_ban:%d", userId)
+}
+
+// InvalidateUserBan 清除用户封禁状态的缓存，下一个请求重新查询数据库
+func InvalidateUserBan(c context.Context, userId int) error {
+	return Redis.Del(c, userBanKey(userId)).Err()
+}
+
+// isUserBanned 查询用户当前是否处于封禁期
+func isUserBanned(c context.Context, userId int) (bool, error) {
+	key := userBanKey(userId)
+	if cached, err := Redis.Get(c, key).Result(); err == nil {
+		return cached == "1", nil
+	} else if err != redis.Nil {
+		return false, err
+	}
+	var expiresAt *time.Time
+	sqlString := `SELECT expires_at FROM user_ban WHERE user_id = $1 AND (expires_at IS NULL OR expires_at > $2)
+		ORDER BY expires_at DESC NULLS FIRST LIMIT 1`
+	err := Database.Get(&expiresAt, sqlString, userId, time.Now().Local())
+	if err == sql.ErrNoRows {
+		return false, Redis.Set(c, key, "0", banCacheExpiration).Err()
+	} else if err != nil {
+		return false, err
+	}
+	expiration := banCacheExpiration
+	if expiresAt != nil {
+		expiration = time.Until(*expiresAt)
+	}
+	if expiration > 0 {
+		if err := Redis.Set(c, key, "1", expiration).Err(); err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
 func Authenticate(c *gin.Context) {
 	token := c.Request.Header.Get(TokenHeader)
 	if token == "" {
@@ -58,6 +254,18 @@ func Authenticate(c *gin.Context) {
 		c.Next()
 		return
 	}
+	// jwt 模式下只接受访问令牌，访问令牌只校验签名，不查 Redis 和数据库，过期后客户端需要用刷新令牌换取新的访问令牌。
+	// 封禁在刷新访问令牌时检查，已签发的访问令牌在过期前仍然有效
+	if AuthMode == AuthModeJWT {
+		claims, err := ParseAccessToken(token)
+		if err != nil {
+			c.Set("Role", GUEST)
+			c.Next()
+			return
+		}
+		setRequestUser(c, claims.Role, claims.UserId(), claims.SessionId)
+		return
+	}
 	sessionInfo := GetSessionByToken(c, token)
 	if sessionInfo == nil {
 		c.Set("Role", GUEST)
@@ -72,8 +280,35 @@ func Authenticate(c *gin.Context) {
 		c.Abort()
 		return
 	}
-	c.Set("Role", session.Role)
-	c.Set("UserId", session.UserId)
+	if err := touchSession(c, token, &session, c.ClientIP()); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		c.Abort()
+		return
+	}
+	authenticateUser(c, session.Role, session.UserId, session.ID)
+}
+
+// authenticateUser 检查用户没有被封禁后设置当前请求的用户
+func authenticateUser(c *gin.Context, role Role, userId int, sessionId string) {
+	// 封禁时会删除用户的会话，这里再检查一次，防止封禁期间仍有会话可用
+	if banned, err := isUserBanned(c, userId); err != nil {
+		c.String(http.StatusInternalServerError, "服务器错误")
+		c.Abort()
+		return
+	} else if banned {
+		_ = DeleteUserSessions(c, userId)
+		c.String(http.StatusForbidden, "账号已被封禁")
+		c.Abort()
+		return
+	}
+	setRequestUser(c, role, userId, sessionId)
+}
+
+// setRequestUser 设置当前请求的用户，SessionId 是请求所属会话的公开ID
+func setRequestUser(c *gin.Context, role Role, userId int, sessionId string) {
+	c.Set("Role", role)
+	c.Set("UserId", userId)
+	c.Set("SessionId", sessionId)
 	c.Next()
 }
 
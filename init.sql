@@ -13,7 +13,6 @@ create table if not exists "user"
 (
     id         serial
         primary key,
-    union_id   varchar(255),
     name       varchar(255)                                         not null
         unique,
     email      varchar(255)                                         not null,
@@ -21,7 +20,8 @@ create table if not exists "user"
     password   varchar(255)                                         not null,
     created_at timestamp                                            not null,
     avatar_url varchar(1024) default '/user.png'::character varying not null,
-    nick_name  varchar(255)                                         not null
+    nick_name  varchar(255)                                         not null,
+    role       integer       default 1                              not null
 );
 
 alter table "user"
@@ -38,7 +38,8 @@ create table if not exists problem_type
         references "user",
     problem_type_id integer   not null,
     is_public       boolean   not null,
-    analysis        text
+    analysis        text,
+    is_hidden       boolean default false not null
 );
 
 alter table problem_type
@@ -82,7 +83,8 @@ create table if not exists problem_set
         references "user",
     is_public   boolean             not null,
     group_id    integer default 0   not null,
-    area_id     integer default 100 not null
+    area_id     integer default 100 not null,
+    is_hidden   boolean default false not null
 );
 
 alter table problem_set
@@ -160,7 +162,8 @@ create table if not exists note
     user_id    integer      not null
         references "user"
             on delete cascade,
-    is_public  boolean      not null
+    is_public  boolean      not null,
+    is_hidden  boolean default false not null
 );
 
 alter table note
@@ -179,7 +182,11 @@ create table if not exists note_review
             on delete cascade,
     note_id    integer      not null
         references note
-            on delete cascade
+            on delete cascade,
+    parent_id  integer
+        references note_review
+            on delete cascade,
+    is_hidden  boolean default false not null
 );
 
 alter table note_review
@@ -242,19 +249,39 @@ create table if not exists problem_judge
 alter table problem_judge
     owner to postgres;
 
+create table if not exists problem_image
+(
+    id         serial
+        primary key,
+    problem_id integer                    not null
+        references problem_type
+            on delete cascade,
+    target     integer                    not null,
+    choice     varchar(255) default ''    not null,
+    url        varchar(1024)              not null,
+    sort_order integer      default 0     not null,
+    created_at timestamp                  not null
+);
+
+alter table problem_image
+    owner to postgres;
+
 create table if not exists "group"
 (
-    id          serial
+    id              serial
         primary key,
-    name        varchar(255)              not null,
-    description text                      not null,
-    invitation  varchar(255)              not null,
-    created_at  timestamp                 not null,
-    user_id     integer                   not null
+    name            varchar(255)               not null,
+    description     text                       not null,
+    invitation      varchar(255)               not null,
+    created_at      timestamp                  not null,
+    user_id         integer                    not null
         references "user"
             on delete cascade,
-    area_id     integer       default 100 not null,
-    avatar_url  varchar(1024) default '/group.png'::character varying
+    area_id         integer       default 100  not null,
+    avatar_url      varchar(1024) default '/group.png'::character varying,
+    join_policy     varchar(16)   default 'approval' not null,
+    entry_questions text          default '[]' not null,
+    application_ttl integer       default 7    not null
 );
 
 alter table "group"
@@ -292,7 +319,11 @@ create table if not exists discussion
         references "group"
             on delete cascade,
     is_public  boolean      not null,
-    like_count integer default 0
+    like_count integer default 0,
+    is_pinned  boolean default false not null,
+    pinned_at  timestamp,
+    is_locked  boolean default false not null,
+    is_hidden  boolean default false not null
 );
 
 alter table discussion
@@ -326,12 +357,21 @@ create table if not exists discussion_review
     discussion_id integer      not null
         references discussion
             on delete cascade,
-    like_count    integer default 0
+    like_count    integer default 0,
+    parent_id     integer
+        references discussion_review
+            on delete cascade,
+    is_accepted   boolean default false not null,
+    is_hidden     boolean default false not null
 );
 
 alter table discussion_review
     owner to postgres;
 
+create unique index if not exists discussion_review_accepted_key
+    on discussion_review (discussion_id)
+    where is_accepted;
+
 create table if not exists note_problem
 (
     note_id    integer not null
@@ -389,12 +429,353 @@ create table if not exists group_application
             on delete cascade,
     created_at timestamp not null,
     status     integer   not null,
-    message    text
+    message    text,
+    answers    text
 );
 
 alter table group_application
     owner to postgres;
 
+create table if not exists mail_outbox
+(
+    id              serial
+        primary key,
+    recipient       varchar(255)                  not null,
+    subject         varchar(255)                  not null,
+    body            text                          not null,
+    template        varchar(255)                  not null,
+    locale          varchar(32)                   not null,
+    status          varchar(32) default 'pending' not null,
+    attempts        integer     default 0         not null,
+    last_error      text,
+    created_at      timestamp                     not null,
+    updated_at      timestamp                     not null,
+    sent_at         timestamp
+);
+
+alter table mail_outbox
+    owner to postgres;
+
+create table if not exists notification
+(
+    id         serial
+        primary key,
+    user_id    integer               not null
+        references "user"
+            on delete cascade,
+    type       varchar(64)           not null,
+    actor_id   integer
+        references "user"
+            on delete set null,
+    target_id  integer               not null,
+    content    text                  not null,
+    is_read    boolean default false not null,
+    created_at timestamp             not null
+);
+
+alter table notification
+    owner to postgres;
+
+create table if not exists notification_mute
+(
+    user_id integer     not null
+        references "user"
+            on delete cascade,
+    type    varchar(64) not null,
+    primary key (user_id, type)
+);
+
+alter table notification_mute
+    owner to postgres;
+
+create table if not exists group_quiz
+(
+    id               serial
+        primary key,
+    group_id         integer     not null
+        references "group"
+            on delete cascade,
+    problem_set_id   integer     not null
+        references problem_set
+            on delete cascade,
+    host_id          integer     not null
+        references "user"
+            on delete cascade,
+    status           varchar(16) not null,
+    question_seconds integer     not null,
+    question_count   integer     not null,
+    created_at       timestamp   not null,
+    started_at       timestamp,
+    finished_at      timestamp
+);
+
+alter table group_quiz
+    owner to postgres;
+
+create table if not exists group_quiz_result
+(
+    quiz_id       integer not null
+        references group_quiz
+            on delete cascade,
+    user_id       integer not null
+        references "user"
+            on delete cascade,
+    score         integer not null,
+    correct_count integer not null,
+    rank          integer not null,
+    primary key (quiz_id, user_id)
+);
+
+alter table group_quiz_result
+    owner to postgres;
+
+create table if not exists group_assignment
+(
+    id                serial
+        primary key,
+    group_id          integer      not null
+        references "group"
+            on delete cascade,
+    problem_set_id    integer      not null
+        references problem_set
+            on delete cascade,
+    user_id           integer      not null
+        references "user"
+            on delete cascade,
+    title             varchar(255) not null,
+    description       text         not null,
+    start_time        timestamp    not null,
+    deadline          timestamp    not null,
+    max_attempts      integer      not null,
+    answer_visibility varchar(16)  not null,
+    created_at        timestamp    not null,
+    updated_at        timestamp    not null
+);
+
+alter table group_assignment
+    owner to postgres;
+
+create table if not exists group_assignment_submission
+(
+    id            serial
+        primary key,
+    assignment_id integer   not null
+        references group_assignment
+            on delete cascade,
+    user_id       integer   not null
+        references "user"
+            on delete cascade,
+    attempt       integer   not null,
+    score         integer   not null,
+    correct_count integer   not null,
+    total_count   integer   not null,
+    time_spent    integer   not null,
+    answers       text      not null,
+    submitted_at  timestamp not null,
+    unique (assignment_id, user_id, attempt)
+);
+
+alter table group_assignment_submission
+    owner to postgres;
+
+create table if not exists user_problem_attempt
+(
+    id         serial
+        primary key,
+    user_id    integer   not null
+        references "user"
+            on delete cascade,
+    problem_id integer   not null
+        references problem_type
+            on delete cascade,
+    area_id    integer   not null,
+    is_correct boolean   not null,
+    created_at timestamp not null
+);
+
+alter table user_problem_attempt
+    owner to postgres;
+
+create table if not exists leaderboard_opt_out
+(
+    user_id    integer   not null
+        primary key
+        references "user"
+            on delete cascade,
+    created_at timestamp not null
+);
+
+alter table leaderboard_opt_out
+    owner to postgres;
+
+create table if not exists group_invitation
+(
+    id           serial
+        primary key,
+    group_id     integer     not null
+        references "group"
+            on delete cascade,
+    user_id      integer     not null
+        references "user"
+            on delete cascade,
+    code         varchar(32) not null
+        unique,
+    expires_at   timestamp,
+    max_uses     integer     not null,
+    use_count    integer     not null,
+    auto_approve boolean     not null,
+    revoked      boolean     not null,
+    created_at   timestamp   not null
+);
+
+alter table group_invitation
+    owner to postgres;
+
+create table if not exists discussion_review_mention
+(
+    discussion_review_id integer   not null
+        references discussion_review
+            on delete cascade,
+    user_id              integer   not null
+        references "user"
+            on delete cascade,
+    created_at           timestamp not null,
+    primary key (discussion_review_id, user_id)
+);
+
+alter table discussion_review_mention
+    owner to postgres;
+
+create table if not exists note_review_mention
+(
+    note_review_id integer   not null
+        references note_review
+            on delete cascade,
+    user_id        integer   not null
+        references "user"
+            on delete cascade,
+    created_at     timestamp not null,
+    primary key (note_review_id, user_id)
+);
+
+alter table note_review_mention
+    owner to postgres;
+
+create table if not exists content_report
+(
+    id             serial
+        primary key,
+    user_id        integer
+        references "user"
+            on delete cascade,
+    target_type    varchar(32) not null,
+    target_id      integer     not null,
+    target_user_id integer     not null
+        references "user"
+            on delete cascade,
+    reason         varchar(32) not null,
+    description    text        not null,
+    status         varchar(16) default 'pending' not null,
+    action         varchar(16),
+    handled_by     integer
+        references "user"
+            on delete set null,
+    handled_at     timestamp,
+    auto_hidden    boolean default false not null,
+    created_at     timestamp   not null,
+    unique (user_id, target_type, target_id)
+);
+
+alter table content_report
+    owner to postgres;
+
+create table if not exists user_ban
+(
+    id         serial
+        primary key,
+    user_id    integer   not null
+        references "user"
+            on delete cascade,
+    reason     text      not null,
+    expires_at timestamp,
+    created_by integer
+        references "user"
+            on delete set null,
+    created_at timestamp not null
+);
+
+alter table user_ban
+    owner to postgres;
+
+create table if not exists sensitive_word
+(
+    id         serial
+        primary key,
+    word       varchar(255) not null
+        unique,
+    action     varchar(16)  not null,
+    created_at timestamp    not null
+);
+
+alter table sensitive_word
+    owner to postgres;
+
+create table if not exists audit_log
+(
+    id                serial
+        primary key,
+    actor_id          integer
+        references "user"
+            on delete set null,
+    action            varchar(32)           not null,
+    target_type       varchar(32)           not null,
+    target_id         integer               not null,
+    group_id          integer,
+    is_admin_override boolean default false not null,
+    before            text,
+    after             text,
+    ip                varchar(64)           not null,
+    created_at        timestamp             not null
+);
+
+alter table audit_log
+    owner to postgres;
+
+create table if not exists login_history
+(
+    id         serial
+        primary key,
+    user_id    integer     not null
+        references "user"
+            on delete cascade,
+    method     varchar(32) not null,
+    success    boolean     not null,
+    reason     varchar(32),
+    ip         varchar(64) not null,
+    user_agent text        not null,
+    created_at timestamp   not null
+);
+
+alter table login_history
+    owner to postgres;
+
+create table if not exists user_identity
+(
+    id         serial
+        primary key,
+    user_id    integer      not null
+        references "user"
+            on delete cascade,
+    provider   varchar(32)  not null,
+    subject    varchar(255) not null,
+    created_at timestamp    not null,
+    unique (provider, subject),
+    unique (user_id, provider)
+);
+
+alter table user_identity
+    owner to postgres;
+
 create table if not exists area
 (
     id   integer primary key,
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
@@ -15,8 +16,8 @@ import (
 	"kayak-backend/api"
 	"kayak-backend/docs"
 	"kayak-backend/global"
+	"kayak-backend/utils"
 	"log"
-	"net/smtp"
 	"os"
 )
 
@@ -74,8 +75,9 @@ func InitMinio(Addr string, Port int, AccessKey string, SecretKey string, UseSSL
 
 }
 
-func InitSMTP(Addr string, Username string, Password string) {
-	global.SMTPAuth = smtp.PlainAuth("", Username, Password, Addr)
+func InitSMTP(Addr string, Port int, Username string, Password string) {
+	utils.InitMailer(viper.GetString("MailTransport"), Addr, Port, Username, Password,
+		viper.GetString("MailFrom"), viper.GetString("MailTemplateDir"), viper.GetString("MailFileDir"))
 }
 
 func LoadConfig() {
@@ -95,12 +97,32 @@ func LoadConfig() {
 	InitMinio(viper.GetString("MinioHost"), viper.GetInt("MinioPort"),
 		viper.GetString("MinioAccessKey"), viper.GetString("MinioSecretKey"),
 		false)
-	InitSMTP(viper.GetString("SMTPHost"), viper.GetString("SMTPUsername"), viper.GetString("SMTPPassword"))
+	if err := utils.InitJobFiles(viper.GetString("JobFileStorage"), viper.GetString("JobFileBucket"),
+		viper.GetString("JobFileDir")); err != nil {
+		panic(err)
+	}
+	InitSMTP(viper.GetString("SMTPHost"), viper.GetInt("SMTPPort"),
+		viper.GetString("SMTPUsername"), viper.GetString("SMTPPassword"))
 	docs.SwaggerInfo.BasePath = viper.GetString("DocsPath")
 	global.AppID = viper.GetString("MiniProgramAppID")
 	global.AppSecret = viper.GetString("MiniProgramAppSecret")
 	global.TencentCloudSecretID = viper.GetString("TencentCloudSecretID")
 	global.TencentCloudSecretKey = viper.GetString("TencentCloudSecretKey")
+	if err := utils.InitOCR(viper.GetString("OCRProvider"), viper.GetInt("OCRDailyQuota")); err != nil {
+		panic(err)
+	}
+	if err := utils.InitCaptcha(viper.GetString("CaptchaProvider")); err != nil {
+		panic(err)
+	}
+	var oidcProviders []utils.OIDCProviderConfig
+	if err := viper.UnmarshalKey("OIDCProviders", &oidcProviders); err != nil {
+		panic(err)
+	}
+	utils.InitIdentityProviders(global.AppID, global.AppSecret, oidcProviders)
+	if err := global.InitAuth(viper.GetString("AuthMode"), viper.GetString("JWTSecret"),
+		viper.GetInt("AccessTokenMinutes")); err != nil {
+		panic(err)
+	}
 }
 
 // @title Kayak Backend API
@@ -112,6 +134,10 @@ func LoadConfig() {
 func main() {
 	LoadConfig()
 	global.Router = gin.Default()
+	// 登录限流和会话记录使用客户端IP，只信任配置的代理转发的地址
+	if err := global.Router.SetTrustedProxies(viper.GetStringSlice("TrustedProxies")); err != nil {
+		panic(err)
+	}
 
 	corsConfig := cors.DefaultConfig()
 	corsConfig.AllowAllOrigins = true
@@ -123,6 +149,28 @@ func main() {
 	global.Router.GET("/swagger/*any",
 		ginSwagger.WrapHandler(swaggerFiles.Handler, ginSwagger.URL("doc.json")))
 	api.InitRoute()
+	api.InitJobHandlers()
+	workers := viper.GetInt("JobWorkers")
+	if workers <= 0 {
+		workers = 4
+	}
+	utils.StartJobWorkers(workers)
+	utils.StartPushHub()
+	utils.StartSensitiveWordSync()
+	api.StartGroupApplicationExpiry()
+	api.StartGroupQuizRecovery()
+	if err := utils.ResumeMailOutbox(context.Background()); err != nil {
+		log.Printf("恢复发件箱失败: %v", err)
+	}
+	if err := api.EnsureLeaderboards(context.Background()); err != nil {
+		log.Printf("重建排行榜失败: %v", err)
+	}
+	if err := api.EnsureAdminUsers(viper.GetStringSlice("AdminUserNames")); err != nil {
+		log.Printf("初始化管理员失败: %v", err)
+	}
+	if err := utils.LoadSensitiveWords(); err != nil {
+		log.Printf("加载敏感词表失败: %v", err)
+	}
 	err := global.Router.Run("0.0.0.0:9000")
 	if err != nil {
 		return
@@ -0,0 +1,41 @@
+-- 一次性迁移：旧版本把微信 openid 保存在 "user".open_id 中，迁移到 user_identity 后删除该列。
+-- init.sql 会重建整个 schema，已有数据的数据库不能用它升级，需要在部署新版本前对现有数据库执行本文件：
+-- psql -d kayak -f migrations/001_user_identity_from_open_id.sql
+-- 重复执行不会重复插入
+
+begin;
+
+create table if not exists user_identity
+(
+    id         serial
+        primary key,
+    user_id    integer      not null
+        references "user"
+            on delete cascade,
+    provider   varchar(32)  not null,
+    subject    varchar(255) not null,
+    created_at timestamp    not null,
+    unique (provider, subject),
+    unique (user_id, provider)
+);
+
+alter table user_identity
+    owner to postgres;
+
+alter table "user"
+    add column if not exists open_id varchar(255);
+
+insert into user_identity (user_id, provider, subject, created_at)
+select id, 'weixin', open_id, created_at
+from "user"
+where open_id is not null
+  and open_id <> ''
+on conflict do nothing;
+
+alter table "user"
+    drop column if exists open_id;
+
+alter table "user"
+    drop column if exists union_id;
+
+commit;
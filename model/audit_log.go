@@ -0,0 +1,17 @@
+package model
+
+import "time"
+
+type AuditLog struct {
+	ID              int       `json:"id" db:"id"`
+	ActorId         *int      `json:"actor_id" db:"actor_id"`
+	Action          string    `json:"action" db:"action"`
+	TargetType      string    `json:"target_type" db:"target_type"`
+	TargetId        int       `json:"target_id" db:"target_id"`
+	GroupId         *int      `json:"group_id" db:"group_id"`
+	IsAdminOverride bool      `json:"is_admin_override" db:"is_admin_override"`
+	Before          *string   `json:"before" db:"before"`
+	After           *string   `json:"after" db:"after"`
+	IP              string    `json:"ip" db:"ip"`
+	CreatedAt       time.Time `json:"created_at" db:"created_at"`
+}
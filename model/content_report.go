@@ -0,0 +1,19 @@
+package model
+
+import "time"
+
+type ContentReport struct {
+	ID           int        `json:"id" db:"id"`
+	UserId       *int       `json:"user_id" db:"user_id"`
+	TargetType   string     `json:"target_type" db:"target_type"`
+	TargetId     int        `json:"target_id" db:"target_id"`
+	TargetUserId int        `json:"target_user_id" db:"target_user_id"`
+	Reason       string     `json:"reason" db:"reason"`
+	Description  string     `json:"description" db:"description"`
+	Status       string     `json:"status" db:"status"`
+	Action       *string    `json:"action" db:"action"`
+	HandledBy    *int       `json:"handled_by" db:"handled_by"`
+	HandledAt    *time.Time `json:"handled_at" db:"handled_at"`
+	AutoHidden   bool       `json:"auto_hidden" db:"auto_hidden"`
+	CreatedAt    time.Time  `json:"created_at" db:"created_at"`
+}
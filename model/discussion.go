@@ -1,14 +1,18 @@
 package model
 
 type Discussion struct {
-	ID            int    `json:"id" db:"id"`
-	Title         string `json:"title" db:"title"`
-	Content       string `json:"content" db:"content"`
-	UserId        int    `json:"user_id" db:"user_id"`
-	GroupId       int    `json:"group_id" db:"group_id"`
-	CreatedAt     string `json:"created_at" db:"created_at"`
-	UpdatedAt     string `json:"updated_at" db:"updated_at"`
-	IsPublic      bool   `json:"is_public" db:"is_public"`
-	LikeCount     int    `json:"like_count" db:"like_count"`
-	FavoriteCount int    `json:"favorite_count" db:"favorite_count"`
+	ID            int     `json:"id" db:"id"`
+	Title         string  `json:"title" db:"title"`
+	Content       string  `json:"content" db:"content"`
+	UserId        int     `json:"user_id" db:"user_id"`
+	GroupId       int     `json:"group_id" db:"group_id"`
+	CreatedAt     string  `json:"created_at" db:"created_at"`
+	UpdatedAt     string  `json:"updated_at" db:"updated_at"`
+	IsPublic      bool    `json:"is_public" db:"is_public"`
+	LikeCount     int     `json:"like_count" db:"like_count"`
+	FavoriteCount int     `json:"favorite_count" db:"favorite_count"`
+	IsPinned      bool    `json:"is_pinned" db:"is_pinned"`
+	PinnedAt      *string `json:"pinned_at" db:"pinned_at"`
+	IsLocked      bool    `json:"is_locked" db:"is_locked"`
+	IsHidden      bool    `json:"is_hidden" db:"is_hidden"`
 }
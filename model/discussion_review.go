@@ -9,4 +9,7 @@ type DiscussionReview struct {
 	CreatedAt    string `json:"created_at" db:"created_at"`
 	UpdatedAt    string `json:"updated_at" db:"updated_at"`
 	LikeCount    int    `json:"like_count" db:"like_count"`
+	ParentId     *int   `json:"parent_id" db:"parent_id"`
+	IsAccepted   bool   `json:"is_accepted" db:"is_accepted"`
+	IsHidden     bool   `json:"is_hidden" db:"is_hidden"`
 }
@@ -3,12 +3,15 @@ package model
 import "time"
 
 type Group struct {
-	Id          int       `json:"id" db:"id"`
-	Name        string    `json:"name" db:"name"`
-	Description string    `json:"description" db:"description"`
-	Invitation  string    `json:"invitation" db:"invitation"`
-	UserId      int       `json:"user_id" db:"user_id"`
-	CreatedAt   time.Time `json:"created_at" db:"created_at"`
-	AreaId      int       `json:"area_id" db:"area_id"`
-	AvatarURL   string    `json:"avatar_url" db:"avatar_url"`
+	Id             int       `json:"id" db:"id"`
+	Name           string    `json:"name" db:"name"`
+	Description    string    `json:"description" db:"description"`
+	Invitation     string    `json:"invitation" db:"invitation"`
+	UserId         int       `json:"user_id" db:"user_id"`
+	CreatedAt      time.Time `json:"created_at" db:"created_at"`
+	AreaId         int       `json:"area_id" db:"area_id"`
+	AvatarURL      string    `json:"avatar_url" db:"avatar_url"`
+	JoinPolicy     string    `json:"join_policy" db:"join_policy"`
+	EntryQuestions string    `json:"entry_questions" db:"entry_questions"` // JSON 数组
+	ApplicationTTL int       `json:"application_ttl" db:"application_ttl"` // 入组申请的有效天数, 0 表示不过期
 }
@@ -7,4 +7,5 @@ type GroupApplication struct {
 	CreatedAt string  `json:"created_at" db:"created_at"`
 	Status    int     `json:"status" db:"status"` // 0: pending, 1: accepted, 2: rejected
 	Message   *string `json:"message" db:"message"`
+	Answers   *string `json:"answers" db:"answers"` // 入组问题的回答, JSON 数组
 }
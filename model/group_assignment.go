@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+type GroupAssignment struct {
+	ID               int       `json:"id" db:"id"`
+	GroupId          int       `json:"group_id" db:"group_id"`
+	ProblemSetId     int       `json:"problem_set_id" db:"problem_set_id"`
+	UserId           int       `json:"user_id" db:"user_id"`
+	Title            string    `json:"title" db:"title"`
+	Description      string    `json:"description" db:"description"`
+	StartTime        time.Time `json:"start_time" db:"start_time"`
+	Deadline         time.Time `json:"deadline" db:"deadline"`
+	MaxAttempts      int       `json:"max_attempts" db:"max_attempts"`
+	AnswerVisibility string    `json:"answer_visibility" db:"answer_visibility"`
+	CreatedAt        time.Time `json:"created_at" db:"created_at"`
+	UpdatedAt        time.Time `json:"updated_at" db:"updated_at"`
+}
+
+type GroupAssignmentSubmission struct {
+	ID           int       `json:"id" db:"id"`
+	AssignmentId int       `json:"assignment_id" db:"assignment_id"`
+	UserId       int       `json:"user_id" db:"user_id"`
+	Attempt      int       `json:"attempt" db:"attempt"`
+	Score        int       `json:"score" db:"score"`
+	CorrectCount int       `json:"correct_count" db:"correct_count"`
+	TotalCount   int       `json:"total_count" db:"total_count"`
+	TimeSpent    int       `json:"time_spent" db:"time_spent"`
+	Answers      string    `json:"answers" db:"answers"`
+	SubmittedAt  time.Time `json:"submitted_at" db:"submitted_at"`
+}
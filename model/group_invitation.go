@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+type GroupInvitation struct {
+	ID          int        `json:"id" db:"id"`
+	GroupId     int        `json:"group_id" db:"group_id"`
+	UserId      int        `json:"user_id" db:"user_id"`
+	Code        string     `json:"code" db:"code"`
+	ExpiresAt   *time.Time `json:"expires_at" db:"expires_at"`
+	MaxUses     int        `json:"max_uses" db:"max_uses"` // 0 表示不限次数
+	UseCount    int        `json:"use_count" db:"use_count"`
+	AutoApprove bool       `json:"auto_approve" db:"auto_approve"`
+	Revoked     bool       `json:"revoked" db:"revoked"`
+	CreatedAt   time.Time  `json:"created_at" db:"created_at"`
+}
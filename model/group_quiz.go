@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type GroupQuiz struct {
+	ID              int        `json:"id" db:"id"`
+	GroupId         int        `json:"group_id" db:"group_id"`
+	ProblemSetId    int        `json:"problem_set_id" db:"problem_set_id"`
+	HostId          int        `json:"host_id" db:"host_id"`
+	Status          string     `json:"status" db:"status"`
+	QuestionSeconds int        `json:"question_seconds" db:"question_seconds"`
+	QuestionCount   int        `json:"question_count" db:"question_count"`
+	CreatedAt       time.Time  `json:"created_at" db:"created_at"`
+	StartedAt       *time.Time `json:"started_at" db:"started_at"`
+	FinishedAt      *time.Time `json:"finished_at" db:"finished_at"`
+}
+
+type GroupQuizResult struct {
+	QuizId       int `json:"quiz_id" db:"quiz_id"`
+	UserId       int `json:"user_id" db:"user_id"`
+	Score        int `json:"score" db:"score"`
+	CorrectCount int `json:"correct_count" db:"correct_count"`
+	Rank         int `json:"rank" db:"rank"`
+}
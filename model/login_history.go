@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type LoginHistory struct {
+	ID        int       `json:"id" db:"id"`
+	UserId    int       `json:"user_id" db:"user_id"`
+	Method    string    `json:"method" db:"method"`
+	Success   bool      `json:"success" db:"success"`
+	Reason    *string   `json:"reason" db:"reason"`
+	IP        string    `json:"ip" db:"ip"`
+	UserAgent string    `json:"user_agent" db:"user_agent"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,18 @@
+package model
+
+import "time"
+
+type MailOutbox struct {
+	ID        int        `json:"id" db:"id"`
+	Recipient string     `json:"recipient" db:"recipient"`
+	Subject   string     `json:"subject" db:"subject"`
+	Body      string     `json:"body" db:"body"`
+	Template  string     `json:"template" db:"template"`
+	Locale    string     `json:"locale" db:"locale"`
+	Status    string     `json:"status" db:"status"` // pending, sending, sent, failed
+	Attempts  int        `json:"attempts" db:"attempts"`
+	LastError *string    `json:"last_error" db:"last_error"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at" db:"updated_at"`
+	SentAt    *time.Time `json:"sent_at" db:"sent_at"`
+}
@@ -12,4 +12,5 @@ type Note struct {
 	IsPublic      bool      `json:"is_public" db:"is_public"`
 	LikeCount     int       `json:"like_count" db:"like_count"`
 	FavoriteCount int       `json:"favorite_count" db:"favorite_count"`
+	IsHidden      bool      `json:"is_hidden" db:"is_hidden"`
 }
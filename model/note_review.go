@@ -10,4 +10,6 @@ type NoteReview struct {
 	Content   string    `json:"content" db:"content"`
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	UpdatedAt time.Time `json:"updated_at" db:"updated_at"`
+	ParentId  *int      `json:"parent_id" db:"parent_id"`
+	IsHidden  bool      `json:"is_hidden" db:"is_hidden"`
 }
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+type Notification struct {
+	ID        int       `json:"id" db:"id"`
+	UserId    int       `json:"user_id" db:"user_id"`
+	Type      string    `json:"type" db:"type"`
+	ActorId   *int      `json:"actor_id" db:"actor_id"`
+	TargetId  int       `json:"target_id" db:"target_id"`
+	Content   string    `json:"content" db:"content"`
+	IsRead    bool      `json:"is_read" db:"is_read"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
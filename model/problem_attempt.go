@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type ProblemAttempt struct {
+	ID        int       `json:"id" db:"id"`
+	UserId    int       `json:"user_id" db:"user_id"`
+	ProblemId int       `json:"problem_id" db:"problem_id"`
+	AreaId    int       `json:"area_id" db:"area_id"`
+	IsCorrect bool      `json:"is_correct" db:"is_correct"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -0,0 +1,13 @@
+package model
+
+import "time"
+
+type ProblemImage struct {
+	ID        int       `json:"id" db:"id"`
+	ProblemId int       `json:"problem_id" db:"problem_id"`
+	Target    int       `json:"target" db:"target"` // 0: stem, 1: choice, 2: analysis
+	Choice    string    `json:"choice" db:"choice"`
+	URL       string    `json:"url" db:"url"`
+	SortOrder int       `json:"sort_order" db:"sort_order"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
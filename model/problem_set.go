@@ -13,4 +13,5 @@ type ProblemSet struct {
 	GroupId       int       `json:"group_id" db:"group_id"`
 	AreaId        int       `json:"area_id" db:"area_id"`
 	FavoriteCount int       `json:"favorite_count" db:"favorite_count"`
+	IsHidden      bool      `json:"is_hidden" db:"is_hidden"`
 }
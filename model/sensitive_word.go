@@ -0,0 +1,10 @@
+package model
+
+import "time"
+
+type SensitiveWord struct {
+	ID        int       `json:"id" db:"id"`
+	Word      string    `json:"word" db:"word"`
+	Action    string    `json:"action" db:"action"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -4,7 +4,6 @@ import "time"
 
 type User struct {
 	ID        int       `json:"id" db:"id"`
-	OpenId    *string   `json:"open_id" db:"open_id"`
 	Name      string    `json:"name" db:"name"`
 	Email     string    `json:"email" db:"email"`
 	Phone     *string   `json:"phone" db:"phone"`
@@ -12,4 +11,5 @@ type User struct {
 	CreatedAt time.Time `json:"created_at" db:"created_at"`
 	AvatarURL string    `json:"avatar_url" db:"avatar_url"`
 	NickName  string    `json:"nick_name" db:"nick_name"`
+	Role      int       `json:"role" db:"role"`
 }
@@ -0,0 +1,12 @@
+package model
+
+import "time"
+
+type UserBan struct {
+	ID        int        `json:"id" db:"id"`
+	UserId    int        `json:"user_id" db:"user_id"`
+	Reason    string     `json:"reason" db:"reason"`
+	ExpiresAt *time.Time `json:"expires_at" db:"expires_at"`
+	CreatedBy *int       `json:"created_by" db:"created_by"`
+	CreatedAt time.Time  `json:"created_at" db:"created_at"`
+}
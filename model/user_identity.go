@@ -0,0 +1,11 @@
+package model
+
+import "time"
+
+type UserIdentity struct {
+	ID        int       `json:"id" db:"id"`
+	UserId    int       `json:"user_id" db:"user_id"`
+	Provider  string    `json:"provider" db:"provider"`
+	Subject   string    `json:"subject" db:"subject"`
+	CreatedAt time.Time `json:"created_at" db:"created_at"`
+}
@@ -13,6 +13,8 @@ var stages = [][]func(*testing.T){
 	{testLogin} /*{testRegister},*/, {testChangePassword, testLogout, testUserInfo},
 	{testFavoriteNote, testFavoriteProblem, testLikeNote, testLikeNoteReview, testFavoriteProblemSet},
 	{TestProblemAnswer}, {TestCreateGroup, TestCreateNote},
+	{testOCRProblem, testPDFOCRJob, testSendEmail, testNotification, testPush, testGroupQuiz, testGroupAssignment, testLeaderboard, testGroupRole, testGroupInvitation, testGroupPolicy, testGroupStats, testReviewThread, testProblemImage, testDiscussionModeration, testReport, testSensitiveWord, testAdmin, testAudit, testLoginGuard, testSession, testIdentity},
+	{testJWT},
 }
 
 func goTestWithWait(wg *sync.WaitGroup, t *testing.T, f func(t *testing.T)) {
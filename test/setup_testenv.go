@@ -167,7 +167,11 @@ func readConfig() {
 	corsConfig.AllowHeaders = append(corsConfig.AllowHeaders, global.TokenHeader)
 	global.Router.Use(cors.New(corsConfig))
 	global.Router.Use(global.Authenticate)
+	utils.InitMailer("file", "", 0, "", "", "", "../templates/mail", "")
 	api.InitRoute()
+	api.InitJobHandlers()
+	utils.StartJobWorkers(2)
+	utils.StartPushHub()
 }
 
 func InitUserTable(tx *sqlx.Tx) error {
@@ -0,0 +1,99 @@
+package test
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testAdmin(t *testing.T) {
+	// 被管理的用户单独创建，封禁和修改角色不影响其他并行的测试
+	password, err := utils.EncryptPassword("managed")
+	assert.Equal(t, err, nil)
+	var userId int
+	err = global.Database.Get(&userId, `INSERT INTO "user" (name, created_at, password, nick_name, email)
+		VALUES ('managed', now(), $1, 'managed', 'managed@boat4study.com') RETURNING id`, password)
+	assert.Equal(t, err, nil)
+	id := strconv.Itoa(userId)
+	login := func() (string, int) {
+		res := api.LoginResponse{}
+		code := Post("/login", "", &api.LoginInfo{UserName: "managed", Password: "managed"}, &res)
+		return res.Token, code
+	}
+	token, code := login()
+	assert.Equal(t, code, http.StatusOK)
+	adminToken := adminSession(t)
+
+	var users api.AllAdminUserResponse
+	code = Get("/admin/user/search", token, map[string][]string{"keyword": {"managed"}}, &users)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Get("/admin/user/search", adminToken, map[string][]string{"keyword": {"MANAGED"}}, &users)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, users.TotalCount, 1)
+	assert.Equal(t, users.Users[0].ID, userId)
+	assert.Equal(t, users.Users[0].Role, int(global.USER))
+
+	code = Post("/note/create", token, &api.NoteCreateRequest{Title: "private note", Content: "private"}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var content api.AllUserContentResponse
+	code = Get("/admin/user/content/"+id, adminToken, map[string][]string{"target_type": {api.ReportTargetNote}}, &content)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, content.TotalCount, 1)
+	assert.Equal(t, content.Items[0].Title, "private note")
+	code = Get("/admin/user/content/"+id, adminToken, map[string][]string{"target_type": {"user"}}, &content)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 角色保存在用户表中，修改后原有会话失效，重新登录后生效
+	code = Put("/admin/user/role/1", adminToken, &api.AdminRoleRequest{IsAdmin: false}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Put("/admin/user/role/"+id, adminToken, &api.AdminRoleRequest{IsAdmin: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var userInfo api.UserInfoResponse
+	code = Get("/user/info", token, nil, &userInfo)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	token, code = login()
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/admin/user/search", token, map[string][]string{"role": {strconv.Itoa(int(global.ADMIN))}}, &users)
+	assert.Equal(t, code, http.StatusOK)
+	code = Put("/admin/user/role/"+id, adminToken, &api.AdminRoleRequest{IsAdmin: false}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	token, code = login()
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/admin/user/search", token, nil, &users)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// 强制下线
+	code = Post("/admin/user/logout/"+id, adminToken, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/user/info", token, nil, &userInfo)
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// 封禁期间不能登录，封禁前创建的会话也不能使用
+	token, code = login()
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/admin/user/ban/"+id, adminToken, &api.AdminBanRequest{Reason: "spam", Days: 3}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/user/info", token, nil, &userInfo)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	_, code = login()
+	assert.Equal(t, code, http.StatusForbidden)
+	staleToken, err := global.CreateSession(context.Background(), &global.Session{Role: global.USER, UserId: userId})
+	assert.Equal(t, err, nil)
+	code = Get("/user/info", staleToken, nil, &userInfo)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Get("/admin/user/search", adminToken, map[string][]string{"keyword": {"managed"}}, &users)
+	assert.Equal(t, code, http.StatusOK)
+	assert.NotEqual(t, users.Users[0].Ban, nil)
+
+	code = Delete("/admin/user/ban/"+id, adminToken, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Delete("/admin/user/ban/"+id, adminToken, nil, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+	_, code = login()
+	assert.Equal(t, code, http.StatusOK)
+}
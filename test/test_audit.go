@@ -0,0 +1,95 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testAudit(t *testing.T) {
+	tokens := loginUsers(t, 2, 3)
+	adminToken := adminSession(t)
+
+	// 小组成员删除了小组的题集，可以从审计日志中查到是谁删除的
+	var group api.GroupResponse
+	code := Post("/group/create", tokens[2], &api.GroupCreateRequest{
+		Name:        "audit group",
+		Description: "audit group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 3, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+	var problemSet api.ProblemSetResponse
+	code = Post("/problem_set/create", tokens[2], &api.ProblemSetCreateRequest{
+		Name:        "audited problem set",
+		Description: "audited problem set",
+		GroupId:     &group.Id,
+	}, &problemSet)
+	assert.Equal(t, code, http.StatusOK)
+	code = Delete("/problem_set/delete/"+strconv.Itoa(problemSet.ID), tokens[3], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	var logs api.AllAuditLogResponse
+	code = Get("/admin/audit_log/all", tokens[2], map[string][]string{"group_id": {strconv.Itoa(group.Id)}}, &logs)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Get("/admin/audit_log/all", adminToken, map[string][]string{
+		"group_id": {strconv.Itoa(group.Id)}, "action": {api.AuditActionDelete},
+	}, &logs)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, logs.TotalCount, 1)
+	assert.Equal(t, logs.AuditLogs[0].ActorInfo.UserId, 3)
+	assert.Equal(t, logs.AuditLogs[0].TargetType, api.ReportTargetProblemSet)
+	assert.Equal(t, logs.AuditLogs[0].TargetId, problemSet.ID)
+	assert.Equal(t, logs.AuditLogs[0].IsAdminOverride, false)
+	assert.NotEqual(t, len(logs.AuditLogs[0].Before), 0)
+
+	// 成员退出小组
+	code = Delete("/group/quit/"+strconv.Itoa(group.Id), tokens[3], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/admin/audit_log/all", adminToken, map[string][]string{
+		"group_id": {strconv.Itoa(group.Id)}, "action": {api.AuditActionMemberQuit},
+	}, &logs)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, logs.TotalCount, 1)
+	assert.Equal(t, logs.AuditLogs[0].TargetId, 3)
+
+	// 管理员删除别人的笔记记为越权操作
+	var note api.NoteResponse
+	code = Post("/note/create", tokens[3], &api.NoteCreateRequest{Title: "audited note", Content: "audited"}, &note)
+	assert.Equal(t, code, http.StatusOK)
+	code = Delete("/note/delete/"+strconv.Itoa(note.ID), adminToken, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/admin/audit_log/all", adminToken, map[string][]string{
+		"target_type": {api.ReportTargetNote}, "target_id": {strconv.Itoa(note.ID)},
+	}, &logs)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, logs.TotalCount, 1)
+	assert.Equal(t, logs.AuditLogs[0].IsAdminOverride, true)
+
+	// 修改密码只记录操作，不保存快照
+	password, err := utils.EncryptPassword("audited")
+	assert.Equal(t, err, nil)
+	var userId int
+	err = global.Database.Get(&userId, `INSERT INTO "user" (name, created_at, password, nick_name, email)
+		VALUES ('audited', now(), $1, 'audited', 'audited@boat4study.com') RETURNING id`, password)
+	assert.Equal(t, err, nil)
+	res := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{UserName: "audited", Password: "audited"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/change-password", res.Token, &api.RegisterResponse{
+		OldPassword: "audited",
+		NewPassword: "audited-new",
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/admin/audit_log/all", adminToken, map[string][]string{
+		"actor_id": {strconv.Itoa(userId)}, "action": {api.AuditActionPasswordChange},
+	}, &logs)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, logs.TotalCount, 1)
+	assert.Equal(t, string(logs.AuditLogs[0].Before), "null")
+}
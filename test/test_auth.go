@@ -1,9 +1,13 @@
 package test
 
 import (
+	"context"
 	"github.com/go-playground/assert/v2"
 	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/model"
 	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -83,3 +87,19 @@ func testLogout(t *testing.T) {
 	assert.Equal(t, code, http.StatusOK)
 	//assert.Equal(t, result, "退出成功")
 }
+
+func testSendEmail(t *testing.T) {
+	email := "mail-test@boat4study.com"
+	code := Post("/send-email?email="+email, "", nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/send-email?email="+email, "", nil, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 邮件先写入发件箱再由后台任务投递
+	var mail model.MailOutbox
+	err := global.Database.Get(&mail, `SELECT * FROM mail_outbox WHERE recipient = $1 ORDER BY id DESC LIMIT 1`, email)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, mail.Template, "verify_code")
+	vCode, _ := global.Redis.Get(context.Background(), email).Result()
+	assert.Equal(t, strings.Contains(mail.Body, vCode), true)
+}
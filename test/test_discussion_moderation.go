@@ -0,0 +1,126 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testDiscussionModeration(t *testing.T) {
+	tokens := loginUsers(t, 2, 8)
+
+	var group api.GroupResponse
+	code := Post("/group/create", tokens[2], &api.GroupCreateRequest{
+		Name:        "moderation group",
+		Description: "moderation group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 8, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+	var first, second api.DiscussionResponse
+	for _, discussion := range []*api.DiscussionResponse{&first, &second} {
+		code = Post("/discussion/create", tokens[8], &api.DiscussionCreateRequest{
+			Title:    "question",
+			Content:  "question",
+			GroupId:  group.Id,
+			IsPublic: true,
+		}, discussion)
+		assert.Equal(t, code, http.StatusOK)
+	}
+
+	// 只有组长和管理员可以置顶，置顶的讨论排在最前面
+	firstId := strconv.Itoa(first.ID)
+	code = Put("/discussion/pin/"+firstId, tokens[8], &api.DiscussionPinRequest{IsPinned: true}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Put("/discussion/pin/"+firstId, tokens[2], &api.DiscussionPinRequest{IsPinned: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var discussions api.AllDiscussionResponse
+	code = Get("/discussion/all", tokens[8], map[string][]string{
+		"group_id": {strconv.Itoa(group.Id)}, "sort_by_like": {"false"},
+	}, &discussions)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, discussions.TotalCount, 2)
+	assert.Equal(t, discussions.Discussions[0].ID, first.ID)
+	assert.Equal(t, discussions.Discussions[0].IsPinned, true)
+
+	// 锁定的讨论不能再添加评论
+	secondId := strconv.Itoa(second.ID)
+	code = Put("/discussion/lock/"+secondId, tokens[2], &api.DiscussionLockRequest{IsLocked: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/discussion_review/add", tokens[8], &api.DiscussionReviewCreateRequest{
+		Title:        "answer",
+		Content:      "answer",
+		DiscussionId: second.ID,
+	}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Put("/discussion/lock/"+secondId, tokens[2], &api.DiscussionLockRequest{IsLocked: false}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/discussion_review/add", tokens[8], &api.DiscussionReviewCreateRequest{
+		Title:        "answer",
+		Content:      "answer",
+		DiscussionId: second.ID,
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 被采纳的回答排在最前面并计入作者的声望，每个讨论只有一个被采纳的回答，
+	// 讨论作者自己的评论和回复不能被采纳
+	answererId := createLoginUser(t, "answerer")
+	_, err = global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, $2, false, false, now())`, group.Id, answererId)
+	assert.Equal(t, err, nil)
+	res := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{UserName: "answerer", Password: "answerer"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	answererToken := res.Token
+	var ownerAnswer, authorAnswer, memberAnswer, reply api.DiscussionReviewResponse
+	for _, answer := range []struct {
+		token    string
+		response *api.DiscussionReviewResponse
+	}{{tokens[2], &ownerAnswer}, {tokens[8], &authorAnswer}, {answererToken, &memberAnswer}} {
+		code = Post("/discussion_review/add", answer.token, &api.DiscussionReviewCreateRequest{
+			Title:        "answer",
+			Content:      "answer",
+			DiscussionId: first.ID,
+		}, answer.response)
+		assert.Equal(t, code, http.StatusOK)
+	}
+	code = Post("/discussion_review/add", answererToken, &api.DiscussionReviewCreateRequest{
+		Title:        "reply",
+		Content:      "reply",
+		DiscussionId: first.ID,
+		ParentId:     &ownerAnswer.ID,
+	}, &reply)
+	assert.Equal(t, code, http.StatusOK)
+	code = Put("/discussion_review/accept/"+strconv.Itoa(authorAnswer.ID), tokens[2],
+		&api.DiscussionReviewAcceptRequest{IsAccepted: true}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Put("/discussion_review/accept/"+strconv.Itoa(reply.ID), tokens[8],
+		&api.DiscussionReviewAcceptRequest{IsAccepted: true}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Put("/discussion_review/accept/"+strconv.Itoa(memberAnswer.ID), tokens[2],
+		&api.DiscussionReviewAcceptRequest{IsAccepted: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var reviews api.AllDiscussionReviewResponse
+	code = Get("/discussion_review/get", tokens[2], map[string][]string{"discussion_id": {firstId}}, &reviews)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reviews.DiscussionReviews[0].ID, memberAnswer.ID)
+	assert.Equal(t, reviews.DiscussionReviews[0].IsAccepted, true)
+	var userInfo api.UserInfoResponse
+	code = Get("/user/info/"+strconv.Itoa(answererId), tokens[2], nil, &userInfo)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, userInfo.Reputation, 10)
+
+	code = Put("/discussion_review/accept/"+strconv.Itoa(ownerAnswer.ID), tokens[8],
+		&api.DiscussionReviewAcceptRequest{IsAccepted: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/user/info/"+strconv.Itoa(answererId), tokens[2], nil, &userInfo)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, userInfo.Reputation, 0)
+	code = Get("/user/info", tokens[2], nil, &userInfo)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, userInfo.Reputation, 10)
+}
@@ -0,0 +1,124 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testGroupAssignment(t *testing.T) {
+	admin := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{
+		UserName: initUser[1].Name,
+		Password: initUser[1].Password,
+	}, &admin)
+	assert.Equal(t, code, http.StatusOK)
+	member := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{
+		UserName: initUser[0].Name,
+		Password: initUser[0].Password,
+	}, &member)
+	assert.Equal(t, code, http.StatusOK)
+
+	var group api.GroupResponse
+	code = Post("/group/create", admin.Token, &api.GroupCreateRequest{
+		Name:        "assignment group",
+		Description: "assignment group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 1, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+
+	// 题集2中只有一道答案为 problem2_answer 的填空题
+	var assignment api.GroupAssignmentResponse
+	request := api.GroupAssignmentCreateRequest{
+		GroupId:          group.Id,
+		ProblemSetId:     initProblemSet[1].ID,
+		Title:            "homework",
+		Deadline:         time.Now().Add(time.Hour),
+		MaxAttempts:      1,
+		AnswerVisibility: api.AnswerVisibleAfterDeadline,
+	}
+	code = Post("/group_assignment/create", member.Token, &request, &assignment)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/group_assignment/create", admin.Token, &request, &assignment)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, assignment.ProblemCount, 1)
+
+	var pending api.AllGroupAssignmentResponse
+	code = Get("/group_assignment/pending", member.Token, nil, &pending)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, pending.TotalCount, 1)
+	assert.Equal(t, pending.Assignments[0].Status, api.AssignmentPending)
+
+	// 截止前成员不能通过题目接口查看作业中题目的答案，小组管理员不受限制
+	answerURL := "/problem/blank/answer/" + strconv.Itoa(initProblemType[1].ID)
+	var answer api.BlankProblemAnswerResponse
+	code = Get(answerURL, member.Token, nil, &answer)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Get(answerURL, admin.Token, nil, &answer)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 截止前通过题目提交接口作答同样不返回正确答案，题集中没有的题目不能提交
+	submitURL := "/problem/submit/" + strconv.Itoa(initProblemType[1].ID)
+	var submitted api.ProblemSubmitResponse
+	code = Post(submitURL, member.Token, &api.ProblemSubmitRequest{Answer: "wrong"}, &submitted)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, submitted.IsCorrect, false)
+	assert.Equal(t, submitted.CorrectAnswer, "")
+	code = Post(submitURL, admin.Token, &api.ProblemSubmitRequest{Answer: "wrong"}, &submitted)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, submitted.CorrectAnswer, "problem2_answer")
+	code = Post(submitURL, member.Token, &api.ProblemSubmitRequest{
+		Answer:       "wrong",
+		ProblemSetId: initProblemSet[0].ID,
+	}, &submitted)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 截止前提交不返回正确答案，超过次数后不能再提交
+	id := strconv.Itoa(assignment.ID)
+	var submission api.GroupAssignmentSubmissionResponse
+	code = Post("/group_assignment/submit/"+id, member.Token, &api.GroupAssignmentSubmitRequest{
+		Answers:   []api.AssignmentAnswer{{ProblemId: initProblemType[1].ID, Answer: "problem2_answer"}},
+		TimeSpent: 60,
+	}, &submission)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, submission.Score, 100)
+	assert.Equal(t, submission.Results[0].IsCorrect, true)
+	assert.Equal(t, submission.Results[0].CorrectAnswer, (*string)(nil))
+	var result interface{}
+	code = Post("/group_assignment/submit/"+id, member.Token, &api.GroupAssignmentSubmitRequest{
+		Answers: []api.AssignmentAnswer{},
+	}, &result)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	code = Get("/group_assignment/pending", member.Token, nil, &pending)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, pending.TotalCount, 0)
+	code = Get(answerURL, member.Token, nil, &answer)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// 管理员查看每个成员的完成情况
+	var matrix api.GroupAssignmentMatrixResponse
+	code = Get("/group_assignment/matrix/"+id, member.Token, nil, &matrix)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Get("/group_assignment/matrix/"+id, admin.Token, nil, &matrix)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(matrix.Members), 2)
+	for _, row := range matrix.Members {
+		if row.UserInfo.UserId == 1 {
+			assert.Equal(t, row.Status, api.AssignmentCompleted)
+			assert.Equal(t, *row.BestScore, 100)
+			assert.Equal(t, row.TimeSpent, 0)
+		} else {
+			assert.Equal(t, row.Status, api.AssignmentPending)
+		}
+	}
+	code = Get("/group_assignment/export/"+id, admin.Token, nil, &result)
+	assert.Equal(t, code, http.StatusOK)
+}
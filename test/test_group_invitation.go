@@ -0,0 +1,101 @@
+package test
+
+import (
+	"bytes"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func testGroupInvitation(t *testing.T) {
+	tokens := loginUsers(t, 5, 6, 7)
+
+	var group api.GroupResponse
+	code := Post("/group/create", tokens[5], &api.GroupCreateRequest{
+		Name:        "invitation group",
+		Description: "invitation group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 只能使用一次、无需审核的邀请码
+	var invitation api.GroupInvitationResponse
+	code = Post("/group_invitation/create", tokens[6], &api.GroupInvitationCreateRequest{
+		GroupId: group.Id,
+	}, &invitation)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/group_invitation/create", tokens[5], &api.GroupInvitationCreateRequest{
+		GroupId:     group.Id,
+		MaxUses:     1,
+		AutoApprove: true,
+	}, &invitation)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, invitation.JoinURL, "kayak://group/join?code="+invitation.Code)
+
+	var join api.JoinGroupResponse
+	code = Post("/group/join", tokens[6], &api.JoinGroupRequest{Code: invitation.Code}, &join)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, join.Status, api.JoinGroupJoined)
+	var logs api.AllAuditLogResponse
+	code = Get("/admin/audit_log/all", adminSession(t), map[string][]string{
+		"group_id": {strconv.Itoa(group.Id)}, "action": {api.AuditActionMemberJoin},
+	}, &logs)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, logs.TotalCount, 1)
+	assert.Equal(t, logs.AuditLogs[0].TargetId, 6)
+	code = Post("/group/join", tokens[6], &api.JoinGroupRequest{Code: invitation.Code}, &join)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/group/join", tokens[7], &api.JoinGroupRequest{Code: invitation.Code}, &join)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 需要审核的邀请码提交入组申请，重新生成后旧邀请码失效
+	code = Post("/group_invitation/create", tokens[5], &api.GroupInvitationCreateRequest{
+		GroupId: group.Id,
+	}, &invitation)
+	assert.Equal(t, code, http.StatusOK)
+	oldCode := invitation.Code
+	id := strconv.Itoa(invitation.ID)
+	code = Put("/group_invitation/regenerate/"+id, tokens[6], nil, &invitation)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Put("/group_invitation/regenerate/"+id, tokens[5], nil, &invitation)
+	assert.Equal(t, code, http.StatusOK)
+	assert.NotEqual(t, invitation.Code, oldCode)
+	code = Post("/group/join", tokens[7], &api.JoinGroupRequest{Code: oldCode}, &join)
+	assert.Equal(t, code, http.StatusNotFound)
+	code = Post("/group/join", tokens[7], &api.JoinGroupRequest{Code: invitation.Code}, &join)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, join.Status, api.JoinGroupPending)
+	var application api.GroupApplicationResponse
+	code = Get("/group/application/"+strconv.Itoa(group.Id), tokens[5], nil, &application)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, application.TotalCount, 1)
+
+	// 二维码为 PNG 图片
+	req, _ := http.NewRequest("GET", "/group_invitation/qrcode/"+strconv.Itoa(invitation.ID), nil)
+	req.Header.Add(global.TokenHeader, tokens[5])
+	w := httptest.NewRecorder()
+	global.Router.ServeHTTP(w, req)
+	assert.Equal(t, w.Code, http.StatusOK)
+	assert.Equal(t, bytes.HasPrefix(w.Body.Bytes(), []byte("\x89PNG")), true)
+
+	code = Delete("/group_invitation/revoke/"+strconv.Itoa(invitation.ID), tokens[5], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var all api.AllGroupInvitationResponse
+	code = Get("/group_invitation/all", tokens[5], map[string][]string{"group_id": {strconv.Itoa(group.Id)}}, &all)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, all.TotalCount, 3)
+	for _, item := range all.Invitations {
+		assert.Equal(t, item.Revoked, item.MaxUses == 0)
+	}
+
+	// 过期的邀请码不能使用
+	_, err := global.Database.Exec(`UPDATE group_invitation SET expires_at = $1, revoked = false WHERE id = $2`,
+		time.Now().Add(-time.Hour), invitation.ID)
+	assert.Equal(t, err, nil)
+	code = Post("/group/join", tokens[6], &api.JoinGroupRequest{Code: invitation.Code}, &join)
+	assert.Equal(t, code, http.StatusBadRequest)
+}
@@ -0,0 +1,111 @@
+package test
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testGroupPolicy(t *testing.T) {
+	tokens := loginUsers(t, 1, 2, 3, 4, 5, 8)
+
+	var group api.GroupResponse
+	code := Post("/group/create", tokens[8], &api.GroupCreateRequest{
+		Name:        "policy group",
+		Description: "policy group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, group.JoinPolicy, api.GroupJoinApproval)
+	id := strconv.Itoa(group.Id)
+
+	policy := api.GroupJoinInviteOnly
+	code = Put("/group/update/"+id, tokens[8], &api.UpdateGroupInfoRequest{JoinPolicy: &policy}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/group/apply", tokens[1], &api.ApplyToJoinGroupRequest{GroupId: group.Id}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// 需要审核时必须回答所有入组问题
+	policy = api.GroupJoinApproval
+	questions := []string{"why?"}
+	code = Put("/group/update/"+id, tokens[8], &api.UpdateGroupInfoRequest{
+		JoinPolicy:     &policy,
+		EntryQuestions: &questions,
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/group/apply", tokens[1], &api.ApplyToJoinGroupRequest{GroupId: group.Id}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	for _, userId := range []int{1, 2, 3} {
+		code = Post("/group/apply", tokens[userId], &api.ApplyToJoinGroupRequest{
+			GroupId: group.Id,
+			Answers: []string{"to study"},
+		}, nil)
+		assert.Equal(t, code, http.StatusOK)
+	}
+	var applications api.GroupApplicationResponse
+	code = Get("/group/application/"+id, tokens[8], nil, &applications)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, applications.TotalCount, 3)
+	assert.Equal(t, applications.Applications[0].Answers[0].Question, "why?")
+	assert.Equal(t, applications.Applications[0].Answers[0].Answer, "to study")
+
+	// 批量通过用户1和2的申请，没有权限时跳过
+	var ids []int
+	var userThreeApplication int
+	for _, application := range applications.Applications {
+		if application.Application.UserId == 3 {
+			userThreeApplication = application.Application.ID
+		} else {
+			ids = append(ids, application.Application.ID)
+		}
+	}
+	var batch api.BatchGroupApplicationResponse
+	code = Put("/group/application/batch", tokens[1], &api.BatchGroupApplicationRequest{
+		ApplicationIds: ids,
+		Status:         api.Accepted,
+	}, &batch)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, batch.Skipped, 2)
+	code = Put("/group/application/batch", tokens[8], &api.BatchGroupApplicationRequest{
+		ApplicationIds: ids,
+		Status:         api.Accepted,
+	}, &batch)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, batch.Handled, 2)
+	var users api.AllUserResponse
+	code = Get("/group/all_user/"+id, tokens[8], nil, &users)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, users.TotalCount, 3)
+
+	// 超过有效天数的申请被自动拒绝
+	_, err := global.Database.Exec(`UPDATE group_application SET created_at = now() - interval '8 days' WHERE id = $1`,
+		userThreeApplication)
+	assert.Equal(t, err, nil)
+	_, err = api.ExpireGroupApplications(context.Background())
+	assert.Equal(t, err, nil)
+	var status int
+	err = global.Database.Get(&status, `SELECT status FROM group_application WHERE id = $1`, userThreeApplication)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, status, api.Rejected)
+
+	policy = api.GroupJoinOpen
+	code = Put("/group/update/"+id, tokens[8], &api.UpdateGroupInfoRequest{JoinPolicy: &policy}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/group/apply", tokens[4], &api.ApplyToJoinGroupRequest{GroupId: group.Id}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/group/all_user/"+id, tokens[8], nil, &users)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, users.TotalCount, 4)
+
+	policy = api.GroupJoinClosed
+	code = Put("/group/update/"+id, tokens[8], &api.UpdateGroupInfoRequest{JoinPolicy: &policy}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/group/apply", tokens[5], &api.ApplyToJoinGroupRequest{GroupId: group.Id}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	policy = "unknown"
+	code = Put("/group/update/"+id, tokens[8], &api.UpdateGroupInfoRequest{JoinPolicy: &policy}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+}
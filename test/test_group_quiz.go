@@ -0,0 +1,109 @@
+package test
+
+import (
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"golang.org/x/net/websocket"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func testGroupQuiz(t *testing.T) {
+	host := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{
+		UserName: initUser[6].Name,
+		Password: initUser[6].Password,
+	}, &host)
+	assert.Equal(t, code, http.StatusOK)
+	player := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{
+		UserName: initUser[7].Name,
+		Password: initUser[7].Password,
+	}, &player)
+	assert.Equal(t, code, http.StatusOK)
+
+	var group api.GroupResponse
+	code = Post("/group/create", host.Token, &api.GroupCreateRequest{
+		Name:        "quiz group",
+		Description: "quiz group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 8, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+
+	// 只有小组管理员可以创建竞赛，题集7中只有一道答案为D的选择题
+	request := api.GroupQuizCreateRequest{
+		GroupId:         group.Id,
+		ProblemSetId:    initProblemSet[6].ID,
+		QuestionSeconds: 10,
+	}
+	var quiz api.GroupQuizResponse
+	code = Post("/group_quiz/create", player.Token, &request, &quiz)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/group_quiz/create", host.Token, &request, &quiz)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, quiz.Status, api.GroupQuizWaiting)
+	assert.Equal(t, quiz.QuestionCount, 1)
+
+	server := httptest.NewServer(global.Router)
+	defer server.Close()
+	config, _ := websocket.NewConfig("ws"+strings.TrimPrefix(server.URL, "http")+
+		"/group_quiz/ws/"+strconv.Itoa(quiz.ID), server.URL)
+	config.Header.Set(global.TokenHeader, player.Token)
+	conn, err := websocket.DialConfig(config)
+	assert.Equal(t, err, nil)
+	defer conn.Close()
+	_ = conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+	var event utils.PushEvent
+	assert.Equal(t, websocket.JSON.Receive(conn, &event), nil)
+	assert.Equal(t, event.Type, api.GroupQuizJoinedEvent)
+
+	var fill, result interface{}
+	code = Post("/group_quiz/start/"+strconv.Itoa(quiz.ID), player.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/group_quiz/start/"+strconv.Itoa(quiz.ID), host.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+
+	events := make(map[string]utils.PushEvent)
+	for event.Type != api.GroupQuizFinishedEvent {
+		assert.Equal(t, websocket.JSON.Receive(conn, &event), nil)
+		events[event.Type] = event
+		if event.Type == api.GroupQuizQuestionEvent {
+			var question api.GroupQuizQuestion
+			assert.Equal(t, json.Unmarshal(event.Data, &question), nil)
+			assert.Equal(t, question.ProblemId, initProblemType[6].ID)
+			assert.Equal(t, len(question.Choices), 4)
+			assert.Equal(t, websocket.JSON.Send(conn, &api.GroupQuizAnswerRequest{
+				ProblemId: question.ProblemId,
+				Answer:    "d",
+			}), nil)
+		}
+	}
+	var answer api.GroupQuizAnswerResult
+	assert.Equal(t, json.Unmarshal(events[api.GroupQuizAnswerEvent].Data, &answer), nil)
+	assert.Equal(t, answer.IsCorrect, true)
+	assert.Equal(t, answer.Points > 500, true)
+	var leaderboard api.GroupQuizLeaderboardResponse
+	assert.Equal(t, json.Unmarshal(events[api.GroupQuizLeaderboardEvent].Data, &leaderboard), nil)
+	assert.Equal(t, leaderboard.Answer, "D")
+	assert.Equal(t, leaderboard.Leaderboard[0].UserInfo.UserId, 8)
+
+	// 最终成绩保存在小组的竞赛记录中
+	var history api.AllGroupQuizResponse
+	code = Get("/group_quiz/all", player.Token, map[string][]string{"group_id": {strconv.Itoa(group.Id)}}, &history)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, history.TotalCount, 1)
+	assert.Equal(t, history.Quizzes[0].Status, api.GroupQuizFinished)
+	assert.Equal(t, len(history.Quizzes[0].Results), 1)
+	assert.Equal(t, history.Quizzes[0].Results[0].Score, answer.Score)
+	assert.Equal(t, history.Quizzes[0].Results[0].CorrectCount, 1)
+}
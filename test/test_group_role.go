@@ -0,0 +1,67 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testGroupRole(t *testing.T) {
+	tokens := loginUsers(t, 2, 3, 8)
+
+	var group api.GroupResponse
+	code := Post("/group/create", tokens[2], &api.GroupCreateRequest{
+		Name:        "role group",
+		Description: "role group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 3, false, false, now()), ($1, 8, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+	id := strconv.Itoa(group.Id)
+
+	// 只有组长可以设置管理员
+	code = Put("/group/admin/"+id, tokens[3], &api.GroupAdminRequest{UserId: 8, IsAdmin: true}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Put("/group/admin/"+id, tokens[2], &api.GroupAdminRequest{UserId: 3, IsAdmin: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Put("/group/admin/"+id, tokens[2], &api.GroupAdminRequest{UserId: 2, IsAdmin: false}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	var users api.AllUserResponse
+	code = Get("/group/all_user/"+id, tokens[8], nil, &users)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, users.OwnerId, 2)
+	assert.Equal(t, users.AdminIds, []int{3})
+
+	// 管理员不能移除组长，组长不能直接退出
+	code = Delete("/group/remove/"+id+"?user_id=2", tokens[3], nil, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Delete("/group/quit/"+id, tokens[2], nil, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// 转让后原组长保留管理员身份，新组长可以移除原组长
+	code = Put("/group/transfer/"+id, tokens[3], &api.GroupTransferRequest{UserId: 8}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Put("/group/transfer/"+id, tokens[2], &api.GroupTransferRequest{UserId: 3}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/group/all_user/"+id, tokens[8], nil, &users)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, users.OwnerId, 3)
+	assert.Equal(t, users.AdminIds, []int{2})
+	code = Delete("/group/remove/"+id+"?user_id=3", tokens[2], nil, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Delete("/group/remove/"+id+"?user_id=8", tokens[2], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Delete("/group/remove/"+id+"?user_id=8", tokens[2], nil, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+	code = Delete("/group/quit/"+id, tokens[2], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	code = Delete("/group/delete/"+id, tokens[2], nil, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Delete("/group/delete/"+id, tokens[3], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+}
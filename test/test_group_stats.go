@@ -0,0 +1,87 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testGroupStats(t *testing.T) {
+	tokens := loginUsers(t, 6)
+	// 成员和题目单独创建，不修改其他并行测试使用的作答记录和错题
+	activeId := createLoginUser(t, "statsactive")
+	idleId := createLoginUser(t, "statsidle")
+	res := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{UserName: "statsactive", Password: "statsactive"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	activeToken := res.Token
+	var problemId int
+	err := global.Database.Get(&problemId, `INSERT INTO problem_type (description, created_at, updated_at, user_id,
+		problem_type_id, is_public) VALUES ('stats problem', now(), now(), 6, $1, false) RETURNING id`, api.BlankProblemType)
+	assert.Equal(t, err, nil)
+	_, err = global.Database.Exec(`INSERT INTO problem_answer (id, answer) VALUES ($1, 'stats answer')`, problemId)
+	assert.Equal(t, err, nil)
+
+	var group api.GroupResponse
+	code = Post("/group/create", tokens[6], &api.GroupCreateRequest{
+		Name:        "stats group",
+		Description: "stats group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err = global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, $2, false, false, now()), ($1, $3, false, false, now())`, group.Id, activeId, idleId)
+	assert.Equal(t, err, nil)
+
+	// 小组题集中只有一道题，活跃成员作答错误一次并在小组中发起讨论，另一个成员没有任何活动
+	var problemSetId int
+	err = global.Database.Get(&problemSetId, `INSERT INTO problem_set (name, description, created_at, updated_at, user_id,
+		is_public, group_id) VALUES ('stats set', 'stats set', now(), now(), 6, false, $1) RETURNING id`, group.Id)
+	assert.Equal(t, err, nil)
+	_, err = global.Database.Exec(`INSERT INTO problem_in_problem_set (problem_set_id, problem_id) VALUES ($1, $2)`, problemSetId, problemId)
+	assert.Equal(t, err, nil)
+	var result api.ProblemSubmitResponse
+	code = Post("/problem/submit/"+strconv.Itoa(problemId), activeToken, &api.ProblemSubmitRequest{
+		Answer:       "wrong",
+		ProblemSetId: problemSetId,
+	}, &result)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.IsCorrect, false)
+	_, err = global.Database.Exec(`INSERT INTO user_wrong_record (user_id, problem_id, created_at, updated_at, count)
+		VALUES ($1, $2, now(), now(), 3) ON CONFLICT (problem_id, user_id) DO UPDATE SET count = 3`, activeId, problemId)
+	assert.Equal(t, err, nil)
+	_, err = global.Database.Exec(`INSERT INTO discussion (title, content, created_at, updated_at, user_id, group_id, is_public)
+		VALUES ('stats', 'stats', now(), now(), $1, $2, true)`, activeId, group.Id)
+	assert.Equal(t, err, nil)
+
+	url := "/group/stats/" + strconv.Itoa(group.Id)
+	var stats api.GroupStatsResponse
+	code = Get(url, activeToken, nil, &stats)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Get(url, tokens[6], map[string][]string{"weeks": {"100"}}, &stats)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Get(url, tokens[6], map[string][]string{"weeks": {"4"}}, &stats)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, stats.MemberCount, 3)
+	assert.Equal(t, stats.ActiveMembers, 1)
+	assert.Equal(t, stats.ProblemCount, 1)
+	assert.Equal(t, len(stats.MemberGrowth), 4)
+	assert.Equal(t, stats.MemberGrowth[3].Total, 3)
+	assert.Equal(t, len(stats.WeeklyActivity), 4)
+	assert.Equal(t, stats.WeeklyActivity[3].Discussions, 1)
+	assert.Equal(t, stats.WeeklyActivity[3].ActiveMembers, 1)
+
+	assert.Equal(t, len(stats.ProblemSets), 1)
+	assert.Equal(t, stats.ProblemSets[0].Attempts, 1)
+	assert.Equal(t, stats.ProblemSets[0].Accuracy, float64(0))
+	assert.Equal(t, stats.ProblemSets[0].WrongRecords, 1)
+	assert.Equal(t, len(stats.HardestProblems), 1)
+	assert.Equal(t, stats.HardestProblems[0].ProblemId, problemId)
+	assert.Equal(t, stats.HardestProblems[0].WrongCount, 3)
+
+	assert.Equal(t, len(stats.BehindMembers), 1)
+	assert.Equal(t, stats.BehindMembers[0].UserInfo.UserId, idleId)
+	assert.Equal(t, stats.BehindMembers[0].Reason, "inactive")
+}
@@ -0,0 +1,135 @@
+package test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// newFakeIdentityServer 模拟微信的 jscode2session 接口和一个 OIDC 服务，授权码 bad 表示无效的授权码
+func newFakeIdentityServer() *httptest.Server {
+	mux := http.NewServeMux()
+	server := httptest.NewServer(mux)
+	mux.HandleFunc("/sns/jscode2session", func(w http.ResponseWriter, r *http.Request) {
+		code := r.URL.Query().Get("js_code")
+		if code == "bad" {
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"errcode": 40029, "errmsg": "invalid code"})
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"openid": "wx-" + code, "session_key": "key"})
+	})
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"issuer":         server.URL,
+			"token_endpoint": server.URL + "/token",
+		})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		code := r.PostFormValue("code")
+		if code == "bad" || r.PostFormValue("client_secret") != "kayak-secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_ = json.NewEncoder(w).Encode(map[string]interface{}{"error": "invalid_grant"})
+			return
+		}
+		claims, _ := json.Marshal(map[string]interface{}{
+			"iss":  server.URL,
+			"sub":  "oidc-" + code,
+			"aud":  []string{r.PostFormValue("client_id")},
+			"exp":  time.Now().Add(5 * time.Minute).Unix(),
+			"name": code,
+		})
+		idToken := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`)) + "." +
+			base64.RawURLEncoding.EncodeToString(claims) + ".sig"
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"access_token": "access", "id_token": idToken})
+	})
+	return server
+}
+
+func testIdentity(t *testing.T) {
+	server := newFakeIdentityServer()
+	defer server.Close()
+	utils.RegisterIdentityProvider(&utils.WeixinIdentityProvider{
+		AppID: "kayak", AppSecret: "kayak-secret", Endpoint: server.URL + "/sns/jscode2session",
+	})
+	utils.RegisterIdentityProvider(&utils.OIDCIdentityProvider{
+		ProviderName: "fake", Issuer: server.URL, ClientID: "kayak", ClientSecret: "kayak-secret",
+	})
+	getUserId := func(token string) int {
+		var userInfo api.UserInfoResponse
+		code := Get("/user/info", token, nil, &userInfo)
+		assert.Equal(t, code, http.StatusOK)
+		return userInfo.UserId
+	}
+	getIdentities := func(token string) api.AllIdentityResponse {
+		var identities api.AllIdentityResponse
+		code := Get("/user/identity/all", token, nil, &identities)
+		assert.Equal(t, code, http.StatusOK)
+		return identities
+	}
+
+	code := Post("/oauth/login/unknown", "", &api.OAuthLoginRequest{Code: "alice"}, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+	code = Post("/oauth/login/fake", "", &api.OAuthLoginRequest{Code: "bad"}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 第一次登录自动注册，之后登录到同一个用户
+	var res api.OAuthLoginResponse
+	code = Post("/oauth/login/fake", "", &api.OAuthLoginRequest{Code: "alice", RedirectURI: "kayak://callback"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, res.Code, 201)
+	token := res.Token
+	userId := getUserId(token)
+	code = Post("/oauth/login/fake", "", &api.OAuthLoginRequest{Code: "alice"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, getUserId(res.Token), userId)
+	identities := getIdentities(token)
+	assert.Equal(t, identities.TotalCount, 1)
+	assert.Equal(t, identities.Identities[0].Provider, "fake")
+	assert.Equal(t, identities.Identities[0].Subject, "oidc-alice")
+
+	// 没有密码的用户不能解绑最后一个第三方账号
+	code = Delete("/user/identity/unbind/fake", token, nil, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 旧的微信接口也走同一套绑定
+	code = Post("/weixin-bind", "", &api.WeixinLoginInfo{Code: "alice"}, nil)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code = Post("/weixin-bind", token, &api.WeixinLoginInfo{Code: "bad"}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Post("/weixin-bind", token, &api.WeixinLoginInfo{Code: "alice"}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/user/identity/bind/weixin", token, &api.IdentityBindRequest{Code: "alice2"}, nil)
+	assert.Equal(t, code, http.StatusConflict)
+	assert.Equal(t, getIdentities(token).TotalCount, 2)
+	code = Post("/weixin-login", "", &api.WeixinLoginInfo{Code: "alice"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, getUserId(res.Token), userId)
+	code = Delete("/user/identity/unbind/fake", token, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 第三方账号只能绑定到一个用户
+	createLoginUser(t, "linked")
+	code = Post("/login", "", &api.LoginInfo{UserName: "linked", Password: "linked"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	linkedToken := res.Token
+	code = Post("/user/identity/bind/weixin", linkedToken, &api.IdentityBindRequest{Code: "alice"}, nil)
+	assert.Equal(t, code, http.StatusConflict)
+	code = Post("/user/identity/bind/fake", linkedToken, &api.IdentityBindRequest{Code: "alice"}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/oauth/login/fake", "", &api.OAuthLoginRequest{Code: "alice"}, &res)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, res.Code, 200)
+	assert.Equal(t, getUserId(res.Token), getUserId(linkedToken))
+
+	// 有密码的用户可以解绑所有第三方账号
+	code = Delete("/user/identity/unbind/fake", linkedToken, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Delete("/user/identity/unbind/fake", linkedToken, nil, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+}
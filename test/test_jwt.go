@@ -0,0 +1,88 @@
+package test
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testJWT 切换了全局的登录凭证模式，需要单独放在一个阶段中运行
+func testJWT(t *testing.T) {
+	assert.Equal(t, global.InitAuth(global.AuthModeJWT, "kayak-test-secret", 0), nil)
+	defer func() {
+		_ = global.InitAuth(global.AuthModeOpaque, "", 0)
+	}()
+	createLoginUser(t, "stateless")
+	login := func() api.LoginResponse {
+		res := api.LoginResponse{}
+		code := Post("/login", "", &api.LoginInfo{UserName: "stateless", Password: "stateless"}, &res)
+		assert.Equal(t, code, http.StatusOK)
+		return res
+	}
+	isValid := func(token string) bool {
+		var userInfo api.UserInfoResponse
+		return Get("/user/info", token, nil, &userInfo) == http.StatusOK
+	}
+
+	res := login()
+	assert.Equal(t, strings.Count(res.Token, "."), 2)
+	assert.NotEqual(t, res.RefreshToken, "")
+	assert.Equal(t, res.ExpiresIn, int(15*time.Minute/time.Second))
+	assert.Equal(t, isValid(res.Token), true)
+	assert.Equal(t, isValid(res.Token+"x"), false)
+
+	// 过期的访问令牌不能使用
+	claims, err := global.ParseAccessToken(res.Token)
+	assert.Equal(t, err, nil)
+	global.AccessTokenExpiration = -time.Minute
+	expired, err := global.CreateAccessToken(&global.Session{
+		ID: claims.SessionId, Role: claims.Role, UserId: claims.UserId(),
+	})
+	global.AccessTokenExpiration = 15 * time.Minute
+	assert.Equal(t, err, nil)
+	assert.Equal(t, isValid(expired), false)
+
+	// jwt 模式下不接受会话 token，刷新令牌和令牌中的会话ID也不能当作会话 token 使用
+	assert.Equal(t, isValid(res.RefreshToken), false)
+	assert.Equal(t, isValid(claims.SessionId), false)
+	assert.Equal(t, isValid(fmt.Sprintf("%s@%s", claims.SessionId, claims.Subject)), false)
+	sessionToken, err := global.CreateSession(context.Background(), &global.Session{Role: global.USER, UserId: claims.UserId()})
+	assert.Equal(t, err, nil)
+	assert.Equal(t, isValid(sessionToken), false)
+
+	// 刷新令牌每次使用后轮换
+	var refreshed api.LoginResponse
+	code := Post("/refresh", "", &api.RefreshTokenRequest{RefreshToken: res.RefreshToken}, &refreshed)
+	assert.Equal(t, code, http.StatusOK)
+	assert.NotEqual(t, refreshed.RefreshToken, res.RefreshToken)
+	assert.Equal(t, isValid(refreshed.Token), true)
+
+	// 旧的刷新令牌被再次使用时注销整个会话，新的刷新令牌也随之失效
+	code = Post("/refresh", "", &api.RefreshTokenRequest{RefreshToken: res.RefreshToken}, nil)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code = Post("/refresh", "", &api.RefreshTokenRequest{RefreshToken: refreshed.RefreshToken}, nil)
+	assert.Equal(t, code, http.StatusUnauthorized)
+
+	// 刷新时按数据库中的角色签发访问令牌
+	res = login()
+	_, err = global.Database.Exec(`UPDATE "user" SET role = $1 WHERE id = $2`, global.ADMIN, claims.UserId())
+	assert.Equal(t, err, nil)
+	code = Post("/refresh", "", &api.RefreshTokenRequest{RefreshToken: res.RefreshToken}, &refreshed)
+	assert.Equal(t, code, http.StatusOK)
+	claims, err = global.ParseAccessToken(refreshed.Token)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, claims.Role, global.ADMIN)
+
+	// 退出登录后刷新令牌失效
+	res = login()
+	code = Get("/logout", res.Token, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/refresh", "", &api.RefreshTokenRequest{RefreshToken: res.RefreshToken}, nil)
+	assert.Equal(t, code, http.StatusUnauthorized)
+}
@@ -0,0 +1,110 @@
+package test
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testLeaderboard(t *testing.T) {
+	owner := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{
+		UserName: initUser[2].Name,
+		Password: initUser[2].Password,
+	}, &owner)
+	assert.Equal(t, code, http.StatusOK)
+	member := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{
+		UserName: initUser[3].Name,
+		Password: initUser[3].Password,
+	}, &member)
+	assert.Equal(t, code, http.StatusOK)
+
+	var group api.GroupResponse
+	code = Post("/group/create", owner.Token, &api.GroupCreateRequest{
+		Name:        "leaderboard group",
+		Description: "leaderboard group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 4, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+	// 小组排行只统计小组题集中的题目，把题目2放进小组的题集
+	var problemSetId int
+	err = global.Database.Get(&problemSetId, `INSERT INTO problem_set (name, description, created_at, updated_at,
+		user_id, is_public, group_id) VALUES ('leaderboard', 'leaderboard', now(), now(), 3, false, $1) RETURNING id`, group.Id)
+	assert.Equal(t, err, nil)
+	_, err = global.Database.Exec(`INSERT INTO problem_in_problem_set (problem_set_id, problem_id) VALUES ($1, 2)`,
+		problemSetId)
+	assert.Equal(t, err, nil)
+
+	// 题目2是答案为 problem2_answer 的公开填空题，题目1不在小组题集中，答案为 A
+	var result api.ProblemSubmitResponse
+	code = Post("/problem/submit/2", owner.Token, &api.ProblemSubmitRequest{Answer: "problem2_answer"}, &result)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.IsCorrect, true)
+	code = Post("/problem/submit/2", owner.Token, &api.ProblemSubmitRequest{Answer: "problem2_answer"}, &result)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/problem/submit/2", member.Token, &api.ProblemSubmitRequest{Answer: "wrong"}, &result)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.IsCorrect, false)
+	assert.Equal(t, result.CorrectAnswer, "problem2_answer")
+	code = Post("/problem/submit/7", member.Token, &api.ProblemSubmitRequest{Answer: "D"}, &result)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/problem/submit/1", member.Token, &api.ProblemSubmitRequest{Answer: "A"}, &result)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, result.IsCorrect, true)
+
+	// 同一道题做对多次只计一次，小组题集以外的题目不计入小组排行
+	var leaderboard api.LeaderboardResponse
+	url := "/leaderboard/group/" + strconv.Itoa(group.Id)
+	code = Get(url, owner.Token, map[string][]string{"period": {"all"}}, &leaderboard)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, leaderboard.TotalCount, 1)
+	assert.Equal(t, leaderboard.Items[0].UserInfo.UserId, 3)
+	assert.Equal(t, leaderboard.Items[0].Value, float64(1))
+	assert.Equal(t, leaderboard.Items[0].Rank, 1)
+
+	code = Get(url, owner.Token, map[string][]string{"metric": {"streak"}}, &leaderboard)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, leaderboard.TotalCount, 2)
+	assert.Equal(t, leaderboard.Items[0].Value, float64(1))
+	assert.Equal(t, leaderboard.Items[1].Rank, 1)
+
+	code = Get(url, owner.Token, map[string][]string{"metric": {"unknown"}}, &leaderboard)
+	assert.Equal(t, code, http.StatusBadRequest)
+	outsider := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{
+		UserName: initUser[4].Name,
+		Password: initUser[4].Password,
+	}, &outsider)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get(url, outsider.Token, nil, &leaderboard)
+	assert.Equal(t, code, http.StatusForbidden)
+
+	// 隐藏后不再出现在任何排行榜中
+	var privacy api.LeaderboardPrivacyResponse
+	code = Put("/leaderboard/privacy", owner.Token, &api.LeaderboardPrivacyRequest{Hidden: true}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/leaderboard/privacy", owner.Token, nil, &privacy)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, privacy.Hidden, true)
+	code = Get(url, member.Token, map[string][]string{"period": {"all"}}, &leaderboard)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, leaderboard.TotalCount, 0)
+	code = Put("/leaderboard/privacy", owner.Token, &api.LeaderboardPrivacyRequest{Hidden: false}, nil)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 重新计算后结果不变
+	code = Post("/leaderboard/rebuild", owner.Token, nil, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	assert.Equal(t, api.RebuildLeaderboards(context.Background()), nil)
+	code = Get(url, member.Token, map[string][]string{"period": {"all"}}, &leaderboard)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, leaderboard.TotalCount, 1)
+	assert.Equal(t, leaderboard.Items[0].Value, float64(1))
+}
@@ -0,0 +1,131 @@
+package test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+// loginFrom 从指定IP登录，其他测试的请求没有来源地址，这样失败计数不会互相影响
+func loginFrom(ip string, info *api.LoginInfo) int {
+	body, _ := json.Marshal(info)
+	req, _ := http.NewRequest("POST", "/login", bytes.NewReader(body))
+	req.RemoteAddr = ip + ":12345"
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "kayak-test")
+	w := httptest.NewRecorder()
+	global.Router.ServeHTTP(w, req)
+	return w.Code
+}
+
+func solveCaptcha(t *testing.T) (string, string) {
+	var challenge utils.CaptchaChallenge
+	code := Get("/captcha", "", nil, &challenge)
+	assert.Equal(t, code, http.StatusOK)
+	var a, b int
+	_, err := fmt.Sscanf(challenge.Question, "%d + %d = ?", &a, &b)
+	assert.Equal(t, err, nil)
+	return challenge.ID, fmt.Sprint(a + b)
+}
+
+func createLoginUser(t *testing.T, name string) int {
+	password, err := utils.EncryptPassword(name)
+	assert.Equal(t, err, nil)
+	var userId int
+	err = global.Database.Get(&userId, `INSERT INTO "user" (name, created_at, password, nick_name, email)
+		VALUES ($1, now(), $2, $1, $1 || '@boat4study.com') RETURNING id`, name, password)
+	assert.Equal(t, err, nil)
+	return userId
+}
+
+func getLoginHistory(t *testing.T, userId int) api.AllLoginHistoryResponse {
+	token, err := global.CreateSession(context.Background(), &global.Session{Role: global.USER, UserId: userId})
+	assert.Equal(t, err, nil)
+	var history api.AllLoginHistoryResponse
+	code := Get("/user/login_history", token, nil, &history)
+	assert.Equal(t, code, http.StatusOK)
+	return history
+}
+
+func testLoginGuard(t *testing.T) {
+	userId := createLoginUser(t, "throttled")
+	wrong := &api.LoginInfo{UserName: "throttled", Password: "wrong"}
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, loginFrom("10.47.0.1", wrong), http.StatusBadRequest)
+	}
+
+	// 连续失败后需要验证码，验证码错误同样计入失败次数
+	right := &api.LoginInfo{UserName: "throttled", Password: "throttled"}
+	assert.Equal(t, loginFrom("10.47.0.1", right), http.StatusPreconditionRequired)
+	captchaId, _ := solveCaptcha(t)
+	assert.Equal(t, loginFrom("10.47.0.1", &api.LoginInfo{
+		UserName: "throttled", Password: "throttled", CaptchaId: captchaId, CaptchaAnswer: "-1",
+	}), http.StatusBadRequest)
+	captchaId, answer := solveCaptcha(t)
+	assert.Equal(t, loginFrom("10.47.0.1", &api.LoginInfo{
+		UserName: "throttled", Password: "wrong", CaptchaId: captchaId, CaptchaAnswer: answer,
+	}), http.StatusBadRequest)
+
+	// 达到锁定阈值后即使密码正确也不能登录
+	captchaId, answer = solveCaptcha(t)
+	assert.Equal(t, loginFrom("10.47.0.1", &api.LoginInfo{
+		UserName: "throttled", Password: "throttled", CaptchaId: captchaId, CaptchaAnswer: answer,
+	}), http.StatusTooManyRequests)
+
+	history := getLoginHistory(t, userId)
+	assert.Equal(t, history.TotalCount, 6)
+	assert.Equal(t, history.Items[0].Success, false)
+	assert.Equal(t, *history.Items[0].Reason, api.LoginFailLocked)
+	assert.Equal(t, *history.Items[1].Reason, api.LoginFailWrongPassword)
+	assert.Equal(t, *history.Items[2].Reason, api.LoginFailCaptcha)
+	assert.Equal(t, history.Items[0].IP, "10.47.0.1")
+	assert.Equal(t, history.Items[0].UserAgent, "kayak-test")
+
+	// 登录成功后失败次数清零
+	userId = createLoginUser(t, "recovered")
+	wrong = &api.LoginInfo{UserName: "recovered", Password: "wrong"}
+	right = &api.LoginInfo{UserName: "recovered", Password: "recovered"}
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, loginFrom("10.47.0.2", wrong), http.StatusBadRequest)
+	}
+	assert.Equal(t, loginFrom("10.47.0.2", right), http.StatusOK)
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, loginFrom("10.47.0.2", wrong), http.StatusBadRequest)
+	}
+	assert.Equal(t, loginFrom("10.47.0.2", right), http.StatusOK)
+	history = getLoginHistory(t, userId)
+	assert.Equal(t, history.TotalCount, 6)
+	assert.Equal(t, history.Items[0].Success, true)
+	assert.Equal(t, history.Items[0].Reason == nil, true)
+
+	// 并发的错误登录先计入失败次数再比较阈值，只有验证码阈值以内的请求会校验密码
+	createLoginUser(t, "concurrent")
+	wrong = &api.LoginInfo{UserName: "concurrent", Password: "wrong"}
+	codes := make(chan int, 10)
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes <- loginFrom("10.47.0.3", wrong)
+		}()
+	}
+	wg.Wait()
+	close(codes)
+	failed := 0
+	for code := range codes {
+		if code == http.StatusBadRequest {
+			failed++
+		}
+	}
+	assert.Equal(t, failed, 3)
+}
@@ -0,0 +1,79 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testNotification(t *testing.T) {
+	actor := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{
+		UserName: initUser[3].Name,
+		Password: initUser[3].Password,
+	}, &actor)
+	assert.Equal(t, code, http.StatusOK)
+	owner := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{
+		UserName: initUser[4].Name,
+		Password: initUser[4].Password,
+	}, &owner)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 点赞他人的笔记会通知笔记作者，重复点赞不会重复通知
+	noteId := strconv.Itoa(initNote[4].ID)
+	var fill, result interface{}
+	code = Post("/note/like/"+noteId, actor.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/note/like/"+noteId, actor.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+
+	var unread api.UnreadNotificationCountResponse
+	code = Get("/notification/unread_count", owner.Token, nil, &unread)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, unread.Count, 1)
+
+	var notifications api.AllNotificationResponse
+	code = Get("/notification/all", owner.Token, nil, &notifications)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, notifications.TotalCount, 1)
+	assert.Equal(t, notifications.Notifications[0].Type, api.NotificationNoteLike)
+	assert.Equal(t, notifications.Notifications[0].TargetId, initNote[4].ID)
+	assert.Equal(t, notifications.Notifications[0].ActorInfo.UserId, 4)
+
+	// 只能标记自己的通知
+	notificationId := strconv.Itoa(notifications.Notifications[0].ID)
+	code = Put("/notification/read/"+notificationId, actor.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusNotFound)
+	code = Put("/notification/read_all", owner.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/notification/unread_count", owner.Token, nil, &unread)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, unread.Count, 0)
+
+	// 屏蔽后不再收到该类通知
+	code = Put("/notification/mute", owner.Token, &api.NotificationMuteRequest{
+		Type: api.NotificationNoteLike,
+		Mute: true,
+	}, &result)
+	assert.Equal(t, code, http.StatusOK)
+	var mute api.NotificationMuteResponse
+	code = Get("/notification/mute", owner.Token, nil, &mute)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, mute.MutedTypes, []string{api.NotificationNoteLike})
+	code = Post("/note/unlike/"+noteId, actor.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/note/like/"+noteId, actor.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+	code = Get("/notification/unread_count", owner.Token, nil, &unread)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, unread.Count, 0)
+
+	code = Put("/notification/mute", owner.Token, &api.NotificationMuteRequest{
+		Type: "unknown",
+		Mute: true,
+	}, &result)
+	assert.Equal(t, code, http.StatusBadRequest)
+}
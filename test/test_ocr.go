@@ -0,0 +1,167 @@
+package test
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	ocr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/ocr/v20181119"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+const ocrSample = `一、选择题
+1. 下列哪个数是质数？
+A. 4    B. 7
+C. 9    D. 15
+[答案] B [解析] 7只能被1和它本身整除
+二、判断题
+2. 地球绕太阳公转。
+[答案] 正确
+`
+
+func testOCRProblem(t *testing.T) {
+	// 测试环境使用本地OCR实现，不依赖外部服务
+	assert.Equal(t, utils.InitOCR("local", 0), nil)
+	// 未知的OCR服务在启动时报错，而不是默认使用腾讯云
+	assert.NotEqual(t, utils.InitOCR("locl", 0), nil)
+	assert.Equal(t, utils.OCR.Name(), "local")
+
+	res := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{
+		UserName: initUser[2].Name,
+		Password: initUser[2].Password,
+	}, &res)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 原始结果保持腾讯云的返回格式，带有坐标，相同内容再次识别结果一致
+	var raw, cachedRaw ocr.GeneralAccurateOCRResponse
+	request := api.OCRRequest{ImageBase64: base64.StdEncoding.EncodeToString([]byte(ocrSample)), RawResult: true}
+	code = Post("/special/picture_ocr", res.Token, &request, &raw)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(raw.Response.TextDetections), 8)
+	code = Post("/special/picture_ocr", res.Token, &request, &cachedRaw)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, cachedRaw.ToJsonString(), raw.ToJsonString())
+	var lines []utils.OCRLine
+	for _, item := range raw.Response.TextDetections {
+		lines = append(lines, utils.OCRLine{
+			Text:   *item.DetectedText,
+			X:      int(*item.ItemPolygon.X),
+			Y:      int(*item.ItemPolygon.Y),
+			Width:  int(*item.ItemPolygon.Width),
+			Height: int(*item.ItemPolygon.Height),
+		})
+	}
+	assert.Equal(t, lines[1].Text, "1. 下列哪个数是质数？")
+
+	// 根据文本行重建题目并写入题集
+	drafts := api.BuildOCRDraftProblems(lines)
+	assert.Equal(t, len(drafts), 2)
+	assert.Equal(t, drafts[0].ProblemType, api.ChoiceProblemType)
+	assert.Equal(t, len(drafts[0].Choices), 4)
+	assert.Equal(t, drafts[0].Choices[1].IsCorrect, true)
+	assert.Equal(t, drafts[1].ProblemType, api.JudgeProblemType)
+
+	// 只有答案开头连续的字母是正确选项，解析或英文单词中的字母不算
+	answers := map[string][]bool{
+		"[答案] B 因为A不是质数":  {false, true, false, false},
+		"答案：A、C":          {true, false, true, false},
+		"答案：a c d":        {true, false, true, true},
+		"答案：Because of D": {false, false, false, false},
+		"答案：无":            {false, false, false, false},
+	}
+	for answer, expected := range answers {
+		choiceDrafts := api.BuildOCRDraftProblems([]utils.OCRLine{
+			{Text: "1. 下列说法正确的是", Y: 0, Height: 20},
+			{Text: "A. 4    B. 7", Y: 30, Height: 20},
+			{Text: "C. 9    D. 15", Y: 60, Height: 20},
+			{Text: answer, Y: 90, Height: 20},
+		})
+		assert.Equal(t, len(choiceDrafts), 1)
+		assert.Equal(t, len(choiceDrafts[0].Choices), 4)
+		for i, choice := range choiceDrafts[0].Choices {
+			assert.Equal(t, choice.IsCorrect, expected[i])
+		}
+	}
+
+	var batch api.BatchProblemResponse
+	code = Post("/special/ocr_problem/commit", res.Token, &api.OCRCommitRequest{
+		ProblemSetId: initProblemSet[2].ID,
+		Problems:     drafts,
+	}, &batch)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(batch.Problems), 2)
+
+	// 没有题集权限时不能写入
+	code = Post("/special/ocr_problem/commit", res.Token, &api.OCRCommitRequest{
+		ProblemSetId: initProblemSet[0].ID,
+		Problems:     drafts,
+	}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+}
+
+// postPDF 以 multipart 表单上传PDF文件
+func postPDF(url string, token string, data []byte, dest interface{}) int {
+	var buf bytes.Buffer
+	writer := multipart.NewWriter(&buf)
+	part, _ := writer.CreateFormFile("file", "problems.pdf")
+	_, _ = part.Write(data)
+	_ = writer.Close()
+	req, _ := http.NewRequest("POST", url, &buf)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req.Header.Add(global.TokenHeader, token)
+	w := httptest.NewRecorder()
+	global.Router.ServeHTTP(w, req)
+	_ = json.Unmarshal(w.Body.Bytes(), dest)
+	return w.Code
+}
+
+func testPDFOCRJob(t *testing.T) {
+	tokens := loginUsers(t, 4)
+
+	// 超过大小限制的文件直接拒绝
+	large := append([]byte("%PDF-1.4\n"), make([]byte, 20<<20)...)
+	code := postPDF("/special/pdf_ocr_job", tokens[4], large, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 本地OCR实现按 \f 分页，第3页不存在，识别失败后仍然返回前两页的结果
+	pdf := []byte("%PDF-1.4\n1. 下列哪个数是质数？\nA. 4    B. 7\n[答案] B\f2. 地球绕太阳公转。\n[答案] 正确")
+	var created api.CreateJobResponse
+	code = postPDF("/special/pdf_ocr_job?last_page=3", tokens[4], pdf, &created)
+	assert.Equal(t, code, http.StatusOK)
+
+	// 轮询任务进度，每次看到的部分结果都包含已完成的全部页面
+	var job utils.Job
+	for i := 0; i < 100; i++ {
+		code = Get("/jobs/"+created.JobId, tokens[4], nil, &job)
+		assert.Equal(t, code, http.StatusOK)
+		if len(job.Result) > 0 {
+			var partial api.PDFOCRJobResult
+			assert.Equal(t, json.Unmarshal(job.Result, &partial), nil)
+			assert.Equal(t, len(partial.Pages), job.Progress)
+		}
+		if job.Status == utils.JobSucceeded || job.Status == utils.JobFailed {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	assert.Equal(t, job.Status, utils.JobSucceeded)
+	assert.Equal(t, job.Progress, 3)
+	assert.Equal(t, job.Total, 3)
+	assert.Equal(t, job.Error, "1页识别失败")
+
+	var result api.PDFOCRJobResult
+	code = Get("/jobs/"+created.JobId+"/result", tokens[4], nil, &result)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(result.Pages), 3)
+	assert.Equal(t, result.Pages[1].Lines[0].Text, "2. 地球绕太阳公转。")
+	assert.Equal(t, result.Pages[2].Error, "识别失败")
+	assert.Equal(t, len(result.Problems), 2)
+}
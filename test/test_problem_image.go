@@ -0,0 +1,82 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"github.com/spf13/viper"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testProblemImage(t *testing.T) {
+	tokens := loginUsers(t, 3)
+	// 用户通过上传接口上传到公开存储桶中的图片地址
+	image := func(userId int, name string) string {
+		return viper.GetString("S3PublicBucketRoute") + "/" + strconv.Itoa(userId) + "/" + name
+	}
+
+	// 不接受外部地址和其他用户上传的图片
+	request := api.ChoiceProblemCreateRequest{
+		Description: "image problem",
+		Choices: []api.ChoiceRequest{
+			{Choice: "A", Description: "a", IsCorrect: true, Images: []string{image(3, "a.png")}},
+			{Choice: "B", Description: "b"},
+		},
+		Images:         []string{"https://example.com/stem.png"},
+		AnalysisImages: []string{image(3, "analysis.png")},
+	}
+	code := Post("/problem/choice/create", tokens[3], &request, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	request.Images = []string{image(4, "stem.png")}
+	code = Post("/problem/choice/create", tokens[3], &request, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	request.Images = []string{image(3, "stem1.png"), image(3, "stem2.png")}
+	var problem api.ChoiceProblemResponse
+	code = Post("/problem/choice/create", tokens[3], &request, &problem)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, problem.Images, request.Images)
+	assert.Equal(t, problem.Choices[0].Images, []string{image(3, "a.png")})
+	assert.Equal(t, len(problem.Choices[1].Images), 0)
+
+	// 题目放在用户3自己的题集中，更新时可以调整已有图片的顺序
+	var problemSetIds [2]int
+	for i := range problemSetIds {
+		err := global.Database.Get(&problemSetIds[i], `INSERT INTO problem_set (name, description, created_at,
+			updated_at, user_id, is_public) VALUES ('images', 'images', now(), now(), 3, false) RETURNING id`)
+		assert.Equal(t, err, nil)
+	}
+	_, err := global.Database.Exec(`INSERT INTO problem_in_problem_set (problem_set_id, problem_id) VALUES ($1, $2)`,
+		problemSetIds[0], problem.ID)
+	assert.Equal(t, err, nil)
+	reordered := []string{image(3, "stem2.png"), image(3, "stem1.png")}
+	code = Put("/problem/choice/update", tokens[3], &api.ChoiceProblemUpdateRequest{
+		ID:     problem.ID,
+		Images: reordered,
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	images, err := api.GetProblemImageURLs(problem.ID, api.ProblemImageStem, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, images, reordered)
+
+	// 复制到另一个题集时一起复制题干、选项和解析的图片
+	code = Post("/problem_set/migrate/"+strconv.Itoa(problemSetIds[1])+"?problem_id="+strconv.Itoa(problem.ID),
+		tokens[3], nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var copyId int
+	err = global.Database.Get(&copyId, `SELECT problem_id FROM problem_in_problem_set WHERE problem_set_id = $1`,
+		problemSetIds[1])
+	assert.Equal(t, err, nil)
+	assert.NotEqual(t, copyId, problem.ID)
+	images, err = api.GetProblemImageURLs(copyId, api.ProblemImageStem, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, images, reordered)
+	images, err = api.GetProblemImageURLs(copyId, api.ProblemImageChoice, "A")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, images, []string{image(3, "a.png")})
+	images, err = api.GetProblemImageURLs(copyId, api.ProblemImageAnalysis, "")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, images, []string{image(3, "analysis.png")})
+}
@@ -0,0 +1,94 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"io"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// readPushEvent 从事件流中读取下一个不是心跳的事件
+func readPushEvent(t *testing.T, reader *bufio.Reader) (string, utils.PushEvent) {
+	var eventType string
+	var event utils.PushEvent
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatalf("读取事件流失败: %v", err)
+		}
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "event:") {
+			eventType = strings.TrimPrefix(line, "event:")
+		} else if strings.HasPrefix(line, "data:") && eventType != "ping" {
+			_ = json.Unmarshal([]byte(strings.TrimPrefix(line, "data:")), &event)
+			return eventType, event
+		}
+	}
+}
+
+func testPush(t *testing.T) {
+	// 缩短心跳间隔，便于检查会话注销后连接被关闭
+	api.PushHeartbeatInterval = 200 * time.Millisecond
+	actor := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{
+		UserName: initUser[0].Name,
+		Password: initUser[0].Password,
+	}, &actor)
+	assert.Equal(t, code, http.StatusOK)
+	owner := api.LoginResponse{}
+	code = Post("/login", "", &api.LoginInfo{
+		UserName: initUser[5].Name,
+		Password: initUser[5].Password,
+	}, &owner)
+	assert.Equal(t, code, http.StatusOK)
+
+	server := httptest.NewServer(global.Router)
+	defer server.Close()
+
+	// 未登录不能订阅
+	resp, err := http.Get(server.URL + "/push/stream")
+	assert.Equal(t, err, nil)
+	assert.Equal(t, resp.StatusCode, http.StatusUnauthorized)
+	_ = resp.Body.Close()
+
+	req, _ := http.NewRequest("GET", server.URL+"/push/stream", nil)
+	req.Header.Add(global.TokenHeader, owner.Token)
+	client := http.Client{Timeout: 10 * time.Second}
+	resp, err = client.Do(req)
+	assert.Equal(t, err, nil)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusOK)
+	reader := bufio.NewReader(resp.Body)
+	// 第一个心跳说明订阅已经建立
+	line, _ := reader.ReadString('\n')
+	assert.Equal(t, strings.TrimSpace(line), "event:ping")
+
+	var fill, result interface{}
+	code = Post("/note/like/"+strconv.Itoa(initNote[5].ID), actor.Token, &fill, &result)
+	assert.Equal(t, code, http.StatusOK)
+	eventType, event := readPushEvent(t, reader)
+	assert.Equal(t, eventType, utils.PushNotification)
+	var notification api.NotificationResponse
+	assert.Equal(t, json.Unmarshal(event.Data, &notification), nil)
+	assert.Equal(t, notification.Type, api.NotificationNoteLike)
+	assert.Equal(t, notification.TargetId, initNote[5].ID)
+
+	// 注销后下一次心跳关闭连接
+	code = Get("/logout", owner.Token, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	for {
+		if _, err := reader.ReadString('\n'); err != nil {
+			assert.Equal(t, err, io.EOF)
+			break
+		}
+	}
+}
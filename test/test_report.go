@@ -0,0 +1,142 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testReport(t *testing.T) {
+	// 被举报的作者单独创建，封禁后不影响其他并行的测试
+	password, err := utils.EncryptPassword("reported")
+	assert.Equal(t, err, nil)
+	var authorId int
+	err = global.Database.Get(&authorId, `INSERT INTO "user" (name, created_at, password, nick_name, email)
+		VALUES ('reported', now(), $1, 'reported', 'reported@boat4study.com') RETURNING id`, password)
+	assert.Equal(t, err, nil)
+	author := api.LoginResponse{}
+	code := Post("/login", "", &api.LoginInfo{UserName: "reported", Password: "reported"}, &author)
+	assert.Equal(t, code, http.StatusOK)
+	var noteId int
+	err = global.Database.Get(&noteId, `INSERT INTO note (title, content, created_at, updated_at, user_id, is_public)
+		VALUES ('spam', 'spam', now(), now(), $1, true) RETURNING id`, authorId)
+	assert.Equal(t, err, nil)
+	_, err = global.Database.Exec(`INSERT INTO user_favorite_note (note_id, user_id, created_at) VALUES ($1, 1, now())`, noteId)
+	assert.Equal(t, err, nil)
+
+	tokens := loginUsers(t, 1, 2, 3, 4, 5, 8)
+	code = Post("/report/create", author.Token, &api.ReportCreateRequest{
+		TargetType: api.ReportTargetNote,
+		TargetId:   noteId,
+		Reason:     api.ReportReasonSpam,
+	}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Post("/report/create", tokens[1], &api.ReportCreateRequest{
+		TargetType: api.ReportTargetNote,
+		TargetId:   noteId,
+		Reason:     "boring",
+	}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Post("/report/create", tokens[1], &api.ReportCreateRequest{
+		TargetType: api.ReportTargetDiscussion,
+		TargetId:   noteId + 10000,
+		Reason:     api.ReportReasonSpam,
+	}, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// 达到举报阈值后内容自动隐藏，只有作者还能看到
+	for _, userId := range []int{1, 2, 3, 4, 8} {
+		code = Post("/report/create", tokens[userId], &api.ReportCreateRequest{
+			TargetType:  api.ReportTargetNote,
+			TargetId:    noteId,
+			Reason:      api.ReportReasonSpam,
+			Description: "advertisement",
+		}, nil)
+		assert.Equal(t, code, http.StatusOK)
+	}
+	code = Post("/report/create", tokens[1], &api.ReportCreateRequest{
+		TargetType: api.ReportTargetNote,
+		TargetId:   noteId,
+		Reason:     api.ReportReasonAbuse,
+	}, nil)
+	assert.Equal(t, code, http.StatusConflict)
+	var notes api.AllNoteResponse
+	code = Get("/note/all", tokens[1], map[string][]string{"id": {strconv.Itoa(noteId)}}, &notes)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, notes.TotalCount, 0)
+	code = Get("/note/all", author.Token, map[string][]string{"id": {strconv.Itoa(noteId)}}, &notes)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, notes.TotalCount, 1)
+	var favorites api.FavoriteNoteResponse
+	code = Get("/user/favorite/note", tokens[1], nil, &favorites)
+	assert.Equal(t, code, http.StatusOK)
+	for _, note := range favorites.Notes {
+		assert.NotEqual(t, note.ID, noteId)
+	}
+
+	// 只有管理员可以处理举报
+	var reports api.AllReportResponse
+	code = Get("/admin/report/all", tokens[1], nil, &reports)
+	assert.Equal(t, code, http.StatusForbidden)
+	adminToken := adminSession(t)
+	code = Get("/admin/report/all", adminToken, map[string][]string{"target_type": {api.ReportTargetNote}}, &reports)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reports.TotalCount, 5)
+	assert.Equal(t, reports.Reports[0].ReportCount, 5)
+	assert.Equal(t, reports.Reports[0].IsHidden, true)
+	assert.Equal(t, reports.Reports[0].TargetUserInfo.UserId, authorId)
+
+	var handled api.HandleReportResponse
+	code = Put("/admin/report/handle/"+strconv.Itoa(reports.Reports[0].ID), adminToken, &api.ReportHandleRequest{
+		Action:  api.ReportActionBan,
+		BanDays: 1,
+	}, &handled)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, handled.Handled, 5)
+	code = Put("/admin/report/handle/"+strconv.Itoa(reports.Reports[1].ID), adminToken, &api.ReportHandleRequest{
+		Action: api.ReportActionDismiss,
+	}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Get("/admin/report/all", adminToken, map[string][]string{
+		"target_type": {api.ReportTargetNote}, "status": {api.ReportResolved},
+	}, &reports)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reports.TotalCount, 5)
+
+	// 封禁后原有会话失效，也不能重新登录
+	var userInfo api.UserInfoResponse
+	code = Get("/user/info", author.Token, nil, &userInfo)
+	assert.Equal(t, code, http.StatusUnauthorized)
+	code = Post("/login", "", &api.LoginInfo{UserName: "reported", Password: "reported"}, &author)
+	assert.Equal(t, code, http.StatusForbidden)
+	var notificationCount int
+	err = global.Database.Get(&notificationCount, `SELECT count(*) FROM notification WHERE user_id = $1 AND type = $2`,
+		authorId, api.NotificationModeration)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, notificationCount, 1)
+
+	// 驳回举报只恢复因举报自动隐藏的内容，处理举报时隐藏的内容保持隐藏
+	code = Post("/report/create", tokens[5], &api.ReportCreateRequest{
+		TargetType: api.ReportTargetNote,
+		TargetId:   noteId,
+		Reason:     api.ReportReasonOther,
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	var reportId int
+	err = global.Database.Get(&reportId, `SELECT id FROM content_report WHERE user_id = 5 AND target_type = $1
+		AND target_id = $2`, api.ReportTargetNote, noteId)
+	assert.Equal(t, err, nil)
+	code = Put("/admin/report/handle/"+strconv.Itoa(reportId), adminToken, &api.ReportHandleRequest{
+		Action: api.ReportActionDismiss,
+	}, &handled)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, handled.Handled, 1)
+	var isHidden bool
+	err = global.Database.Get(&isHidden, `SELECT is_hidden FROM note WHERE id = $1`, noteId)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, isHidden, true)
+}
@@ -0,0 +1,155 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func countNotifications(t *testing.T, userId int, notificationType string) int {
+	var count int
+	err := global.Database.Get(&count, `SELECT count(*) FROM notification WHERE user_id = $1 AND type = $2`,
+		userId, notificationType)
+	assert.Equal(t, err, nil)
+	return count
+}
+
+func testReviewThread(t *testing.T) {
+	tokens := loginUsers(t, 3, 7)
+
+	// 回复笔记8下用户7的评论，并提及用户2和一个不存在的用户
+	rootId := initNoteReview[14].ID
+	var reply api.NoteReviewResponse
+	code := Post("/note_review/add", tokens[3], &api.NoteReviewCreateRequest{
+		Title:    "reply",
+		Content:  "hi @test2 and @nobody <b>",
+		NoteId:   initNote[7].ID,
+		ParentId: &rootId,
+	}, &reply)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, *reply.ParentId, rootId)
+	assert.Equal(t, len(reply.Mentions), 1)
+	assert.Equal(t, reply.Mentions[0].UserId, 2)
+	assert.Equal(t, reply.RenderedContent, `hi <a class="mention" href="kayak://user/2">@test2</a> and @nobody &lt;b&gt;`)
+	assert.Equal(t, countNotifications(t, 2, api.NotificationNoteMention), 1)
+	assert.Equal(t, countNotifications(t, 7, api.NotificationNoteReply), 1)
+
+	otherNoteReview := initNoteReview[0].ID
+	code = Post("/note_review/add", tokens[3], &api.NoteReviewCreateRequest{
+		Title:    "reply",
+		Content:  "reply",
+		NoteId:   initNote[7].ID,
+		ParentId: &otherNoteReview,
+	}, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+	var nested api.NoteReviewResponse
+	code = Post("/note_review/add", tokens[7], &api.NoteReviewCreateRequest{
+		Title:    "nested",
+		Content:  "nested",
+		NoteId:   initNote[7].ID,
+		ParentId: &reply.ID,
+	}, &nested)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, countNotifications(t, 3, api.NotificationNoteReply), 1)
+
+	noteId := strconv.Itoa(initNote[7].ID)
+	var reviews api.AllNoteReviewResponse
+	code = Get("/note_review/get", tokens[3], map[string][]string{"note_id": {noteId}}, &reviews)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reviews.TotalCount, 2)
+	assert.Equal(t, reviews.NoteReviews[0].ID, rootId)
+	assert.Equal(t, reviews.NoteReviews[0].ReplyCount, 1)
+	assert.Equal(t, reviews.NoteReviews[0].Replies[0].ID, reply.ID)
+	assert.Equal(t, reviews.NoteReviews[0].Replies[0].Replies[0].ID, nested.ID)
+
+	// 只展开一层时通过回复数和回复列表接口获取后续回复
+	code = Get("/note_review/get", tokens[3], map[string][]string{
+		"note_id": {noteId}, "depth": {"1"}, "limit": {"1"},
+	}, &reviews)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reviews.TotalCount, 2)
+	assert.Equal(t, len(reviews.NoteReviews), 1)
+	assert.Equal(t, len(reviews.NoteReviews[0].Replies), 0)
+	assert.Equal(t, reviews.NoteReviews[0].ReplyCount, 1)
+	code = Get("/note_review/get", tokens[3], map[string][]string{"note_id": {noteId}, "depth": {"6"}}, &reviews)
+	assert.Equal(t, code, http.StatusBadRequest)
+	code = Get("/note_review/replies/"+strconv.Itoa(rootId), tokens[3], nil, &reviews)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reviews.TotalCount, 1)
+	assert.Equal(t, reviews.NoteReviews[0].ReplyCount, 1)
+
+	// 只有作者可以编辑，编辑后只通知新提及的用户
+	content := "hi @test2 and @test4"
+	code = Put("/note_review/update/"+strconv.Itoa(reply.ID), tokens[7], &api.NoteReviewUpdateRequest{
+		Content: &content,
+	}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Put("/note_review/update/"+strconv.Itoa(reply.ID), tokens[3], &api.NoteReviewUpdateRequest{
+		Content: &content,
+	}, &reply)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, reply.Content, content)
+	assert.Equal(t, reply.Title, "reply")
+	assert.Equal(t, len(reply.Mentions), 2)
+	assert.Equal(t, reply.ReplyCount, 1)
+	assert.Equal(t, countNotifications(t, 2, api.NotificationNoteMention), 1)
+	assert.Equal(t, countNotifications(t, 4, api.NotificationNoteMention), 1)
+
+	// 讨论评论同样支持回复和编辑
+	var group api.GroupResponse
+	code = Post("/group/create", tokens[3], &api.GroupCreateRequest{
+		Name:        "thread group",
+		Description: "thread group",
+	}, &group)
+	assert.Equal(t, code, http.StatusOK)
+	_, err := global.Database.Exec(`INSERT INTO group_member (group_id, user_id, is_admin, is_owner, created_at)
+		VALUES ($1, 7, false, false, now())`, group.Id)
+	assert.Equal(t, err, nil)
+	var discussionId int
+	err = global.Database.Get(&discussionId, `INSERT INTO discussion (title, content, created_at, updated_at, user_id,
+		group_id, is_public) VALUES ('thread', 'thread', now(), now(), 3, $1, true) RETURNING id`, group.Id)
+	assert.Equal(t, err, nil)
+	var root, discussionReply api.DiscussionReviewResponse
+	code = Post("/discussion_review/add", tokens[3], &api.DiscussionReviewCreateRequest{
+		Title:        "root",
+		Content:      "root",
+		DiscussionId: discussionId,
+	}, &root)
+	assert.Equal(t, code, http.StatusOK)
+	code = Post("/discussion_review/add", tokens[7], &api.DiscussionReviewCreateRequest{
+		Title:        "reply",
+		Content:      "@test3 agreed",
+		DiscussionId: discussionId,
+		ParentId:     &root.ID,
+	}, &discussionReply)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, discussionReply.Mentions[0].UserId, 3)
+	// 讨论作者同时是被回复和被提及的用户，只收到一条回复通知
+	assert.Equal(t, countNotifications(t, 3, api.NotificationDiscussionReply), 1)
+	assert.Equal(t, countNotifications(t, 3, api.NotificationDiscussionMention), 0)
+
+	var discussionReviews api.AllDiscussionReviewResponse
+	code = Get("/discussion_review/get", tokens[7], map[string][]string{
+		"discussion_id": {strconv.Itoa(discussionId)},
+	}, &discussionReviews)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, discussionReviews.TotalCount, 1)
+	assert.Equal(t, discussionReviews.DiscussionReviews[0].Replies[0].ID, discussionReply.ID)
+	title := "edited"
+	code = Put("/discussion_review/update/"+strconv.Itoa(discussionReply.ID), tokens[7],
+		&api.DiscussionReviewUpdateRequest{Title: &title}, &discussionReply)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, discussionReply.Title, title)
+	assert.Equal(t, discussionReply.Content, "@test3 agreed")
+
+	// 不是小组成员的用户看不到讨论，被提及时不会收到通知
+	content = "@test3 agreed, @test4 too"
+	code = Put("/discussion_review/update/"+strconv.Itoa(discussionReply.ID), tokens[7],
+		&api.DiscussionReviewUpdateRequest{Content: &content}, &discussionReply)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, len(discussionReply.Mentions), 2)
+	assert.Equal(t, countNotifications(t, 4, api.NotificationDiscussionMention), 0)
+}
@@ -0,0 +1,103 @@
+package test
+
+import (
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"kayak-backend/model"
+	"kayak-backend/utils"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func testSensitiveWord(t *testing.T) {
+	tokens := loginUsers(t, 3, 4)
+	adminToken := adminSession(t)
+
+	// 只有管理员可以维护词表，添加后立即生效
+	code := Post("/admin/sensitive_word/add", tokens[3], &api.SensitiveWordCreateRequest{
+		Word:   "kayakblockword",
+		Action: utils.WordActionBlock,
+	}, nil)
+	assert.Equal(t, code, http.StatusForbidden)
+	code = Post("/admin/sensitive_word/add", adminToken, &api.SensitiveWordCreateRequest{
+		Word:   "kayakblockword",
+		Action: "delete",
+	}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	words := make([]model.SensitiveWord, 0)
+	for _, word := range []api.SensitiveWordCreateRequest{
+		{Word: "KayakBlockWord", Action: utils.WordActionBlock},
+		{Word: "kayakmaskword", Action: utils.WordActionMask},
+		{Word: "kayakreviewword", Action: utils.WordActionReview},
+	} {
+		var added model.SensitiveWord
+		code = Post("/admin/sensitive_word/add", adminToken, &word, &added)
+		assert.Equal(t, code, http.StatusOK)
+		words = append(words, added)
+	}
+	assert.Equal(t, words[0].Word, "kayakblockword")
+	code = Post("/admin/sensitive_word/add", adminToken, &api.SensitiveWordCreateRequest{
+		Word:   "kayakmaskword",
+		Action: utils.WordActionBlock,
+	}, nil)
+	assert.Equal(t, code, http.StatusConflict)
+
+	code = Post("/note/create", tokens[3], &api.NoteCreateRequest{
+		Title:   "sensitive",
+		Content: "this contains kayakBLOCKword",
+	}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+	var masked api.NoteResponse
+	code = Post("/note/create", tokens[3], &api.NoteCreateRequest{
+		Title:    "sensitive",
+		Content:  "hello kayakmaskword",
+		IsPublic: true,
+	}, &masked)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, masked.Content, "hello *************")
+
+	// 用户名会用作昵称，不能被替换，命中 mask 词时也不能注册
+	code = Post("/register", "", &api.RegisterInfo{Name: "kayakmaskword", Password: "kayakmaskword"}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	// 命中 review 词的内容先隐藏，并由系统加入举报队列
+	var reviewed api.NoteResponse
+	code = Post("/note/create", tokens[3], &api.NoteCreateRequest{
+		Title:    "sensitive",
+		Content:  "kayakreviewword",
+		IsPublic: true,
+	}, &reviewed)
+	assert.Equal(t, code, http.StatusOK)
+	var notes api.AllNoteResponse
+	code = Get("/note/all", tokens[4], map[string][]string{"id": {strconv.Itoa(reviewed.ID)}}, &notes)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, notes.TotalCount, 0)
+	code = Get("/note/all", tokens[3], map[string][]string{"id": {strconv.Itoa(reviewed.ID)}}, &notes)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, notes.TotalCount, 1)
+	var reportCount int
+	err := global.Database.Get(&reportCount, `SELECT count(*) FROM content_report WHERE user_id IS NULL
+		AND target_type = $1 AND target_id = $2 AND reason = $3`,
+		api.ReportTargetNote, reviewed.ID, api.ReportReasonSensitiveWord)
+	assert.Equal(t, err, nil)
+	assert.Equal(t, reportCount, 1)
+
+	// 昵称没有审核流程，review 词也不能使用
+	reviewWord := "kayakreviewword"
+	code = Put("/user/update", tokens[4], &api.UserInfoRequest{NickName: &reviewWord}, nil)
+	assert.Equal(t, code, http.StatusBadRequest)
+
+	for _, word := range words {
+		code = Delete("/admin/sensitive_word/remove/"+strconv.Itoa(word.ID), adminToken, nil, nil)
+		assert.Equal(t, code, http.StatusOK)
+	}
+	code = Delete("/admin/sensitive_word/remove/"+strconv.Itoa(words[0].ID), adminToken, nil, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+	code = Post("/note/create", tokens[3], &api.NoteCreateRequest{
+		Title:   "sensitive",
+		Content: "kayakblockword",
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+}
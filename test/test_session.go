@@ -0,0 +1,76 @@
+package test
+
+import (
+	"context"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
+	"kayak-backend/global"
+	"net/http"
+	"testing"
+)
+
+func testSession(t *testing.T) {
+	createLoginUser(t, "sessioned")
+	password := "sessioned"
+	login := func(device string, rememberMe bool) string {
+		res := api.LoginResponse{}
+		code := Post("/login", "", &api.LoginInfo{
+			UserName: "sessioned", Password: password, Device: device, RememberMe: rememberMe,
+		}, &res)
+		assert.Equal(t, code, http.StatusOK)
+		return res.Token
+	}
+	isValid := func(token string) bool {
+		var userInfo api.UserInfoResponse
+		return Get("/user/info", token, nil, &userInfo) == http.StatusOK
+	}
+	phone := login("phone", true)
+	laptop := login("laptop", false)
+
+	// “记住我”的会话过期时间更长
+	ttl, err := global.Redis.TTL(context.Background(), phone).Result()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl > global.SessionExpiration, true)
+	ttl, err = global.Redis.TTL(context.Background(), laptop).Result()
+	assert.Equal(t, err, nil)
+	assert.Equal(t, ttl <= global.SessionExpiration, true)
+
+	var sessions api.AllSessionResponse
+	code := Get("/user/sessions", phone, nil, &sessions)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, sessions.TotalCount, 2)
+	devices := make(map[string]api.SessionResponse)
+	for _, session := range sessions.Sessions {
+		devices[session.Device] = session
+	}
+	assert.Equal(t, devices["phone"].IsCurrent, true)
+	assert.Equal(t, devices["phone"].RememberMe, true)
+	assert.Equal(t, devices["laptop"].IsCurrent, false)
+
+	// 注销单个会话
+	code = Delete("/user/sessions/revoke/"+devices["laptop"].ID, phone, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, isValid(laptop), false)
+	code = Delete("/user/sessions/revoke/"+devices["laptop"].ID, phone, nil, nil)
+	assert.Equal(t, code, http.StatusNotFound)
+
+	// 注销其他所有会话
+	tablet := login("tablet", false)
+	code = Delete("/user/sessions/revoke_others", phone, nil, nil)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, isValid(tablet), false)
+	assert.Equal(t, isValid(phone), true)
+	code = Get("/user/sessions", phone, nil, &sessions)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, sessions.TotalCount, 1)
+
+	// 修改密码后其他设备需要重新登录
+	desktop := login("desktop", false)
+	code = Post("/change-password", phone, &api.RegisterResponse{
+		OldPassword: password,
+		NewPassword: "sessioned-new",
+	}, nil)
+	assert.Equal(t, code, http.StatusOK)
+	assert.Equal(t, isValid(desktop), false)
+	assert.Equal(t, isValid(phone), true)
+}
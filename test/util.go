@@ -2,10 +2,14 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"github.com/go-playground/assert/v2"
+	"kayak-backend/api"
 	"kayak-backend/global"
 	"net/http"
 	"net/http/httptest"
+	"testing"
 )
 
 func Get(url string, token string, query map[string][]string, dest interface{}) int {
@@ -67,3 +71,25 @@ func Put(url string, token string, src interface{}, dest interface{}) int {
 	_ = json.Unmarshal(w.Body.Bytes(), dest)
 	return w.Code
 }
+
+// loginUsers 用初始化的用户登录，返回用户ID到 token 的映射
+func loginUsers(t *testing.T, userIds ...int) map[int]string {
+	tokens := make(map[int]string)
+	for _, userId := range userIds {
+		res := api.LoginResponse{}
+		code := Post("/login", "", &api.LoginInfo{
+			UserName: initUser[userId-1].Name,
+			Password: initUser[userId-1].Password,
+		}, &res)
+		assert.Equal(t, code, http.StatusOK)
+		tokens[userId] = res.Token
+	}
+	return tokens
+}
+
+// adminSession 直接创建用户1的管理员会话，初始化的用户中没有管理员
+func adminSession(t *testing.T) string {
+	token, err := global.CreateSession(context.Background(), &global.Session{Role: global.ADMIN, UserId: 1})
+	assert.Equal(t, err, nil)
+	return token
+}
@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"context"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"kayak-backend/global"
+	"math/rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CaptchaChallenge 是发给客户端的验证码，Question 的含义由具体的验证码服务决定（文字题目、图片地址等）
+type CaptchaChallenge struct {
+	ID       string `json:"captcha_id"`
+	Question string `json:"question"`
+}
+
+// CaptchaProvider 是验证码服务的抽象，Verify 对同一个验证码只能成功一次
+type CaptchaProvider interface {
+	Name() string
+	Generate(ctx context.Context) (*CaptchaChallenge, error)
+	Verify(ctx context.Context, id string, answer string) (bool, error)
+}
+
+const captchaExpiration = 5 * time.Minute
+
+var Captcha CaptchaProvider = &LocalCaptchaProvider{}
+
+func InitCaptcha(provider string) error {
+	switch provider {
+	// 目前只有本地实现，接入第三方验证码服务时在这里增加分支
+	case "", "local":
+		Captcha = &LocalCaptchaProvider{}
+	default:
+		return fmt.Errorf("unknown captcha provider %q", provider)
+	}
+	return nil
+}
+
+// LocalCaptchaProvider 生成简单的算术题，答案保存在 Redis 中，用于开发和测试
+type LocalCaptchaProvider struct{}
+
+func (p *LocalCaptchaProvider) Name() string {
+	return "local"
+}
+
+func captchaKey(id string) string {
+	return "captcha:" + id
+}
+
+func (p *LocalCaptchaProvider) Generate(ctx context.Context) (*CaptchaChallenge, error) {
+	a, b := rand.Intn(10)+1, rand.Intn(10)+1
+	challenge := &CaptchaChallenge{
+		ID:       uuid.New().String(),
+		Question: fmt.Sprintf("%d + %d = ?", a, b),
+	}
+	if err := global.Redis.Set(ctx, captchaKey(challenge.ID), a+b, captchaExpiration).Err(); err != nil {
+		return nil, err
+	}
+	return challenge, nil
+}
+
+func (p *LocalCaptchaProvider) Verify(ctx context.Context, id string, answer string) (bool, error) {
+	if id == "" {
+		return false, nil
+	}
+	// 取出答案的同时删除，避免同一个验证码被反复尝试
+	var get *redis.StringCmd
+	_, err := global.Redis.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		get = pipe.Get(ctx, captchaKey(id))
+		pipe.Del(ctx, captchaKey(id))
+		return nil
+	})
+	expected := get.Val()
+	if err == redis.Nil {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	value, err := strconv.Atoi(strings.TrimSpace(answer))
+	if err != nil {
+		return false, nil
+	}
+	return strconv.Itoa(value) == expected, nil
+}
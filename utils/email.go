@@ -1,32 +1,285 @@
 package utils
 
 import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/jordan-wright/email"
+	"html/template"
 	"kayak-backend/global"
+	"kayak-backend/model"
+	"log"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
 	"time"
 )
 
-func SendEmailValidate(recipient string) (string, error) {
+const (
+	MailPending = "pending"
+	MailSending = "sending"
+	MailSent    = "sent"
+	MailFailed  = "failed"
+)
+
+const MailJobType = "mail"
+
+// 发送中的邮件超过这么长时间没有更新才认为发送它的进程已经退出，恢复时重新投递
+const mailSendingStaleAfter = 10 * time.Minute
+
+const DefaultMailLocale = "zh-CN"
+
+type MailMessage struct {
+	From    string
+	To      []string
+	Subject string
+	HTML    string
+}
+
+// MailTransport 负责把一封已经渲染好的邮件投递出去
+type MailTransport interface {
+	Send(message *MailMessage) error
+}
+
+type SMTPTransport struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+}
+
+func (t *SMTPTransport) Send(message *MailMessage) error {
 	e := email.NewEmail()
-	e.From = fmt.Sprintf("boat4study <boat4study@163.com>")
-	e.To = make([]string, 1)
-	e.To[0] = recipient
+	e.From = message.From
+	e.To = message.To
+	e.Subject = message.Subject
+	e.HTML = []byte(message.HTML)
+	auth := smtp.PlainAuth("", t.Username, t.Password, t.Host)
+	return e.Send(fmt.Sprintf("%s:%d", t.Host, t.Port), auth)
+}
+
+// FileTransport 把邮件写入目录并记录日志而不真正发送，用于本地开发和测试，Dir 为空时只记录日志
+type FileTransport struct {
+	Dir string
+}
+
+func (t *FileTransport) Send(message *MailMessage) error {
+	log.Printf("邮件 [%s] -> %s", message.Subject, strings.Join(message.To, ", "))
+	if t.Dir == "" {
+		return nil
+	}
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+	name := fmt.Sprintf("%s_%s.html", time.Now().Format("20060102150405.000000000"), strings.Join(message.To, "_"))
+	content := fmt.Sprintf("From: %s\nTo: %s\nSubject: %s\n\n%s", message.From,
+		strings.Join(message.To, ", "), message.Subject, message.HTML)
+	return os.WriteFile(filepath.Join(t.Dir, name), []byte(content), 0644)
+}
+
+var (
+	Mailer          MailTransport = &FileTransport{}
+	MailFrom                      = "boat4study <boat4study@163.com>"
+	MailTemplateDir               = "templates/mail"
+)
+
+func InitMailer(transport string, host string, port int, username string, password string,
+	from string, templateDir string, fileDir string) {
+	switch transport {
+	case "file":
+		Mailer = &FileTransport{Dir: fileDir}
+	default:
+		if port == 0 {
+			port = 25
+		}
+		Mailer = &SMTPTransport{Host: host, Port: port, Username: username, Password: password}
+	}
+	if from != "" {
+		MailFrom = from
+	} else if username != "" {
+		MailFrom = username
+	}
+	if templateDir != "" {
+		MailTemplateDir = templateDir
+	}
+}
+
+// mailTemplateFiles 返回按优先级排列的候选模板文件，例如 zh-CN 依次查找
+// name.zh-CN.html、name.zh.html、name.<默认语言>.html 和 name.html
+func mailTemplateFiles(name string, locale string) []string {
+	var candidates []string
+	if locale != "" {
+		candidates = append(candidates, name+"."+locale+".html")
+		if i := strings.Index(locale, "-"); i > 0 {
+			candidates = append(candidates, name+"."+locale[:i]+".html")
+		}
+	}
+	if locale != DefaultMailLocale {
+		candidates = append(candidates, name+"."+DefaultMailLocale+".html")
+	}
+	candidates = append(candidates, name+".html")
+	for i := range candidates {
+		candidates[i] = filepath.Join(MailTemplateDir, candidates[i])
+	}
+	return candidates
+}
+
+// RenderMailTemplate 渲染模板目录中的邮件模板，模板需要定义 subject 和 body 两个块
+func RenderMailTemplate(name string, locale string, data interface{}) (string, string, error) {
+	if strings.ContainsAny(name, `/\`) {
+		return "", "", errors.New("invalid template name")
+	}
+	for _, file := range mailTemplateFiles(name, locale) {
+		if _, err := os.Stat(file); err != nil {
+			continue
+		}
+		tmpl, err := template.ParseFiles(file)
+		if err != nil {
+			return "", "", err
+		}
+		var subject, body bytes.Buffer
+		if err := tmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+			return "", "", err
+		}
+		if err := tmpl.ExecuteTemplate(&body, "body", data); err != nil {
+			return "", "", err
+		}
+		return strings.TrimSpace(subject.String()), body.String(), nil
+	}
+	return "", "", fmt.Errorf("mail template %s not found", name)
+}
+
+// ParseLocale 从 Accept-Language 中取出优先级最高的语言
+func ParseLocale(acceptLanguage string) string {
+	locale := strings.TrimSpace(strings.Split(strings.Split(acceptLanguage, ",")[0], ";")[0])
+	if locale == "" || strings.ContainsAny(locale, `/\.`) {
+		return DefaultMailLocale
+	}
+	return locale
+}
+
+type mailJobPayload struct {
+	OutboxId int `json:"outbox_id"`
+}
+
+// QueueMail 渲染模板并写入发件箱，随后由后台任务投递，返回发件箱记录ID
+func QueueMail(ctx context.Context, recipient string, templateName string, locale string, data interface{}) (int, error) {
+	subject, body, err := RenderMailTemplate(templateName, locale, data)
+	if err != nil {
+		return 0, err
+	}
+	var id int
+	sqlString := `INSERT INTO mail_outbox (recipient, subject, body, template, locale, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $7) RETURNING id`
+	if err := global.Database.Get(&id, sqlString, recipient, subject, body, templateName, locale,
+		MailPending, time.Now().Local()); err != nil {
+		return 0, err
+	}
+	if _, err := EnqueueJob(ctx, MailJobType, 0, 1, &mailJobPayload{OutboxId: id}); err != nil {
+		markMailEnqueueFailed(id, err)
+		return id, err
+	}
+	return id, nil
+}
+
+// markMailEnqueueFailed 在投递任务入队失败时把邮件标记为发送失败，避免留下一封永远不会投递的待发送邮件，
+// 管理员可以之后重试
+func markMailEnqueueFailed(id int, enqueueErr error) {
+	sqlString := `UPDATE mail_outbox SET status = $1, last_error = $2, updated_at = $3 WHERE id = $4 AND status = $5`
+	if _, err := global.Database.Exec(sqlString, MailFailed, enqueueErr.Error(), time.Now().Local(), id, MailPending); err != nil {
+		log.Printf("更新邮件 %d 状态失败: %v", id, err)
+	}
+}
+
+// DeliverMailJob 是发送邮件的后台任务，失败时由任务队列按退避策略重试，重试耗尽后标记为发送失败
+func DeliverMailJob(ctx context.Context, job *Job, payload []byte) (interface{}, error) {
+	var request mailJobPayload
+	if err := json.Unmarshal(payload, &request); err != nil {
+		return nil, PermanentJobError(err)
+	}
+	var mail model.MailOutbox
+	sqlString := `UPDATE mail_outbox SET status = $1, attempts = attempts + 1, updated_at = $2
+		WHERE id = $3 AND status = $4 RETURNING *`
+	err := global.Database.Get(&mail, sqlString, MailSending, time.Now().Local(), request.OutboxId, MailPending)
+	if err == sql.ErrNoRows {
+		// 已经发送或正在由其他任务发送
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	err = Mailer.Send(&MailMessage{
+		From:    MailFrom,
+		To:      []string{mail.Recipient},
+		Subject: mail.Subject,
+		HTML:    mail.Body,
+	})
+	if err == nil {
+		sqlString = `UPDATE mail_outbox SET status = $1, last_error = NULL, sent_at = $2, updated_at = $2 WHERE id = $3`
+		if _, err := global.Database.Exec(sqlString, MailSent, time.Now().Local(), mail.ID); err != nil {
+			log.Printf("更新邮件 %d 状态失败: %v", mail.ID, err)
+		}
+		return nil, nil
+	}
+	status := MailPending
+	if job.Attempts >= job.MaxAttempts {
+		status = MailFailed
+	}
+	sqlString = `UPDATE mail_outbox SET status = $1, last_error = $2, updated_at = $3 WHERE id = $4`
+	if _, dbErr := global.Database.Exec(sqlString, status, err.Error(), time.Now().Local(), mail.ID); dbErr != nil {
+		log.Printf("更新邮件 %d 状态失败: %v", mail.ID, dbErr)
+	}
+	return nil, err
+}
+
+// ResumeMailOutbox 重新投递发件箱中未完成的邮件，用于进程重启后恢复。
+// 其他实例可能正在发送邮件，所以只重置长时间没有更新的发送中的邮件
+func ResumeMailOutbox(ctx context.Context) error {
+	now := time.Now().Local()
+	sqlString := `UPDATE mail_outbox SET status = $1, updated_at = $2 WHERE status = $3 AND updated_at < $4`
+	if _, err := global.Database.Exec(sqlString, MailPending, now, MailSending, now.Add(-mailSendingStaleAfter)); err != nil {
+		return err
+	}
+	var ids []int
+	sqlString = `SELECT id FROM mail_outbox WHERE status = $1`
+	if err := global.Database.Select(&ids, sqlString, MailPending); err != nil {
+		return err
+	}
+	for _, id := range ids {
+		if _, err := EnqueueJob(ctx, MailJobType, 0, 1, &mailJobPayload{OutboxId: id}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// RetryMail 把发送失败的邮件重新放回发件箱
+func RetryMail(ctx context.Context, id int) error {
+	sqlString := `UPDATE mail_outbox SET status = $1, updated_at = $2 WHERE id = $3 AND status = $4`
+	result, err := global.Database.Exec(sqlString, MailPending, time.Now().Local(), id, MailFailed)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errors.New("mail is not failed")
+	}
+	if _, err := EnqueueJob(ctx, MailJobType, 0, 1, &mailJobPayload{OutboxId: id}); err != nil {
+		markMailEnqueueFailed(id, err)
+		return err
+	}
+	return nil
+}
+
+// SendEmailValidate 向 recipient 发送邮箱验证码并返回验证码
+func SendEmailValidate(ctx context.Context, recipient string, locale string) (string, error) {
 	vCode := GenerateDigitalCode(6)
-	content := fmt.Sprintf(`
-	<div>
-		<div>
-			尊敬的%s，您好！
-		</div>
-		<div style="padding: 8px 40px 8px 50px;">
-			<p>您于 %s 提交的邮箱验证，本次验证码为<u><strong>%s</strong></u>，为了保证账号安全，验证码有效期为5分钟。请确认为本人操作，切勿向他人泄露，感谢您的理解与使用。</p>
-		</div>
-		<div>
-			<p>此邮箱为系统邮箱，请勿回复。</p>
-		</div>
-	</div>
-	`, recipient, time.Now().Format("2006-01-02 15:04:05"), vCode)
-	e.HTML = []byte(content)
-	err := e.Send("smtp.163.com:25", global.SMTPAuth)
+	_, err := QueueMail(ctx, recipient, "verify_code", locale, map[string]string{
+		"Recipient": recipient,
+		"Time":      time.Now().Format("2006-01-02 15:04:05"),
+		"Code":      vCode,
+	})
 	return vCode, err
 }
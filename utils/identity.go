@@ -0,0 +1,253 @@
+package utils
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	neturl "net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ExternalIdentity 是第三方登录返回的用户身份，Subject 在同一个登录方式内唯一标识一个用户，
+// Name 仅用作新用户的默认昵称，可能为空
+type ExternalIdentity struct {
+	Provider string
+	Subject  string
+	Name     string
+}
+
+// IdentityProvider 是第三方登录方式的抽象，Exchange 用客户端拿到的授权码换取用户身份，
+// redirectURI 是客户端发起授权时使用的回调地址，不需要的登录方式可以忽略
+type IdentityProvider interface {
+	Name() string
+	Exchange(ctx context.Context, code string, redirectURI string) (*ExternalIdentity, error)
+}
+
+var ErrIdentityExchange = errors.New("identity provider rejected the code")
+
+var identityProviders = make(map[string]IdentityProvider)
+var identityProvidersLock sync.RWMutex
+
+func RegisterIdentityProvider(provider IdentityProvider) {
+	identityProvidersLock.Lock()
+	defer identityProvidersLock.Unlock()
+	identityProviders[provider.Name()] = provider
+}
+
+func GetIdentityProvider(name string) (IdentityProvider, bool) {
+	identityProvidersLock.RLock()
+	defer identityProvidersLock.RUnlock()
+	provider, ok := identityProviders[name]
+	return provider, ok
+}
+
+// OIDCProviderConfig 是配置文件中一个 OIDC 登录方式的配置
+type OIDCProviderConfig struct {
+	Name         string `mapstructure:"name"`
+	Issuer       string `mapstructure:"issuer"`
+	ClientID     string `mapstructure:"client_id"`
+	ClientSecret string `mapstructure:"client_secret"`
+}
+
+// InitIdentityProviders 注册微信登录和配置中的 OIDC 登录方式
+func InitIdentityProviders(weixinAppID string, weixinAppSecret string, oidcConfigs []OIDCProviderConfig) {
+	RegisterIdentityProvider(&WeixinIdentityProvider{
+		AppID:     weixinAppID,
+		AppSecret: weixinAppSecret,
+	})
+	for _, config := range oidcConfigs {
+		RegisterIdentityProvider(&OIDCIdentityProvider{
+			ProviderName: config.Name,
+			Issuer:       config.Issuer,
+			ClientID:     config.ClientID,
+			ClientSecret: config.ClientSecret,
+		})
+	}
+}
+
+var identityHTTPClient = &http.Client{Timeout: 5 * time.Second}
+
+func readIdentityResponse(resp *http.Response, dest interface{}) error {
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: http status %d: %s", ErrIdentityExchange, resp.StatusCode, body)
+	}
+	return json.Unmarshal(body, dest)
+}
+
+const weixinCode2SessionURL = "https://api.weixin.qq.com/sns/jscode2session"
+
+// WeixinIdentityProvider 是微信小程序登录，Subject 为小程序的 openid
+type WeixinIdentityProvider struct {
+	AppID     string
+	AppSecret string
+	// Endpoint 为空时使用微信的 jscode2session 接口，测试时指向本地的假服务
+	Endpoint string
+}
+
+func (p *WeixinIdentityProvider) Name() string {
+	return "weixin"
+}
+
+func (p *WeixinIdentityProvider) Exchange(ctx context.Context, code string, _ string) (*ExternalIdentity, error) {
+	endpoint := p.Endpoint
+	if endpoint == "" {
+		endpoint = weixinCode2SessionURL
+	}
+	query := neturl.Values{
+		"appid":      {p.AppID},
+		"secret":     {p.AppSecret},
+		"js_code":    {code},
+		"grant_type": {"authorization_code"},
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET", endpoint+"?"+query.Encode(), nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := identityHTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		OpenID  string `json:"openid"`
+		ErrCode int    `json:"errcode"`
+		ErrMsg  string `json:"errmsg"`
+	}
+	if err := readIdentityResponse(resp, &result); err != nil {
+		return nil, err
+	}
+	if result.ErrCode != 0 || result.OpenID == "" {
+		return nil, fmt.Errorf("%w: %d %s", ErrIdentityExchange, result.ErrCode, result.ErrMsg)
+	}
+	return &ExternalIdentity{Provider: p.Name(), Subject: result.OpenID}, nil
+}
+
+// OIDCIdentityProvider 是通用的 OpenID Connect 授权码登录，端点通过 Issuer 的发现文档获取
+type OIDCIdentityProvider struct {
+	ProviderName string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	discoveryLock sync.Mutex
+	tokenEndpoint string
+}
+
+func (p *OIDCIdentityProvider) Name() string {
+	return p.ProviderName
+}
+
+func (p *OIDCIdentityProvider) getTokenEndpoint(ctx context.Context) (string, error) {
+	p.discoveryLock.Lock()
+	defer p.discoveryLock.Unlock()
+	if p.tokenEndpoint != "" {
+		return p.tokenEndpoint, nil
+	}
+	request, err := http.NewRequestWithContext(ctx, "GET",
+		strings.TrimSuffix(p.Issuer, "/")+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return "", err
+	}
+	resp, err := identityHTTPClient.Do(request)
+	if err != nil {
+		return "", err
+	}
+	var discovery struct {
+		Issuer        string `json:"issuer"`
+		TokenEndpoint string `json:"token_endpoint"`
+	}
+	if err := readIdentityResponse(resp, &discovery); err != nil {
+		return "", err
+	}
+	if discovery.Issuer != p.Issuer || discovery.TokenEndpoint == "" {
+		return "", fmt.Errorf("invalid openid configuration of %s", p.Issuer)
+	}
+	p.tokenEndpoint = discovery.TokenEndpoint
+	return p.tokenEndpoint, nil
+}
+
+type oidcClaims struct {
+	Issuer    string          `json:"iss"`
+	Subject   string          `json:"sub"`
+	Audience  json.RawMessage `json:"aud"`
+	ExpiresAt int64           `json:"exp"`
+	Name      string          `json:"name"`
+}
+
+// hasAudience 判断 aud 是否包含 clientId，aud 可以是字符串或字符串数组
+func (claims *oidcClaims) hasAudience(clientId string) bool {
+	var single string
+	if err := json.Unmarshal(claims.Audience, &single); err == nil {
+		return single == clientId
+	}
+	var multiple []string
+	if err := json.Unmarshal(claims.Audience, &multiple); err != nil {
+		return false
+	}
+	for _, audience := range multiple {
+		if audience == clientId {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *OIDCIdentityProvider) Exchange(ctx context.Context, code string, redirectURI string) (*ExternalIdentity, error) {
+	tokenEndpoint, err := p.getTokenEndpoint(ctx)
+	if err != nil {
+		return nil, err
+	}
+	form := neturl.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {redirectURI},
+		"client_id":     {p.ClientID},
+		"client_secret": {p.ClientSecret},
+	}
+	request, err := http.NewRequestWithContext(ctx, "POST", tokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := identityHTTPClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	var token struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := readIdentityResponse(resp, &token); err != nil {
+		return nil, err
+	}
+	// ID Token 是服务端通过 TLS 直接从令牌端点取得的，按 OIDC Core 3.1.3.7 可以不校验签名，
+	// 但仍然需要校验签发者、受众和有效期
+	parts := strings.Split(token.IDToken, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("%w: malformed id_token", ErrIdentityExchange)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed id_token", ErrIdentityExchange)
+	}
+	var claims oidcClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return nil, fmt.Errorf("%w: malformed id_token", ErrIdentityExchange)
+	}
+	if claims.Issuer != p.Issuer || !claims.hasAudience(p.ClientID) || claims.Subject == "" ||
+		time.Now().Unix() >= claims.ExpiresAt {
+		return nil, fmt.Errorf("%w: invalid id_token claims", ErrIdentityExchange)
+	}
+	return &ExternalIdentity{Provider: p.Name(), Subject: claims.Subject, Name: claims.Name}, nil
+}
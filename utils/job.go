@@ -0,0 +1,461 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/google/uuid"
+	"kayak-backend/global"
+	"log"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+)
+
+const (
+	jobExpiration     = 24 * time.Hour
+	deadJobExpiration = 7 * 24 * time.Hour
+	jobQueueKey       = "job:queue"
+	jobWorkersKey     = "job:workers"
+	jobDelayedKey     = "job:delayed"
+	jobDeadKey        = "job:dead"
+	maxDeadJobs       = 1000
+	// 工作协程的心跳在这段时间内没有更新就认为所在进程已经退出，它正在处理的任务会被放回队列
+	jobWorkerTTL = 30 * time.Second
+)
+
+var ErrJobNotFound = errors.New("job not found")
+
+// Job 是保存在 Redis 中的后台任务状态，Result 的结构由任务类型决定
+type Job struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	UserId      int             `json:"user_id"`
+	Status      string          `json:"status"`
+	Progress    int             `json:"progress"`
+	Total       int             `json:"total"`
+	Attempts    int             `json:"attempts"`
+	MaxAttempts int             `json:"max_attempts"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+// JobHandler 执行一个任务，payload 为入队时传入的参数的 JSON，返回值会被序列化为任务结果。
+// 运行过程中可以调用 SetJobResult 更新进度和部分结果
+type JobHandler func(ctx context.Context, job *Job, payload []byte) (interface{}, error)
+
+type JobOptions struct {
+	// MaxAttempts 最多执行次数（包括第一次），默认为3
+	MaxAttempts int
+	// Backoff 第一次重试前的等待时间，之后每次翻倍，默认为5秒
+	Backoff time.Duration
+}
+
+type jobType struct {
+	handler JobHandler
+	options JobOptions
+}
+
+var (
+	jobTypes   = make(map[string]jobType)
+	jobTypesMu sync.RWMutex
+)
+
+// permanentJobError 表示重试也不会成功的错误，任务会直接失败
+type permanentJobError struct {
+	err error
+}
+
+func (e *permanentJobError) Error() string {
+	return e.err.Error()
+}
+
+func (e *permanentJobError) Unwrap() error {
+	return e.err
+}
+
+// PermanentJobError 包装 err，使任务不再重试
+func PermanentJobError(err error) error {
+	return &permanentJobError{err: err}
+}
+
+// IsPermanentJobError 判断 err 是否由 PermanentJobError 包装，这样的错误不会重试
+func IsPermanentJobError(err error) bool {
+	var permanent *permanentJobError
+	return errors.As(err, &permanent)
+}
+
+func RegisterJobHandler(name string, handler JobHandler, options JobOptions) {
+	if options.MaxAttempts <= 0 {
+		options.MaxAttempts = 3
+	}
+	if options.Backoff <= 0 {
+		options.Backoff = 5 * time.Second
+	}
+	jobTypesMu.Lock()
+	defer jobTypesMu.Unlock()
+	jobTypes[name] = jobType{handler: handler, options: options}
+}
+
+func jobKey(id string) string {
+	return "job:" + id
+}
+
+func jobPayloadKey(id string) string {
+	return "job:" + id + ":payload"
+}
+
+// jobProcessingKey 是工作协程正在处理的任务列表，每个工作协程一个
+func jobProcessingKey(workerId string) string {
+	return "job:processing:" + workerId
+}
+
+func jobWorkerAliveKey(workerId string) string {
+	return "job:worker:" + workerId
+}
+
+// CreateJob 只创建任务记录而不入队，适用于由调用方自行执行的任务
+func CreateJob(ctx context.Context, jobType string, userId int, total int) (*Job, error) {
+	job := &Job{
+		ID:          uuid.New().String(),
+		Type:        jobType,
+		UserId:      userId,
+		Status:      JobPending,
+		Total:       total,
+		MaxAttempts: 1,
+		CreatedAt:   time.Now().Local(),
+		UpdatedAt:   time.Now().Local(),
+	}
+	if err := SaveJob(ctx, job); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+// EnqueueJob 创建任务并放入队列，payload 会被序列化为 JSON 交给对应类型的 JobHandler
+func EnqueueJob(ctx context.Context, name string, userId int, total int, payload interface{}) (*Job, error) {
+	jobTypesMu.RLock()
+	t, ok := jobTypes[name]
+	jobTypesMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown job type %s", name)
+	}
+	raw, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+	job, err := CreateJob(ctx, name, userId, total)
+	if err != nil {
+		return nil, err
+	}
+	job.MaxAttempts = t.options.MaxAttempts
+	if err := SaveJob(ctx, job); err != nil {
+		return nil, err
+	}
+	if err := global.Redis.Set(ctx, jobPayloadKey(job.ID), raw, jobExpiration).Err(); err != nil {
+		return nil, err
+	}
+	if err := global.Redis.LPush(ctx, jobQueueKey, job.ID).Err(); err != nil {
+		return nil, err
+	}
+	return job, nil
+}
+
+func GetJob(ctx context.Context, id string) (*Job, error) {
+	raw, err := global.Redis.Get(ctx, jobKey(id)).Bytes()
+	if err == redis.Nil {
+		return nil, ErrJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var job Job
+	if err := json.Unmarshal(raw, &job); err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+func SaveJob(ctx context.Context, job *Job) error {
+	job.UpdatedAt = time.Now().Local()
+	raw, err := json.Marshal(job)
+	if err != nil {
+		return err
+	}
+	return global.Redis.Set(ctx, jobKey(job.ID), raw, jobExpiration).Err()
+}
+
+// SetJobResult 序列化 result 并保存任务的当前进度，用于在任务运行过程中暴露部分结果
+func SetJobResult(ctx context.Context, job *Job, result interface{}) error {
+	raw, err := json.Marshal(result)
+	if err != nil {
+		return err
+	}
+	job.Result = raw
+	return SaveJob(ctx, job)
+}
+
+// GetDeadJobs 返回最近进入死信队列的任务，按进入时间倒序
+func GetDeadJobs(ctx context.Context, offset int, limit int) ([]Job, int, error) {
+	total, err := global.Redis.LLen(ctx, jobDeadKey).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	ids, err := global.Redis.LRange(ctx, jobDeadKey, int64(offset), int64(offset+limit-1)).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+	jobs := make([]Job, 0, len(ids))
+	for _, id := range ids {
+		job, err := GetJob(ctx, id)
+		if err == ErrJobNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, 0, err
+		}
+		jobs = append(jobs, *job)
+	}
+	return jobs, int(total), nil
+}
+
+// RetryDeadJob 把死信队列中的任务重置后重新入队
+func RetryDeadJob(ctx context.Context, id string) error {
+	removed, err := global.Redis.LRem(ctx, jobDeadKey, 0, id).Result()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return ErrJobNotFound
+	}
+	job, err := GetJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := global.Redis.Expire(ctx, jobPayloadKey(id), jobExpiration).Err(); err != nil {
+		return err
+	}
+	job.Status = JobPending
+	job.Attempts = 0
+	job.Error = ""
+	if err := SaveJob(ctx, job); err != nil {
+		return err
+	}
+	return global.Redis.LPush(ctx, jobQueueKey, id).Err()
+}
+
+// StartJobWorkers 启动 n 个工作协程和一个调度协程，调度协程负责延迟任务、心跳和回收已退出进程的任务。
+// 每个工作协程有自己的处理中列表，多个进程可以消费同一个 Redis
+func StartJobWorkers(n int) {
+	ctx := context.Background()
+	instanceId := uuid.New().String()
+	workerIds := make([]string, n)
+	for i := range workerIds {
+		workerIds[i] = fmt.Sprintf("%s:%d", instanceId, i)
+	}
+	heartbeatJobWorkers(ctx, workerIds)
+	recoverJobs(ctx)
+	for _, workerId := range workerIds {
+		go jobWorker(ctx, workerId)
+	}
+	go jobScheduler(ctx, workerIds)
+}
+
+// heartbeatJobWorkers 刷新当前进程所有工作协程的心跳
+func heartbeatJobWorkers(ctx context.Context, workerIds []string) {
+	_, err := global.Redis.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, workerId := range workerIds {
+			pipe.Set(ctx, jobWorkerAliveKey(workerId), time.Now().Unix(), jobWorkerTTL)
+			pipe.SAdd(ctx, jobWorkersKey, workerId)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Printf("刷新任务心跳失败: %v", err)
+	}
+}
+
+// requeueJobs 把处理中列表里的任务全部放回队列
+func requeueJobs(ctx context.Context, processingKey string) error {
+	for {
+		err := global.Redis.RPopLPush(ctx, processingKey, jobQueueKey).Err()
+		if err == redis.Nil {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// recoverJobs 把心跳已经过期的工作协程正在处理的任务放回队列，任务逐个原子地移动，多个进程同时回收也不会重复
+func recoverJobs(ctx context.Context) {
+	workerIds, err := global.Redis.SMembers(ctx, jobWorkersKey).Result()
+	if err != nil {
+		log.Printf("回收任务失败: %v", err)
+		return
+	}
+	for _, workerId := range workerIds {
+		alive, err := global.Redis.Exists(ctx, jobWorkerAliveKey(workerId)).Result()
+		if err != nil {
+			log.Printf("回收任务失败: %v", err)
+			return
+		}
+		if alive > 0 {
+			continue
+		}
+		if err := requeueJobs(ctx, jobProcessingKey(workerId)); err != nil {
+			log.Printf("回收任务失败: %v", err)
+			continue
+		}
+		global.Redis.SRem(ctx, jobWorkersKey, workerId)
+	}
+}
+
+func jobScheduler(ctx context.Context, workerIds []string) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	heartbeat := time.NewTicker(jobWorkerTTL / 3)
+	defer heartbeat.Stop()
+	recovery := time.NewTicker(jobWorkerTTL)
+	defer recovery.Stop()
+	for {
+		select {
+		case <-heartbeat.C:
+			heartbeatJobWorkers(ctx, workerIds)
+			continue
+		case <-recovery.C:
+			recoverJobs(ctx)
+			continue
+		case <-ticker.C:
+		}
+		now := strconv.FormatInt(time.Now().Unix(), 10)
+		ids, err := global.Redis.ZRangeByScore(ctx, jobDelayedKey, &redis.ZRangeBy{Min: "-inf", Max: now}).Result()
+		if err != nil {
+			log.Printf("任务调度失败: %v", err)
+			continue
+		}
+		for _, id := range ids {
+			// ZRem 成功才说明由当前协程负责把任务放回队列
+			if removed, err := global.Redis.ZRem(ctx, jobDelayedKey, id).Result(); err == nil && removed > 0 {
+				global.Redis.LPush(ctx, jobQueueKey, id)
+			}
+		}
+	}
+}
+
+func jobWorker(ctx context.Context, workerId string) {
+	processingKey := jobProcessingKey(workerId)
+	for {
+		id, err := global.Redis.BRPopLPush(ctx, jobQueueKey, processingKey, 5*time.Second).Result()
+		if err == redis.Nil {
+			continue
+		}
+		if err != nil {
+			log.Printf("读取任务队列失败: %v", err)
+			time.Sleep(time.Second)
+			continue
+		}
+		runJob(ctx, id)
+		global.Redis.LRem(ctx, processingKey, 1, id)
+	}
+}
+
+func runJob(ctx context.Context, id string) {
+	job, err := GetJob(ctx, id)
+	if err != nil {
+		log.Printf("读取任务 %s 失败: %v", id, err)
+		return
+	}
+	jobTypesMu.RLock()
+	t, ok := jobTypes[job.Type]
+	jobTypesMu.RUnlock()
+	if !ok {
+		job.Error = "未知的任务类型"
+		failJob(ctx, job)
+		return
+	}
+	payload, err := global.Redis.Get(ctx, jobPayloadKey(id)).Bytes()
+	if err != nil {
+		// 参数丢失后任务不可能再成功，和永久错误一样直接放入死信队列
+		job.Error = "任务参数已过期"
+		failJob(ctx, job)
+		return
+	}
+	job.Status = JobRunning
+	job.Attempts++
+	job.Error = ""
+	if err := SaveJob(ctx, job); err != nil {
+		log.Printf("保存任务 %s 失败: %v", id, err)
+		return
+	}
+	result, err := callJobHandler(ctx, t.handler, job, payload)
+	if err == nil {
+		job.Status = JobSucceeded
+		if result != nil {
+			if err := SetJobResult(ctx, job, result); err != nil {
+				log.Printf("保存任务 %s 结果失败: %v", id, err)
+			}
+		} else {
+			_ = SaveJob(ctx, job)
+		}
+		publishJobDone(ctx, job)
+		return
+	}
+	job.Error = err.Error()
+	if !IsPermanentJobError(err) && job.Attempts < job.MaxAttempts {
+		job.Status = JobPending
+		_ = SaveJob(ctx, job)
+		delay := t.options.Backoff << (job.Attempts - 1)
+		global.Redis.ZAdd(ctx, jobDelayedKey, &redis.Z{
+			Score:  float64(time.Now().Add(delay).Unix()),
+			Member: id,
+		})
+		return
+	}
+	failJob(ctx, job)
+}
+
+// failJob 把任务标记为失败并放入死信队列，然后通知任务创建者
+func failJob(ctx context.Context, job *Job) {
+	job.Status = JobFailed
+	_ = SaveJob(ctx, job)
+	global.Redis.Expire(ctx, jobKey(job.ID), deadJobExpiration)
+	global.Redis.Expire(ctx, jobPayloadKey(job.ID), deadJobExpiration)
+	global.Redis.LPush(ctx, jobDeadKey, job.ID)
+	global.Redis.LTrim(ctx, jobDeadKey, 0, maxDeadJobs-1)
+	publishJobDone(ctx, job)
+}
+
+// publishJobDone 通知任务创建者任务已经结束，推送的任务信息不包含结果
+func publishJobDone(ctx context.Context, job *Job) {
+	if job.UserId == 0 {
+		return
+	}
+	event := *job
+	event.Result = nil
+	if err := PublishToUser(ctx, job.UserId, PushJob, &event); err != nil {
+		log.Printf("推送任务 %s 状态失败: %v", job.ID, err)
+	}
+}
+
+func callJobHandler(ctx context.Context, handler JobHandler, job *Job, payload []byte) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("任务 %s 异常: %v", job.ID, r)
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return handler(ctx, job, payload)
+}
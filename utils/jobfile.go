@@ -0,0 +1,123 @@
+package utils
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/minio/minio-go/v6"
+	"io/ioutil"
+	"kayak-backend/global"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// JobFileStorage 保存后台任务的输入文件，任务负载中只保存文件的键，避免大文件写入 Redis
+type JobFileStorage interface {
+	Put(ctx context.Context, key string, data []byte) error
+	Get(ctx context.Context, key string) ([]byte, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var JobFiles JobFileStorage = &FileJobFileStorage{Dir: defaultJobFileDir}
+
+const defaultJobFileBucket = "jobs"
+
+var defaultJobFileDir = filepath.Join(os.TempDir(), "kayak-job-files")
+
+func InitJobFiles(provider string, bucket string, dir string) error {
+	switch provider {
+	case "file":
+		if dir == "" {
+			dir = defaultJobFileDir
+		}
+		JobFiles = &FileJobFileStorage{Dir: dir}
+	case "", "minio":
+		if global.MinioClient == nil {
+			return errors.New("minio client is not initialized")
+		}
+		if bucket == "" {
+			bucket = defaultJobFileBucket
+		}
+		exists, err := global.MinioClient.BucketExists(bucket)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			if err := global.MinioClient.MakeBucket(bucket, ""); err != nil {
+				return err
+			}
+		}
+		JobFiles = &MinioJobFileStorage{Bucket: bucket}
+	default:
+		return fmt.Errorf("unknown job file storage %q", provider)
+	}
+	return nil
+}
+
+// MinioJobFileStorage 把任务文件保存在 MinIO 的私有存储桶中
+type MinioJobFileStorage struct {
+	Bucket string
+}
+
+func (s *MinioJobFileStorage) Put(ctx context.Context, key string, data []byte) error {
+	_, err := global.MinioClient.PutObjectWithContext(ctx, s.Bucket, key, bytes.NewReader(data), int64(len(data)),
+		minio.PutObjectOptions{ContentType: "application/octet-stream"})
+	return err
+}
+
+func (s *MinioJobFileStorage) Get(ctx context.Context, key string) ([]byte, error) {
+	object, err := global.MinioClient.GetObjectWithContext(ctx, s.Bucket, key, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, err
+	}
+	defer object.Close()
+	return ioutil.ReadAll(object)
+}
+
+func (s *MinioJobFileStorage) Delete(_ context.Context, key string) error {
+	return global.MinioClient.RemoveObject(s.Bucket, key)
+}
+
+// FileJobFileStorage 把任务文件保存在本地目录中，只适用于单实例部署、本地开发和测试
+type FileJobFileStorage struct {
+	Dir string
+}
+
+func (s *FileJobFileStorage) path(key string) (string, error) {
+	if key == "" || strings.Contains(key, "..") || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("invalid job file key %q", key)
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+func (s *FileJobFileStorage) Put(_ context.Context, key string, data []byte) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(s.Dir, 0755); err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0644)
+}
+
+func (s *FileJobFileStorage) Get(_ context.Context, key string) ([]byte, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(path)
+}
+
+func (s *FileJobFileStorage) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,259 @@
+package utils
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/go-redis/redis/v8"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
+	ocr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/ocr/v20181119"
+	"kayak-backend/global"
+	"regexp"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// OCRLine 是OCR识别出的一行文字及其在页面上的位置
+type OCRLine struct {
+	Text   string `json:"text"`
+	X      int    `json:"x"`
+	Y      int    `json:"y"`
+	Width  int    `json:"width"`
+	Height int    `json:"height"`
+}
+
+// OCRProvider 是OCR服务的抽象，page 仅在 isPdf 为 true 时有效，从1开始
+type OCRProvider interface {
+	Name() string
+	Recognize(ctx context.Context, data []byte, isPdf bool, page int) ([]OCRLine, error)
+}
+
+var ErrOCRQuotaExceeded = errors.New("ocr daily quota exceeded")
+
+const ocrCacheExpiration = 30 * 24 * time.Hour
+
+var OCR OCRProvider = &LocalOCRProvider{}
+
+// OCRDailyQuota 每个用户每天可以发起的（未命中缓存的）OCR次数，0表示不限制
+var OCRDailyQuota = 0
+
+func InitOCR(provider string, dailyQuota int) error {
+	switch provider {
+	case "local":
+		OCR = &LocalOCRProvider{}
+	case "", "tencent":
+		OCR = &TencentOCRProvider{
+			SecretID:  global.TencentCloudSecretID,
+			SecretKey: global.TencentCloudSecretKey,
+			Region:    "ap-beijing",
+		}
+	default:
+		return fmt.Errorf("unknown ocr provider %q", provider)
+	}
+	OCRDailyQuota = dailyQuota
+	return nil
+}
+
+type TencentOCRProvider struct {
+	SecretID  string
+	SecretKey string
+	Region    string
+}
+
+func (p *TencentOCRProvider) Name() string {
+	return "tencent"
+}
+
+func (p *TencentOCRProvider) Recognize(_ context.Context, data []byte, isPdf bool, page int) ([]OCRLine, error) {
+	credential := common.NewCredential(p.SecretID, p.SecretKey)
+	cpf := profile.NewClientProfile()
+	cpf.HttpProfile.ReqMethod = "POST"
+	cpf.HttpProfile.Endpoint = "ocr.tencentcloudapi.com"
+	cpf.SignMethod = "TC3-HMAC-SHA256"
+	client, err := ocr.NewClient(credential, p.Region, cpf)
+	if err != nil {
+		return nil, err
+	}
+	request := ocr.NewGeneralAccurateOCRRequest()
+	request.ImageBase64 = common.StringPtr(base64.StdEncoding.EncodeToString(data))
+	request.EnableDetectSplit = common.BoolPtr(true)
+	request.IsPdf = common.BoolPtr(isPdf)
+	if isPdf {
+		request.PdfPageNumber = common.Uint64Ptr(uint64(page))
+	}
+	response, err := client.GeneralAccurateOCR(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.Response == nil {
+		return nil, errors.New("empty ocr response")
+	}
+	lines := make([]OCRLine, 0, len(response.Response.TextDetections))
+	for _, item := range response.Response.TextDetections {
+		if item.DetectedText == nil {
+			continue
+		}
+		line := OCRLine{Text: *item.DetectedText}
+		if c := item.ItemPolygon; c != nil && c.X != nil && c.Y != nil && c.Width != nil && c.Height != nil {
+			line.X, line.Y, line.Width, line.Height = int(*c.X), int(*c.Y), int(*c.Width), int(*c.Height)
+		}
+		lines = append(lines, line)
+	}
+	return lines, nil
+}
+
+// LocalOCRProvider 是不依赖外部服务的确定性实现，用于本地开发和测试：
+// 如果输入是UTF-8文本，则把每一行当作识别结果（PDF按 \f 分页），否则返回一行包含内容摘要的文字
+type LocalOCRProvider struct{}
+
+func (p *LocalOCRProvider) Name() string {
+	return "local"
+}
+
+func (p *LocalOCRProvider) Recognize(_ context.Context, data []byte, isPdf bool, page int) ([]OCRLine, error) {
+	const lineHeight = 20
+	if !utf8.Valid(data) {
+		sum := sha256.Sum256(data)
+		text := fmt.Sprintf("local-ocr %s", hex.EncodeToString(sum[:8]))
+		if isPdf {
+			text += fmt.Sprintf(" page %d", page)
+		}
+		return []OCRLine{{Text: text, Width: len(text) * lineHeight / 2, Height: lineHeight}}, nil
+	}
+	text := string(data)
+	if isPdf {
+		pages := strings.Split(text, "\f")
+		if page < 1 || page > len(pages) {
+			return nil, fmt.Errorf("page %d out of range", page)
+		}
+		text = pages[page-1]
+	}
+	lines := make([]OCRLine, 0)
+	for i, row := range strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n") {
+		indent := len(row) - len(strings.TrimLeft(row, " "))
+		row = strings.TrimSpace(row)
+		if row == "" {
+			continue
+		}
+		lines = append(lines, OCRLine{
+			Text:   row,
+			X:      indent * lineHeight / 2,
+			Y:      i * lineHeight * 3 / 2,
+			Width:  utf8.RuneCountInString(row) * lineHeight,
+			Height: lineHeight,
+		})
+	}
+	return lines, nil
+}
+
+// TencentOCRResponse 把文本行转换为腾讯云通用印刷体识别的返回结构，raw_result 接口保持原来的返回格式。
+// 结果来自缓存或其他 OCR 实现，只包含文字和坐标
+func TencentOCRResponse(lines []OCRLine) *ocr.GeneralAccurateOCRResponse {
+	detections := make([]*ocr.TextDetection, 0, len(lines))
+	for _, line := range lines {
+		x, y, width, height := int64(line.X), int64(line.Y), int64(line.Width), int64(line.Height)
+		detections = append(detections, &ocr.TextDetection{
+			DetectedText: common.StringPtr(line.Text),
+			Polygon: []*ocr.Coord{
+				{X: common.Int64Ptr(x), Y: common.Int64Ptr(y)},
+				{X: common.Int64Ptr(x + width), Y: common.Int64Ptr(y)},
+				{X: common.Int64Ptr(x + width), Y: common.Int64Ptr(y + height)},
+				{X: common.Int64Ptr(x), Y: common.Int64Ptr(y + height)},
+			},
+			ItemPolygon: &ocr.ItemCoord{
+				X:      common.Int64Ptr(x),
+				Y:      common.Int64Ptr(y),
+				Width:  common.Int64Ptr(width),
+				Height: common.Int64Ptr(height),
+			},
+		})
+	}
+	return &ocr.GeneralAccurateOCRResponse{
+		Response: &ocr.GeneralAccurateOCRResponseParams{
+			TextDetections: detections,
+			Angel:          common.Float64Ptr(0),
+		},
+	}
+}
+
+func ocrCacheKey(provider string, data []byte, isPdf bool, page int) string {
+	sum := sha256.Sum256(data)
+	if !isPdf {
+		page = 0
+	}
+	return fmt.Sprintf("ocr:cache:%s:%s:%d", provider, hex.EncodeToString(sum[:]), page)
+}
+
+func ocrQuotaKey(userId int) string {
+	return fmt.Sprintf("ocr:quota:%d:%s", userId, time.Now().Local().Format("20060102"))
+}
+
+// RecognizeWithCache 先按内容哈希查询缓存，未命中时消耗 userId 当天的配额并调用 OCR 服务，
+// 识别失败时退还配额。cached 表示结果是否来自缓存
+func RecognizeWithCache(ctx context.Context, userId int, data []byte, isPdf bool, page int) (lines []OCRLine, cached bool, err error) {
+	key := ocrCacheKey(OCR.Name(), data, isPdf, page)
+	if raw, err := global.Redis.Get(ctx, key).Bytes(); err == nil {
+		if err := json.Unmarshal(raw, &lines); err == nil {
+			return lines, true, nil
+		}
+	} else if err != redis.Nil {
+		return nil, false, err
+	}
+	if OCRDailyQuota > 0 {
+		quotaKey := ocrQuotaKey(userId)
+		// 赋值给具名返回值 err，下面退还配额的 defer 才能看到识别失败
+		var used int64
+		used, err = global.Redis.Incr(ctx, quotaKey).Result()
+		if err != nil {
+			return nil, false, err
+		}
+		if used == 1 {
+			global.Redis.Expire(ctx, quotaKey, 48*time.Hour)
+		}
+		if used > int64(OCRDailyQuota) {
+			global.Redis.Decr(ctx, quotaKey)
+			return nil, false, ErrOCRQuotaExceeded
+		}
+		defer func() {
+			if err != nil {
+				global.Redis.Decr(ctx, quotaKey)
+			}
+		}()
+	}
+	lines, err = OCR.Recognize(ctx, data, isPdf, page)
+	if err != nil {
+		return nil, false, err
+	}
+	if raw, err := json.Marshal(lines); err == nil {
+		global.Redis.Set(ctx, key, raw, ocrCacheExpiration)
+	}
+	return lines, false, nil
+}
+
+// OCRQuotaRemaining 返回 userId 当天剩余的OCR次数，不限制时返回 -1
+func OCRQuotaRemaining(ctx context.Context, userId int) (int, error) {
+	if OCRDailyQuota <= 0 {
+		return -1, nil
+	}
+	used, err := global.Redis.Get(ctx, ocrQuotaKey(userId)).Int()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if used >= OCRDailyQuota {
+		return 0, nil
+	}
+	return OCRDailyQuota - used, nil
+}
+
+var pdfPageObject = regexp.MustCompile(`/Type\s*/Page\b`)
+
+// PDFPageCount 通过统计页面对象估算PDF页数，页面对象被压缩在对象流中时返回0
+func PDFPageCount(data []byte) int {
+	return len(pdfPageObject.FindAllIndex(data, -1))
+}
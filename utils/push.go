@@ -0,0 +1,169 @@
+package utils
+
+import (
+	"context"
+	"encoding/json"
+	"kayak-backend/global"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	PushNotification     = "notification"
+	PushDiscussionReview = "discussion_review"
+	PushJob              = "job"
+)
+
+const (
+	pushUserChannelPrefix  = "push:user:"
+	pushGroupChannelPrefix = "push:group:"
+	pushTopicChannelPrefix = "push:topic:"
+	// 每个连接最多缓存的未发送事件，客户端读取过慢时丢弃新事件
+	pushBufferSize = 64
+)
+
+// PushEvent 是推送给客户端的实时事件，Data 的结构由 Type 决定
+type PushEvent struct {
+	Type      string          `json:"type"`
+	Data      json.RawMessage `json:"data"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// PushSubscriber 是一个实时连接在本进程中的订阅，Events 在取消订阅后关闭。
+// 订阅了主题的连接只接收该主题的事件
+type PushSubscriber struct {
+	UserId int
+	Events chan PushEvent
+	groups map[int]bool
+	topic  string
+}
+
+var (
+	pushSubscribers   = make(map[*PushSubscriber]bool)
+	pushSubscribersMu sync.RWMutex
+)
+
+func publishPush(ctx context.Context, channel string, eventType string, data interface{}) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	event, err := json.Marshal(&PushEvent{Type: eventType, Data: raw, CreatedAt: time.Now().Local()})
+	if err != nil {
+		return err
+	}
+	return global.Redis.Publish(ctx, channel, event).Err()
+}
+
+// PublishToUser 通过 Redis 向所有实例上 userId 的实时连接推送事件
+func PublishToUser(ctx context.Context, userId int, eventType string, data interface{}) error {
+	return publishPush(ctx, pushUserChannelPrefix+strconv.Itoa(userId), eventType, data)
+}
+
+// PublishToGroup 通过 Redis 向所有实例上属于 groupId 小组的实时连接推送事件
+func PublishToGroup(ctx context.Context, groupId int, eventType string, data interface{}) error {
+	return publishPush(ctx, pushGroupChannelPrefix+strconv.Itoa(groupId), eventType, data)
+}
+
+// PublishToTopic 通过 Redis 向所有实例上订阅了 topic 的实时连接推送事件
+func PublishToTopic(ctx context.Context, topic string, eventType string, data interface{}) error {
+	return publishPush(ctx, pushTopicChannelPrefix+topic, eventType, data)
+}
+
+// SubscribePush 为 userId 的一个实时连接注册订阅，groupIds 为用户所在的小组
+func SubscribePush(userId int, groupIds []int) *PushSubscriber {
+	subscriber := &PushSubscriber{
+		UserId: userId,
+		Events: make(chan PushEvent, pushBufferSize),
+	}
+	subscriber.SetGroups(groupIds)
+	addPushSubscriber(subscriber)
+	return subscriber
+}
+
+// SubscribePushTopic 为 userId 的一个实时连接注册对 topic 的订阅
+func SubscribePushTopic(userId int, topic string) *PushSubscriber {
+	subscriber := &PushSubscriber{
+		UserId: userId,
+		Events: make(chan PushEvent, pushBufferSize),
+		topic:  topic,
+	}
+	addPushSubscriber(subscriber)
+	return subscriber
+}
+
+func addPushSubscriber(subscriber *PushSubscriber) {
+	pushSubscribersMu.Lock()
+	defer pushSubscribersMu.Unlock()
+	pushSubscribers[subscriber] = true
+}
+
+// SetGroups 更新订阅的小组，用于用户加入或退出小组后刷新
+func (s *PushSubscriber) SetGroups(groupIds []int) {
+	groups := make(map[int]bool, len(groupIds))
+	for _, id := range groupIds {
+		groups[id] = true
+	}
+	pushSubscribersMu.Lock()
+	defer pushSubscribersMu.Unlock()
+	s.groups = groups
+}
+
+func UnsubscribePush(subscriber *PushSubscriber) {
+	pushSubscribersMu.Lock()
+	defer pushSubscribersMu.Unlock()
+	if pushSubscribers[subscriber] {
+		delete(pushSubscribers, subscriber)
+		close(subscriber.Events)
+	}
+}
+
+// StartPushHub 订阅 Redis 上的推送频道并分发给本进程的实时连接，每个进程只需要启动一次
+func StartPushHub() {
+	ctx := context.Background()
+	pubsub := global.Redis.PSubscribe(ctx, pushUserChannelPrefix+"*", pushGroupChannelPrefix+"*",
+		pushTopicChannelPrefix+"*")
+	go func() {
+		for message := range pubsub.Channel() {
+			var event PushEvent
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				log.Printf("解析推送事件失败: %v", err)
+				continue
+			}
+			dispatchPush(message.Channel, event)
+		}
+	}()
+}
+
+func dispatchPush(channel string, event PushEvent) {
+	var userId, groupId int
+	var topic string
+	var err error
+	switch {
+	case strings.HasPrefix(channel, pushUserChannelPrefix):
+		userId, err = strconv.Atoi(strings.TrimPrefix(channel, pushUserChannelPrefix))
+	case strings.HasPrefix(channel, pushGroupChannelPrefix):
+		groupId, err = strconv.Atoi(strings.TrimPrefix(channel, pushGroupChannelPrefix))
+	default:
+		topic = strings.TrimPrefix(channel, pushTopicChannelPrefix)
+	}
+	if err != nil || userId == 0 && groupId == 0 && topic == "" {
+		return
+	}
+	pushSubscribersMu.RLock()
+	defer pushSubscribersMu.RUnlock()
+	for subscriber := range pushSubscribers {
+		if subscriber.topic != topic || userId != 0 && subscriber.UserId != userId ||
+			groupId != 0 && !subscriber.groups[groupId] {
+			continue
+		}
+		select {
+		case subscriber.Events <- event:
+		default:
+			log.Printf("用户 %d 的推送缓冲区已满，丢弃事件 %s", subscriber.UserId, event.Type)
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package utils
+
+import (
+	"github.com/skip2/go-qrcode"
+)
+
+// EncodeQRCode 将 content 以 M 级纠错编码为二维码并渲染为 PNG，scale 为每个模块的像素数
+func EncodeQRCode(content string, scale int) ([]byte, error) {
+	if scale <= 0 {
+		scale = 8
+	}
+	qr, err := qrcode.New(content, qrcode.Medium)
+	if err != nil {
+		return nil, err
+	}
+	// 尺寸为负数时按每个模块 -size 个像素渲染
+	return qr.PNG(-scale)
+}
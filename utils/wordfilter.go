@@ -0,0 +1,198 @@
+package utils
+
+import (
+	"context"
+	"kayak-backend/global"
+	"log"
+	"sync"
+	"unicode"
+)
+
+const (
+	// WordActionBlock 包含该词的内容不能提交
+	WordActionBlock = "block"
+	// WordActionMask 该词被替换为同样长度的 *
+	WordActionMask = "mask"
+	// WordActionReview 内容可以提交，但需要管理员审核
+	WordActionReview = "review"
+)
+
+// 敏感词表修改后在这个频道上通知所有实例重新加载
+const sensitiveWordsChannel = "sensitive_words:reload"
+
+type SensitiveWord struct {
+	Word   string `db:"word"`
+	Action string `db:"action"`
+}
+
+type WordFilterResult struct {
+	// Text 是处理过 mask 词之后的文本
+	Text       string
+	Blocked    bool
+	NeedReview bool
+	// Matches 是命中的敏感词，每个词只出现一次
+	Matches []string
+}
+
+type acNode struct {
+	next map[rune]int
+	fail int
+	// 以该节点结尾的敏感词下标，包括沿失败指针可以到达的词
+	output []int
+}
+
+// wordMatcher 是敏感词的 Aho-Corasick 自动机，构建后只读，可以并发使用
+type wordMatcher struct {
+	nodes []acNode
+	words []SensitiveWord
+	// 每个词的长度（字符数），用于从结束位置算出开始位置
+	lengths []int
+}
+
+var (
+	matcherLock sync.RWMutex
+	matcher     = newWordMatcher(nil)
+)
+
+func normalizeRune(r rune) rune {
+	return unicode.ToLower(r)
+}
+
+func newWordMatcher(words []SensitiveWord) *wordMatcher {
+	m := &wordMatcher{nodes: []acNode{{next: make(map[rune]int)}}}
+	for _, word := range words {
+		runes := []rune(word.Word)
+		if len(runes) == 0 {
+			continue
+		}
+		cur := 0
+		for _, r := range runes {
+			r = normalizeRune(r)
+			nxt, ok := m.nodes[cur].next[r]
+			if !ok {
+				m.nodes = append(m.nodes, acNode{next: make(map[rune]int)})
+				nxt = len(m.nodes) - 1
+				m.nodes[cur].next[r] = nxt
+			}
+			cur = nxt
+		}
+		m.nodes[cur].output = append(m.nodes[cur].output, len(m.words))
+		m.words = append(m.words, word)
+		m.lengths = append(m.lengths, len(runes))
+	}
+	// 按层次遍历计算失败指针
+	queue := make([]int, 0, len(m.nodes))
+	for _, child := range m.nodes[0].next {
+		queue = append(queue, child)
+	}
+	for len(queue) > 0 {
+		cur := queue[0]
+		queue = queue[1:]
+		for r, child := range m.nodes[cur].next {
+			fail := m.nodes[cur].fail
+			for fail != 0 {
+				if _, ok := m.nodes[fail].next[r]; ok {
+					break
+				}
+				fail = m.nodes[fail].fail
+			}
+			if target, ok := m.nodes[fail].next[r]; ok && target != child {
+				m.nodes[child].fail = target
+			}
+			m.nodes[child].output = append(m.nodes[child].output, m.nodes[m.nodes[child].fail].output...)
+			queue = append(queue, child)
+		}
+	}
+	return m
+}
+
+func (m *wordMatcher) filter(text string) WordFilterResult {
+	runes := []rune(text)
+	masked := make([]bool, len(runes))
+	seen := make(map[int]bool)
+	result := WordFilterResult{Matches: make([]string, 0)}
+	cur := 0
+	for i, r := range runes {
+		r = normalizeRune(r)
+		for cur != 0 {
+			if _, ok := m.nodes[cur].next[r]; ok {
+				break
+			}
+			cur = m.nodes[cur].fail
+		}
+		if nxt, ok := m.nodes[cur].next[r]; ok {
+			cur = nxt
+		}
+		for _, index := range m.nodes[cur].output {
+			word := m.words[index]
+			switch word.Action {
+			case WordActionBlock:
+				result.Blocked = true
+			case WordActionReview:
+				result.NeedReview = true
+			default:
+				for j := i - m.lengths[index] + 1; j <= i; j++ {
+					masked[j] = true
+				}
+			}
+			if !seen[index] {
+				seen[index] = true
+				result.Matches = append(result.Matches, word.Word)
+			}
+		}
+	}
+	for i := range runes {
+		if masked[i] {
+			runes[i] = '*'
+		}
+	}
+	result.Text = string(runes)
+	return result
+}
+
+// SetSensitiveWords 用给定的词表重建敏感词自动机，正在进行的过滤不受影响
+func SetSensitiveWords(words []SensitiveWord) {
+	m := newWordMatcher(words)
+	matcherLock.Lock()
+	matcher = m
+	matcherLock.Unlock()
+}
+
+// LoadSensitiveWords 从数据库重新加载敏感词表
+func LoadSensitiveWords() error {
+	var words []SensitiveWord
+	sqlString := `SELECT word, action FROM sensitive_word`
+	if err := global.Database.Select(&words, sqlString); err != nil {
+		return err
+	}
+	SetSensitiveWords(words)
+	return nil
+}
+
+// SyncSensitiveWords 重新加载本进程的敏感词表，并通知其他实例重新加载
+func SyncSensitiveWords(ctx context.Context) error {
+	if err := LoadSensitiveWords(); err != nil {
+		return err
+	}
+	return global.Redis.Publish(ctx, sensitiveWordsChannel, "").Err()
+}
+
+// StartSensitiveWordSync 订阅敏感词表的修改通知，收到后从数据库重新加载，每个进程只需要启动一次
+func StartSensitiveWordSync() {
+	pubsub := global.Redis.Subscribe(context.Background(), sensitiveWordsChannel)
+	go func() {
+		for range pubsub.Channel() {
+			if err := LoadSensitiveWords(); err != nil {
+				log.Printf("加载敏感词表失败: %v", err)
+			}
+		}
+	}()
+}
+
+// FilterText 检查文本中的敏感词（不区分大小写），返回处理后的文本和需要采取的措施
+func FilterText(text string) WordFilterResult {
+	matcherLock.RLock()
+	m := matcher
+	matcherLock.RUnlock()
+	return m.filter(text)
+}